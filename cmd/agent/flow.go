@@ -20,7 +20,9 @@ func runFlow() {
 	cmd.SetVersionTemplate("{{ .Version }}\n")
 
 	cmd.AddCommand(
+		convertCommand(),
 		fmtCommand(),
+		lspCommand(),
 		runCommand(),
 	)
 
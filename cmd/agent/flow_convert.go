@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/grafana/agent/converter"
+	convert_diag "github.com/grafana/agent/converter/diag"
+)
+
+func convertCommand() *cobra.Command {
+	f := &flowConvert{
+		output:       "",
+		from:         "",
+		bypassErrors: false,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "convert [flags] file",
+		Short: "Convert a supported config file to River",
+		Long: `The convert subcommand translates a supported config file to
+a River configuration file.
+
+If the file argument is not supplied or if the file argument is "-", then
+convert will read from stdin.
+
+The -o flag can be used to write the converted file to disk. When -o
+is not provided, convert will write the result to stdout.
+
+The -f flag specifies the format of the file being converted, such as
+"static" for Grafana Agent static mode configs.
+
+The -b flag can be used to bypass errors. Errors are defined as
+non-critical issues identified during the conversion where an
+output can still be generated.`,
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			var err error
+
+			if len(args) == 0 {
+				// Read from stdin when there are no args provided.
+				err = f.Run("-")
+			} else {
+				err = f.Run(args[0])
+			}
+
+			var diags convert_diag.Diagnostics
+			if errors.As(err, &diags) {
+				for _, diag := range diags {
+					fmt.Fprintln(os.Stderr, diag)
+				}
+				return fmt.Errorf("encountered errors during conversion")
+			}
+
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&f.output, "output", "o", f.output, "The filepath and filename where the output is written.")
+	cmd.Flags().StringVarP(&f.from, "from", "f", f.from, fmt.Sprintf("The format of the file to convert. Supported formats: %s.", strings.Join(converter.SupportedFormats, ", ")))
+	cmd.Flags().BoolVarP(&f.bypassErrors, "bypass-errors", "b", f.bypassErrors, "Write the converted config even if some parts of it couldn't be converted.")
+	return cmd
+}
+
+type flowConvert struct {
+	output       string
+	from         string
+	bypassErrors bool
+}
+
+func (fc *flowConvert) Run(configFile string) error {
+	if fc.from == "" {
+		return fmt.Errorf("--from is a required flag")
+	}
+
+	if configFile == "-" {
+		return convert(os.Stdin, fc)
+	}
+
+	fi, err := os.Stat(configFile)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("cannot convert a directory")
+	}
+
+	f, err := os.Open(configFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return convert(f, fc)
+}
+
+func convert(r io.Reader, fc *flowConvert) error {
+	inputBytes, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	riverBytes, diags := converter.Convert(inputBytes, converter.Input(fc.from))
+
+	// Warnings and informational diagnostics never stop the conversion, so
+	// they're always printed.
+	for _, diag := range diags {
+		if diag.Severity < convert_diag.SeverityLevelError {
+			fmt.Fprintln(os.Stderr, diag)
+		}
+	}
+
+	hasError := diags.HasSeverity(convert_diag.SeverityLevelError)
+	hasCritical := diags.HasSeverity(convert_diag.SeverityLevelCritical)
+	if hasCritical || (hasError && !fc.bypassErrors) {
+		return filterDiags(diags, convert_diag.SeverityLevelError)
+	} else if hasError {
+		for _, diag := range filterDiags(diags, convert_diag.SeverityLevelError) {
+			fmt.Fprintln(os.Stderr, diag)
+		}
+	}
+
+	if fc.output == "" {
+		_, err := os.Stdout.Write(riverBytes)
+		return err
+	}
+
+	wf, err := os.Create(fc.output)
+	if err != nil {
+		return err
+	}
+	defer wf.Close()
+
+	_, err = wf.Write(riverBytes)
+	return err
+}
+
+// filterDiags returns the diagnostics in diags with a severity of at least
+// severity.
+func filterDiags(diags convert_diag.Diagnostics, severity convert_diag.Severity) convert_diag.Diagnostics {
+	var res convert_diag.Diagnostics
+	for _, diag := range diags {
+		if diag.Severity >= severity {
+			res = append(res, diag)
+		}
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+
+	"github.com/prometheus/common/version"
+	"github.com/spf13/cobra"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/tracing"
+	"github.com/grafana/agent/pkg/river/lsp"
+
+	// Install Components
+	_ "github.com/grafana/agent/component/all"
+)
+
+func lspCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lsp",
+		Short: "Run a language server for River files",
+		Long: `The lsp subcommand runs a Language Server Protocol server for River
+configuration files, communicating with the editor over stdin and stdout.
+
+The server reports syntax errors and unknown components or arguments, and
+provides hover documentation, completion, go-to-definition for component
+references, and formatting.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, _ []string) error {
+			srv := lsp.New(lsp.Options{
+				Components: lspComponents(),
+				Version:    version.Version,
+			})
+			return srv.Serve(os.Stdin, os.Stdout)
+		},
+	}
+	return cmd
+}
+
+// lspComponents returns the set of blocks which may be declared in a Flow
+// config file, including the non-component logging and tracing blocks.
+func lspComponents() []lsp.Component {
+	components := []lsp.Component{
+		{Name: "logging", Singleton: true, Arguments: logging.Options{}},
+		{Name: "tracing", Singleton: true, Arguments: tracing.Options{}},
+	}
+
+	for _, name := range component.AllNames() {
+		reg, ok := component.Get(name)
+		if !ok {
+			continue
+		}
+		components = append(components, lsp.Component{
+			Name:      reg.Name,
+			Singleton: reg.Singleton,
+			Arguments: reg.Args,
+			Exports:   reg.Exports,
+		})
+	}
+	return components
+}
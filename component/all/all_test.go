@@ -0,0 +1,123 @@
+package all
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/rivertypes"
+	"github.com/grafana/agent/pkg/river/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// sentinel is the value stored in every secret when checking that secrets
+// aren't exposed.
+const sentinel = "sentinel-secret-value"
+
+// TestSecretsNeverExposed ensures that the JSON representation of the
+// Arguments and Exports of every registered component, which is used by the
+// UI, never reveals the contents of a secret.
+func TestSecretsNeverExposed(t *testing.T) {
+	for _, name := range component.AllNames() {
+		reg, _ := component.Get(name)
+
+		t.Run(name, func(t *testing.T) {
+			args := reg.CloneArguments()
+			fillSecrets(reflect.ValueOf(args), 0)
+
+			bb, err := encoding.ConvertRiverBodyToJSON(args)
+			require.NoError(t, err)
+			require.NotContains(t, string(bb), sentinel, "arguments exposed a secret")
+
+			if reg.Exports == nil {
+				return
+			}
+
+			exports := reflect.New(reflect.TypeOf(reg.Exports)).Interface()
+			fillSecrets(reflect.ValueOf(exports), 0)
+
+			bb, err = encoding.ConvertRiverBodyToJSON(exports)
+			require.NoError(t, err)
+			require.NotContains(t, string(bb), sentinel, "exports exposed a secret")
+		})
+	}
+}
+
+var (
+	secretType         = reflect.TypeOf(rivertypes.Secret(""))
+	optionalSecretType = reflect.TypeOf(rivertypes.OptionalSecret{})
+)
+
+// fillSecrets recursively sets every secret reachable from rv to sentinel.
+// Nil pointers and empty slices of structs are populated so that optional
+// blocks holding secrets are checked too.
+func fillSecrets(rv reflect.Value, depth int) {
+	// Guard against recursive types.
+	if depth > 10 {
+		return
+	}
+
+	switch rv.Type() {
+	case secretType:
+		if rv.CanSet() {
+			rv.Set(reflect.ValueOf(rivertypes.Secret(sentinel)))
+		}
+		return
+	case optionalSecretType:
+		if rv.CanSet() {
+			rv.Set(reflect.ValueOf(rivertypes.OptionalSecret{IsSecret: true, Value: sentinel}))
+		}
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			if !rv.CanSet() || !containsSecret(rv.Type().Elem(), 0) {
+				return
+			}
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		fillSecrets(rv.Elem(), depth+1)
+
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if !rv.Type().Field(i).IsExported() {
+				continue
+			}
+			fillSecrets(rv.Field(i), depth+1)
+		}
+
+	case reflect.Slice:
+		if rv.Len() == 0 && rv.CanSet() && containsSecret(rv.Type().Elem(), 0) {
+			rv.Set(reflect.MakeSlice(rv.Type(), 1, 1))
+		}
+		for i := 0; i < rv.Len(); i++ {
+			fillSecrets(rv.Index(i), depth+1)
+		}
+	}
+}
+
+// containsSecret reports whether values of type ty can hold a secret.
+func containsSecret(ty reflect.Type, depth int) bool {
+	if depth > 10 {
+		return false
+	}
+
+	switch ty {
+	case secretType, optionalSecretType:
+		return true
+	}
+
+	switch ty.Kind() {
+	case reflect.Pointer, reflect.Slice:
+		return containsSecret(ty.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < ty.NumField(); i++ {
+			if ty.Field(i).IsExported() && containsSecret(ty.Field(i).Type, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -51,7 +51,9 @@ type positions struct {
 	logger    log.Logger
 	cfg       Config
 	mtx       sync.Mutex
+	saveMtx   sync.Mutex // Serializes the writes of the positions file.
 	positions map[Entry]string
+	fileIDs   map[Entry]FileID
 	quit      chan struct{}
 	done      chan struct{}
 }
@@ -68,9 +70,18 @@ type Entry struct {
 	Labels string `yaml:"labels"`
 }
 
+// FileID identifies a file independently of its path, using its device and
+// inode numbers. It allows following a file across renames, and telling
+// apart the different files which were found at the same path.
+type FileID struct {
+	Device uint64 `yaml:"device"`
+	Inode  uint64 `yaml:"inode"`
+}
+
 // File format for the positions data.
 type File struct {
 	Positions map[Entry]string `yaml:"positions"`
+	FileIDs   map[Entry]FileID `yaml:"file_ids,omitempty"`
 }
 
 type Positions interface {
@@ -88,10 +99,22 @@ type Positions interface {
 	PutString(path, labels string, pos string)
 	// Put records (asynchronously) how far we've read through a file.
 	Put(path, labels string, pos int64)
+	// GetFileID returns the identity of the file whose position is tracked
+	// for path and labels, if it was recorded.
+	GetFileID(path, labels string) (FileID, bool)
+	// PutFileID records the identity of the file whose position is tracked
+	// for path and labels.
+	PutFileID(path, labels string, id FileID)
+	// FindFileID returns the path of the entry with the given labels which
+	// tracks the file with the given identity, if any.
+	FindFileID(labels string, id FileID) (string, bool)
 	// Remove removes the position tracking for a filepath
 	Remove(path, labels string)
 	// SyncPeriod returns how often the positions file gets resynced
 	SyncPeriod() time.Duration
+	// Sync writes the positions file right away, instead of waiting for the
+	// next sync.
+	Sync()
 	// Stop the Position tracker.
 	Stop()
 }
@@ -106,7 +129,8 @@ func New(logger log.Logger, cfg Config) (Positions, error) {
 	p := &positions{
 		logger:    logger,
 		cfg:       cfg,
-		positions: positionData,
+		positions: positionData.Positions,
+		fileIDs:   positionData.FileIDs,
 		quit:      make(chan struct{}),
 		done:      make(chan struct{}),
 	}
@@ -146,6 +170,30 @@ func (p *positions) Get(path, labels string) (int64, error) {
 	return strconv.ParseInt(pos, 10, 64)
 }
 
+func (p *positions) GetFileID(path, labels string) (FileID, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	id, ok := p.fileIDs[Entry{path, labels}]
+	return id, ok
+}
+
+func (p *positions) PutFileID(path, labels string, id FileID) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.fileIDs[Entry{path, labels}] = id
+}
+
+func (p *positions) FindFileID(labels string, id FileID) (string, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for e, fileID := range p.fileIDs {
+		if e.Labels == labels && fileID == id {
+			return e.Path, true
+		}
+	}
+	return "", false
+}
+
 func (p *positions) Remove(path, labels string) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
@@ -154,12 +202,17 @@ func (p *positions) Remove(path, labels string) {
 
 func (p *positions) remove(path, labels string) {
 	delete(p.positions, Entry{path, labels})
+	delete(p.fileIDs, Entry{path, labels})
 }
 
 func (p *positions) SyncPeriod() time.Duration {
 	return p.cfg.SyncPeriod
 }
 
+func (p *positions) Sync() {
+	p.save()
+}
+
 func (p *positions) run() {
 	defer func() {
 		p.save()
@@ -183,14 +236,21 @@ func (p *positions) save() {
 	if p.cfg.ReadOnly {
 		return
 	}
+	p.saveMtx.Lock()
+	defer p.saveMtx.Unlock()
+
 	p.mtx.Lock()
 	positions := make(map[Entry]string, len(p.positions))
 	for k, v := range p.positions {
 		positions[k] = v
 	}
+	fileIDs := make(map[Entry]FileID, len(p.fileIDs))
+	for k, v := range p.fileIDs {
+		fileIDs[k] = v
+	}
 	p.mtx.Unlock()
 
-	if err := writePositionFile(p.cfg.PositionsFile, positions); err != nil {
+	if err := writePositionFile(p.cfg.PositionsFile, File{Positions: positions, FileIDs: fileIDs}); err != nil {
 		level.Error(p.logger).Log("msg", "error writing positions file", "error", err)
 	}
 }
@@ -228,14 +288,19 @@ func (p *positions) cleanup() {
 	}
 }
 
-func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error) {
+func readPositionsFile(cfg Config, logger log.Logger) (File, error) {
+	empty := File{
+		Positions: map[Entry]string{},
+		FileIDs:   map[Entry]FileID{},
+	}
+
 	cleanfn := filepath.Clean(cfg.PositionsFile)
 	buf, err := os.ReadFile(cleanfn)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
-		return nil, err
+		return File{}, err
 	}
 
 	var p File
@@ -244,16 +309,20 @@ func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error)
 		// return empty if cfg option enabled
 		if cfg.IgnoreInvalidYaml {
 			level.Debug(logger).Log("msg", "ignoring invalid positions file", "file", cleanfn, "error", err)
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
 
-		return nil, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
+		return File{}, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
 	}
 
-	// p.Positions will be nil if the file exists but is empty
+	// p.Positions will be nil if the file exists but is empty, and
+	// p.FileIDs if it was written by a version which didn't record them.
 	if p.Positions == nil {
 		p.Positions = map[Entry]string{}
 	}
+	if p.FileIDs == nil {
+		p.FileIDs = map[Entry]FileID{}
+	}
 
-	return p.Positions, nil
+	return p, nil
 }
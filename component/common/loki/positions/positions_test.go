@@ -59,7 +59,7 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, "17623", pos[Entry{
+	require.Equal(t, "17623", pos.Positions[Entry{
 		Path:   "/tmp/random.log",
 		Labels: `{job="tmp"}`,
 	}])
@@ -82,7 +82,7 @@ func TestReadPositionsEmptyFile(t *testing.T) {
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.NotNil(t, pos)
+	require.NotNil(t, pos.Positions)
 }
 
 func TestReadPositionsFromDir(t *testing.T) {
@@ -152,7 +152,7 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, map[Entry]string{}, out)
+	require.Equal(t, map[Entry]string{}, out.Positions)
 }
 
 func Test_ReadOnly(t *testing.T) {
@@ -196,7 +196,7 @@ positions:
 	require.NoError(t, err)
 	require.Equal(t, map[Entry]string{
 		{Path: "/tmp/random.log", Labels: `{job="tmp"}`}: "17623",
-	}, out)
+	}, out.Positions)
 }
 
 func TestWriteEmptyLabels(t *testing.T) {
@@ -245,7 +245,7 @@ positions:
 		{Path: "/tmp/bar/nolabels.log", Labels: ""}:       "10060",
 		{Path: "/tmp/foo/emptylabels.log", Labels: `{}`}:  "10050",
 		{Path: "/tmp/foo/nolabels.log", Labels: ""}:       "10040",
-	}, out)
+	}, out.Positions)
 }
 
 func TestReadEmptyLabels(t *testing.T) {
@@ -275,16 +275,79 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, "10020", pos[Entry{
+	require.Equal(t, "10020", pos.Positions[Entry{
 		Path:   "/tmp/nolabels.log",
 		Labels: ``,
 	}])
-	require.Equal(t, "10030", pos[Entry{
+	require.Equal(t, "10030", pos.Positions[Entry{
 		Path:   "/tmp/emptylabels.log",
 		Labels: `{}`,
 	}])
-	require.Equal(t, "10040", pos[Entry{
+	require.Equal(t, "10040", pos.Positions[Entry{
 		Path:   "/tmp/missinglabels.log",
 		Labels: ``,
 	}])
 }
+
+func TestFileIDs(t *testing.T) {
+	temp := tempFilename(t)
+	defer func() {
+		_ = os.Remove(temp)
+	}()
+
+	p, err := New(util_log.Logger, Config{
+		SyncPeriod:    time.Minute,
+		PositionsFile: temp,
+	})
+	require.NoError(t, err)
+
+	id := FileID{Device: 66306, Inode: 1234}
+	p.Put("/tmp/app.log", `{job="app"}`, 42)
+	p.PutFileID("/tmp/app.log", `{job="app"}`, id)
+
+	path, ok := p.FindFileID(`{job="app"}`, id)
+	require.True(t, ok)
+	require.Equal(t, "/tmp/app.log", path)
+	_, ok = p.FindFileID(`{job="other"}`, id)
+	require.False(t, ok)
+
+	// File IDs are saved along with the positions.
+	p.Stop()
+	out, err := readPositionsFile(Config{PositionsFile: temp}, log.NewNopLogger())
+	require.NoError(t, err)
+	require.Equal(t, map[Entry]FileID{{Path: "/tmp/app.log", Labels: `{job="app"}`}: id}, out.FileIDs)
+
+	// Removing a position also removes its file ID.
+	p, err = New(util_log.Logger, Config{
+		SyncPeriod:    time.Minute,
+		PositionsFile: temp,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+	p.Remove("/tmp/app.log", `{job="app"}`)
+	_, ok = p.GetFileID("/tmp/app.log", `{job="app"}`)
+	require.False(t, ok)
+}
+
+func TestSync(t *testing.T) {
+	temp := tempFilename(t)
+	defer func() {
+		_ = os.Remove(temp)
+	}()
+
+	p, err := New(util_log.Logger, Config{
+		SyncPeriod:    time.Hour,
+		PositionsFile: temp,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	// The position is written right away, without waiting for the sync
+	// period or for the positions to be stopped.
+	p.Put("/tmp/app.log", `{job="app"}`, 42)
+	p.Sync()
+
+	out, err := readPositionsFile(Config{PositionsFile: temp}, log.NewNopLogger())
+	require.NoError(t, err)
+	require.Equal(t, "42", out.Positions[Entry{Path: "/tmp/app.log", Labels: `{job="app"}`}])
+}
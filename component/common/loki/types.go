@@ -13,6 +13,11 @@ import (
 	"github.com/grafana/loki/pkg/logproto"
 )
 
+// ReservedLabelTenantID is the label which overrides the tenant ID of a log
+// entry when it's written to Loki. It can be set while processing pipeline
+// stages.
+const ReservedLabelTenantID = "__tenant_id__"
+
 // LogsReceiver is an alias for chan Entry which will be used for component
 // communication
 type LogsReceiver chan Entry
@@ -3,6 +3,7 @@ package relabel
 import (
 	"fmt"
 
+	"github.com/grafana/agent/pkg/river/diag"
 	"github.com/grafana/regexp"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/relabel"
@@ -129,22 +130,22 @@ func (rc *Config) UnmarshalRiver(f func(interface{}) error) error {
 		return fmt.Errorf("relabel action cannot be empty")
 	}
 	if rc.Modulus == 0 && rc.Action == HashMod {
-		return fmt.Errorf("relabel configuration for hashmod requires non-zero modulus")
+		return diag.AttributeErrorf("modulus", "must be non-zero for the hashmod action")
 	}
 	if (rc.Action == Replace || rc.Action == HashMod || rc.Action == Lowercase || rc.Action == Uppercase) && rc.TargetLabel == "" {
-		return fmt.Errorf("relabel configuration for %s action requires 'target_label' value", rc.Action)
+		return diag.AttributeErrorf("target_label", "must be set for the %s action", rc.Action)
 	}
 	if (rc.Action == Replace || rc.Action == Lowercase || rc.Action == Uppercase) && !relabelTarget.MatchString(rc.TargetLabel) {
-		return fmt.Errorf("%q is invalid 'target_label' for %s action", rc.TargetLabel, rc.Action)
+		return diag.AttributeErrorf("target_label", "value %q is invalid for the %s action", rc.TargetLabel, rc.Action)
 	}
 	if (rc.Action == Lowercase || rc.Action == Uppercase) && rc.Replacement != DefaultRelabelConfig.Replacement {
-		return fmt.Errorf("'replacement' can not be set for %s action", rc.Action)
+		return diag.AttributeErrorf("replacement", "can not be set for the %s action", rc.Action)
 	}
 	if rc.Action == LabelMap && !relabelTarget.MatchString(rc.Replacement) {
-		return fmt.Errorf("%q is invalid 'replacement' for %s action", rc.Replacement, rc.Action)
+		return diag.AttributeErrorf("replacement", "value %q is invalid for the %s action", rc.Replacement, rc.Action)
 	}
 	if rc.Action == HashMod && !model.LabelName(rc.TargetLabel).IsValid() {
-		return fmt.Errorf("%q is invalid 'target_label' for %s action", rc.TargetLabel, rc.Action)
+		return diag.AttributeErrorf("target_label", "value %q is invalid for the %s action", rc.TargetLabel, rc.Action)
 	}
 
 	if rc.Action == LabelDrop || rc.Action == LabelKeep {
@@ -161,6 +162,14 @@ func (rc *Config) UnmarshalRiver(f func(interface{}) error) error {
 	return nil
 }
 
+// Rules is a list of relabeling rules which can be exported by a component
+// and passed along to other components.
+type Rules []*Config
+
+// RiverCapsule marks Rules as a capsule so that the rules are passed around
+// as-is rather than being converted back and forth to River values.
+func (r Rules) RiverCapsule() {}
+
 // ComponentToPromRelabelConfigs bridges the Compnoent-based configuration of
 // relabeling steps to the Prometheus implementation.
 func ComponentToPromRelabelConfigs(rcs []*Config) []*relabel.Config {
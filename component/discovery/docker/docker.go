@@ -10,6 +10,7 @@ import (
 	"github.com/grafana/agent/component/common/config"
 	"github.com/grafana/agent/component/discovery"
 	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/diag"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/moby"
 )
@@ -28,10 +29,10 @@ func init() {
 
 // Arguments configures the discovery.docker component.
 type Arguments struct {
-	Host               string                  `river:"host,attr"`
+	Host               string                  `river:"host,attr" validate:"nonempty"`
 	Port               int                     `river:"port,attr,optional"`
 	HostNetworkingHost string                  `river:"host_networking_host,attr,optional"`
-	RefreshInterval    time.Duration           `river:"refresh_interval,attr,optional"`
+	RefreshInterval    time.Duration           `river:"refresh_interval,attr,optional" validate:"gt=0s"`
 	Filters            []Filter                `river:"filter,block,optional"`
 	HTTPClientConfig   config.HTTPClientConfig `river:"http_client_config,block,optional"`
 }
@@ -71,14 +72,8 @@ func (args *Arguments) UnmarshalRiver(f func(interface{}) error) error {
 		return err
 	}
 
-	if args.Host == "" {
-		return fmt.Errorf("host attribute must not be empty")
-	} else if _, err := url.Parse(args.Host); err != nil {
-		return fmt.Errorf("parsing host attribute: %w", err)
-	}
-
-	if args.RefreshInterval <= 0 {
-		return fmt.Errorf("refresh_interval must be greater than 0")
+	if _, err := url.Parse(args.Host); err != nil {
+		return diag.AttributeError{Name: "host", Err: fmt.Errorf("must be a valid URL: %w", err)}
 	}
 
 	return args.HTTPClientConfig.Validate()
@@ -0,0 +1,121 @@
+package metric
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/metric.
+// The configuration blocks have been adapted to be decoded from River.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Counter actions.
+const (
+	CounterInc = "inc"
+	CounterAdd = "add"
+)
+
+// Configuration errors.
+const (
+	ErrCounterActionRequired          = "counter action must be defined as either `inc` or `add`"
+	ErrCounterInvalidAction           = "action %s is not valid, action must be either `inc` or `add`"
+	ErrCounterInvalidMatchAll         = "`match_all: true` cannot be combined with `value`, please remove `match_all` or `value`"
+	ErrCounterInvalidCountBytes       = "`count_entry_bytes: true` can only be set with `match_all: true`"
+	ErrCounterInvalidCountBytesAction = "`count_entry_bytes: true` can only be used with `action: add`"
+)
+
+// CounterConfig defines a counter metric whose value only goes up.
+type CounterConfig struct {
+	// When adding fields here, make sure to update the stage that uses this
+	// config, as the common fields are defaulted and validated there.
+	Name        string        `river:"name,attr"`
+	Description string        `river:"description,attr,optional"`
+	Source      string        `river:"source,attr,optional"`
+	Prefix      string        `river:"prefix,attr,optional"`
+	MaxIdle     time.Duration `river:"max_idle_duration,attr,optional"`
+	Value       string        `river:"value,attr,optional"`
+
+	Action          string `river:"action,attr"`
+	MatchAll        bool   `river:"match_all,attr,optional"`
+	CountEntryBytes bool   `river:"count_entry_bytes,attr,optional"`
+}
+
+func validateCounterConfig(config *CounterConfig) error {
+	if config.Action == "" {
+		return errors.New(ErrCounterActionRequired)
+	}
+	config.Action = strings.ToLower(config.Action)
+	if config.Action != CounterInc && config.Action != CounterAdd {
+		return fmt.Errorf(ErrCounterInvalidAction, config.Action)
+	}
+	if config.MatchAll && config.Value != "" {
+		return errors.New(ErrCounterInvalidMatchAll)
+	}
+	if config.CountEntryBytes && !config.MatchAll {
+		return errors.New(ErrCounterInvalidCountBytes)
+	}
+	if config.CountEntryBytes && config.Action != CounterAdd {
+		return errors.New(ErrCounterInvalidCountBytesAction)
+	}
+	return nil
+}
+
+// Counters is a vector of counters for each log stream.
+type Counters struct {
+	*metricVec
+	Cfg *CounterConfig
+}
+
+// NewCounters creates a new counter vec with the given fully-qualified
+// metric name.
+func NewCounters(name string, config *CounterConfig) (*Counters, error) {
+	err := validateCounterConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Counters{
+		metricVec: newMetricVec(func(labels map[string]string) prometheus.Metric {
+			return &expiringCounter{prometheus.NewCounter(prometheus.CounterOpts{
+				Help:        config.Description,
+				Name:        name,
+				ConstLabels: labels,
+			}),
+				0,
+			}
+		}, int64(config.MaxIdle.Seconds())),
+		Cfg: config,
+	}, nil
+}
+
+// With returns the counter associated with a stream labelset.
+func (c *Counters) With(labels model.LabelSet) prometheus.Counter {
+	return c.metricVec.With(labels).(prometheus.Counter)
+}
+
+type expiringCounter struct {
+	prometheus.Counter
+	lastModSec int64
+}
+
+// Inc increments the counter by 1. Use Add to increment it by arbitrary
+// non-negative values.
+func (e *expiringCounter) Inc() {
+	e.Counter.Inc()
+	e.lastModSec = time.Now().Unix()
+}
+
+// Add adds the given value to the counter. It panics if the value is <
+// 0.
+func (e *expiringCounter) Add(val float64) {
+	e.Counter.Add(val)
+	e.lastModSec = time.Now().Unix()
+}
+
+// HasExpired implements Expirable
+func (e *expiringCounter) HasExpired(currentTimeSec int64, maxAgeSec int64) bool {
+	return currentTimeSec-e.lastModSec >= maxAgeSec
+}
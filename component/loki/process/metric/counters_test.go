@@ -0,0 +1,153 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateCounterConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		config CounterConfig
+		err    error
+	}{
+		{"invalid action",
+			CounterConfig{
+				Action: "del",
+			},
+			fmt.Errorf(ErrCounterInvalidAction, "del"),
+		},
+		{"invalid counter match all",
+			CounterConfig{
+				MatchAll: true,
+				Value:    "some val",
+				Action:   "inc",
+			},
+			errors.New(ErrCounterInvalidMatchAll),
+		},
+		{"invalid counter match bytes",
+			CounterConfig{
+				CountEntryBytes: true,
+				Action:          "add",
+			},
+			errors.New(ErrCounterInvalidCountBytes),
+		},
+		{"invalid counter match bytes action",
+			CounterConfig{
+				MatchAll:        true,
+				CountEntryBytes: true,
+				Action:          "inc",
+			},
+			errors.New(ErrCounterInvalidCountBytesAction),
+		},
+		{"valid counter match bytes",
+			CounterConfig{
+				MatchAll:        true,
+				CountEntryBytes: true,
+				Action:          "add",
+			},
+			nil,
+		},
+		{"valid",
+			CounterConfig{
+				Value:  "some val",
+				Action: "inc",
+			},
+			nil,
+		},
+		{"valid match all is false",
+			CounterConfig{
+				MatchAll: false,
+				Value:    "some val",
+				Action:   "inc",
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateCounterConfig(&tt.config)
+			if ((err != nil) && (err.Error() != tt.err.Error())) || (err == nil && tt.err != nil) {
+				t.Errorf("Metrics stage validation error, expected error = %v, actual error = %v", tt.err, err)
+				return
+			}
+		})
+	}
+}
+
+func TestCounterExpiration(t *testing.T) {
+	t.Parallel()
+	cfg := &CounterConfig{
+		Description: "HELP ME!!!!!",
+		MaxIdle:     1 * time.Second,
+		Action:      "inc",
+	}
+
+	cnt, err := NewCounters("test1", cfg)
+	assert.Nil(t, err)
+
+	// Create a label and increment the counter
+	lbl1 := model.LabelSet{}
+	lbl1["test"] = "i don't wanna make this a constant"
+	cnt.With(lbl1).Inc()
+
+	// Collect the metrics, should still find the metric in the map
+	collect(cnt)
+	assert.Contains(t, cnt.metrics, lbl1.Fingerprint())
+
+	time.Sleep(1100 * time.Millisecond) // Wait just past our max idle of 1 sec
+
+	//Add another counter with new label val
+	lbl2 := model.LabelSet{}
+	lbl2["test"] = "eat this linter"
+	cnt.With(lbl2).Inc()
+
+	// Collect the metrics, first counter should have expired and removed, second should still be present
+	collect(cnt)
+	assert.NotContains(t, cnt.metrics, lbl1.Fingerprint())
+	assert.Contains(t, cnt.metrics, lbl2.Fingerprint())
+}
+
+func TestCounterDeleteAll(t *testing.T) {
+	t.Parallel()
+	cnt, err := NewCounters("test1", &CounterConfig{Action: "inc", MaxIdle: time.Minute})
+	assert.Nil(t, err)
+
+	cnt.With(model.LabelSet{"test": "app1"}).Inc()
+	cnt.With(model.LabelSet{"test": "app2"}).Inc()
+	assert.Len(t, cnt.metrics, 2)
+
+	cnt.DeleteAll()
+	assert.Empty(t, cnt.metrics)
+	assert.Zero(t, collect(cnt))
+}
+
+// collect drains the metrics sent by c and returns how many there were.
+func collect(c prometheus.Collector) int {
+	done := make(chan struct{})
+	collector := make(chan prometheus.Metric)
+
+	go func() {
+		defer close(done)
+		c.Collect(collector)
+	}()
+
+	var n int
+	for {
+		select {
+		case <-collector:
+			n++
+		case <-done:
+			return n
+		}
+	}
+}
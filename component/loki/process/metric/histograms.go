@@ -0,0 +1,71 @@
+package metric
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/metric.
+// The configuration blocks have been adapted to be decoded from River.
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// HistogramConfig defines a histogram metric whose values are recorded in
+// predefined buckets.
+type HistogramConfig struct {
+	// When adding fields here, make sure to update the stage that uses this
+	// config, as the common fields are defaulted and validated there.
+	Name        string        `river:"name,attr"`
+	Description string        `river:"description,attr,optional"`
+	Source      string        `river:"source,attr,optional"`
+	Prefix      string        `river:"prefix,attr,optional"`
+	MaxIdle     time.Duration `river:"max_idle_duration,attr,optional"`
+	Value       string        `river:"value,attr,optional"`
+
+	Buckets []float64 `river:"buckets,attr,optional"`
+}
+
+// Histograms is a vector of histograms for each log stream.
+type Histograms struct {
+	*metricVec
+	Cfg *HistogramConfig
+}
+
+// NewHistograms creates a new histogram vec with the given fully-qualified
+// metric name.
+func NewHistograms(name string, config *HistogramConfig) (*Histograms, error) {
+	return &Histograms{
+		metricVec: newMetricVec(func(labels map[string]string) prometheus.Metric {
+			return &expiringHistogram{prometheus.NewHistogram(prometheus.HistogramOpts{
+				Help:        config.Description,
+				Name:        name,
+				ConstLabels: labels,
+				Buckets:     config.Buckets,
+			}),
+				0,
+			}
+		}, int64(config.MaxIdle.Seconds())),
+		Cfg: config,
+	}, nil
+}
+
+// With returns the histogram associated with a stream labelset.
+func (h *Histograms) With(labels model.LabelSet) prometheus.Histogram {
+	return h.metricVec.With(labels).(prometheus.Histogram)
+}
+
+type expiringHistogram struct {
+	prometheus.Histogram
+	lastModSec int64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *expiringHistogram) Observe(val float64) {
+	h.Histogram.Observe(val)
+	h.lastModSec = time.Now().Unix()
+}
+
+// HasExpired implements Expirable
+func (h *expiringHistogram) HasExpired(currentTimeSec int64, maxAgeSec int64) bool {
+	return currentTimeSec-h.lastModSec >= maxAgeSec
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"reflect"
 	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
-	"github.com/grafana/agent/component/loki/process/internal/stages"
+	"github.com/grafana/agent/component/loki/process/stages"
 )
 
 func init() {
@@ -38,27 +41,45 @@ var (
 	_ component.Component = (*Component)(nil)
 )
 
+// shutdownFlushTimeout is how long the component tries to forward the entries
+// still buffered in its pipeline when shutting down, as the components it
+// forwards to may be shutting down too.
+const shutdownFlushTimeout = 5 * time.Second
+
 // Component implements the loki.process component.
 type Component struct {
 	opts component.Options
 
-	mut        sync.RWMutex
-	receiver   loki.LogsReceiver
-	fanout     []loki.LogsReceiver
-	processIn  chan<- loki.Entry
-	processOut chan loki.Entry
-	stages     []stages.StageConfig
+	mut          sync.RWMutex
+	receiver     loki.LogsReceiver
+	processIn    chan<- loki.Entry
+	processOut   chan loki.Entry
+	entryHandler loki.EntryHandler
+	stages       []stages.StageConfig
+	pipeline     *stages.Pipeline
+	metrics      *pipelineCollector
+
+	fanoutMut sync.RWMutex
+	fanout    []loki.LogsReceiver
 }
 
 // New creates a new loki.process component.
 func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
-		opts: o,
+		opts:    o,
+		metrics: &pipelineCollector{},
+	}
+
+	// The metrics of the stages are registered in a registry owned by each
+	// pipeline, which is exposed through the collector registered here.
+	if err := o.Registerer.Register(c.metrics); err != nil {
+		return nil, err
 	}
 
 	// Create and immediately export the receiver which remains the same for
 	// the component's lifetime.
 	c.receiver = make(loki.LogsReceiver)
+	c.processOut = make(chan loki.Entry)
 	o.OnStateChange(Exports{Receiver: c.receiver})
 
 	// Call to Update() to start readers and set receivers once at the start.
@@ -71,30 +92,81 @@ func New(o component.Options, args Arguments) (*Component, error) {
 
 // Run implements component.Component.
 func (c *Component) Run(ctx context.Context) error {
+	var (
+		wg         sync.WaitGroup
+		dropCh     = make(chan struct{})
+		shutdownCh = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.handleOut(dropCh, shutdownCh)
+	}()
+
+	c.handleIn(ctx)
+
+	// Stop the pipeline so that the entries it still buffers, such as
+	// incomplete multiline blocks, are flushed. If they can't be forwarded in
+	// time, they're dropped instead.
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		c.mut.Lock()
+		defer c.mut.Unlock()
+		c.stopPipeline()
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(shutdownFlushTimeout):
+		level.Warn(c.opts.Logger).Log("msg", "timed out forwarding buffered log entries on shutdown, dropping them")
+		close(dropCh)
+		<-flushed
+	}
+
+	close(shutdownCh)
+	wg.Wait()
+	return nil
+}
+
+// handleIn sends the received entries to the pipeline until ctx is canceled.
+func (c *Component) handleIn(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return
 		case entry := <-c.receiver:
 			c.mut.RLock()
 			select {
 			case <-ctx.Done():
-				return nil
+				c.mut.RUnlock()
+				return
 			case c.processIn <- entry:
 				// no-op
 			}
 			c.mut.RUnlock()
+		}
+	}
+}
+
+// handleOut forwards the entries coming out of the pipeline until shutdownCh
+// is closed. Once dropCh is closed, entries which can't be forwarded right
+// away are dropped.
+func (c *Component) handleOut(dropCh, shutdownCh chan struct{}) {
+	for {
+		select {
+		case <-shutdownCh:
+			return
 		case entry := <-c.processOut:
-			c.mut.RLock()
-			for _, f := range c.fanout {
+			c.fanoutMut.RLock()
+			fanout := c.fanout
+			c.fanoutMut.RUnlock()
+			for _, f := range fanout {
 				select {
-				case <-ctx.Done():
-					return nil
+				case <-dropCh:
 				case f <- entry:
 					// no-op
 				}
 			}
-			c.mut.RUnlock()
 		}
 	}
 }
@@ -103,25 +175,49 @@ func (c *Component) Run(ctx context.Context) error {
 func (c *Component) Update(args component.Arguments) error {
 	newArgs := args.(Arguments)
 
+	// Update the fanout first, as replacing the pipeline below flushes the
+	// entries buffered by the previous one.
+	c.fanoutMut.Lock()
+	c.fanout = newArgs.ForwardTo
+	c.fanoutMut.Unlock()
+
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	if stagesChanged(c.stages, newArgs.Stages) {
-		pipeline, err := stages.NewPipeline(c.opts.Logger, newArgs.Stages, &c.opts.ID, c.opts.Registerer)
+	if c.pipeline == nil || stagesChanged(c.stages, newArgs.Stages) {
+		reg := newPipelineRegistry()
+		pipeline, err := stages.NewPipeline(c.opts.Logger, newArgs.Stages, &c.opts.ID, reg)
 		if err != nil {
 			return err
 		}
-		c.processOut = make(chan loki.Entry)
-		entryHandler := loki.NewEntryHandler(c.processOut, func() {})
-		c.processIn = pipeline.Wrap(entryHandler).Chan()
+
+		// Flush the replaced pipeline before switching to the new one, so
+		// that entries buffered by its stages aren't lost.
+		c.stopPipeline()
+
+		c.pipeline = pipeline
+		c.metrics.set(reg)
+		c.entryHandler = pipeline.Wrap(loki.NewEntryHandler(c.processOut, func() {}))
+		c.processIn = c.entryHandler.Chan()
 		c.stages = newArgs.Stages
 	}
 
-	c.fanout = newArgs.ForwardTo
-
 	return nil
 }
 
+// stopPipeline stops the current pipeline, waiting for the entries it
+// buffers to be flushed, and releases its metrics. c.mut must be held when
+// calling stopPipeline.
+func (c *Component) stopPipeline() {
+	if c.pipeline == nil {
+		return
+	}
+	c.entryHandler.Stop()
+	c.pipeline.Cleanup()
+	c.metrics.set(nil)
+	c.pipeline, c.entryHandler, c.processIn = nil, nil, nil
+}
+
 func stagesChanged(prev, next []stages.StageConfig) bool {
 	if len(prev) != len(next) {
 		return true
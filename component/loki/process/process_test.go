@@ -3,16 +3,19 @@ package process
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
-	"github.com/grafana/agent/component/loki/process/internal/stages"
+	"github.com/grafana/agent/component/loki/process/metric"
+	"github.com/grafana/agent/component/loki/process/stages"
 	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/grafana/agent/pkg/river"
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 )
@@ -120,3 +123,177 @@ func TestJSONLabelsStage(t *testing.T) {
 		}
 	}
 }
+
+func TestMetricsStageUpdate(t *testing.T) {
+	stg := `stage {
+			  metrics {
+			    metric.counter {
+				  name        = "lines_total"
+				  description = "lines"
+				  match_all   = true
+				  action      = "inc"
+				}
+			  }
+			}`
+
+	type cfg struct {
+		Stages []stages.StageConfig `river:"stage,block"`
+	}
+	var stagesCfg cfg
+	err := river.Unmarshal([]byte(stg), &stagesCfg)
+	require.NoError(t, err)
+
+	ch1 := make(loki.LogsReceiver)
+
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	opts := component.Options{Logger: l, Registerer: registry, OnStateChange: func(e component.Exports) {}}
+	args := Arguments{
+		ForwardTo: []loki.LogsReceiver{ch1},
+		Stages:    stagesCfg.Stages,
+	}
+
+	c, err := New(opts, args)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	sendAndReceive := func() {
+		c.receiver <- loki.Entry{
+			Labels: model.LabelSet{"foo": "bar"},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: "hello"},
+		}
+		select {
+		case <-ch1:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log line")
+		}
+	}
+
+	sendAndReceive()
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP loki_process_custom_lines_total lines
+# TYPE loki_process_custom_lines_total counter
+loki_process_custom_lines_total{foo="bar"} 1
+`), "loki_process_custom_lines_total"))
+
+	// Changing the stages replaces the pipeline; the series of the previous
+	// pipeline must not be exposed alongside the ones of the new pipeline.
+	var newStagesCfg cfg
+	err = river.Unmarshal([]byte(strings.Replace(stg, `"lines"`, `"number of lines"`, 1)), &newStagesCfg)
+	require.NoError(t, err)
+	args.Stages = newStagesCfg.Stages
+	prevMetrics := c.metrics.current
+	require.NoError(t, c.Update(args))
+
+	// The registry of the previous pipeline was dropped along with it, rather
+	// than left registered.
+	require.NotSame(t, prevMetrics, c.metrics.current)
+
+	sendAndReceive()
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP loki_process_custom_lines_total number of lines
+# TYPE loki_process_custom_lines_total counter
+loki_process_custom_lines_total{foo="bar"} 1
+`), "loki_process_custom_lines_total"))
+}
+
+func TestMultilineStageFlush(t *testing.T) {
+	stg := `stage {
+			  multiline {
+			    firstline     = "^START"
+			    max_wait_time = "1h"
+			  }
+			}`
+
+	type cfg struct {
+		Stages []stages.StageConfig `river:"stage,block"`
+	}
+	var stagesCfg cfg
+	err := river.Unmarshal([]byte(stg), &stagesCfg)
+	require.NoError(t, err)
+
+	ch1 := make(loki.LogsReceiver)
+
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+	opts := component.Options{Logger: l, Registerer: prometheus.NewRegistry(), OnStateChange: func(e component.Exports) {}}
+	args := Arguments{
+		ForwardTo: []loki.LogsReceiver{ch1},
+		Stages:    stagesCfg.Stages,
+	}
+
+	c, err := New(opts, args)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		_ = c.Run(ctx)
+	}()
+
+	receive := func() loki.Entry {
+		select {
+		case e := <-ch1:
+			return e
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log line")
+		}
+		return loki.Entry{}
+	}
+	// sendBlock sends lines to be buffered by the multiline stage. It then
+	// sends an entry from another stream which passes through the stage, so
+	// that once it's received all lines are known to be in the pipeline.
+	sendBlock := func(lines ...string) {
+		for _, line := range lines {
+			c.receiver <- loki.Entry{
+				Labels: model.LabelSet{"foo": "bar"},
+				Entry:  logproto.Entry{Timestamp: time.Now(), Line: line},
+			}
+		}
+		c.receiver <- loki.Entry{
+			Labels: model.LabelSet{"foo": "baz"},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: "passthrough"},
+		}
+		require.Equal(t, "passthrough", receive().Line)
+	}
+
+	// Updating the stages flushes the block buffered by the previous
+	// pipeline.
+	sendBlock("START first", "continued")
+	var newStagesCfg cfg
+	err = river.Unmarshal([]byte(strings.Replace(stg, `"1h"`, `"2h"`, 1)), &newStagesCfg)
+	require.NoError(t, err)
+	args.Stages = newStagesCfg.Stages
+
+	updateDone := make(chan error)
+	go func() { updateDone <- c.Update(args) }()
+	require.Equal(t, "START first\ncontinued", receive().Line)
+	require.NoError(t, <-updateDone)
+
+	// Shutting down flushes the block buffered by the current pipeline.
+	sendBlock("START second", "continued")
+	cancel()
+	require.Equal(t, "START second\ncontinued", receive().Line)
+
+	select {
+	case <-runDone:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "component did not shut down")
+	}
+}
+
+func TestPipelineRegistryUnregister(t *testing.T) {
+	reg := newPipelineRegistry()
+
+	// The collectors of the metrics stage are unchecked, which a
+	// prometheus.Registry can't unregister.
+	counters, err := metric.NewCounters("test_total", &metric.CounterConfig{Description: "test", Action: metric.CounterInc})
+	require.NoError(t, err)
+	require.NoError(t, reg.Register(counters))
+	require.True(t, reg.Unregister(counters))
+	require.Empty(t, reg.collectors)
+}
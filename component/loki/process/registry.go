@@ -0,0 +1,111 @@
+package process
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipelineRegistry is a prometheus.Registerer holding the metrics of a single
+// pipeline. It's registered once for the lifetime of the component and
+// collects from the metrics of the current pipeline, so that the metrics of a
+// replaced pipeline are dropped along with it.
+//
+// Registering the stage metrics with the component's registerer directly would
+// leak them, as the collectors of the metrics stage are unchecked and can't be
+// unregistered from a prometheus.Registry.
+type pipelineRegistry struct {
+	// reg reports collectors that are registered more than once, which stages
+	// rely on to share metrics.
+	reg *prometheus.Registry
+
+	mut        sync.RWMutex
+	collectors []prometheus.Collector
+}
+
+var (
+	_ prometheus.Registerer = (*pipelineRegistry)(nil)
+	_ prometheus.Collector  = (*pipelineRegistry)(nil)
+)
+
+func newPipelineRegistry() *pipelineRegistry {
+	return &pipelineRegistry{reg: prometheus.NewRegistry()}
+}
+
+// Register implements prometheus.Registerer.
+func (r *pipelineRegistry) Register(c prometheus.Collector) error {
+	if err := r.reg.Register(c); err != nil {
+		return err
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (r *pipelineRegistry) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements prometheus.Registerer. Unlike a prometheus.Registry,
+// it also unregisters unchecked collectors.
+func (r *pipelineRegistry) Unregister(c prometheus.Collector) bool {
+	r.reg.Unregister(c)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for i, rc := range r.collectors {
+		if rc == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Describe implements prometheus.Collector. It doesn't describe any metrics,
+// as the metrics of the pipeline change when it's replaced.
+func (r *pipelineRegistry) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (r *pipelineRegistry) Collect(ch chan<- prometheus.Metric) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	for _, c := range r.collectors {
+		c.Collect(ch)
+	}
+}
+
+// pipelineCollector collects the metrics of the current pipeline of the
+// component.
+type pipelineCollector struct {
+	mut     sync.RWMutex
+	current *pipelineRegistry
+}
+
+var _ prometheus.Collector = (*pipelineCollector)(nil)
+
+// set replaces the registry of the current pipeline.
+func (c *pipelineCollector) set(reg *pipelineRegistry) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.current = reg
+}
+
+// Describe implements prometheus.Collector.
+func (c *pipelineCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (c *pipelineCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.current != nil {
+		c.current.Collect(ch)
+	}
+}
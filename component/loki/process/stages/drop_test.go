@@ -0,0 +1,380 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/agent/pkg/river"
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+// Not all these are tested but are here to make sure the different types marshal without error
+var testDropRiver = `
+stage {
+  json {
+    expressions = { "app" = "", "msg" = "" }
+  }
+}
+
+stage {
+  drop {
+    source      = "src"
+    expression  = ".*test.*"
+    older_than  = "24h"
+    longer_than = "8KB"
+  }
+}
+
+stage {
+  drop {
+    expression = ".*app1.*"
+  }
+}
+
+stage {
+  drop {
+    source = "app"
+    value  = "loki"
+  }
+}
+
+stage {
+  drop {
+    longer_than = "10KB"
+  }
+}
+`
+
+func Test_dropStage_Process(t *testing.T) {
+	// Enable debug logging
+	Debug = true
+
+	tests := []struct {
+		name       string
+		config     *DropConfig
+		labels     model.LabelSet
+		extracted  map[string]interface{}
+		t          time.Time
+		entry      string
+		shouldDrop bool
+	}{
+		{
+			name: "Longer Than Should Drop",
+			config: &DropConfig{
+				LongerThan: ptrFromBytes(10),
+			},
+			labels:     model.LabelSet{},
+			extracted:  map[string]interface{}{},
+			entry:      "12345678901",
+			shouldDrop: true,
+		},
+		{
+			name: "Longer Than Should Not Drop When Equal",
+			config: &DropConfig{
+				LongerThan: ptrFromBytes(10),
+			},
+			labels:     model.LabelSet{},
+			extracted:  map[string]interface{}{},
+			entry:      "1234567890",
+			shouldDrop: false,
+		},
+		{
+			name: "Longer Than Should Not Drop When Less",
+			config: &DropConfig{
+				LongerThan: ptrFromBytes(10),
+			},
+			labels:     model.LabelSet{},
+			extracted:  map[string]interface{}{},
+			entry:      "123456789",
+			shouldDrop: false,
+		},
+		{
+			name: "Older than Should Drop",
+			config: &DropConfig{
+				OlderThan: ptrFromDuration(time.Hour),
+			},
+			labels:     model.LabelSet{},
+			extracted:  map[string]interface{}{},
+			t:          time.Now().Add(-2 * time.Hour),
+			shouldDrop: true,
+		},
+		{
+			name: "Older than Should Not Drop",
+			config: &DropConfig{
+				OlderThan: ptrFromDuration(time.Hour),
+			},
+			labels:     model.LabelSet{},
+			extracted:  map[string]interface{}{},
+			t:          time.Now().Add(-5 * time.Minute),
+			shouldDrop: false,
+		},
+		{
+			name: "Matched Source",
+			config: &DropConfig{
+				Source: ptrFromString("key"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "",
+			},
+			shouldDrop: true,
+		},
+		{
+			name: "Did not match Source",
+			config: &DropConfig{
+				Source: ptrFromString("key1"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "val1",
+			},
+			shouldDrop: false,
+		},
+		{
+			name: "Matched Source and Value",
+			config: &DropConfig{
+				Source: ptrFromString("key"),
+				Value:  ptrFromString("val1"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "val1",
+			},
+			shouldDrop: true,
+		},
+		{
+			name: "Did not match Source and Value",
+			config: &DropConfig{
+				Source: ptrFromString("key"),
+				Value:  ptrFromString("val1"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "VALRUE1",
+			},
+			shouldDrop: false,
+		},
+		{
+			name: "Regex Matched Source and Value",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				Expression: ptrFromString(".*val.*"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "val1",
+			},
+			shouldDrop: true,
+		},
+		{
+			name: "Regex Did not match Source and Value",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				Expression: ptrFromString(".*val.*"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "pal1",
+			},
+			shouldDrop: false,
+		},
+		{
+			name: "Regex No Matching Source",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				Expression: ptrFromString(".*val.*"),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"pokey": "pal1",
+			},
+			shouldDrop: false,
+		},
+		{
+			name: "Regex Did Not Match Line",
+			config: &DropConfig{
+				Expression: ptrFromString(".*val.*"),
+			},
+			labels:     model.LabelSet{},
+			entry:      "this is a line which does not match the regex",
+			extracted:  map[string]interface{}{},
+			shouldDrop: false,
+		},
+		{
+			name: "Regex Matched Line",
+			config: &DropConfig{
+				Expression: ptrFromString(".*val.*"),
+			},
+			labels:     model.LabelSet{},
+			entry:      "this is a line with the word value in it",
+			extracted:  map[string]interface{}{},
+			shouldDrop: true,
+		},
+		{
+			name: "Match Source and Length Both Match",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				LongerThan: ptrFromBytes(10),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "pal1",
+			},
+			entry:      "12345678901",
+			shouldDrop: true,
+		},
+		{
+			name: "Match Source and Length Only First Matches",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				LongerThan: ptrFromBytes(10),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "pal1",
+			},
+			entry:      "123456789",
+			shouldDrop: false,
+		},
+		{
+			name: "Match Source and Length Only Second Matches",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				LongerThan: ptrFromBytes(10),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"WOOOOOOOOOOOOOO": "pal1",
+			},
+			entry:      "123456789012",
+			shouldDrop: false,
+		},
+		{
+			name: "Everything Must Match",
+			config: &DropConfig{
+				Source:     ptrFromString("key"),
+				Expression: ptrFromString(".*val.*"),
+				OlderThan:  ptrFromDuration(time.Hour),
+				LongerThan: ptrFromBytes(10),
+			},
+			labels: model.LabelSet{},
+			extracted: map[string]interface{}{
+				"key": "must contain value to match",
+			},
+			t:          time.Now().Add(-2 * time.Hour),
+			entry:      "12345678901",
+			shouldDrop: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDropConfig(tt.config)
+			if err != nil {
+				t.Error(err)
+			}
+			m, err := newDropStage(util_log.Logger, tt.config, prometheus.DefaultRegisterer)
+			require.NoError(t, err)
+			out := processEntries(m, newEntry(tt.extracted, tt.labels, tt.entry, tt.t))
+			if tt.shouldDrop {
+				assert.Len(t, out, 0)
+			} else {
+				assert.Len(t, out, 1)
+			}
+		})
+	}
+}
+
+func ptrFromString(str string) *string {
+	return &str
+}
+
+func ptrFromDuration(d time.Duration) *time.Duration {
+	return &d
+}
+
+func ptrFromBytes(b units.Base2Bytes) *units.Base2Bytes {
+	return &b
+}
+
+// TestDropPipeline is used to verify we properly parse the River config and create a working pipeline
+func TestDropPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	plName := "test_pipeline"
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testDropRiver), &plName, registry)
+	require.NoError(t, err)
+	out := processEntries(pl,
+		newEntry(nil, nil, testMatchLogLineApp1, time.Now()),
+		newEntry(nil, nil, testMatchLogLineApp2, time.Now()),
+	)
+
+	// Only the second line will go through.
+	assert.Len(t, out, 1)
+	assert.Equal(t, out[0].Line, testMatchLogLineApp2)
+}
+
+var (
+	dropVal          = "msg"
+	dropRegex        = ".*blah"
+	dropInvalidRegex = "(?P<ts[0-9]+).*"
+)
+
+func Test_validateDropConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DropConfig
+		wantErr error
+	}{
+		{
+			name:    "ErrEmpty",
+			config:  &DropConfig{},
+			wantErr: errors.New(ErrDropStageEmptyConfig),
+		},
+		{
+			name: "Invalid Config",
+			config: &DropConfig{
+				Value:      &dropVal,
+				Expression: &dropRegex,
+			},
+			wantErr: errors.New(ErrDropStageInvalidConfig),
+		},
+		{
+			name: "Invalid Regex",
+			config: &DropConfig{
+				Expression: &dropInvalidRegex,
+			},
+			wantErr: fmt.Errorf(ErrDropStageInvalidRegex, "error parsing regexp: invalid named capture: `(?P<ts[0-9]+).*`"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDropConfig(tt.config); ((err != nil) && (err.Error() != tt.wantErr.Error())) || (err == nil && tt.wantErr != nil) {
+				t.Errorf("validateDropConfig() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_dropConfig_invalidValues(t *testing.T) {
+	tests := map[string]string{
+		"Invalid Duration": `older_than = "10y"`,
+		"Invalid Bytesize": `longer_than = "23QB"`,
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got DropConfig
+			require.Error(t, river.Unmarshal([]byte(cfg), &got))
+		})
+	}
+}
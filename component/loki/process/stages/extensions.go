@@ -0,0 +1,224 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+
+	"github.com/alecthomas/units"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Configuration errors.
+const (
+	ErrCRIStageInvalidMaxPartialLines = "cri stage `max_partial_lines` must be a positive number"
+	ErrCRIStageTruncateWithoutSize    = "cri stage `max_partial_line_size_truncate` requires `max_partial_line_size` to be set"
+)
+
+const (
+	criFlagPartial         = "P"
+	defaultMaxPartialLines = 100
+)
+
+// DockerConfig is an empty struct that is used to enable a pre-defined
+// pipeline for decoding entries that are using the Docker logs format.
+type DockerConfig struct{}
+
+// CRIConfig is used to enable a pre-defined pipeline for decoding entries
+// that are using the CRI logging format.
+type CRIConfig struct {
+	MaxPartialLines            int              `river:"max_partial_lines,attr,optional"`
+	MaxPartialLineSize         units.Base2Bytes `river:"max_partial_line_size,attr,optional"`
+	MaxPartialLineSizeTruncate bool             `river:"max_partial_line_size_truncate,attr,optional"`
+}
+
+// validateCRIConfig validates the CRIConfig for the cri stage.
+func validateCRIConfig(cfg *CRIConfig) error {
+	if cfg.MaxPartialLines < 0 {
+		return errors.New(ErrCRIStageInvalidMaxPartialLines)
+	}
+	if cfg.MaxPartialLineSizeTruncate && cfg.MaxPartialLineSize <= 0 {
+		return errors.New(ErrCRIStageTruncateWithoutSize)
+	}
+	return nil
+}
+
+// NewDocker creates a predefined pipeline for parsing entries in the Docker
+// json log format.
+func NewDocker(logger log.Logger, registerer prometheus.Registerer) (Stage, error) {
+	stream := "stream"
+	stages := []StageConfig{
+		{JSONConfig: &JSONConfig{
+			Expressions: map[string]string{
+				"output":    "log",
+				"stream":    "stream",
+				"timestamp": "time",
+			},
+		}},
+		{LabelsConfig: &LabelsConfig{
+			Values: map[string]*string{"stream": &stream},
+		}},
+		{TimestampConfig: &TimestampConfig{
+			Source: "timestamp",
+			Format: "RFC3339Nano",
+		}},
+		{OutputConfig: &OutputConfig{
+			Source: "output",
+		}},
+	}
+	return NewPipeline(logger, stages, nil, registerer)
+}
+
+// cri is a predefined pipeline for parsing entries in the CRI log format,
+// which also reassembles lines that the container runtime split into
+// several partial lines.
+type cri struct {
+	base *Pipeline
+
+	logger                     log.Logger
+	maxPartialLines            int
+	maxPartialLineSize         int
+	maxPartialLineSizeTruncate bool
+}
+
+// criPartials holds the partial lines of each stream which haven't been
+// reassembled yet.
+type criPartials struct {
+	entries map[model.Fingerprint]Entry
+	lines   map[model.Fingerprint]int // The number of partial lines buffered for each stream.
+	total   int                       // The number of partial lines buffered across all streams.
+}
+
+func newCRIPartials() *criPartials {
+	return &criPartials{
+		entries: make(map[model.Fingerprint]Entry),
+		lines:   make(map[model.Fingerprint]int),
+	}
+}
+
+// remove drops the partial lines of a stream from the buffer.
+func (p *criPartials) remove(fingerprint model.Fingerprint) {
+	p.total -= p.lines[fingerprint]
+	delete(p.entries, fingerprint)
+	delete(p.lines, fingerprint)
+}
+
+// NewCRI creates a predefined pipeline for parsing entries in the CRI log
+// format.
+func NewCRI(logger log.Logger, config *CRIConfig, registerer prometheus.Registerer) (Stage, error) {
+	if err := validateCRIConfig(config); err != nil {
+		return nil, err
+	}
+
+	stream := "stream"
+	stages := []StageConfig{
+		{RegexConfig: &RegexConfig{
+			Expression: "^(?s)(?P<time>\\S+?) (?P<stream>stdout|stderr) (?P<flags>\\S+?) (?P<content>.*)$",
+		}},
+		{LabelsConfig: &LabelsConfig{
+			Values: map[string]*string{"stream": &stream},
+		}},
+		{TimestampConfig: &TimestampConfig{
+			Source: "time",
+			Format: "RFC3339Nano",
+		}},
+		{OutputConfig: &OutputConfig{
+			Source: "content",
+		}},
+	}
+
+	p, err := NewPipeline(logger, stages, nil, registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	maxPartialLines := config.MaxPartialLines
+	if maxPartialLines == 0 {
+		maxPartialLines = defaultMaxPartialLines
+	}
+
+	return &cri{
+		base:                       p,
+		logger:                     log.With(logger, "component", "stage", "type", "cri"),
+		maxPartialLines:            maxPartialLines,
+		maxPartialLineSize:         int(config.MaxPartialLineSize),
+		maxPartialLineSizeTruncate: config.MaxPartialLineSizeTruncate,
+	}, nil
+}
+
+// Name implements Stage.
+func (c *cri) Name() string {
+	return StageTypeCRI
+}
+
+// Run implements Stage. Partial lines are buffered per stream until the
+// line which completes them is received. Any partial lines which are still
+// buffered once the in channel is closed are flushed as they are.
+func (c *cri) Run(in chan Entry) chan Entry {
+	in = c.base.Run(in)
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+
+		partials := newCRIPartials()
+		for e := range in {
+			for _, e := range c.process(partials, e) {
+				out <- e
+			}
+		}
+		for _, e := range partials.entries {
+			out <- e
+		}
+	}()
+	return out
+}
+
+// process handles a single parsed entry and returns the entries that are
+// ready to be sent further down the pipeline.
+func (c *cri) process(partials *criPartials, e Entry) []Entry {
+	fingerprint := e.Labels.FastFingerprint()
+	prev, hasPrev := partials.entries[fingerprint]
+
+	if e.Extracted["flags"] != criFlagPartial {
+		// A full line completes the partial lines of its stream, if any.
+		if hasPrev {
+			e.Line = prev.Line + e.Line
+			partials.remove(fingerprint)
+		}
+		return []Entry{e}
+	}
+
+	var flushed []Entry
+	if partials.total >= c.maxPartialLines {
+		// Flush everything buffered so far rather than growing unbounded.
+		level.Warn(c.logger).Log("msg", "cri stage: partial lines upperbound exceeded, flushing buffered partial lines", "threshold", c.maxPartialLines)
+		flushed = make([]Entry, 0, len(partials.entries))
+		for _, pe := range partials.entries {
+			flushed = append(flushed, pe)
+		}
+		*partials = *newCRIPartials()
+		hasPrev = false
+	}
+
+	if hasPrev {
+		e.Line = prev.Line + e.Line
+	}
+	if c.maxPartialLineSizeTruncate && len(e.Line) > c.maxPartialLineSize {
+		e.Line = e.Line[:c.maxPartialLineSize]
+	}
+	partials.entries[fingerprint] = e
+	partials.lines[fingerprint]++
+	partials.total++
+
+	return flushed
+}
+
+// Cleanup implements cleaner.
+func (c *cri) Cleanup() {
+	c.base.Cleanup()
+}
@@ -0,0 +1,368 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/pkg/river"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var (
+	dockerRaw       = `{"log":"level=info ts=2019-04-30T02:12:41.844179Z caller=filetargetmanager.go:180 msg=\"Adding target\" key=\"{com_docker_deploy_namespace=\\\"docker\\\", com_docker_fry=\\\"compose.api\\\", com_docker_image_tag=\\\"v0.4.12\\\", container_name=\\\"compose\\\", instance=\\\"compose-api-cbff6dfc9-cqfr8\\\", job=\\\"docker/compose-api\\\", namespace=\\\"docker\\\", pod_template_hash=\\\"769928975\\\"}\"\n","stream":"stderr","time":"2019-04-30T02:12:41.8443515Z"}`
+	dockerProcessed = `level=info ts=2019-04-30T02:12:41.844179Z caller=filetargetmanager.go:180 msg="Adding target" key="{com_docker_deploy_namespace=\"docker\", com_docker_fry=\"compose.api\", com_docker_image_tag=\"v0.4.12\", container_name=\"compose\", instance=\"compose-api-cbff6dfc9-cqfr8\", job=\"docker/compose-api\", namespace=\"docker\", pod_template_hash=\"769928975\"}"
+`
+	dockerInvalidTimestampRaw = `{"log":"log message\n","stream":"stderr","time":"hi!"}`
+	dockerTestTimeNow         = time.Now()
+)
+
+func TestNewDocker(t *testing.T) {
+	loc, err := time.LoadLocation("UTC")
+	if err != nil {
+		t.Fatal("could not parse timezone", err)
+	}
+
+	tests := map[string]struct {
+		entry          string
+		expectedEntry  string
+		t              time.Time
+		expectedT      time.Time
+		labels         map[string]string
+		expectedLabels map[string]string
+	}{
+		"happy path": {
+			dockerRaw,
+			dockerProcessed,
+			time.Now(),
+			time.Date(2019, 4, 30, 02, 12, 41, 844351500, loc),
+			map[string]string{},
+			map[string]string{
+				"stream": "stderr",
+			},
+		},
+		"invalid timestamp": {
+			dockerInvalidTimestampRaw,
+			"log message\n",
+			dockerTestTimeNow,
+			dockerTestTimeNow,
+			map[string]string{},
+			map[string]string{
+				"stream": "stderr",
+			},
+		},
+		"invalid json": {
+			"i'm not json!",
+			"i'm not json!",
+			dockerTestTimeNow,
+			dockerTestTimeNow,
+			map[string]string{},
+			map[string]string{},
+		},
+	}
+
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewDocker(util_log.Logger, prometheus.NewRegistry())
+			if err != nil {
+				t.Fatalf("failed to create Docker parser: %s", err)
+			}
+			out := processEntries(p, newEntry(nil, toLabelSet(tt.labels), tt.entry, tt.t))[0]
+
+			assertLabels(t, tt.expectedLabels, out.Labels)
+			assert.Equal(t, tt.expectedEntry, out.Line, "did not receive expected log entry")
+			if out.Timestamp.Unix() != tt.expectedT.Unix() {
+				t.Fatalf("mismatch ts want: %s got:%s", tt.expectedT, tt.t)
+			}
+		})
+	}
+}
+
+var (
+	criTestTimeStr = "2019-01-01T01:00:00.000000001Z"
+	criTestTime, _ = time.Parse(time.RFC3339Nano, criTestTimeStr)
+	criTestTime2   = time.Now()
+)
+
+func TestCRI_tags(t *testing.T) {
+	cases := []struct {
+		name                       string
+		lines                      []string
+		expected                   []string
+		maxPartialLines            int
+		maxPartialLineSize         int
+		maxPartialLineSizeTruncate bool
+	}{
+		{
+			name: "tag F",
+			lines: []string{
+				"2019-05-07T18:57:50.904275087+00:00 stdout F some full line",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F log",
+			},
+			expected: []string{"some full line", "log"},
+		},
+		{
+			name: "tag P",
+			lines: []string{
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 1 ",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 2 ",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F log finished",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F another full log",
+			},
+			expected: []string{
+				"partial line 1 partial line 2 log finished",
+				"another full log",
+			},
+		},
+		{
+			name: "tag P exceeding MaxPartialLines",
+			lines: []string{
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 1 ",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 2 ",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 3 ",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 4 ", // this exceeds the `MaxPartialLines` of 3
+				"2019-05-07T18:57:55.904275087+00:00 stdout F log finished",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F another full log",
+			},
+			maxPartialLines: 3,
+			expected: []string{
+				"partial line 1 partial line 2 partial line 3 ",
+				"partial line 4 log finished",
+				"another full log",
+			},
+		},
+		{
+			name: "tag P exceeding MaxPartialLineSize",
+			lines: []string{
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 1 ",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P partial line 2 ",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F log finished",
+			},
+			maxPartialLineSize:         20,
+			maxPartialLineSizeTruncate: true,
+			expected: []string{
+				"partial line 1 partilog finished",
+			},
+		},
+		{
+			name: "panic",
+			lines: []string{
+				"2019-05-07T18:57:50.904275087+00:00 stdout P panic: I'm pannicing\n",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P \n",
+				"2019-05-07T18:57:50.904275087+00:00 stdout P goroutine 1 [running]:\n",
+				"2019-05-07T18:57:55.904275087+00:00 stdout P main.main()\n",
+				"2019-05-07T18:57:55.904275087+00:00 stdout F 	/home/kavirajk/src/go-play/main.go:11 +0x27",
+			},
+			expected: []string{
+				`panic: I'm pannicing
+
+goroutine 1 [running]:
+main.main()
+	/home/kavirajk/src/go-play/main.go:11 +0x27`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &CRIConfig{}
+			p, err := NewCRI(util_log.Logger, cfg, prometheus.NewRegistry())
+			require.NoError(t, err)
+
+			// tweak the limits of the stage
+			if tt.maxPartialLines != 0 {
+				p.(*cri).maxPartialLines = tt.maxPartialLines
+			}
+			p.(*cri).maxPartialLineSize = tt.maxPartialLineSize
+			p.(*cri).maxPartialLineSizeTruncate = tt.maxPartialLineSizeTruncate
+
+			entries := make([]Entry, 0, len(tt.lines))
+			for _, line := range tt.lines {
+				entries = append(entries, newEntry(nil, nil, line, time.Now()))
+			}
+
+			got := make([]string, 0)
+			for _, en := range processEntries(p, entries...) {
+				got = append(got, en.Line)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCRI_multipleStreams(t *testing.T) {
+	p, err := NewCRI(util_log.Logger, &CRIConfig{}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	out := processEntries(p,
+		newEntry(nil, model.LabelSet{"pod": "a"}, "2019-05-07T18:57:50.904275087+00:00 stdout P a1 ", time.Now()),
+		newEntry(nil, model.LabelSet{"pod": "b"}, "2019-05-07T18:57:50.904275087+00:00 stdout P b1 ", time.Now()),
+		newEntry(nil, model.LabelSet{"pod": "a"}, "2019-05-07T18:57:50.904275087+00:00 stderr F a2", time.Now()),
+		newEntry(nil, model.LabelSet{"pod": "a"}, "2019-05-07T18:57:50.904275087+00:00 stdout F a3", time.Now()),
+		newEntry(nil, model.LabelSet{"pod": "b"}, "2019-05-07T18:57:50.904275087+00:00 stdout F b2", time.Now()),
+		// This partial line is never completed, and is flushed as-is once
+		// the input is closed.
+		newEntry(nil, model.LabelSet{"pod": "b"}, "2019-05-07T18:57:50.904275087+00:00 stdout P b3", time.Now()),
+	)
+
+	got := make([]string, 0, len(out))
+	for _, e := range out {
+		got = append(got, string(e.Labels["pod"])+"/"+string(e.Labels["stream"])+": "+e.Line)
+	}
+	assert.Equal(t, []string{
+		"a/stderr: a2",
+		"a/stdout: a1 a3",
+		"b/stdout: b1 b2",
+		"b/stdout: b3",
+	}, got)
+}
+
+func TestNewCri(t *testing.T) {
+	tests := map[string]struct {
+		entry          string
+		expectedEntry  string
+		t              time.Time
+		expectedT      time.Time
+		labels         map[string]string
+		expectedLabels map[string]string
+	}{
+		"happy path": {
+			criTestTimeStr + " stderr F message",
+			"message",
+			time.Now(),
+			criTestTime,
+			map[string]string{},
+			map[string]string{
+				"stream": "stderr",
+			},
+		},
+		"multi line pass": {
+			criTestTimeStr + " stderr F message\nmessage2",
+			"message\nmessage2",
+			time.Now(),
+			criTestTime,
+			map[string]string{},
+			map[string]string{
+				"stream": "stderr",
+			},
+		},
+		"invalid timestamp": {
+			"3242 stderr F message",
+			"message",
+			criTestTime2,
+			criTestTime2,
+			map[string]string{},
+			map[string]string{
+				"stream": "stderr",
+			},
+		},
+		"invalid line": {
+			"i'm invalid!!!",
+			"i'm invalid!!!",
+			criTestTime2,
+			criTestTime2,
+			map[string]string{},
+			map[string]string{},
+		},
+	}
+
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewCRI(util_log.Logger, &CRIConfig{}, prometheus.NewRegistry())
+			if err != nil {
+				t.Fatalf("failed to create CRI parser: %s", err)
+			}
+			out := processEntries(p, newEntry(nil, toLabelSet(tt.labels), tt.entry, tt.t))[0]
+
+			assertLabels(t, tt.expectedLabels, out.Labels)
+			assert.Equal(t, tt.expectedEntry, out.Line, "did not receive expected log entry")
+			if out.Timestamp.Unix() != tt.expectedT.Unix() {
+				t.Fatalf("mismatch ts want: %s got:%s", tt.expectedT, tt.t)
+			}
+		})
+	}
+}
+
+func TestCRIConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    error
+	}{
+		"defaults": {
+			`cri {}`,
+			nil,
+		},
+		"negative max_partial_lines": {
+			`cri {
+			  max_partial_lines = -1
+			}`,
+			errors.New(ErrCRIStageInvalidMaxPartialLines),
+		},
+		"truncate without size": {
+			`cri {
+			  max_partial_line_size_truncate = true
+			}`,
+			errors.New(ErrCRIStageTruncateWithoutSize),
+		},
+		"valid": {
+			`cri {
+			  max_partial_lines              = 50
+			  max_partial_line_size          = "64KiB"
+			  max_partial_line_size_truncate = true
+			}`,
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var cfg StageConfig
+			require.NoError(t, river.Unmarshal([]byte(test.config), &cfg))
+
+			_, err := NewCRI(util_log.Logger, cfg.CRIConfig, prometheus.NewRegistry())
+			if test.err != nil {
+				require.EqualError(t, err, test.err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDockerCRIStagesConfig(t *testing.T) {
+	stages := loadConfig(`
+stage {
+  docker {}
+}
+stage {
+  cri {}
+}`)
+	require.Len(t, stages, 2)
+	require.NotNil(t, stages[0].DockerConfig)
+	require.NotNil(t, stages[1].CRIConfig)
+
+	pl, err := NewPipeline(util_log.Logger, stages, nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(pl.stages))
+	for _, s := range pl.stages {
+		names = append(names, s.Name())
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{StageTypeCRI, StageTypePipeline}, names)
+}
@@ -0,0 +1,219 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/prometheus/common/model"
+)
+
+// Configuration errors.
+const (
+	ErrGeoIPStageEmptyConfig   = "geoip stage config cannot be empty"
+	ErrGeoIPStageEmptyDB       = "geoip stage `db` cannot be empty"
+	ErrGeoIPStageEmptySource   = "geoip stage `source` cannot be empty"
+	ErrGeoIPStageInvalidDBType = "geoip stage `db_type` must be either city or asn"
+	ErrGeoIPStageOpenDB        = "geoip stage failed to open the database: %w"
+	ErrGeoIPStageUnknownDBType = "geoip stage cannot detect the type of database %q, `db_type` must be set"
+)
+
+// Supported types of GeoIP databases.
+const (
+	GeoIPDBTypeCity = "city"
+	GeoIPDBTypeASN  = "asn"
+)
+
+// Names of the values extracted by the geoip stage.
+const (
+	fieldGeoIPCityName            = "geoip_city_name"
+	fieldGeoIPCountryName         = "geoip_country_name"
+	fieldGeoIPCountryCode         = "geoip_country_code"
+	fieldGeoIPContinentName       = "geoip_continent_name"
+	fieldGeoIPContinentCode       = "geoip_continent_code"
+	fieldGeoIPLocationLatitude    = "geoip_location_latitude"
+	fieldGeoIPLocationLongitude   = "geoip_location_longitude"
+	fieldGeoIPPostalCode          = "geoip_postal_code"
+	fieldGeoIPTimezone            = "geoip_timezone"
+	fieldGeoIPSubdivisionName     = "geoip_subdivision_name"
+	fieldGeoIPSubdivisionCode     = "geoip_subdivision_code"
+	fieldGeoIPAutonomousSystemNum = "geoip_autonomous_system_number"
+	fieldGeoIPAutonomousSystemOrg = "geoip_autonomous_system_organization"
+)
+
+const (
+	geoIPNamesLanguage             = "en"
+	geoIPDatabaseTypeCityIndicator = "City"
+	geoIPDatabaseTypeASNIndicator  = "ASN"
+)
+
+// GeoIPConfig represents the configuration of the geoip stage.
+type GeoIPConfig struct {
+	DB     string  `river:"db,attr"`
+	Source *string `river:"source,attr"`
+	DBType string  `river:"db_type,attr,optional"`
+}
+
+// validateGeoIPConfig validates the GeoIPConfig for the geoip stage.
+func validateGeoIPConfig(c *GeoIPConfig) error {
+	if c == nil {
+		return errors.New(ErrGeoIPStageEmptyConfig)
+	}
+	if c.DB == "" {
+		return errors.New(ErrGeoIPStageEmptyDB)
+	}
+	if c.Source == nil || *c.Source == "" {
+		return errors.New(ErrGeoIPStageEmptySource)
+	}
+	switch c.DBType {
+	case "", GeoIPDBTypeCity, GeoIPDBTypeASN:
+	default:
+		return errors.New(ErrGeoIPStageInvalidDBType)
+	}
+	return nil
+}
+
+// newGeoIPStage creates a geoip stage which enriches entries with the
+// location or autonomous system of the IP address found in the extracted
+// data.
+func newGeoIPStage(logger log.Logger, config *GeoIPConfig) (Stage, error) {
+	err := validateGeoIPConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := geoip2.Open(config.DB)
+	if err != nil {
+		return nil, fmt.Errorf(ErrGeoIPStageOpenDB, err)
+	}
+
+	// Fall back to the type recorded in the database metadata, e.g.
+	// GeoLite2-City or GeoLite2-ASN, when no type is configured.
+	dbType := config.DBType
+	if dbType == "" {
+		switch t := db.Metadata().DatabaseType; {
+		case strings.Contains(t, geoIPDatabaseTypeCityIndicator):
+			dbType = GeoIPDBTypeCity
+		case strings.Contains(t, geoIPDatabaseTypeASNIndicator):
+			dbType = GeoIPDBTypeASN
+		default:
+			_ = db.Close()
+			return nil, fmt.Errorf(ErrGeoIPStageUnknownDBType, t)
+		}
+	}
+
+	return toStage(&geoIPStage{
+		db:     db,
+		logger: log.With(logger, "component", "stage", "type", "geoip"),
+		source: *config.Source,
+		dbType: dbType,
+	}), nil
+}
+
+// geoIPStage looks up IP addresses in a local MaxMind database.
+type geoIPStage struct {
+	logger log.Logger
+	db     *geoip2.Reader
+	source string
+	dbType string
+}
+
+// Process implements Processor.
+func (g *geoIPStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	value, ok := extracted[g.source]
+	if !ok {
+		if Debug {
+			level.Debug(g.logger).Log("msg", "source does not exist in the extracted data", "source", g.source)
+		}
+		return
+	}
+	s, err := getString(value)
+	if err != nil {
+		if Debug {
+			level.Debug(g.logger).Log("msg", "failed to convert source value to string", "source", g.source, "err", err, "type", reflect.TypeOf(value))
+		}
+		return
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		level.Error(g.logger).Log("msg", "source is not an ip", "source", g.source, "value", s)
+		return
+	}
+
+	switch g.dbType {
+	case GeoIPDBTypeCity:
+		record, err := g.db.City(ip)
+		if err != nil {
+			level.Error(g.logger).Log("msg", "unable to get city record for the ip", "err", err, "ip", ip)
+			return
+		}
+		g.populateCity(extracted, record)
+	case GeoIPDBTypeASN:
+		record, err := g.db.ASN(ip)
+		if err != nil {
+			level.Error(g.logger).Log("msg", "unable to get asn record for the ip", "err", err, "ip", ip)
+			return
+		}
+		g.populateASN(extracted, record)
+	}
+}
+
+// Name implements Processor.
+func (g *geoIPStage) Name() string {
+	return StageTypeGeoIP
+}
+
+// Cleanup implements cleaner, closing the database.
+func (g *geoIPStage) Cleanup() {
+	if err := g.db.Close(); err != nil {
+		level.Error(g.logger).Log("msg", "error while closing geoip database", "err", err)
+	}
+}
+
+// populateCity adds the non-empty fields of a city record to the extracted
+// data.
+func (g *geoIPStage) populateCity(extracted map[string]interface{}, record *geoip2.City) {
+	setNonEmpty(extracted, fieldGeoIPCityName, record.City.Names[geoIPNamesLanguage])
+	setNonEmpty(extracted, fieldGeoIPCountryName, record.Country.Names[geoIPNamesLanguage])
+	setNonEmpty(extracted, fieldGeoIPCountryCode, record.Country.IsoCode)
+	setNonEmpty(extracted, fieldGeoIPContinentName, record.Continent.Names[geoIPNamesLanguage])
+	setNonEmpty(extracted, fieldGeoIPContinentCode, record.Continent.Code)
+	setNonEmpty(extracted, fieldGeoIPPostalCode, record.Postal.Code)
+	setNonEmpty(extracted, fieldGeoIPTimezone, record.Location.TimeZone)
+
+	// A zero coordinate pair means the record has no location.
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		extracted[fieldGeoIPLocationLatitude] = record.Location.Latitude
+		extracted[fieldGeoIPLocationLongitude] = record.Location.Longitude
+	}
+
+	// Only the most specific subdivision is kept.
+	if n := len(record.Subdivisions); n > 0 {
+		subdivision := record.Subdivisions[n-1]
+		setNonEmpty(extracted, fieldGeoIPSubdivisionName, subdivision.Names[geoIPNamesLanguage])
+		setNonEmpty(extracted, fieldGeoIPSubdivisionCode, subdivision.IsoCode)
+	}
+}
+
+// populateASN adds the non-empty fields of an ASN record to the extracted
+// data.
+func (g *geoIPStage) populateASN(extracted map[string]interface{}, record *geoip2.ASN) {
+	if record.AutonomousSystemNumber != 0 {
+		extracted[fieldGeoIPAutonomousSystemNum] = strconv.FormatUint(uint64(record.AutonomousSystemNumber), 10)
+	}
+	setNonEmpty(extracted, fieldGeoIPAutonomousSystemOrg, record.AutonomousSystemOrganization)
+}
+
+// setNonEmpty sets key to value in the extracted data, unless value is empty.
+func setNonEmpty(extracted map[string]interface{}, key, value string) {
+	if value != "" {
+		extracted[key] = value
+	}
+}
@@ -0,0 +1,333 @@
+package stages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testGeoIPCityRecord = map[string]interface{}{
+	"city": map[string]interface{}{
+		"names": map[string]interface{}{"en": "Boston"},
+	},
+	"continent": map[string]interface{}{
+		"code":  "NA",
+		"names": map[string]interface{}{"en": "North America"},
+	},
+	"country": map[string]interface{}{
+		"iso_code": "US",
+		"names":    map[string]interface{}{"en": "United States"},
+	},
+	"location": map[string]interface{}{
+		"latitude":  42.3601,
+		"longitude": -71.0589,
+		"time_zone": "America/New_York",
+	},
+	"postal": map[string]interface{}{
+		"code": "02108",
+	},
+	"subdivisions": []interface{}{
+		map[string]interface{}{
+			"iso_code": "MA",
+			"names":    map[string]interface{}{"en": "Massachusetts"},
+		},
+	},
+}
+
+var testGeoIPASNRecord = map[string]interface{}{
+	"autonomous_system_number":       uint32(64512),
+	"autonomous_system_organization": "Example Networks",
+}
+
+func TestGeoIPConfig_validate(t *testing.T) {
+	source := "ip"
+	empty := ""
+	tests := map[string]struct {
+		config *GeoIPConfig
+		err    error
+	}{
+		"nil config": {
+			config: nil,
+			err:    errors.New(ErrGeoIPStageEmptyConfig),
+		},
+		"missing db": {
+			config: &GeoIPConfig{Source: &source},
+			err:    errors.New(ErrGeoIPStageEmptyDB),
+		},
+		"missing source": {
+			config: &GeoIPConfig{DB: "test.mmdb"},
+			err:    errors.New(ErrGeoIPStageEmptySource),
+		},
+		"empty source": {
+			config: &GeoIPConfig{DB: "test.mmdb", Source: &empty},
+			err:    errors.New(ErrGeoIPStageEmptySource),
+		},
+		"invalid db type": {
+			config: &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: "isp"},
+			err:    errors.New(ErrGeoIPStageInvalidDBType),
+		},
+		"valid city": {
+			config: &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: GeoIPDBTypeCity},
+		},
+		"valid without db type": {
+			config: &GeoIPConfig{DB: "test.mmdb", Source: &source},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := validateGeoIPConfig(tt.config)
+			if tt.err != nil {
+				require.EqualError(t, err, tt.err.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGeoIPStage_City(t *testing.T) {
+	db := writeTestMMDB(t, "GeoLite2-City", map[string]map[string]interface{}{
+		"1.2.3.0/24": testGeoIPCityRecord,
+	})
+
+	pl, err := NewPipeline(util_log.Logger, loadConfig(fmt.Sprintf(`
+stage {
+  regex {
+    expression = "^(?P<ip>\\S+) .*"
+  }
+}
+
+stage {
+  geoip {
+    db     = %q
+    source = "ip"
+  }
+}`, db)), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	defer pl.Cleanup()
+
+	out := processEntries(pl,
+		newEntry(nil, model.LabelSet{}, "1.2.3.4 GET /", time.Now()),
+		newEntry(nil, model.LabelSet{}, "5.6.7.8 GET /", time.Now()),
+		newEntry(nil, model.LabelSet{}, "localhost GET /", time.Now()),
+	)
+	require.Len(t, out, 3)
+
+	assert.Equal(t, map[string]interface{}{
+		"ip":                       "1.2.3.4",
+		"geoip_city_name":          "Boston",
+		"geoip_country_name":       "United States",
+		"geoip_country_code":       "US",
+		"geoip_continent_name":     "North America",
+		"geoip_continent_code":     "NA",
+		"geoip_location_latitude":  42.3601,
+		"geoip_location_longitude": -71.0589,
+		"geoip_postal_code":        "02108",
+		"geoip_timezone":           "America/New_York",
+		"geoip_subdivision_name":   "Massachusetts",
+		"geoip_subdivision_code":   "MA",
+	}, out[0].Extracted)
+
+	// Addresses which aren't in the database or aren't addresses at all are
+	// left untouched.
+	assert.Equal(t, map[string]interface{}{"ip": "5.6.7.8"}, out[1].Extracted)
+	assert.Equal(t, map[string]interface{}{"ip": "localhost"}, out[2].Extracted)
+}
+
+func TestGeoIPStage_ASN(t *testing.T) {
+	db := writeTestMMDB(t, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"10.0.0.0/8": testGeoIPASNRecord,
+	})
+
+	source := "ip"
+	for _, dbType := range []string{"", GeoIPDBTypeASN} {
+		s, err := newGeoIPStage(util_log.Logger, &GeoIPConfig{DB: db, Source: &source, DBType: dbType})
+		require.NoError(t, err)
+
+		out := processEntries(s, newEntry(map[string]interface{}{"ip": "10.1.2.3"}, model.LabelSet{}, "", time.Now()))
+		require.Len(t, out, 1)
+		assert.Equal(t, map[string]interface{}{
+			"ip":                                   "10.1.2.3",
+			"geoip_autonomous_system_number":       "64512",
+			"geoip_autonomous_system_organization": "Example Networks",
+		}, out[0].Extracted)
+
+		s.(cleaner).Cleanup()
+	}
+}
+
+func TestGeoIPStage_Errors(t *testing.T) {
+	source := "ip"
+
+	_, err := newGeoIPStage(util_log.Logger, &GeoIPConfig{DB: filepath.Join(t.TempDir(), "missing.mmdb"), Source: &source})
+	require.ErrorContains(t, err, "geoip stage failed to open the database")
+
+	db := writeTestMMDB(t, "GeoIP2-Domain", map[string]map[string]interface{}{
+		"10.0.0.0/8": {"domain": "example.com"},
+	})
+	_, err = newGeoIPStage(util_log.Logger, &GeoIPConfig{DB: db, Source: &source})
+	require.EqualError(t, err, fmt.Sprintf(ErrGeoIPStageUnknownDBType, "GeoIP2-Domain"))
+}
+
+// writeTestMMDB writes an IPv4 MaxMind DB file of the given database type
+// holding the given records, keyed by network, and returns its path.
+func writeTestMMDB(t *testing.T, dbType string, records map[string]map[string]interface{}) string {
+	t.Helper()
+
+	const (
+		emptyRecord = -1
+		dataRecord  = -2 // Data records are stored as dataRecord - index.
+	)
+
+	var (
+		nodes   = [][2]int{{emptyRecord, emptyRecord}}
+		data    bytes.Buffer
+		offsets []int
+	)
+
+	networks := make([]string, 0, len(records))
+	for network := range records {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	for i, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		require.NoError(t, err)
+		ip := ipNet.IP.To4()
+		require.NotNil(t, ip, "only IPv4 networks are supported")
+		ones, _ := ipNet.Mask.Size()
+
+		offsets = append(offsets, data.Len())
+		encodeMMDBValue(t, &data, records[network])
+
+		node := 0
+		for bit := 0; bit < ones; bit++ {
+			b := (ip[bit/8] >> (7 - bit%8)) & 1
+			if bit == ones-1 {
+				nodes[node][b] = dataRecord - i
+				break
+			}
+			if nodes[node][b] == emptyRecord {
+				nodes = append(nodes, [2]int{emptyRecord, emptyRecord})
+				nodes[node][b] = len(nodes) - 1
+			}
+			node = nodes[node][b]
+		}
+	}
+
+	// The search tree uses 24 bit records. Empty records point right past the
+	// last node, data records point into the data section which follows the
+	// tree and a 16 byte separator.
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, record := range node {
+			var value int
+			switch {
+			case record == emptyRecord:
+				value = len(nodes)
+			case record <= dataRecord:
+				value = len(nodes) + 16 + offsets[dataRecord-record]
+			default:
+				value = record
+			}
+			buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDBValue(t, &buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(0),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	return path
+}
+
+// encodeMMDBValue writes v to buf using the MaxMind DB data section format.
+func encodeMMDBValue(t *testing.T, buf *bytes.Buffer, v interface{}) {
+	t.Helper()
+
+	switch v := v.(type) {
+	case string:
+		writeMMDBControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		writeMMDBControl(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		writeMMDBControl(buf, 5, 2)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		writeMMDBControl(buf, 6, 4)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint64:
+		writeMMDBControl(buf, 9, 8)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		writeMMDBControl(buf, 7, len(v))
+		for _, k := range keys {
+			encodeMMDBValue(t, buf, k)
+			encodeMMDBValue(t, buf, v[k])
+		}
+	case []interface{}:
+		writeMMDBControl(buf, 11, len(v))
+		for _, e := range v {
+			encodeMMDBValue(t, buf, e)
+		}
+	default:
+		t.Fatalf("unsupported MaxMind DB value type %T", v)
+	}
+}
+
+// writeMMDBControl writes the control byte introducing a value of the given
+// type and size. Sizes above 284 aren't needed by the tests.
+func writeMMDBControl(buf *bytes.Buffer, typ, size int) {
+	var extra []byte
+	if size >= 29 {
+		extra = []byte{byte(size - 29)}
+		size = 29
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		// Extended types store their type in the byte following the control
+		// byte.
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(extra)
+}
@@ -0,0 +1,64 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// ErrEmptyLabelAllowStageConfig error returned if config is empty
+	ErrEmptyLabelAllowStageConfig = "labelallow stage config cannot be empty"
+)
+
+// LabelAllowConfig contains the slice of labels to allow through.
+type LabelAllowConfig struct {
+	Values []string `river:"values,attr"`
+}
+
+func validateLabelAllowConfig(c LabelAllowConfig) error {
+	if len(c.Values) < 1 {
+		return errors.New(ErrEmptyLabelAllowStageConfig)
+	}
+
+	return nil
+}
+
+func newLabelAllowStage(config LabelAllowConfig) (Stage, error) {
+	err := validateLabelAllowConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	labelMap := make(map[string]struct{})
+	for _, label := range config.Values {
+		labelMap[label] = struct{}{}
+	}
+
+	return toStage(&labelAllowStage{
+		labels: labelMap,
+	}), nil
+}
+
+type labelAllowStage struct {
+	labels map[string]struct{}
+}
+
+// Process implements Stage
+func (l *labelAllowStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	for label := range labels {
+		if _, ok := l.labels[string(label)]; !ok {
+			delete(labels, label)
+		}
+	}
+}
+
+// Name implements Stage
+func (l *labelAllowStage) Name() string {
+	return StageTypeLabelAllow
+}
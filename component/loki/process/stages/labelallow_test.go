@@ -0,0 +1,105 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+func Test_addLabelStage_Process(t *testing.T) {
+	Debug = true
+
+	tests := []struct {
+		name           string
+		config         LabelAllowConfig
+		inputLabels    model.LabelSet
+		expectedLabels model.LabelSet
+	}{
+		{
+			name:   "allow single label",
+			config: LabelAllowConfig{Values: []string{"testLabel1"}},
+			inputLabels: model.LabelSet{
+				"testLabel1": "testValue",
+				"testLabel2": "testValue",
+			},
+			expectedLabels: model.LabelSet{
+				"testLabel1": "testValue",
+			},
+		},
+		{
+			name:   "allow multiple labels",
+			config: LabelAllowConfig{Values: []string{"testLabel1", "testLabel2"}},
+			inputLabels: model.LabelSet{
+				"testLabel1": "testValue",
+				"testLabel2": "testValue",
+				"testLabel3": "testValue",
+			},
+			expectedLabels: model.LabelSet{
+				"testLabel1": "testValue",
+				"testLabel2": "testValue",
+			},
+		},
+		{
+			name:   "allow non-existing label",
+			config: LabelAllowConfig{Values: []string{"foobar"}},
+			inputLabels: model.LabelSet{
+				"testLabel1": "testValue",
+				"testLabel2": "testValue",
+			},
+			expectedLabels: model.LabelSet{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st, err := newLabelAllowStage(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := processEntries(st, newEntry(nil, test.inputLabels, "", time.Now()))[0]
+			assert.Equal(t, test.expectedLabels, out.Labels)
+		})
+	}
+}
+
+func TestLabelAllowDropPipeline(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage {
+  labelallow {
+    values = ["app", "env", "pod"]
+  }
+}
+
+stage {
+  labeldrop {
+    values = ["pod"]
+  }
+}`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	out := processEntries(pl, newEntry(nil, model.LabelSet{
+		"app":      "loki",
+		"env":      "prod",
+		"pod":      "loki-0",
+		"filename": "/var/log/pods/loki-0/loki/0.log",
+	}, "", time.Now()))[0]
+	assert.Equal(t, model.LabelSet{"app": "loki", "env": "prod"}, out.Labels)
+}
+
+func TestLabelAllowConfig_validate(t *testing.T) {
+	_, err := New(util_log.Logger, nil, StageConfig{LabelAllowConfig: &LabelAllowConfig{}}, prometheus.NewRegistry())
+	require.EqualError(t, err, ErrEmptyLabelAllowStageConfig)
+
+	_, err = New(util_log.Logger, nil, StageConfig{LabelDropConfig: &LabelDropConfig{}}, prometheus.NewRegistry())
+	require.EqualError(t, err, ErrEmptyLabelDropStageConfig)
+}
@@ -0,0 +1,172 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"golang.org/x/time/rate"
+)
+
+// Configuration errors.
+const (
+	ErrLimitStageInvalidRateOrBurst = "limit stage failed to parse rate or burst"
+)
+
+// MinReasonableMaxDistinctLabels is the minimum number of distinct streams or
+// label values the limit stage keeps a rate limiter for.
+const MinReasonableMaxDistinctLabels = 10000
+
+var ratelimitDropReason = "ratelimit_drop_stage"
+
+// LimitConfig sets up a Limit stage.
+type LimitConfig struct {
+	Rate              float64 `river:"rate,attr"`
+	Burst             int     `river:"burst,attr"`
+	Drop              bool    `river:"drop,attr,optional"`
+	ByLabelName       string  `river:"by_label_name,attr,optional"`
+	MaxDistinctLabels int     `river:"max_distinct_labels,attr,optional"`
+}
+
+func newLimitStage(logger log.Logger, cfg *LimitConfig, registerer prometheus.Registerer) (Stage, error) {
+	err := validateLimitConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = log.With(logger, "component", "stage", "type", "limit")
+	if cfg.MaxDistinctLabels < MinReasonableMaxDistinctLabels {
+		if cfg.MaxDistinctLabels != 0 {
+			level.Warn(logger).Log(
+				"msg",
+				fmt.Sprintf("max_distinct_labels was adjusted up to the minimal reasonable value of %d", MinReasonableMaxDistinctLabels),
+			)
+		}
+		cfg.MaxDistinctLabels = MinReasonableMaxDistinctLabels
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &limitStage{
+		logger:    logger,
+		cfg:       cfg,
+		dropCount: getDropCountMetric(registerer),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	r.rateLimiters, err = lru.New(cfg.MaxDistinctLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ByLabelName != "" {
+		r.byLabelName = model.LabelName(cfg.ByLabelName)
+		r.dropCountByLabel = getDropCountByLabelMetric(registerer)
+	}
+	return r, nil
+}
+
+func validateLimitConfig(cfg *LimitConfig) error {
+	if cfg.Rate <= 0 || cfg.Burst <= 0 {
+		return errors.New(ErrLimitStageInvalidRateOrBurst)
+	}
+	return nil
+}
+
+// limitStage applies a rate limit to log entries, separately for each stream
+// passing through the stage or for each value of a label.
+type limitStage struct {
+	logger    log.Logger
+	cfg       *LimitConfig
+	dropCount *prometheus.CounterVec
+
+	// rateLimiters holds the rate limiter of each stream, keyed by the
+	// fingerprint of its labels, or of each value of byLabelName when it's
+	// set. The least recently used limiters are evicted once more than
+	// cfg.MaxDistinctLabels are tracked.
+	rateLimiters *lru.Cache // map[model.Fingerprint|model.LabelValue]*rate.Limiter
+
+	byLabelName      model.LabelName
+	dropCountByLabel *prometheus.CounterVec
+
+	// ctx is canceled once the pipeline stops, to stop waiting for the rate
+	// limiters.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (m *limitStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+		for e := range in {
+			if !m.shouldThrottle(e.Labels) {
+				out <- e
+				continue
+			}
+		}
+	}()
+	return out
+}
+
+// shouldThrottle reports whether an entry with the given labels must be
+// dropped. When drop isn't set, it waits for the rate limiter of the entry
+// instead, and only returns true if the stage was stopped while waiting.
+func (m *limitStage) shouldThrottle(labels model.LabelSet) bool {
+	var key interface{}
+	if m.byLabelName != "" {
+		labelValue, ok := labels[m.byLabelName]
+		if !ok {
+			// Entries without the label aren't rate limited.
+			return false
+		}
+		key = labelValue
+	} else {
+		key = labels.Fingerprint()
+	}
+
+	rl := m.getRateLimiter(key)
+	if rl.Allow() {
+		return false
+	}
+	if !m.cfg.Drop {
+		if err := rl.Wait(m.ctx); err == nil {
+			return false
+		}
+		level.Debug(m.logger).Log("msg", "dropping entry waiting for the rate limiter as the pipeline is stopping")
+	}
+
+	m.dropCount.WithLabelValues(ratelimitDropReason).Inc()
+	if m.byLabelName != "" {
+		m.dropCountByLabel.WithLabelValues(m.cfg.ByLabelName, string(key.(model.LabelValue))).Inc()
+	}
+	return true
+}
+
+func (m *limitStage) getRateLimiter(key interface{}) *rate.Limiter {
+	if v, found := m.rateLimiters.Get(key); found {
+		return v.(*rate.Limiter)
+	}
+	rl := rate.NewLimiter(rate.Limit(m.cfg.Rate), m.cfg.Burst)
+	m.rateLimiters.Add(key, rl)
+	return rl
+}
+
+// Stop implements stopper, dropping the entry waiting for its rate limiter,
+// if any, and the entries which would have to wait after it.
+func (m *limitStage) Stop() {
+	m.cancel()
+}
+
+// Name implements Stage
+func (m *limitStage) Name() string {
+	return StageTypeLimit
+}
@@ -0,0 +1,231 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testLimitWaitRiver = `
+stage {
+  json {
+    expressions = { "app" = "", "msg" = "" }
+  }
+}
+
+stage {
+  limit {
+    rate  = 1
+    burst = 1
+    drop  = false
+  }
+}
+`
+
+var testLimitDropRiver = `
+stage {
+  json {
+    expressions = { "app" = "", "msg" = "" }
+  }
+}
+
+stage {
+  limit {
+    rate  = 1
+    burst = 1
+    drop  = true
+  }
+}
+`
+
+var testLimitByLabelRiver = `
+stage {
+  json {
+    expressions = { "app" = "", "msg" = "" }
+  }
+}
+
+stage {
+  limit {
+    rate          = 1
+    burst         = 1
+    drop          = true
+    by_label_name = "app"
+  }
+}
+`
+
+// TestLimitPipeline is used to verify we properly parse the River config and create a working pipeline
+func TestLimitWaitPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	plName := "testPipeline"
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testLimitWaitRiver), &plName, registry)
+	logs := make([]Entry, 0)
+	logCount := 5
+	for i := 0; i < logCount; i++ {
+		logs = append(logs, newEntry(nil, model.LabelSet{"app": "loki"}, testMatchLogLineApp1, time.Now()))
+	}
+	require.NoError(t, err)
+	out := processEntries(pl,
+		logs...,
+	)
+	// Only the second line will go through.
+	assert.Len(t, out, logCount)
+	assert.Equal(t, out[0].Line, testMatchLogLineApp1)
+}
+
+// TestLimitPipeline is used to verify we properly parse the River config and create a working pipeline
+func TestLimitDropPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	plName := "testPipeline"
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testLimitDropRiver), &plName, registry)
+	logs := make([]Entry, 0)
+	logCount := 10
+	for i := 0; i < logCount; i++ {
+		logs = append(logs, newEntry(nil, model.LabelSet{"app": "loki"}, testMatchLogLineApp1, time.Now()))
+	}
+	require.NoError(t, err)
+	out := processEntries(pl,
+		logs...,
+	)
+	// Only the second line will go through.
+	assert.Len(t, out, 1)
+	assert.Equal(t, out[0].Line, testMatchLogLineApp1)
+}
+
+// TestLimitByLabelPipeline is used to verify that entries are rate limited
+// separately for each value of the configured label.
+func TestLimitByLabelPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	plName := "testPipeline"
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testLimitByLabelRiver), &plName, registry)
+	require.NoError(t, err)
+
+	logs := make([]Entry, 0)
+	logCount := 5
+	for i := 0; i < logCount; i++ {
+		logs = append(logs, newEntry(nil, model.LabelSet{"app": "loki"}, testMatchLogLineApp1, time.Now()))
+		logs = append(logs, newEntry(nil, model.LabelSet{"app": "poki"}, testMatchLogLineApp2, time.Now()))
+		logs = append(logs, newEntry(nil, model.LabelSet{"other": "label"}, testMatchLogLineApp2, time.Now()))
+	}
+	out := processEntries(pl, logs...)
+
+	// One line for each value of the app label goes through, and all the
+	// lines without the label are kept.
+	assert.Len(t, out, 2+logCount)
+	assert.Equal(t, 8.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(ratelimitDropReason)))
+	assert.Equal(t, 4.0, testutil.ToFloat64(getDropCountByLabelMetric(registry).WithLabelValues("app", "loki")))
+}
+
+// TestLimitPerStream verifies that a noisy stream doesn't use up the rate limit
+// of other streams, whether entries are dropped or waited for.
+func TestLimitPerStream(t *testing.T) {
+	var (
+		noisy = model.LabelSet{"app": "loki", "pod": "noisy"}
+		quiet = model.LabelSet{"app": "loki", "pod": "quiet"}
+	)
+
+	t.Run("drop", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		plName := "testPipeline"
+		pl, err := NewPipeline(util_log.Logger, loadConfig(testLimitDropRiver), &plName, registry)
+		require.NoError(t, err)
+
+		logs := make([]Entry, 0)
+		for i := 0; i < 10; i++ {
+			logs = append(logs, newEntry(nil, noisy, testMatchLogLineApp1, time.Now()))
+		}
+		logs = append(logs, newEntry(nil, quiet, testMatchLogLineApp2, time.Now()))
+		out := processEntries(pl, logs...)
+
+		// The first line of each stream goes through.
+		require.Len(t, out, 2)
+		assert.Equal(t, noisy, out[0].Labels)
+		assert.Equal(t, quiet, out[1].Labels)
+		assert.Equal(t, 9.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(ratelimitDropReason)))
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		s, err := newLimitStage(util_log.Logger, &LimitConfig{Rate: 0.1, Burst: 1}, prometheus.NewRegistry())
+		require.NoError(t, err)
+		ls := s.(*limitStage)
+
+		// Use up the burst of the noisy stream, whose next entry would wait
+		// for 10 seconds.
+		require.False(t, ls.shouldThrottle(noisy))
+
+		start := time.Now()
+		require.False(t, ls.shouldThrottle(quiet))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+// TestLimitWaitStop verifies that stopping the pipeline doesn't wait for the
+// rate limiter, dropping the entries waiting for it instead.
+func TestLimitWaitStop(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	s, err := newLimitStage(util_log.Logger, &LimitConfig{Rate: 0.01, Burst: 1}, registry)
+	require.NoError(t, err)
+	ls := s.(*limitStage)
+
+	// Use up the burst, so that the next entry waits for 100 seconds.
+	labels := model.LabelSet{"app": "loki"}
+	require.False(t, ls.shouldThrottle(labels))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ls.Stop()
+	}()
+
+	start := time.Now()
+	require.True(t, ls.shouldThrottle(labels))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(ratelimitDropReason)))
+}
+
+func TestLimitConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		config *LimitConfig
+		err    error
+	}{
+		"invalid rate": {
+			&LimitConfig{Rate: 0, Burst: 1},
+			errors.New(ErrLimitStageInvalidRateOrBurst),
+		},
+		"invalid burst": {
+			&LimitConfig{Rate: 1, Burst: 0},
+			errors.New(ErrLimitStageInvalidRateOrBurst),
+		},
+		"by label without drop": {
+			&LimitConfig{Rate: 1, Burst: 1, ByLabelName: "app"},
+			nil,
+		},
+		"valid": {
+			&LimitConfig{Rate: 1, Burst: 1, Drop: true, ByLabelName: "app"},
+			nil,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := validateLimitConfig(tt.config)
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
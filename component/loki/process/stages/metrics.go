@@ -0,0 +1,357 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/loki/process/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultMetricsPrefix = "loki_process_custom_"
+	defaultMaxIdle       = 5 * time.Minute
+)
+
+// Configuration errors.
+const (
+	ErrEmptyMetricsStageConfig = "empty metric stage configuration"
+	ErrMetricsStageDuplicate   = "metric %q is defined more than once"
+	ErrSubSecIdleDur           = "max_idle_duration less than 1s not allowed"
+)
+
+// MetricsConfig is a set of configured metrics.
+type MetricsConfig struct {
+	Counters   []metric.CounterConfig   `river:"metric.counter,block,optional"`
+	Gauges     []metric.GaugeConfig     `river:"metric.gauge,block,optional"`
+	Histograms []metric.HistogramConfig `river:"metric.histogram,block,optional"`
+}
+
+// setMetricDefaults fills in the source, prefix and max idle duration of a
+// metric if they were left unset.
+func setMetricDefaults(name string, source, prefix *string, maxIdle *time.Duration) error {
+	if *source == "" {
+		*source = name
+	}
+	if *prefix == "" {
+		*prefix = defaultMetricsPrefix
+	}
+	if *maxIdle == 0 {
+		*maxIdle = defaultMaxIdle
+	} else if *maxIdle < time.Second {
+		return errors.New(ErrSubSecIdleDur)
+	}
+	return nil
+}
+
+// newMetricStage creates a new set of metrics to process for each log entry
+func newMetricStage(logger log.Logger, config *MetricsConfig, registerer prometheus.Registerer) (Stage, error) {
+	if len(config.Counters)+len(config.Gauges)+len(config.Histograms) == 0 {
+		return nil, errors.New(ErrEmptyMetricsStageConfig)
+	}
+
+	metrics := map[string]cfgCollector{}
+	addMetric := func(name, source string, collector prometheus.Collector) error {
+		if _, ok := metrics[name]; ok {
+			return fmt.Errorf(ErrMetricsStageDuplicate, name)
+		}
+		metrics[name] = cfgCollector{source: source, collector: collector}
+		return nil
+	}
+
+	for _, cfg := range config.Counters {
+		cfg := cfg
+		if err := setMetricDefaults(cfg.Name, &cfg.Source, &cfg.Prefix, &cfg.MaxIdle); err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		name := cfg.Prefix + cfg.Name
+		collector, err := metric.NewCounters(name, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		if err := addMetric(name, cfg.Source, collector); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range config.Gauges {
+		cfg := cfg
+		if err := setMetricDefaults(cfg.Name, &cfg.Source, &cfg.Prefix, &cfg.MaxIdle); err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		name := cfg.Prefix + cfg.Name
+		collector, err := metric.NewGauges(name, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		if err := addMetric(name, cfg.Source, collector); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range config.Histograms {
+		cfg := cfg
+		if err := setMetricDefaults(cfg.Name, &cfg.Source, &cfg.Prefix, &cfg.MaxIdle); err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		name := cfg.Prefix + cfg.Name
+		collector, err := metric.NewHistograms(name, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("metric %q: %w", cfg.Name, err)
+		}
+		if err := addMetric(name, cfg.Source, collector); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range metrics {
+		if err := registerer.Register(m.collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return toStage(&metricStage{
+		logger:     logger,
+		registerer: registerer,
+		metrics:    metrics,
+	}), nil
+}
+
+// cfgCollector is a metric along with the extracted key it is fed from.
+type cfgCollector struct {
+	source    string
+	collector prometheus.Collector
+}
+
+// metricStage creates and updates prometheus metrics based on extracted pipeline data
+type metricStage struct {
+	logger     log.Logger
+	registerer prometheus.Registerer
+	metrics    map[string]cfgCollector
+}
+
+// Process implements Processor
+func (m *metricStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	for name, cc := range m.metrics {
+		// There is a special case for counters where we count even if there is no match in the extracted map.
+		if c, ok := cc.collector.(*metric.Counters); ok {
+			if c != nil && c.Cfg.MatchAll {
+				if c.Cfg.CountEntryBytes {
+					if entry != nil {
+						m.recordCounter(name, c, labels, len(*entry))
+					}
+				} else {
+					m.recordCounter(name, c, labels, nil)
+				}
+				continue
+			}
+		}
+		if v, ok := extracted[cc.source]; ok {
+			switch vec := cc.collector.(type) {
+			case *metric.Counters:
+				m.recordCounter(name, vec, labels, v)
+			case *metric.Gauges:
+				m.recordGauge(name, vec, labels, v)
+			case *metric.Histograms:
+				m.recordHistogram(name, vec, labels, v)
+			}
+		} else {
+			level.Debug(m.logger).Log("msg", "source does not exist", "err", fmt.Sprintf("source: %s, does not exist", cc.source))
+		}
+	}
+}
+
+// Name implements Processor
+func (m *metricStage) Name() string {
+	return StageTypeMetric
+}
+
+// Cleanup implements cleaner. It unregisters the stage's metrics and removes
+// all of their series. As the collectors are unchecked, only registerers that
+// track collectors by identity, such as the per-pipeline registry of
+// loki.process, are able to unregister them.
+func (m *metricStage) Cleanup() {
+	for _, cc := range m.metrics {
+		m.registerer.Unregister(cc.collector)
+		switch vec := cc.collector.(type) {
+		case *metric.Counters:
+			vec.DeleteAll()
+		case *metric.Gauges:
+			vec.DeleteAll()
+		case *metric.Histograms:
+			vec.DeleteAll()
+		}
+	}
+}
+
+// recordCounter will update a counter metric
+func (m *metricStage) recordCounter(name string, counter *metric.Counters, labels model.LabelSet, v interface{}) {
+	// If value matching is defined, make sure value matches.
+	if counter.Cfg.Value != "" {
+		stringVal, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to string, "+
+					"can't perform value comparison", "metric", name, "err",
+					fmt.Sprintf("can't convert %v to string", reflect.TypeOf(v)))
+			}
+			return
+		}
+		if counter.Cfg.Value != stringVal {
+			return
+		}
+	}
+
+	switch counter.Cfg.Action {
+	case metric.CounterInc:
+		counter.With(labels).Inc()
+	case metric.CounterAdd:
+		f, err := getFloat(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to positive float", "metric", name, "err", err)
+			}
+			return
+		}
+		counter.With(labels).Add(f)
+	}
+}
+
+// recordGauge will update a gauge metric
+func (m *metricStage) recordGauge(name string, gauge *metric.Gauges, labels model.LabelSet, v interface{}) {
+	// If value matching is defined, make sure value matches.
+	if gauge.Cfg.Value != "" {
+		stringVal, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to string, "+
+					"can't perform value comparison", "metric", name, "err",
+					fmt.Sprintf("can't convert %v to string", reflect.TypeOf(v)))
+			}
+			return
+		}
+		if gauge.Cfg.Value != stringVal {
+			return
+		}
+	}
+
+	switch gauge.Cfg.Action {
+	case metric.GaugeSet:
+		f, err := getFloat(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to positive float", "metric", name, "err", err)
+			}
+			return
+		}
+		gauge.With(labels).Set(f)
+	case metric.GaugeInc:
+		gauge.With(labels).Inc()
+	case metric.GaugeDec:
+		gauge.With(labels).Dec()
+	case metric.GaugeAdd:
+		f, err := getFloat(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to positive float", "metric", name, "err", err)
+			}
+			return
+		}
+		gauge.With(labels).Add(f)
+	case metric.GaugeSub:
+		f, err := getFloat(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to positive float", "metric", name, "err", err)
+			}
+			return
+		}
+		gauge.With(labels).Sub(f)
+	}
+}
+
+// recordHistogram will update a Histogram metric
+func (m *metricStage) recordHistogram(name string, histogram *metric.Histograms, labels model.LabelSet, v interface{}) {
+	// If value matching is defined, make sure value matches.
+	if histogram.Cfg.Value != "" {
+		stringVal, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to string, "+
+					"can't perform value comparison", "metric", name, "err",
+					fmt.Sprintf("can't convert %v to string", reflect.TypeOf(v)))
+			}
+			return
+		}
+		if histogram.Cfg.Value != stringVal {
+			return
+		}
+	}
+	f, err := getFloat(v)
+	if err != nil {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "failed to convert extracted value to float", "metric", name, "err", err)
+		}
+		return
+	}
+	histogram.With(labels).Observe(f)
+}
+
+// getFloat will take the provided value and return a float64 if possible
+func getFloat(unk interface{}) (float64, error) {
+	switch i := unk.(type) {
+	case float64:
+		return i, nil
+	case float32:
+		return float64(i), nil
+	case int64:
+		return float64(i), nil
+	case int32:
+		return float64(i), nil
+	case int:
+		return float64(i), nil
+	case uint64:
+		return float64(i), nil
+	case uint32:
+		return float64(i), nil
+	case uint:
+		return float64(i), nil
+	case string:
+		return getFloatFromString(i)
+	case bool:
+		if i {
+			return float64(1), nil
+		}
+		return float64(0), nil
+	default:
+		return math.NaN(), fmt.Errorf("can't convert %v to float64", unk)
+	}
+}
+
+// getFloatFromString converts string into float64
+// Two types of string formats are supported:
+//   - strings that represent floating point numbers, e.g., "0.804"
+//   - duration format strings, e.g., "0.5ms", "10h".
+//     Valid time units are "ns", "us", "ms", "s", "m", "h".
+//     Values in this format are converted as a floating point number of seconds.
+//     E.g., "0.5ms" is converted to 0.0005
+func getFloatFromString(str string) (float64, error) {
+	dur, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		dur, err := time.ParseDuration(str)
+		if err != nil {
+			return 0, err
+		}
+		return dur.Seconds(), nil
+	}
+	return dur, nil
+}
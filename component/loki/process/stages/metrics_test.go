@@ -0,0 +1,695 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/loki/process/metric"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testMetricRiver = `
+stage {
+  json {
+    expressions = { "app" = "app", "payload" = "payload" }
+  }
+}
+
+stage {
+  metrics {
+    metric.counter {
+      name        = "loki_count"
+      description = "uhhhhhhh"
+      prefix      = "my_agent_custom_"
+      source      = "app"
+      value       = "loki"
+      action      = "inc"
+    }
+    metric.gauge {
+      name        = "bloki_count"
+      description = "blerrrgh"
+      source      = "app"
+      value       = "bloki"
+      action      = "dec"
+    }
+    metric.counter {
+      name        = "total_lines_count"
+      description = "nothing to see here..."
+      match_all   = true
+      action      = "inc"
+    }
+    metric.counter {
+      name              = "total_bytes_count"
+      description       = "nothing to see here..."
+      match_all         = true
+      count_entry_bytes = true
+      action            = "add"
+    }
+    metric.histogram {
+      name        = "payload_size_bytes"
+      description = "grrrragh"
+      source      = "payload"
+      buckets     = [10, 20]
+    }
+  }
+}
+`
+
+var testMetricLogLine1 = `
+{
+	"time":"2012-11-01T22:08:41+00:00",
+	"app":"loki",
+    "payload": 10,
+	"component": ["parser","type"],
+	"level" : "WARN"
+}
+`
+
+var testMetricLogLine2 = `
+{
+	"time":"2012-11-01T22:08:41+00:00",
+	"app":"bloki",
+    "payload": 20,
+	"component": ["parser","type"],
+	"level" : "WARN"
+}
+`
+
+var testMetricLogLineWithMissingKey = `
+{
+	"time":"2012-11-01T22:08:41+00:00",
+	"payload": 20,
+	"component": ["parser","type"],
+	"level" : "WARN"
+}
+`
+
+const expectedMetrics = `# HELP my_agent_custom_loki_count uhhhhhhh
+# TYPE my_agent_custom_loki_count counter
+my_agent_custom_loki_count{test="app"} 1
+# HELP loki_process_custom_bloki_count blerrrgh
+# TYPE loki_process_custom_bloki_count gauge
+loki_process_custom_bloki_count{test="app"} -1
+# HELP loki_process_custom_payload_size_bytes grrrragh
+# TYPE loki_process_custom_payload_size_bytes histogram
+loki_process_custom_payload_size_bytes_bucket{test="app",le="10"} 1
+loki_process_custom_payload_size_bytes_bucket{test="app",le="20"} 2
+loki_process_custom_payload_size_bytes_bucket{test="app",le="+Inf"} 2
+loki_process_custom_payload_size_bytes_sum{test="app"} 30
+loki_process_custom_payload_size_bytes_count{test="app"} 2
+# HELP loki_process_custom_total_bytes_count nothing to see here...
+# TYPE loki_process_custom_total_bytes_count counter
+loki_process_custom_total_bytes_count{test="app"} 255
+# HELP loki_process_custom_total_lines_count nothing to see here...
+# TYPE loki_process_custom_total_lines_count counter
+loki_process_custom_total_lines_count{test="app"} 2
+`
+
+func TestMetricsPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testMetricRiver), nil, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := <-pl.Run(withInboundEntries(newEntry(nil, model.LabelSet{"test": "app"}, testMetricLogLine1, time.Now())))
+	out.Line = testMetricLogLine2
+	<-pl.Run(withInboundEntries(out))
+
+	if err := testutil.GatherAndCompare(registry,
+		strings.NewReader(expectedMetrics)); err != nil {
+		t.Fatalf("mismatch metrics: %v", err)
+	}
+}
+
+func TestNegativeGauge(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	testConfig := `
+stage {
+  regex {
+    expression = "vehicle=(?P<vehicle>\\d+) longitude=(?P<longitude>[-]?\\d+\\.\\d+) latitude=(?P<latitude>\\d+\\.\\d+)"
+  }
+}
+
+stage {
+  labels {
+    values = { vehicle = "" }
+  }
+}
+
+stage {
+  metrics {
+    metric.gauge {
+      name        = "longitude"
+      description = "longitude GPS vehicle"
+      source      = "longitude"
+      action      = "set"
+    }
+  }
+}
+`
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testConfig), nil, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-pl.Run(withInboundEntries(newEntry(nil, model.LabelSet{"test": "app"}, `#<13>Jan 28 14:25:52 vehicle=1 longitude=-10.1234 latitude=15.1234`, time.Now())))
+	if err := testutil.GatherAndCompare(registry,
+		strings.NewReader(`
+# HELP loki_process_custom_longitude longitude GPS vehicle
+# TYPE loki_process_custom_longitude gauge
+loki_process_custom_longitude{test="app",vehicle="1"} -10.1234
+`)); err != nil {
+		t.Fatalf("mismatch metrics: %v", err)
+	}
+}
+
+func TestPipelineWithMissingKey_Metrics(t *testing.T) {
+	var buf bytes.Buffer
+	w := log.NewSyncWriter(&buf)
+	logger := log.NewLogfmtLogger(w)
+	pl, err := NewPipeline(logger, loadConfig(testMetricRiver), nil, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Debug = true
+	processEntries(pl, newEntry(nil, nil, testMetricLogLineWithMissingKey, time.Now()))
+	expectedLog := "level=debug msg=\"failed to convert extracted value to string, can't perform value comparison\" metric=loki_process_custom_bloki_count err=\"can't convert <nil> to string\""
+	if !(strings.Contains(buf.String(), expectedLog)) {
+		t.Errorf("\nexpected: %s\n+actual: %s", expectedLog, buf.String())
+	}
+}
+
+var testMetricWithDropRiver = `
+stage {
+  json {
+    expressions = { "app" = "app", "drop" = "drop" }
+  }
+}
+
+stage {
+  match {
+    selector = "{drop=\"true\"}"
+    action   = "drop"
+  }
+}
+
+stage {
+  metrics {
+    metric.counter {
+      name        = "loki_count"
+      source      = "app"
+      description = "should only inc on non dropped labels"
+      action      = "inc"
+    }
+  }
+}
+`
+
+const expectedDropMetrics = `# HELP loki_process_dropped_lines_total A count of all log lines dropped as a result of a pipeline stage
+# TYPE loki_process_dropped_lines_total counter
+loki_process_dropped_lines_total{reason="match_stage"} 1
+# HELP loki_process_custom_loki_count should only inc on non dropped labels
+# TYPE loki_process_custom_loki_count counter
+loki_process_custom_loki_count 1
+`
+
+func TestMetricsWithDropInPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testMetricWithDropRiver), nil, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lbls := model.LabelSet{}
+	droppingLabels := model.LabelSet{
+		"drop": "true",
+	}
+	in := make(chan Entry)
+	out := pl.Run(in)
+
+	in <- newEntry(nil, lbls, testMetricLogLine1, time.Now())
+	e := <-out
+	e.Labels = droppingLabels
+	e.Line = testMetricLogLine2
+	in <- e
+	close(in)
+	<-out
+
+	if err := testutil.GatherAndCompare(registry,
+		strings.NewReader(expectedDropMetrics)); err != nil {
+		t.Fatalf("mismatch metrics: %v", err)
+	}
+}
+
+func TestNonPrometheusLabelsShouldBeDropped(t *testing.T) {
+	const counterConfig = `
+stage {
+  static_labels {
+    values = { good_label = "1" }
+  }
+}
+
+stage {
+  metrics {
+    metric.counter {
+      name        = "loki_count"
+      source      = "app"
+      description = "should count all entries"
+      match_all   = true
+      action      = "inc"
+    }
+  }
+}
+`
+
+	const expectedCounterMetrics = `# HELP loki_process_custom_loki_count should count all entries
+# TYPE loki_process_custom_loki_count counter
+loki_process_custom_loki_count{good_label="1"} 1
+`
+
+	const gaugeConfig = `
+stage {
+  regex {
+    expression = "vehicle=(?P<vehicle>\\d+) longitude=(?P<longitude>[-]?\\d+\\.\\d+) latitude=(?P<latitude>\\d+\\.\\d+)"
+  }
+}
+
+stage {
+  labels {
+    values = { vehicle = "" }
+  }
+}
+
+stage {
+  metrics {
+    metric.gauge {
+      name        = "longitude"
+      description = "longitude GPS vehicle"
+      source      = "longitude"
+      action      = "set"
+    }
+  }
+}
+`
+
+	const expectedGaugeMetrics = `# HELP loki_process_custom_longitude longitude GPS vehicle
+# TYPE loki_process_custom_longitude gauge
+loki_process_custom_longitude{vehicle="1"} -10.1234
+`
+
+	const histogramConfig = `
+stage {
+  json {
+    expressions = { payload = "payload" }
+  }
+}
+
+stage {
+  metrics {
+    metric.histogram {
+      name        = "payload_size_bytes"
+      description = "payload size in bytes"
+      source      = "payload"
+      buckets     = [10, 20]
+    }
+  }
+}
+`
+
+	const expectedHistogramMetrics = `# HELP loki_process_custom_payload_size_bytes payload size in bytes
+# TYPE loki_process_custom_payload_size_bytes histogram
+loki_process_custom_payload_size_bytes_bucket{test="app",le="10"} 1
+loki_process_custom_payload_size_bytes_bucket{test="app",le="20"} 1
+loki_process_custom_payload_size_bytes_bucket{test="app",le="+Inf"} 1
+loki_process_custom_payload_size_bytes_sum{test="app"} 10
+loki_process_custom_payload_size_bytes_count{test="app"} 1
+`
+	for name, tc := range map[string]struct {
+		config          string
+		labels          model.LabelSet
+		line            string
+		expectedCollect string
+	}{
+		"counter metric with non-prometheus incoming label": {
+			config: counterConfig,
+			labels: model.LabelSet{
+				"__bad_label__": "2",
+			},
+			line:            testMetricLogLine1,
+			expectedCollect: expectedCounterMetrics,
+		},
+		"gauge metric with non-prometheus incoming label": {
+			config: gaugeConfig,
+			labels: model.LabelSet{
+				"__bad_label__": "2",
+			},
+			line:            `#<13>Jan 28 14:25:52 vehicle=1 longitude=-10.1234 latitude=15.1234`,
+			expectedCollect: expectedGaugeMetrics,
+		},
+		"histogram metric with non-prometheus incoming label": {
+			config: histogramConfig,
+			labels: model.LabelSet{
+				"test":          "app",
+				"__bad_label__": "2",
+			},
+			line:            testMetricLogLine1,
+			expectedCollect: expectedHistogramMetrics,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			pl, err := NewPipeline(util_log.Logger, loadConfig(tc.config), nil, registry)
+			require.NoError(t, err)
+			in := make(chan Entry)
+			out := pl.Run(in)
+
+			in <- newEntry(nil, tc.labels, tc.line, time.Now())
+			close(in)
+			<-out
+
+			err = testutil.GatherAndCompare(registry, strings.NewReader(tc.expectedCollect))
+			require.NoError(t, err, "gathered metrics are different than expected")
+		})
+	}
+}
+
+func TestMetricsConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    error
+	}{
+		"empty": {
+			`metrics {}`,
+			errors.New(ErrEmptyMetricsStageConfig),
+		},
+		"invalid counter action": {
+			`metrics {
+			  metric.counter {
+			    name   = "metric1"
+			    action = "del"
+			  }
+			}`,
+			fmt.Errorf(`metric "metric1": `+metric.ErrCounterInvalidAction, "del"),
+		},
+		"invalid gauge action": {
+			`metrics {
+			  metric.gauge {
+			    name   = "metric1"
+			    action = "mul"
+			  }
+			}`,
+			fmt.Errorf(`metric "metric1": `+metric.ErrGaugeInvalidAction, "mul"),
+		},
+		"sub-second idle duration": {
+			`metrics {
+			  metric.counter {
+			    name              = "metric1"
+			    action            = "inc"
+			    max_idle_duration = "500ms"
+			  }
+			}`,
+			errors.New(`metric "metric1": ` + ErrSubSecIdleDur),
+		},
+		"duplicate metric": {
+			`metrics {
+			  metric.counter {
+			    name   = "metric1"
+			    action = "inc"
+			  }
+			  metric.gauge {
+			    name   = "metric1"
+			    action = "inc"
+			  }
+			}`,
+			fmt.Errorf(ErrMetricsStageDuplicate, "loki_process_custom_metric1"),
+		},
+		"same name with different prefixes": {
+			`metrics {
+			  metric.counter {
+			    name   = "metric1"
+			    action = "inc"
+			  }
+			  metric.gauge {
+			    name   = "metric1"
+			    prefix = "other_"
+			    action = "inc"
+			  }
+			}`,
+			nil,
+		},
+		"valid": {
+			`metrics {
+			  metric.counter {
+			    name        = "metric1"
+			    description = "some description"
+			    action      = "inc"
+			  }
+			}`,
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var cfg StageConfig
+			require.NoError(t, river.Unmarshal([]byte(test.config), &cfg))
+
+			_, err := newMetricStage(util_log.Logger, cfg.MetricsConfig, prometheus.NewRegistry())
+			if ((err != nil) && (err.Error() != test.err.Error())) || (err == nil && test.err != nil) {
+				t.Errorf("Metrics stage validation error, expected error = %v, actual error = %v", test.err, err)
+				return
+			}
+		})
+	}
+}
+
+func TestDefaultIdleDuration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metricsConfig := MetricsConfig{
+		Counters: []metric.CounterConfig{{
+			Name:        "total_keys",
+			Description: "the total keys per doc",
+			Action:      metric.CounterAdd,
+		}},
+	}
+	ms, err := New(util_log.Logger, nil, StageConfig{MetricsConfig: &metricsConfig}, registry)
+	if err != nil {
+		t.Fatalf("failed to create stage with metrics: %v", err)
+	}
+	collector := ms.(*stageProcessor).Processor.(*metricStage).metrics["loki_process_custom_total_keys"].collector
+	assert.Equal(t, 5*time.Minute, collector.(*metric.Counters).Cfg.MaxIdle)
+
+	// The defaults must not leak into the configuration the stage was built
+	// from, otherwise the component would see its arguments as changed.
+	assert.Zero(t, metricsConfig.Counters[0].MaxIdle)
+}
+
+func TestMetricStage_Cleanup(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testMetricRiver), nil, registry)
+	require.NoError(t, err)
+
+	processEntries(pl, newEntry(nil, model.LabelSet{"test": "app"}, testMetricLogLine1, time.Now()))
+	count, err := testutil.GatherAndCount(registry, "loki_process_custom_total_lines_count")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	pl.Cleanup()
+	count, err = testutil.GatherAndCount(registry)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+var (
+	labelFoo = model.LabelSet(map[model.LabelName]model.LabelValue{"foo": "bar", "bar": "foo"})
+	labelFu  = model.LabelSet(map[model.LabelName]model.LabelValue{"fu": "baz", "baz": "fu"})
+)
+
+func TestMetricStage_Process(t *testing.T) {
+	jsonConfig := JSONConfig{
+		Expressions: map[string]string{
+			"total_keys":      "length(keys(@))",
+			"keys_per_line":   "length(keys(@))",
+			"numeric_float":   "numeric.float",
+			"numeric_integer": "numeric.integer",
+			"numeric_string":  "numeric.string",
+			"contains_warn":   "contains(values(@),'WARN')",
+			"contains_false":  "contains(keys(@),'nope')",
+		},
+	}
+	regexHTTPFixture := `11.11.11.11 - frank [25/Jan/2000:14:00:01 -0500] "GET /1986.js HTTP/1.1" 200 932ms"`
+	regexConfig := RegexConfig{
+		Expression: "(?P<get>\"GET).*HTTP/1.1\" (?P<status>\\d*) (?P<time>\\d*ms)",
+	}
+	metricsConfig := MetricsConfig{
+		Counters: []metric.CounterConfig{
+			{
+				Name:        "total_keys",
+				Description: "the total keys per doc",
+				Action:      metric.CounterAdd,
+			},
+			{
+				Name:        "contains_warn",
+				Description: "contains_warn",
+				Value:       "true",
+				Action:      metric.CounterInc,
+			},
+			{
+				Name:        "contains_false",
+				Description: "contains_false",
+				Value:       "true",
+				Action:      metric.CounterAdd,
+			},
+			{
+				Name:        "matches",
+				Source:      "time",
+				Description: "all matches",
+				Action:      metric.CounterInc,
+			},
+		},
+		Gauges: []metric.GaugeConfig{
+			{
+				Name:        "numeric_float",
+				Description: "numeric_float",
+				Action:      metric.GaugeAdd,
+			},
+			{
+				Name:        "numeric_integer",
+				Description: "numeric.integer",
+				Action:      metric.GaugeAdd,
+			},
+			{
+				Name:        "numeric_string",
+				Description: "numeric.string",
+				Action:      metric.GaugeAdd,
+			},
+		},
+		Histograms: []metric.HistogramConfig{
+			{
+				Name:        "keys_per_line",
+				Description: "keys per doc",
+				Buckets:     []float64{1, 3, 5, 10},
+			},
+			{
+				Name:        "response_time_seconds",
+				Source:      "time",
+				Description: "response time in ms",
+				Buckets:     []float64{0.5, 1, 2},
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	jsonStage, err := New(util_log.Logger, nil, StageConfig{JSONConfig: &jsonConfig}, registry)
+	if err != nil {
+		t.Fatalf("failed to create stage with metrics: %v", err)
+	}
+	regexStage, err := New(util_log.Logger, nil, StageConfig{RegexConfig: &regexConfig}, registry)
+	if err != nil {
+		t.Fatalf("failed to create stage with metrics: %v", err)
+	}
+	metricStage, err := New(util_log.Logger, nil, StageConfig{MetricsConfig: &metricsConfig}, registry)
+	if err != nil {
+		t.Fatalf("failed to create stage with metrics: %v", err)
+	}
+	out := processEntries(jsonStage, newEntry(nil, labelFoo, logFixture, time.Now()))
+	out[0].Line = regexHTTPFixture
+	out = processEntries(regexStage, out...)
+	out = processEntries(metricStage, out...)
+	out[0].Labels = labelFu
+	// Process the same extracted values again with different labels so we can verify proper metric/label assignments
+	_ = processEntries(metricStage, out...)
+	names := metricNames(metricsConfig)
+	if err := testutil.GatherAndCompare(registry,
+		strings.NewReader(goldenMetrics), names...); err != nil {
+		t.Fatalf("mismatch metrics: %v", err)
+	}
+}
+
+func metricNames(cfg MetricsConfig) []string {
+	var result []string
+	for _, c := range cfg.Counters {
+		result = append(result, defaultMetricsPrefix+c.Name)
+	}
+	for _, c := range cfg.Gauges {
+		result = append(result, defaultMetricsPrefix+c.Name)
+	}
+	for _, c := range cfg.Histograms {
+		result = append(result, defaultMetricsPrefix+c.Name)
+	}
+	return result
+}
+
+const goldenMetrics = `# HELP loki_process_custom_contains_warn contains_warn
+# TYPE loki_process_custom_contains_warn counter
+loki_process_custom_contains_warn{bar="foo",foo="bar"} 1.0
+loki_process_custom_contains_warn{baz="fu",fu="baz"} 1.0
+# HELP loki_process_custom_keys_per_line keys per doc
+# TYPE loki_process_custom_keys_per_line histogram
+loki_process_custom_keys_per_line_bucket{bar="foo",foo="bar",le="1.0"} 0.0
+loki_process_custom_keys_per_line_bucket{bar="foo",foo="bar",le="3.0"} 0.0
+loki_process_custom_keys_per_line_bucket{bar="foo",foo="bar",le="5.0"} 0.0
+loki_process_custom_keys_per_line_bucket{bar="foo",foo="bar",le="10.0"} 1.0
+loki_process_custom_keys_per_line_bucket{bar="foo",foo="bar",le="+Inf"} 1.0
+loki_process_custom_keys_per_line_sum{bar="foo",foo="bar"} 8.0
+loki_process_custom_keys_per_line_count{bar="foo",foo="bar"} 1.0
+loki_process_custom_keys_per_line_bucket{baz="fu",fu="baz",le="1.0"} 0.0
+loki_process_custom_keys_per_line_bucket{baz="fu",fu="baz",le="3.0"} 0.0
+loki_process_custom_keys_per_line_bucket{baz="fu",fu="baz",le="5.0"} 0.0
+loki_process_custom_keys_per_line_bucket{baz="fu",fu="baz",le="10.0"} 1.0
+loki_process_custom_keys_per_line_bucket{baz="fu",fu="baz",le="+Inf"} 1.0
+loki_process_custom_keys_per_line_sum{baz="fu",fu="baz"} 8.0
+loki_process_custom_keys_per_line_count{baz="fu",fu="baz"} 1.0
+# HELP loki_process_custom_matches all matches
+# TYPE loki_process_custom_matches counter
+loki_process_custom_matches{bar="foo",foo="bar"} 1.0
+loki_process_custom_matches{baz="fu",fu="baz"} 1.0
+# HELP loki_process_custom_numeric_float numeric_float
+# TYPE loki_process_custom_numeric_float gauge
+loki_process_custom_numeric_float{bar="foo",foo="bar"} 12.34
+loki_process_custom_numeric_float{baz="fu",fu="baz"} 12.34
+# HELP loki_process_custom_numeric_integer numeric.integer
+# TYPE loki_process_custom_numeric_integer gauge
+loki_process_custom_numeric_integer{bar="foo",foo="bar"} 123.0
+loki_process_custom_numeric_integer{baz="fu",fu="baz"} 123.0
+# HELP loki_process_custom_numeric_string numeric.string
+# TYPE loki_process_custom_numeric_string gauge
+loki_process_custom_numeric_string{bar="foo",foo="bar"} 123.0
+loki_process_custom_numeric_string{baz="fu",fu="baz"} 123.0
+# HELP loki_process_custom_response_time_seconds response time in ms
+# TYPE loki_process_custom_response_time_seconds histogram
+loki_process_custom_response_time_seconds_bucket{bar="foo",foo="bar",le="0.5"} 0
+loki_process_custom_response_time_seconds_bucket{bar="foo",foo="bar",le="1"} 1
+loki_process_custom_response_time_seconds_bucket{bar="foo",foo="bar",le="2"} 1
+loki_process_custom_response_time_seconds_bucket{bar="foo",foo="bar",le="+Inf"} 1
+loki_process_custom_response_time_seconds_sum{bar="foo",foo="bar"} 0.932
+loki_process_custom_response_time_seconds_count{bar="foo",foo="bar"} 1
+loki_process_custom_response_time_seconds_bucket{baz="fu",fu="baz",le="0.5"} 0
+loki_process_custom_response_time_seconds_bucket{baz="fu",fu="baz",le="1"} 1
+loki_process_custom_response_time_seconds_bucket{baz="fu",fu="baz",le="2"} 1
+loki_process_custom_response_time_seconds_bucket{baz="fu",fu="baz",le="+Inf"} 1
+loki_process_custom_response_time_seconds_sum{baz="fu",fu="baz"} 0.932
+loki_process_custom_response_time_seconds_count{baz="fu",fu="baz"} 1.0
+# HELP loki_process_custom_total_keys the total keys per doc
+# TYPE loki_process_custom_total_keys counter
+loki_process_custom_total_keys{bar="foo",foo="bar"} 8.0
+loki_process_custom_total_keys{baz="fu",fu="baz"} 8.0
+`
@@ -0,0 +1,240 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+)
+
+// Configuration errors.
+const (
+	ErrMultilineStageEmptyConfig        = "multiline stage config must define `firstline` regular expression"
+	ErrMultilineStageInvalidRegex       = "multiline stage first line regex compilation error: %v"
+	ErrMultilineStageInvalidMaxWaitTime = "multiline stage `max_wait_time` must be a positive duration"
+)
+
+const (
+	maxLineDefault uint64 = 128
+	maxWaitDefault        = 3 * time.Second
+)
+
+// MultilineConfig contains the configuration for a multilineStage
+type MultilineConfig struct {
+	Expression  string        `river:"firstline,attr"`
+	MaxLines    uint64        `river:"max_lines,attr,optional"`
+	MaxWaitTime time.Duration `river:"max_wait_time,attr,optional"`
+}
+
+func validateMultilineConfig(cfg *MultilineConfig) (*regexp.Regexp, error) {
+	if cfg.Expression == "" {
+		return nil, errors.New(ErrMultilineStageEmptyConfig)
+	}
+
+	expr, err := regexp.Compile(cfg.Expression)
+	if err != nil {
+		return nil, fmt.Errorf(ErrMultilineStageInvalidRegex, err)
+	}
+
+	if cfg.MaxWaitTime < 0 {
+		return nil, errors.New(ErrMultilineStageInvalidMaxWaitTime)
+	}
+
+	return expr, nil
+}
+
+// multilineStage matches lines to determine whether the following lines belong to a block and should be collapsed
+type multilineStage struct {
+	logger   log.Logger
+	regex    *regexp.Regexp
+	maxLines uint64
+	maxWait  time.Duration
+}
+
+// multilineState captures the internal state of a running multiline stage.
+type multilineState struct {
+	buffer         *bytes.Buffer // The lines of the current multiline block.
+	startLineEntry Entry         // The entry of the start line of a multiline block.
+	currentLines   uint64        // The number of lines of the current multiline block.
+}
+
+// newMultilineStage creates a MultilineStage from config
+func newMultilineStage(logger log.Logger, cfg *MultilineConfig) (Stage, error) {
+	regex, err := validateMultilineConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The defaults are resolved here rather than written back to cfg, so that
+	// the component doesn't see its stages as changed on the next update.
+	maxLines, maxWait := cfg.MaxLines, cfg.MaxWaitTime
+	if maxLines == 0 {
+		maxLines = maxLineDefault
+	}
+	if maxWait == 0 {
+		maxWait = maxWaitDefault
+	}
+
+	return &multilineStage{
+		logger:   log.With(logger, "component", "stage", "type", "multiline"),
+		regex:    regex,
+		maxLines: maxLines,
+		maxWait:  maxWait,
+	}, nil
+}
+
+// Run implements Stage. Entries are buffered separately for each stream, and
+// all buffered blocks are flushed once the in channel is closed.
+func (m *multilineStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+
+		streams := make(map[model.Fingerprint](chan Entry))
+		wg := new(sync.WaitGroup)
+
+		for e := range in {
+			key := e.Labels.FastFingerprint()
+			s, ok := streams[key]
+			if !ok {
+				// Pass through entries until we hit first start line.
+				if !m.regex.MatchString(e.Line) {
+					if Debug {
+						level.Debug(m.logger).Log("msg", "pass through entry", "stream", key)
+					}
+					out <- e
+					continue
+				}
+
+				if Debug {
+					level.Debug(m.logger).Log("msg", "creating new stream", "stream", key)
+				}
+				s = make(chan Entry)
+				streams[key] = s
+
+				wg.Add(1)
+				go m.runMultiline(s, out, wg)
+			}
+			if Debug {
+				level.Debug(m.logger).Log("msg", "pass entry", "stream", key, "line", e.Line)
+			}
+			s <- e
+		}
+
+		// Close all streams and wait for them to finish being processed.
+		for _, s := range streams {
+			close(s)
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+func (m *multilineStage) runMultiline(in chan Entry, out chan Entry, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	state := &multilineState{
+		buffer:       new(bytes.Buffer),
+		currentLines: 0,
+	}
+
+	timer := time.NewTimer(m.maxWait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if Debug {
+				level.Debug(m.logger).Log("msg", fmt.Sprintf("flush multiline block due to %v timeout", m.maxWait), "block", state.buffer.String())
+			}
+			m.flush(out, state)
+			timer.Reset(m.maxWait)
+		case e, ok := <-in:
+			if !ok {
+				if Debug {
+					level.Debug(m.logger).Log("msg", "flush multiline block because inbound closed", "block", state.buffer.String())
+				}
+				m.flush(out, state)
+				return
+			}
+
+			if Debug {
+				level.Debug(m.logger).Log("msg", "processing line", "line", e.Line, "stream", e.Labels.FastFingerprint())
+			}
+
+			// Every received line restarts the wait for the rest of the block.
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(m.maxWait)
+
+			isFirstLine := m.regex.MatchString(e.Line)
+			if isFirstLine {
+				if Debug {
+					level.Debug(m.logger).Log("msg", "flush multiline block because new start line", "block", state.buffer.String(), "stream", e.Labels.FastFingerprint())
+				}
+				m.flush(out, state)
+
+				// The start line entry is used to set timestamp and labels in the flush method.
+				// The timestamps for following lines are ignored for now.
+				state.startLineEntry = e
+			}
+
+			// Append block line
+			if state.buffer.Len() > 0 {
+				state.buffer.WriteRune('\n')
+			}
+			state.buffer.WriteString(e.Line)
+			state.currentLines++
+
+			if state.currentLines == m.maxLines {
+				m.flush(out, state)
+			}
+		}
+	}
+}
+
+func (m *multilineStage) flush(out chan Entry, s *multilineState) {
+	if s.buffer.Len() == 0 {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "nothing to flush", "buffer_len", s.buffer.Len())
+		}
+		return
+	}
+	// copy extracted data.
+	extracted := make(map[string]interface{}, len(s.startLineEntry.Extracted))
+	for k, v := range s.startLineEntry.Extracted {
+		extracted[k] = v
+	}
+	collapsed := Entry{
+		Extracted: extracted,
+		Entry: loki.Entry{
+			Labels: s.startLineEntry.Entry.Labels.Clone(),
+			Entry: logproto.Entry{
+				Timestamp: s.startLineEntry.Entry.Entry.Timestamp,
+				Line:      s.buffer.String(),
+			},
+		},
+	}
+	s.buffer.Reset()
+	s.currentLines = 0
+
+	out <- collapsed
+}
+
+// Name implements Stage
+func (m *multilineStage) Name() string {
+	return StageTypeMultiline
+}
@@ -0,0 +1,247 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+func Test_multilineStage_Process(t *testing.T) {
+	Debug = true
+
+	mcfg := &MultilineConfig{Expression: "^START", MaxWaitTime: 3 * time.Second}
+	stage, err := newMultilineStage(util_log.Logger, mcfg)
+	require.NoError(t, err)
+
+	out := processEntries(stage,
+		simpleEntry("not a start line before 1", "label"),
+		simpleEntry("not a start line before 2", "label"),
+		simpleEntry("START line 1", "label"),
+		simpleEntry("not a start line", "label"),
+		simpleEntry("START line 2", "label"),
+		simpleEntry("START line 3", "label"))
+
+	require.Len(t, out, 5)
+	require.Equal(t, "not a start line before 1", out[0].Line)
+	require.Equal(t, "not a start line before 2", out[1].Line)
+	require.Equal(t, "START line 1\nnot a start line", out[2].Line)
+	require.Equal(t, "START line 2", out[3].Line)
+	require.Equal(t, "START line 3", out[4].Line)
+}
+
+func Test_multilineStage_MultiStreams(t *testing.T) {
+	Debug = true
+
+	mcfg := &MultilineConfig{Expression: "^START", MaxWaitTime: 3 * time.Second}
+	stage, err := newMultilineStage(util_log.Logger, mcfg)
+	require.NoError(t, err)
+
+	out := processEntries(stage,
+		simpleEntry("START line 1", "one"),
+		simpleEntry("not a start line 1", "one"),
+		simpleEntry("START line 1", "two"),
+		simpleEntry("not a start line 2", "one"),
+		simpleEntry("START line 2", "two"),
+		simpleEntry("START line 2", "one"),
+		simpleEntry("not a start line 1", "one"),
+	)
+
+	sort.Slice(out, func(l, r int) bool {
+		return out[l].Timestamp.Before(out[r].Timestamp)
+	})
+
+	require.Len(t, out, 4)
+
+	require.Equal(t, "START line 1\nnot a start line 1\nnot a start line 2", out[0].Line)
+	require.Equal(t, model.LabelValue("one"), out[0].Labels["value"])
+
+	require.Equal(t, "START line 1", out[1].Line)
+	require.Equal(t, model.LabelValue("two"), out[1].Labels["value"])
+
+	require.Equal(t, "START line 2", out[2].Line)
+	require.Equal(t, model.LabelValue("two"), out[2].Labels["value"])
+
+	require.Equal(t, "START line 2\nnot a start line 1", out[3].Line)
+	require.Equal(t, model.LabelValue("one"), out[3].Labels["value"])
+}
+
+func Test_multilineStage_MaxWaitTime(t *testing.T) {
+	Debug = true
+
+	maxWait := 500 * time.Millisecond
+	mcfg := &MultilineConfig{Expression: "^START", MaxWaitTime: maxWait}
+	stage, err := newMultilineStage(util_log.Logger, mcfg)
+	require.NoError(t, err)
+
+	in := make(chan Entry, 2)
+	out := stage.Run(in)
+
+	// Accumulate result
+	mu := new(sync.Mutex)
+	var res []Entry
+	go func() {
+		for e := range out {
+			mu.Lock()
+			t.Logf("appending %s", e.Line)
+			res = append(res, e)
+			mu.Unlock()
+		}
+	}()
+
+	// Write input with a delay
+	go func() {
+		in <- simpleEntry("START line", "label")
+
+		// Trigger flush due to max wait timeout
+		time.Sleep(2 * maxWait)
+
+		in <- simpleEntry("not a start line hitting timeout", "label")
+
+		// Signal pipeline we are done.
+		close(in)
+	}()
+
+	require.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(res) == 2 }, 6*maxWait, 50*time.Millisecond)
+	require.Equal(t, "START line", res[0].Line)
+	require.Equal(t, "not a start line hitting timeout", res[1].Line)
+}
+
+func Test_multilineStage_MaxLines(t *testing.T) {
+	Debug = true
+
+	mcfg := &MultilineConfig{Expression: "^START", MaxLines: 2}
+	stage, err := newMultilineStage(util_log.Logger, mcfg)
+	require.NoError(t, err)
+
+	out := processEntries(stage,
+		simpleEntry("START line 1", "label"),
+		simpleEntry("not a start line 1", "label"),
+		simpleEntry("not a start line 2", "label"),
+		simpleEntry("not a start line 3", "label"),
+		simpleEntry("not a start line 4", "label"),
+		simpleEntry("not a start line 5", "label"))
+
+	require.Len(t, out, 3)
+	require.Equal(t, "START line 1\nnot a start line 1", out[0].Line)
+	require.Equal(t, "not a start line 2\nnot a start line 3", out[1].Line)
+	require.Equal(t, "not a start line 4\nnot a start line 5", out[2].Line)
+}
+
+func Test_multilineStage_FlushOnClose(t *testing.T) {
+	// The wait time is far longer than the test, so that the buffered block
+	// is only flushed because the input is closed.
+	mcfg := &MultilineConfig{Expression: "^START", MaxWaitTime: time.Hour}
+	pl, err := NewPipeline(util_log.Logger, []StageConfig{{MultilineConfig: mcfg}}, nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	out := make(chan loki.Entry, 1)
+	handler := pl.Wrap(loki.NewEntryHandler(out, func() {}))
+	handler.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"value": "label"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "START line 1"},
+	}
+	handler.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"value": "label"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "not a start line"},
+	}
+	handler.Stop()
+
+	select {
+	case e := <-out:
+		require.Equal(t, "START line 1\nnot a start line", e.Line)
+	default:
+		require.FailNow(t, "buffered block was not flushed on stop")
+	}
+}
+
+func TestMultilineConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    error
+	}{
+		"missing firstline": {
+			`multiline {
+			  firstline = ""
+			}`,
+			errors.New(ErrMultilineStageEmptyConfig),
+		},
+		"invalid firstline": {
+			`multiline {
+			  firstline = "(?P<ts[0-9]+"
+			}`,
+			fmt.Errorf(ErrMultilineStageInvalidRegex, "error parsing regexp: invalid named capture: `(?P<ts[0-9]+`"),
+		},
+		"negative max_wait_time": {
+			`multiline {
+			  firstline     = "^START"
+			  max_wait_time = "-1s"
+			}`,
+			errors.New(ErrMultilineStageInvalidMaxWaitTime),
+		},
+		"valid": {
+			`multiline {
+			  firstline     = "^\\[\\d{4}-\\d{2}-\\d{2}"
+			  max_wait_time = "10s"
+			  max_lines     = 500
+			}`,
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var cfg StageConfig
+			require.NoError(t, river.Unmarshal([]byte(test.config), &cfg))
+
+			_, err := newMultilineStage(util_log.Logger, cfg.MultilineConfig)
+			if test.err != nil {
+				require.EqualError(t, err, test.err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMultilineConfig_defaults(t *testing.T) {
+	mcfg := &MultilineConfig{Expression: "^START"}
+	stage, err := newMultilineStage(util_log.Logger, mcfg)
+	require.NoError(t, err)
+
+	ms := stage.(*multilineStage)
+	require.Equal(t, maxLineDefault, ms.maxLines)
+	require.Equal(t, maxWaitDefault, ms.maxWait)
+
+	// The defaults must not be written back to the configuration.
+	require.Equal(t, &MultilineConfig{Expression: "^START"}, mcfg)
+}
+
+func simpleEntry(line, label string) Entry {
+	return Entry{
+		Extracted: map[string]interface{}{},
+		Entry: loki.Entry{
+			Labels: model.LabelSet{"value": model.LabelValue(label)},
+			Entry: logproto.Entry{
+				Timestamp: time.Now(),
+				Line:      line,
+			},
+		},
+	}
+}
@@ -20,8 +20,30 @@ import (
 // We define these as pointers types so we can use reflection to check that
 // exactly one is set.
 type StageConfig struct {
-	JSONConfig   *JSONConfig   `river:"json,block,optional"`
-	LabelsConfig *LabelsConfig `river:"labels,block,optional"`
+	CRIConfig          *CRIConfig          `river:"cri,block,optional"`
+	DockerConfig       *DockerConfig       `river:"docker,block,optional"`
+	DropConfig         *DropConfig         `river:"drop,block,optional"`
+	GeoIPConfig        *GeoIPConfig        `river:"geoip,block,optional"`
+	JSONConfig         *JSONConfig         `river:"json,block,optional"`
+	LogfmtConfig       *LogfmtConfig       `river:"logfmt,block,optional"`
+	LabelAllowConfig   *LabelAllowConfig   `river:"labelallow,block,optional"`
+	LabelDropConfig    *LabelDropConfig    `river:"labeldrop,block,optional"`
+	LabelsConfig       *LabelsConfig       `river:"labels,block,optional"`
+	LimitConfig        *LimitConfig        `river:"limit,block,optional"`
+	MatchConfig        *MatchConfig        `river:"match,block,optional"`
+	MetricsConfig      *MetricsConfig      `river:"metrics,block,optional"`
+	MultilineConfig    *MultilineConfig    `river:"multiline,block,optional"`
+	OutputConfig       *OutputConfig       `river:"output,block,optional"`
+	PackConfig         *PackConfig         `river:"pack,block,optional"`
+	RegexConfig        *RegexConfig        `river:"regex,block,optional"`
+	ReplaceConfig      *ReplaceConfig      `river:"replace,block,optional"`
+	SamplingConfig     *SamplingConfig     `river:"sampling,block,optional"`
+	StaticLabelsConfig *StaticLabelsConfig `river:"static_labels,block,optional"`
+	TemplateConfig     *TemplateConfig     `river:"template,block,optional"`
+	TenantConfig       *TenantConfig       `river:"tenant,block,optional"`
+	TimestampConfig    *TimestampConfig    `river:"timestamp,block,optional"`
+	UnpackConfig       *UnpackConfig       `river:"unpack,block,optional"`
+	UserAgentConfig    *UserAgentConfig    `river:"useragent,block,optional"`
 }
 
 // UnmarshalRiver implements river.Unmarshaler.
@@ -164,10 +186,32 @@ func (p *Pipeline) Wrap(next loki.EntryHandler) loki.EntryHandler {
 	}()
 	return loki.NewEntryHandler(handlerIn, func() {
 		once.Do(func() { close(handlerIn) })
+		p.Stop()
 		wg.Wait()
 	})
 }
 
+// Stop implements stopper, unblocking the stages which wait while processing
+// an entry so that the pipeline can be flushed without waiting for them.
+func (p *Pipeline) Stop() {
+	for _, s := range p.stages {
+		if st, ok := s.(stopper); ok {
+			st.Stop()
+		}
+	}
+}
+
+// Cleanup releases the resources held by the pipeline's stages, such as the
+// metrics registered by the metrics stage. It should be called once the
+// pipeline is no longer used.
+func (p *Pipeline) Cleanup() {
+	for _, s := range p.stages {
+		if c, ok := s.(cleaner); ok {
+			c.Cleanup()
+		}
+	}
+}
+
 // Size gets the current number of stages in the pipeline
 func (p *Pipeline) Size() int {
 	return len(p.stages)
@@ -178,9 +222,8 @@ func SetReadLineRateLimiter(rateVal float64, burstVal int, drop bool) {
 	rateLimiterDrop = drop
 }
 
-// TODO(@tpaschalis) This is a helper from the metrics stage. Remove this
-// copy when we port it over, or remove it entirely in favor of a central
-// metrics struct.
+// getDropCountMetric returns the counter of dropped lines shared by all
+// stages, partitioned by the reason the lines were dropped.
 func getDropCountMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
 	dropCount := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "loki_process_dropped_lines_total",
@@ -197,3 +240,22 @@ func getDropCountMetric(registerer prometheus.Registerer) *prometheus.CounterVec
 	}
 	return dropCount
 }
+
+// getDropCountByLabelMetric returns the counter of lines dropped by the limit
+// stage when rate limiting by label.
+func getDropCountByLabelMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
+	dropCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_process_dropped_lines_by_label_total",
+		Help: "A count of all log lines dropped as a result of a pipeline stage, by label",
+	}, []string{"label_name", "label_value"})
+	err := registerer.Register(dropCount)
+	if err != nil {
+		if existing, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			dropCount = existing.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			// Same behavior as MustRegister if the error is not for AlreadyRegistered
+			panic(err)
+		}
+	}
+	return dropCount
+}
@@ -0,0 +1,270 @@
+package stages
+
+// This package is ported over from grafana/loki/clients/pkg/logentry/stages.
+// We aim to port the stages in steps, to avoid introducing huge amounts of
+// new code without being able to slowly review, examine and test them.
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/agent/pkg/river"
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testReplaceRiverSingleStageWithoutSource = `
+stage {
+  replace {
+    expression = "11.11.11.11 - (\\S+) .*"
+    replace    = "dummy"
+  }
+}
+`
+
+var testReplaceRiverMultiStageWithSource = `
+stage {
+  json {
+    expressions = { "level" = "", "msg" = "" }
+  }
+}
+
+stage {
+  replace {
+    expression = "\\S+ - \"POST (\\S+) .*"
+    source     = "msg"
+    replace    = "/loki/api/v1/push/"
+  }
+}
+`
+
+var testReplaceRiverWithNamedCapturedGroupWithTemplate = `
+stage {
+  replace {
+    expression = "^(?P<ip>\\S+) (?P<identd>\\S+) (?P<user>\\S+) \\[(?P<timestamp>[\\w:/]+\\s[+\\-]\\d{4})\\] \"(?P<action>\\S+)\\s?(?P<path>\\S+)?\\s?(?P<protocol>\\S+)?\" (?P<status>\\d{3}|-) (\\d+|-)\\s?\"?(?P<referer>[^\"]*)\"?\\s?\"?(?P<useragent>[^\"]*)?\"?$"
+    replace    = "{{ if eq .Value \"200\" }}{{ Replace .Value \"200\" \"HttpStatusOk\" -1 }}{{ else }}{{ .Value | ToUpper }}{{ end }}"
+  }
+}
+`
+
+var testReplaceRiverWithNestedCapturedGroups = `
+stage {
+  replace {
+    expression = "(?P<ip_user>^(?P<ip>\\S+) (?P<identd>\\S+) (?P<user>\\S+)) \\[(?P<timestamp>[\\w:/]+\\s[+\\-]\\d{4})\\] \"(?P<action_path>(?P<action>\\S+)\\s?(?P<path>\\S+)?)\\s?(?P<protocol>\\S+)?\" (?P<status>\\d{3}|-) (\\d+|-)\\s?\"?(?P<referer>[^\"]*)\"?\\s?\"?(?P<useragent>[^\"]*)?\"?$"
+    replace    = "{{ if eq .Value \"200\" }}{{ Replace .Value \"200\" \"HttpStatusOk\" -1 }}{{ else }}{{ .Value | ToUpper }}{{ end }}"
+  }
+}
+`
+
+var testReplaceRiverWithTemplate = `
+stage {
+  replace {
+    expression = "^(\\S+) (\\S+) (\\S+) \\[([\\w:/]+\\s[+\\-]\\d{4})\\] \"(\\S+)\\s?(\\S+)?\\s?(\\S+)?\" (\\d{3}|-) (\\d+|-)\\s?\"?([^\"]*)\"?\\s?\"?([^\"]*)?\"?$"
+    replace    = "{{ if eq .Value \"200\" }}{{ Replace .Value \"200\" \"HttpStatusOk\" -1 }}{{ else }}{{ .Value | ToUpper }}{{ end }}"
+  }
+}
+`
+
+var testReplaceRiverWithEmptyReplace = `
+stage {
+  replace {
+    expression = "11.11.11.11 - (\\S+\\s)"
+    replace    = ""
+  }
+}
+`
+
+var testReplaceAdjacentCaptureGroups = `
+stage {
+  replace {
+    expression = "(a|b|c)"
+    replace    = ""
+  }
+}
+`
+
+var testReplaceLogLine = `11.11.11.11 - frank [25/Jan/2000:14:00:01 -0500] "GET /1986.js HTTP/1.1" 200 932 "-" "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6"`
+var testReplaceLogJSONLine = `{"time":"2019-01-01T01:00:00.000000001Z", "level": "info", "msg": "11.11.11.11 - \"POST /loki/api/push/ HTTP/1.1\" 200 932 \"-\" \"Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6\""}`
+var testReplaceLogLineAdjacentCaptureGroups = `abc`
+
+func TestPipeline_Replace(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config        string
+		entry         string
+		extracted     map[string]interface{}
+		expectedEntry string
+	}{
+		"successfully run a pipeline with 1 regex stage without source": {
+			testReplaceRiverSingleStageWithoutSource,
+			testReplaceLogLine,
+			map[string]interface{}{},
+			`11.11.11.11 - dummy [25/Jan/2000:14:00:01 -0500] "GET /1986.js HTTP/1.1" 200 932 "-" "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6"`,
+		},
+		"successfully run a pipeline with multi stage with": {
+			testReplaceRiverMultiStageWithSource,
+			testReplaceLogJSONLine,
+			map[string]interface{}{
+				"level": "info",
+				"msg":   `11.11.11.11 - "POST /loki/api/v1/push/ HTTP/1.1" 200 932 "-" "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6"`,
+			},
+			`{"time":"2019-01-01T01:00:00.000000001Z", "level": "info", "msg": "11.11.11.11 - \"POST /loki/api/push/ HTTP/1.1\" 200 932 \"-\" \"Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6\""}`,
+		},
+		"successfully run a pipeline with 1 regex stage with named captured group and with template and without source": {
+			testReplaceRiverWithNamedCapturedGroupWithTemplate,
+			testReplaceLogLine,
+			map[string]interface{}{
+				"ip":        "11.11.11.11",
+				"identd":    "-",
+				"user":      "FRANK",
+				"timestamp": "25/JAN/2000:14:00:01 -0500",
+				"action":    "GET",
+				"path":      "/1986.JS",
+				"protocol":  "HTTP/1.1",
+				"status":    "HttpStatusOk",
+				"referer":   "-",
+				"useragent": "MOZILLA/5.0 (WINDOWS; U; WINDOWS NT 5.1; DE; RV:1.9.1.7) GECKO/20091221 FIREFOX/3.5.7 GTB6",
+			},
+			`11.11.11.11 - FRANK [25/JAN/2000:14:00:01 -0500] "GET /1986.JS HTTP/1.1" HttpStatusOk 932 "-" "MOZILLA/5.0 (WINDOWS; U; WINDOWS NT 5.1; DE; RV:1.9.1.7) GECKO/20091221 FIREFOX/3.5.7 GTB6"`,
+		},
+		"successfully run a pipeline with 1 regex stage with nested captured groups and with template and without source": {
+			testReplaceRiverWithNestedCapturedGroups,
+			testReplaceLogLine,
+			map[string]interface{}{
+				"ip_user":     "11.11.11.11 - FRANK",
+				"action_path": "GET /1986.JS",
+				"ip":          "11.11.11.11",
+				"identd":      "-",
+				"user":        "FRANK",
+				"timestamp":   "25/JAN/2000:14:00:01 -0500",
+				"action":      "GET",
+				"path":        "/1986.JS",
+				"protocol":    "HTTP/1.1",
+				"status":      "HttpStatusOk",
+				"referer":     "-",
+				"useragent":   "MOZILLA/5.0 (WINDOWS; U; WINDOWS NT 5.1; DE; RV:1.9.1.7) GECKO/20091221 FIREFOX/3.5.7 GTB6",
+			},
+			`11.11.11.11 - FRANK [25/JAN/2000:14:00:01 -0500] "GET /1986.JS HTTP/1.1" HttpStatusOk 932 "-" "MOZILLA/5.0 (WINDOWS; U; WINDOWS NT 5.1; DE; RV:1.9.1.7) GECKO/20091221 FIREFOX/3.5.7 GTB6"`,
+		},
+		"successfully run a pipeline with 1 regex stage with template and without source": {
+			testReplaceRiverWithTemplate,
+			testReplaceLogLine,
+			map[string]interface{}{},
+			`11.11.11.11 - FRANK [25/JAN/2000:14:00:01 -0500] "GET /1986.JS HTTP/1.1" HttpStatusOk 932 "-" "MOZILLA/5.0 (WINDOWS; U; WINDOWS NT 5.1; DE; RV:1.9.1.7) GECKO/20091221 FIREFOX/3.5.7 GTB6"`,
+		},
+		"successfully run a pipeline with empty replace value": {
+			testReplaceRiverWithEmptyReplace,
+			testReplaceLogLine,
+			map[string]interface{}{},
+			`11.11.11.11 - [25/Jan/2000:14:00:01 -0500] "GET /1986.js HTTP/1.1" 200 932 "-" "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6"`,
+		},
+		"successfully run a pipeline with adjacent capture groups": {
+			testReplaceAdjacentCaptureGroups,
+			testReplaceLogLineAdjacentCaptureGroups,
+			map[string]interface{}{},
+			``,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			pl, err := NewPipeline(util_log.Logger, loadConfig(testData.config), nil, prometheus.DefaultRegisterer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := processEntries(pl, newEntry(nil, nil, testData.entry, time.Now()))[0]
+			assert.Equal(t, testData.expectedEntry, out.Line)
+			assert.Equal(t, testData.extracted, out.Extracted)
+		})
+	}
+}
+
+var replaceCfg = `
+expression = "regexexpression"
+replace    = "replace"
+`
+
+func TestReplaceMapStructure(t *testing.T) {
+	t.Parallel()
+
+	var got ReplaceConfig
+	err := river.Unmarshal([]byte(replaceCfg), &got)
+	assert.NoError(t, err, "error while un-marshalling config: %s", err)
+
+	want := ReplaceConfig{
+		Expression: "regexexpression",
+		Replace:    "replace",
+	}
+	assert.True(t, reflect.DeepEqual(got, want), "want: %+v got: %+v", want, got)
+}
+
+func TestReplaceConfig_validate(t *testing.T) {
+	t.Parallel()
+
+	var emptyString = ""
+	var logString = "log"
+
+	tests := map[string]struct {
+		config *ReplaceConfig
+		err    error
+	}{
+		"empty config": {
+			nil,
+			errors.New(ErrEmptyReplaceStageConfig),
+		},
+		"missing regex_expression": {
+			&ReplaceConfig{},
+			errors.New(ErrExpressionRequired),
+		},
+		"invalid regex_expression": {
+			&ReplaceConfig{
+				Expression: "(?P<ts[0-9]+).*",
+				Replace:    "test",
+			},
+			errors.New(ErrCouldNotCompileRegex + ": error parsing regexp: invalid named capture: `(?P<ts[0-9]+).*`"),
+		},
+		"empty source": {
+			&ReplaceConfig{
+				Expression: "(?P<ts>[0-9]+).*",
+				Source:     &emptyString,
+			},
+			errors.New(ErrEmptyReplaceStageSource),
+		},
+		"valid without source": {
+			&ReplaceConfig{
+				Expression: "(?P<ts>[0-9]+).*",
+				Replace:    "test",
+			},
+			nil,
+		},
+		"valid with source": {
+			&ReplaceConfig{
+				Expression: "(?P<ts>[0-9]+).*",
+				Source:     &logString,
+				Replace:    "test",
+			},
+			nil,
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			_, err := validateReplaceConfig(tt.config)
+			if tt.err != nil {
+				assert.NotNil(t, err, "ReplaceConfig.validate() expected error = %v, but got nil", tt.err)
+			}
+			if err != nil {
+				assert.Equal(t, tt.err.Error(), err.Error(), "ReplaceConfig.validate() expected error = %v, actual error = %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package stages
+
+import (
+	"errors"
+	"math"
+	"reflect"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Configuration errors.
+const (
+	ErrSamplingStageInvalidPercentage = "sampling stage `percentage` must be a number between 0 and 100"
+)
+
+var defaultSamplingDropReason = "sampling_stage"
+
+// SamplingConfig contains the configuration for a samplingStage.
+type SamplingConfig struct {
+	Percentage float64 `river:"percentage,attr"`
+	Source     *string `river:"source,attr,optional"`
+	DropReason *string `river:"drop_counter_reason,attr,optional"`
+}
+
+// validateSamplingConfig validates the SamplingConfig for the samplingStage.
+func validateSamplingConfig(cfg *SamplingConfig) error {
+	if math.IsNaN(cfg.Percentage) || cfg.Percentage < 0 || cfg.Percentage > 100 {
+		return errors.New(ErrSamplingStageInvalidPercentage)
+	}
+	return nil
+}
+
+// newSamplingStage creates a samplingStage from config.
+func newSamplingStage(logger log.Logger, cfg *SamplingConfig, registerer prometheus.Registerer) (Stage, error) {
+	err := validateSamplingConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dropReason := defaultSamplingDropReason
+	if cfg.DropReason != nil && *cfg.DropReason != "" {
+		dropReason = *cfg.DropReason
+	}
+
+	return &samplingStage{
+		logger:     log.With(logger, "component", "stage", "type", "sampling"),
+		rate:       cfg.Percentage / 100,
+		source:     cfg.Source,
+		dropReason: dropReason,
+		dropCount:  getDropCountMetric(registerer),
+	}, nil
+}
+
+// samplingStage keeps a fixed percentage of entries. Whether an entry is kept
+// depends only on the hash of its log line, or of the source value if one is
+// configured, so identical values are always either all kept or all dropped.
+//
+// Unlike the other enrichment stages, samplingStage isn't a Processor, since
+// a Processor can't remove entries from the pipeline.
+type samplingStage struct {
+	logger     log.Logger
+	rate       float64 // Share of entries to keep, between 0 and 1.
+	source     *string
+	dropReason string
+	dropCount  *prometheus.CounterVec
+}
+
+// Run implements Stage.
+func (m *samplingStage) Run(in chan Entry) chan Entry {
+	return RunWithSkip(in, func(e Entry) (Entry, bool) {
+		if m.shouldSample(e) {
+			return e, false
+		}
+		m.dropCount.WithLabelValues(m.dropReason).Inc()
+		return e, true
+	})
+}
+
+// shouldSample reports whether the entry is kept.
+func (m *samplingStage) shouldSample(e Entry) bool {
+	switch m.rate {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+
+	value := e.Line
+	if m.source != nil {
+		v, ok := e.Extracted[*m.source]
+		if !ok {
+			// Entries without the source value can't be sampled consistently,
+			// so they're always kept.
+			if Debug {
+				level.Debug(m.logger).Log("msg", "source does not exist in the extracted data, keeping entry", "source", *m.source)
+			}
+			return true
+		}
+		s, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert source value to string, keeping entry", "source", *m.source, "err", err, "type", reflect.TypeOf(v))
+			}
+			return true
+		}
+		value = s
+	}
+
+	return float64(xxhash.Sum64String(value)) < m.rate*math.MaxUint64
+}
+
+// Name implements Stage.
+func (m *samplingStage) Name() string {
+	return StageTypeSampling
+}
@@ -0,0 +1,113 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+func TestSamplingConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		percentage float64
+		err        error
+	}{
+		"zero":      {percentage: 0},
+		"fraction":  {percentage: 0.5},
+		"half":      {percentage: 50},
+		"all":       {percentage: 100},
+		"negative":  {percentage: -10, err: errors.New(ErrSamplingStageInvalidPercentage)},
+		"above 100": {percentage: 150, err: errors.New(ErrSamplingStageInvalidPercentage)},
+		"NaN":       {percentage: math.NaN(), err: errors.New(ErrSamplingStageInvalidPercentage)},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := validateSamplingConfig(&SamplingConfig{Percentage: tt.percentage})
+			if tt.err != nil {
+				require.EqualError(t, err, tt.err.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_samplingStage_Process(t *testing.T) {
+	entries := make([]Entry, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		entries = append(entries, newEntry(nil, model.LabelSet{}, fmt.Sprintf("line %d", i), time.Now()))
+	}
+
+	for _, tt := range []struct {
+		percentage float64
+		min, max   int
+	}{
+		{percentage: 0, min: 0, max: 0},
+		{percentage: 10, min: 50, max: 150},
+		{percentage: 50, min: 400, max: 600},
+		{percentage: 100, min: 1000, max: 1000},
+	} {
+		registry := prometheus.NewRegistry()
+		s, err := newSamplingStage(util_log.Logger, &SamplingConfig{Percentage: tt.percentage}, registry)
+		require.NoError(t, err)
+
+		out := processEntries(s, entries...)
+		assert.GreaterOrEqual(t, len(out), tt.min, "percentage %v", tt.percentage)
+		assert.LessOrEqual(t, len(out), tt.max, "percentage %v", tt.percentage)
+		assert.Equal(t, float64(len(entries)-len(out)), testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(defaultSamplingDropReason)))
+
+		// Sampling is deterministic: the same entries are kept every time.
+		assert.Equal(t, out, processEntries(s, entries...))
+	}
+}
+
+func Test_samplingStage_Source(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage {
+  logfmt {
+    mapping = { "trace_id" = "" }
+  }
+}
+
+stage {
+  sampling {
+    percentage          = 50
+    source              = "trace_id"
+    drop_counter_reason = "trace_sampling"
+  }
+}`), nil, registry)
+	require.NoError(t, err)
+
+	// Every line of a trace is either kept or dropped.
+	kept := map[string]int{}
+	var entries []Entry
+	for trace := 0; trace < 100; trace++ {
+		for line := 0; line < 5; line++ {
+			entries = append(entries, newEntry(nil, model.LabelSet{}, fmt.Sprintf("trace_id=%d line=%d", trace, line), time.Now()))
+		}
+	}
+	for _, e := range processEntries(pl, entries...) {
+		kept[e.Extracted["trace_id"].(string)]++
+	}
+	require.NotEmpty(t, kept)
+	require.Less(t, len(kept), 100)
+	for trace, n := range kept {
+		assert.Equal(t, 5, n, "trace %s was partially sampled", trace)
+	}
+	assert.Equal(t, float64(500-5*len(kept)), testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues("trace_sampling")))
+
+	// Entries without the source are always kept.
+	out := processEntries(pl, newEntry(nil, model.LabelSet{}, "no trace here", time.Now()))
+	require.Len(t, out, 1)
+}
@@ -0,0 +1,79 @@
+package stages
+
+import (
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	json "github.com/json-iterator/go"
+	"github.com/prometheus/common/model"
+)
+
+// UnpackConfig is an empty struct that is used to enable the unpack stage,
+// which reverses the effect of the pack stage.
+type UnpackConfig struct{}
+
+// newUnpackStage creates an unpackStage.
+func newUnpackStage(logger log.Logger) (Stage, error) {
+	return toStage(&unpackStage{
+		logger: log.With(logger, "component", "stage", "type", "unpack"),
+	}), nil
+}
+
+// unpackStage restores the original log line of an entry packed by the pack
+// stage, and turns the embedded keys back into labels and extracted values.
+type unpackStage struct {
+	logger log.Logger
+}
+
+// Process implements Processor.
+func (u *unpackStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	if entry == nil {
+		return
+	}
+
+	// Entries which weren't packed are passed through untouched.
+	var m map[string]interface{}
+	if err := json.UnmarshalFromString(*entry, &m); err != nil {
+		if Debug {
+			level.Debug(u.logger).Log("msg", "line is not a packed entry, skipping unpack", "err", err)
+		}
+		return
+	}
+	line, ok := m[packedEntryKey].(string)
+	if !ok {
+		if Debug {
+			level.Debug(u.logger).Log("msg", "line does not contain a packed entry, skipping unpack")
+		}
+		return
+	}
+
+	for k, v := range m {
+		if k == packedEntryKey {
+			continue
+		}
+		s, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(u.logger).Log("msg", "packed value cannot be converted to a string", "key", k, "err", err)
+			}
+			continue
+		}
+		extracted[k] = s
+
+		name, value := model.LabelName(k), model.LabelValue(s)
+		if !name.IsValid() || !value.IsValid() {
+			if Debug {
+				level.Debug(u.logger).Log("msg", "invalid label parsed from packed entry", "name", name, "value", value)
+			}
+			continue
+		}
+		labels[name] = value
+	}
+	*entry = line
+}
+
+// Name implements Processor.
+func (u *unpackStage) Name() string {
+	return StageTypeUnpack
+}
@@ -0,0 +1,106 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+func Test_unpackStage_Process(t *testing.T) {
+	Debug = true
+
+	tests := map[string]struct {
+		line              string
+		labels            model.LabelSet
+		expectedLine      string
+		expectedLabels    model.LabelSet
+		expectedExtracted map[string]interface{}
+	}{
+		"packed entry": {
+			line:           `{"container":"foo","pod":"foo-xsfs3","_entry":"test line 1"}`,
+			labels:         model.LabelSet{"namespace": "dev"},
+			expectedLine:   "test line 1",
+			expectedLabels: model.LabelSet{"namespace": "dev", "container": "foo", "pod": "foo-xsfs3"},
+			expectedExtracted: map[string]interface{}{
+				"container": "foo",
+				"pod":       "foo-xsfs3",
+			},
+		},
+		"packed entry without labels": {
+			line:              `{"_entry":"{\"message\":\"hello\"}"}`,
+			labels:            model.LabelSet{"namespace": "dev"},
+			expectedLine:      `{"message":"hello"}`,
+			expectedLabels:    model.LabelSet{"namespace": "dev"},
+			expectedExtracted: map[string]interface{}{},
+		},
+		"invalid label name is only extracted": {
+			line:           `{"not-a-label":"foo","_entry":"test line 1"}`,
+			labels:         model.LabelSet{},
+			expectedLine:   "test line 1",
+			expectedLabels: model.LabelSet{},
+			expectedExtracted: map[string]interface{}{
+				"not-a-label": "foo",
+			},
+		},
+		"json without packed entry": {
+			line:              `{"container":"foo","message":"test line 1"}`,
+			labels:            model.LabelSet{"namespace": "dev"},
+			expectedLine:      `{"container":"foo","message":"test line 1"}`,
+			expectedLabels:    model.LabelSet{"namespace": "dev"},
+			expectedExtracted: map[string]interface{}{},
+		},
+		"not json": {
+			line:              "test line 1",
+			labels:            model.LabelSet{"namespace": "dev"},
+			expectedLine:      "test line 1",
+			expectedLabels:    model.LabelSet{"namespace": "dev"},
+			expectedExtracted: map[string]interface{}{},
+		},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			s, err := newUnpackStage(util_log.Logger)
+			require.NoError(t, err)
+
+			out := processEntries(s, newEntry(nil, tt.labels, tt.line, time.Unix(1, 0)))
+			require.Len(t, out, 1)
+			assert.Equal(t, tt.expectedLine, out[0].Line)
+			assert.Equal(t, tt.expectedLabels, out[0].Labels)
+			assert.Equal(t, tt.expectedExtracted, out[0].Extracted)
+			assert.Equal(t, time.Unix(1, 0), out[0].Timestamp)
+		})
+	}
+}
+
+func TestPackUnpackPipeline(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage {
+  pack {
+    labels           = ["pod", "container"]
+    ingest_timestamp = false
+  }
+}
+
+stage {
+  unpack {}
+}`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	lbls := model.LabelSet{
+		"pod":       "foo-xsfs3",
+		"container": "foo",
+		"namespace": "dev",
+	}
+	out := processEntries(pl, newEntry(nil, lbls.Clone(), testMatchLogLineApp1, time.Unix(1, 0)))
+	require.Len(t, out, 1)
+	assert.Equal(t, testMatchLogLineApp1, out[0].Line)
+	assert.Equal(t, lbls, out[0].Labels)
+}
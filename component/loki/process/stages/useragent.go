@@ -0,0 +1,100 @@
+package stages
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mssola/useragent"
+	"github.com/prometheus/common/model"
+)
+
+// Names of the values extracted by the useragent stage.
+const (
+	fieldUserAgentBrowser        = "useragent_browser"
+	fieldUserAgentBrowserVersion = "useragent_browser_version"
+	fieldUserAgentOS             = "useragent_os"
+	fieldUserAgentOSVersion      = "useragent_os_version"
+	fieldUserAgentPlatform       = "useragent_platform"
+	fieldUserAgentEngine         = "useragent_engine"
+	fieldUserAgentEngineVersion  = "useragent_engine_version"
+	fieldUserAgentMobile         = "useragent_mobile"
+	fieldUserAgentBot            = "useragent_bot"
+)
+
+// UserAgentConfig represents the configuration of the useragent stage.
+type UserAgentConfig struct {
+	Source *string `river:"source,attr,optional"`
+}
+
+// newUserAgentStage creates a useragent stage which parses a User-Agent
+// header from the extracted data, or from the log line if no source is set.
+func newUserAgentStage(logger log.Logger, config UserAgentConfig) (Stage, error) {
+	return toStage(&userAgentStage{
+		logger: log.With(logger, "component", "stage", "type", "useragent"),
+		source: config.Source,
+	}), nil
+}
+
+// userAgentStage extracts the browser, operating system and device details
+// of a User-Agent string.
+type userAgentStage struct {
+	logger log.Logger
+	source *string
+}
+
+// Process implements Processor.
+func (u *userAgentStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	var input string
+	if u.source == nil {
+		if entry == nil {
+			return
+		}
+		input = *entry
+	} else {
+		value, ok := extracted[*u.source]
+		if !ok {
+			if Debug {
+				level.Debug(u.logger).Log("msg", "source does not exist in the extracted data", "source", *u.source)
+			}
+			return
+		}
+		s, err := getString(value)
+		if err != nil {
+			if Debug {
+				level.Debug(u.logger).Log("msg", "failed to convert source value to string", "source", *u.source, "err", err, "type", reflect.TypeOf(value))
+			}
+			return
+		}
+		input = s
+	}
+	if input == "" {
+		return
+	}
+
+	ua := useragent.New(input)
+
+	browser, browserVersion := ua.Browser()
+	setNonEmpty(extracted, fieldUserAgentBrowser, browser)
+	setNonEmpty(extracted, fieldUserAgentBrowserVersion, browserVersion)
+
+	os := ua.OSInfo()
+	setNonEmpty(extracted, fieldUserAgentOS, os.Name)
+	setNonEmpty(extracted, fieldUserAgentOSVersion, os.Version)
+
+	setNonEmpty(extracted, fieldUserAgentPlatform, ua.Platform())
+
+	engine, engineVersion := ua.Engine()
+	setNonEmpty(extracted, fieldUserAgentEngine, engine)
+	setNonEmpty(extracted, fieldUserAgentEngineVersion, engineVersion)
+
+	extracted[fieldUserAgentMobile] = strconv.FormatBool(ua.Mobile())
+	extracted[fieldUserAgentBot] = strconv.FormatBool(ua.Bot())
+}
+
+// Name implements Processor.
+func (u *userAgentStage) Name() string {
+	return StageTypeUserAgent
+}
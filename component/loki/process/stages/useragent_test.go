@@ -0,0 +1,125 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+const (
+	testUserAgentChrome    = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36"
+	testUserAgentIPhone    = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	testUserAgentGooglebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func Test_userAgentStage_Process(t *testing.T) {
+	Debug = true
+
+	source := "ua"
+	tests := map[string]struct {
+		config            UserAgentConfig
+		line              string
+		extracted         map[string]interface{}
+		expectedExtracted map[string]interface{}
+	}{
+		"desktop browser from log line": {
+			config:    UserAgentConfig{},
+			line:      testUserAgentChrome,
+			extracted: map[string]interface{}{},
+			expectedExtracted: map[string]interface{}{
+				"useragent_browser":         "Chrome",
+				"useragent_browser_version": "114.0.0.0",
+				"useragent_os":              "Linux",
+				"useragent_platform":        "X11",
+				"useragent_engine":          "AppleWebKit",
+				"useragent_engine_version":  "537.36",
+				"useragent_mobile":          "false",
+				"useragent_bot":             "false",
+			},
+		},
+		"mobile browser from source": {
+			config:    UserAgentConfig{Source: &source},
+			line:      "GET /index.html",
+			extracted: map[string]interface{}{"ua": testUserAgentIPhone},
+			expectedExtracted: map[string]interface{}{
+				"ua":                        testUserAgentIPhone,
+				"useragent_browser":         "Safari",
+				"useragent_browser_version": "16.5",
+				"useragent_os":              "iPhone OS",
+				"useragent_os_version":      "16.5",
+				"useragent_platform":        "iPhone",
+				"useragent_engine":          "AppleWebKit",
+				"useragent_engine_version":  "605.1.15",
+				"useragent_mobile":          "true",
+				"useragent_bot":             "false",
+			},
+		},
+		"bot": {
+			config:    UserAgentConfig{Source: &source},
+			extracted: map[string]interface{}{"ua": testUserAgentGooglebot},
+			expectedExtracted: map[string]interface{}{
+				"ua":                        testUserAgentGooglebot,
+				"useragent_browser":         "Googlebot",
+				"useragent_browser_version": "2.1",
+				"useragent_mobile":          "false",
+				"useragent_bot":             "true",
+			},
+		},
+		"missing source": {
+			config:            UserAgentConfig{Source: &source},
+			line:              testUserAgentChrome,
+			extracted:         map[string]interface{}{},
+			expectedExtracted: map[string]interface{}{},
+		},
+		"empty line": {
+			config:            UserAgentConfig{},
+			extracted:         map[string]interface{}{},
+			expectedExtracted: map[string]interface{}{},
+		},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			s, err := newUserAgentStage(util_log.Logger, tt.config)
+			require.NoError(t, err)
+
+			out := processEntries(s, newEntry(tt.extracted, model.LabelSet{}, tt.line, time.Now()))
+			require.Len(t, out, 1)
+			assert.Equal(t, tt.expectedExtracted, out[0].Extracted)
+			assert.Equal(t, tt.line, out[0].Line)
+		})
+	}
+}
+
+func TestUserAgentPipeline(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage {
+  json {
+    expressions = { "ua" = "user_agent" }
+  }
+}
+
+stage {
+  useragent {
+    source = "ua"
+  }
+}
+
+stage {
+  labels {
+    values = { "browser" = "useragent_browser", "bot" = "useragent_bot" }
+  }
+}`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	out := processEntries(pl, newEntry(nil, model.LabelSet{}, `{"user_agent":"`+testUserAgentChrome+`"}`, time.Now()))
+	require.Len(t, out, 1)
+	assert.Equal(t, model.LabelSet{"browser": "Chrome", "bot": "false"}, out[0].Labels)
+}
@@ -58,7 +58,8 @@ func (a *Arguments) UnmarshalRiver(f func(interface{}) error) error {
 
 // Exports holds values which are exported by the loki.relabel component.
 type Exports struct {
-	Receiver loki.LogsReceiver `river:"receiver,attr"`
+	Receiver loki.LogsReceiver  `river:"receiver,attr"`
+	Rules    flow_relabel.Rules `river:"rules,attr"`
 }
 
 // Component implements the loki.relabel component.
@@ -93,12 +94,12 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		maxCacheSize: args.MaxCacheSize,
 	}
 
-	// Create and immediately export the receiver which remains the same for
-	// the component's lifetime.
+	// Create the receiver which remains the same for the component's
+	// lifetime. It's exported along with the relabeling rules by Update().
 	c.receiver = make(loki.LogsReceiver)
-	o.OnStateChange(Exports{Receiver: c.receiver})
 
-	// Call to Update() to set the relabelling rules once at the start.
+	// Call to Update() to set and export the relabelling rules once at the
+	// start.
 	if err := c.Update(args); err != nil {
 		return nil, err
 	}
@@ -154,6 +155,8 @@ func (c *Component) Update(args component.Arguments) error {
 	c.rcs = newRCS
 	c.fanout = newArgs.ForwardTo
 
+	c.opts.OnStateChange(Exports{Receiver: c.receiver, Rules: newArgs.RelabelConfigs})
+
 	return nil
 }
 
@@ -287,3 +287,29 @@ func getEntry() loki.Entry {
 		},
 	}
 }
+
+func TestExports(t *testing.T) {
+	type cfg struct {
+		Rcs []*flow_relabel.Config `river:"rule,block,optional"`
+	}
+	var relabelConfigs cfg
+	err := river.Unmarshal([]byte(rc), &relabelConfigs)
+	require.NoError(t, err)
+
+	var exports Exports
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+	opts := component.Options{Logger: l, Registerer: prometheus.NewRegistry(), OnStateChange: func(e component.Exports) {
+		exports = e.(Exports)
+	}}
+
+	c, err := New(opts, Arguments{RelabelConfigs: relabelConfigs.Rcs, MaxCacheSize: 10})
+	require.NoError(t, err)
+	require.Equal(t, c.receiver, exports.Receiver)
+	require.Equal(t, flow_relabel.Rules(relabelConfigs.Rcs), exports.Rules)
+
+	// The exported rules follow updates, while the receiver stays the same.
+	require.NoError(t, c.Update(Arguments{MaxCacheSize: 10}))
+	require.Equal(t, c.receiver, exports.Receiver)
+	require.Empty(t, exports.Rules)
+}
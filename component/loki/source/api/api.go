@@ -0,0 +1,235 @@
+// Package api implements the loki.source.api component, which receives log
+// entries over HTTP using the Loki push API.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.api",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the loki.source.api
+// component.
+type Arguments struct {
+	ListenAddress        string              `river:"listen_address,attr,optional"`
+	Labels               map[string]string   `river:"labels,attr,optional"`
+	UseIncomingTimestamp bool                `river:"use_incoming_timestamp,attr,optional"`
+	RelabelRules         flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+	ForwardTo            []loki.LogsReceiver `river:"forward_to,attr"`
+}
+
+// shutdownTimeout is how long the component waits for in-flight requests
+// when its own HTTP server is stopped.
+const shutdownTimeout = 5 * time.Second
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+	_ component.HTTPComponent  = (*Component)(nil)
+)
+
+// Component implements the loki.source.api component.
+type Component struct {
+	opts    component.Options
+	metrics *metrics
+	router  *mux.Router
+
+	mut            sync.RWMutex
+	args           Arguments
+	labels         model.LabelSet
+	relabelConfigs []*relabel.Config
+	handler        loki.LogsReceiver
+	receivers      []loki.LogsReceiver
+	server         *runningServer
+}
+
+// runningServer is the HTTP server of the component.
+type runningServer struct {
+	srv  *http.Server
+	addr net.Addr
+
+	// cancel cancels the base context of the requests to the server, so that
+	// in-flight handlers waiting to forward entries return.
+	cancel context.CancelFunc
+}
+
+// New creates a new loki.source.api component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:    o,
+		metrics: newMetrics(o.Registerer),
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+	}
+
+	c.router = mux.NewRouter()
+	c.router.Path("/loki/api/v1/push").Methods(http.MethodPost).HandlerFunc(c.handlePush)
+	c.router.Path("/loki/api/v1/raw").Methods(http.MethodPost).HandlerFunc(c.handleRaw)
+
+	// Call to Update() to start the HTTP server and set receivers once at
+	// the start.
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.api component shutting down, stopping server")
+		c.mut.Lock()
+		srv := c.server
+		c.server = nil
+		c.mut.Unlock()
+		c.stopServer(srv)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	labels := make(model.LabelSet, len(newArgs.Labels))
+	for k, v := range newArgs.Labels {
+		labels[model.LabelName(k)] = model.LabelValue(v)
+	}
+	c.labels = labels
+	c.relabelConfigs = flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules)
+	c.receivers = newArgs.ForwardTo
+
+	// Only restart the HTTP server when the address changes, so that
+	// in-flight requests aren't interrupted by unrelated updates.
+	restart := c.server == nil || newArgs.ListenAddress != c.args.ListenAddress
+	c.args = newArgs
+	oldServer := c.server
+	if restart {
+		c.server = nil
+	}
+	c.mut.Unlock()
+
+	if !restart {
+		return nil
+	}
+
+	// The previous server is stopped without holding the lock, as its
+	// in-flight handlers need it.
+	c.stopServer(oldServer)
+	if newArgs.ListenAddress == "" {
+		return nil
+	}
+
+	srv, err := c.startServer(newArgs.ListenAddress)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	c.server = srv
+	c.mut.Unlock()
+	return nil
+}
+
+// startServer starts serving the push API on addr.
+func (c *Component) startServer(addr string) (*runningServer, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	baseCtx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Handler:     c.router,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	level.Info(c.opts.Logger).Log("msg", "starting push API server", "addr", lis.Addr())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			level.Error(c.opts.Logger).Log("msg", "push API server shut down with error", "err", err)
+		}
+	}()
+	return &runningServer{srv: srv, addr: lis.Addr(), cancel: cancel}, nil
+}
+
+// stopServer stops the HTTP server s, if not nil. Handlers waiting to forward
+// entries are canceled first, so that they don't hold up the shutdown. c.mut
+// must not be held, as in-flight handlers need it.
+func (c *Component) stopServer(s *runningServer) {
+	if s == nil {
+		return
+	}
+	s.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		level.Warn(c.opts.Logger).Log("msg", "error while stopping push API server", "err", err)
+	}
+}
+
+// Handler implements component.HTTPComponent. It serves the same endpoints
+// as the component's own HTTP server.
+func (c *Component) Handler() http.Handler {
+	return c.router
+}
+
+// DebugInfo returns information about the HTTP server of the component.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res debugInfo
+	if c.server != nil {
+		res.ListenAddress = c.server.addr.String()
+	}
+	return res
+}
+
+type debugInfo struct {
+	ListenAddress string `river:"listen_address,attr,optional"`
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush_Protobuf(t *testing.T) {
+	ch := make(loki.LogsReceiver)
+	c, reg := runTestComponent(t, Arguments{
+		ListenAddress:        "127.0.0.1:0",
+		Labels:               map[string]string{"source": "api"},
+		UseIncomingTimestamp: true,
+		ForwardTo:            []loki.LogsReceiver{ch},
+	})
+
+	ts := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	req := logproto.PushRequest{Streams: []logproto.Stream{{
+		Labels:  `{job="app", __internal="x"}`,
+		Entries: []logproto.Entry{{Timestamp: ts, Line: "hello"}, {Timestamp: ts.Add(time.Second), Line: "world"}},
+	}}}
+	buf, err := req.Marshal()
+	require.NoError(t, err)
+
+	// The request is sent in the background, as it only completes once the
+	// entries have been received.
+	url := fmt.Sprintf("http://%s/loki/api/v1/push", c.DebugInfo().(debugInfo).ListenAddress)
+	errc := make(chan error, 1)
+	statusc := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(url, "application/x-protobuf", bytes.NewReader(snappy.Encode(nil, buf)))
+		if err == nil {
+			statusc <- resp.StatusCode
+			err = resp.Body.Close()
+		}
+		errc <- err
+	}()
+
+	for i, line := range []string{"hello", "world"} {
+		e := sourcetest.ReceiveEntry(t, ch)
+		require.Equal(t, model.LabelSet{"job": "app", "source": "api"}, e.Labels)
+		require.Equal(t, line, e.Line)
+		require.True(t, ts.Add(time.Duration(i)*time.Second).Equal(e.Timestamp))
+	}
+
+	require.NoError(t, <-errc)
+	require.Equal(t, http.StatusNoContent, <-statusc)
+
+	m := newMetricsFrom(t, reg)
+	require.Equal(t, 2.0, testutil.ToFloat64(m.entriesTotal.WithLabelValues(pushEndpoint)))
+}
+
+func TestPush_JSON(t *testing.T) {
+	ch := make(loki.LogsReceiver)
+	c, _ := runTestComponent(t, Arguments{
+		Labels:       map[string]string{"job": "overridden"},
+		RelabelRules: sourcetest.RelabelRules("app", "service"),
+		ForwardTo:    []loki.LogsReceiver{ch},
+	})
+
+	body := `{"streams": [{"stream": {"app": "web", "job": "web"}, "values": [["1672567200000000000", "hello"]]}]}`
+	rec := serveAsync(c, "/loki/api/v1/push", "application/json", body)
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"app": "web", "service": "web", "job": "overridden"}, e.Labels)
+	require.Equal(t, "hello", e.Line)
+	// Incoming timestamps are ignored unless use_incoming_timestamp is set.
+	require.WithinDuration(t, time.Now(), e.Timestamp, time.Minute)
+
+	require.Equal(t, http.StatusNoContent, (<-rec).Code)
+}
+
+func TestPush_Errors(t *testing.T) {
+	c, reg := runTestComponent(t, Arguments{})
+
+	tests := map[string]struct {
+		contentType string
+		body        string
+	}{
+		"invalid JSON": {
+			contentType: "application/json",
+			body:        `{"streams": [`,
+		},
+		"invalid labels": {
+			contentType: "application/json",
+			body:        `{"streams": [{"stream": {"1abc": "x"}, "values": [["1672567200000000000", "hello"]]}]}`,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			rec := <-serveAsync(c, "/loki/api/v1/push", tt.contentType, tt.body)
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	m := newMetricsFrom(t, reg)
+	require.Equal(t, 2.0, testutil.ToFloat64(m.requestErrorsTotal.WithLabelValues(pushEndpoint)))
+}
+
+func TestPush_TooLarge(t *testing.T) {
+	c, reg := runTestComponent(t, Arguments{
+		Labels: map[string]string{"job": "push"},
+	})
+
+	// Stream the body without a Content-Length, so that it's only rejected
+	// once the limit is reached while reading it.
+	body := io.MultiReader(
+		strings.NewReader(`{"streams": [{"stream": {"app": "a"}, "values": [["1672567200000000000", "`),
+		io.LimitReader(infiniteReader('x'), maxPushRequestSize),
+		strings.NewReader(`"]]}]}`),
+	)
+	req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	m := newMetricsFrom(t, reg)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.requestErrorsTotal.WithLabelValues(pushEndpoint)))
+}
+
+func TestRaw(t *testing.T) {
+	ch := make(loki.LogsReceiver)
+	c, reg := runTestComponent(t, Arguments{
+		Labels:    map[string]string{"job": "raw"},
+		ForwardTo: []loki.LogsReceiver{ch},
+	})
+
+	rec := serveAsync(c, "/loki/api/v1/raw", "text/plain", "first\r\n\n{\"msg\": \"second\"}\nthird")
+	for _, line := range []string{"first", `{"msg": "second"}`, "third"} {
+		e := sourcetest.ReceiveEntry(t, ch)
+		require.Equal(t, model.LabelSet{"job": "raw"}, e.Labels)
+		require.Equal(t, line, e.Line)
+	}
+	require.Equal(t, http.StatusNoContent, (<-rec).Code)
+
+	m := newMetricsFrom(t, reg)
+	require.Equal(t, 3.0, testutil.ToFloat64(m.entriesTotal.WithLabelValues(rawEndpoint)))
+}
+
+func TestRaw_TooLarge(t *testing.T) {
+	c, reg := runTestComponent(t, Arguments{
+		Labels: map[string]string{"job": "raw"},
+	})
+
+	body := strings.Repeat("x", maxRawLineSize+1)
+	rec := <-serveAsync(c, "/loki/api/v1/raw", "text/plain", body)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	m := newMetricsFrom(t, reg)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.requestErrorsTotal.WithLabelValues(rawEndpoint)))
+}
+
+func TestShutdown_InFlightRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := New(component.Options{
+		ID:         "loki.source.api.test",
+		Logger:     util.TestLogger(t),
+		Registerer: reg,
+	}, Arguments{
+		ListenAddress: "127.0.0.1:0",
+		Labels:        map[string]string{"job": "raw"},
+		// The receiver is never read from, so that the request never completes.
+		ForwardTo: []loki.LogsReceiver{make(loki.LogsReceiver)},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+
+	url := fmt.Sprintf("http://%s/loki/api/v1/raw", c.DebugInfo().(debugInfo).ListenAddress)
+	statusc := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(url, "text/plain", strings.NewReader("first\nsecond"))
+		if err != nil {
+			statusc <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		statusc <- resp.StatusCode
+	}()
+
+	// Wait for the handler to block on the second line, while Run blocks on
+	// forwarding the first one.
+	m := newMetricsFrom(t, reg)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.entriesTotal.WithLabelValues(rawEndpoint)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Stopping the component cancels the request instead of waiting for the
+	// shutdown timeout.
+	start := time.Now()
+	cancel()
+	<-done
+	require.Less(t, time.Since(start), shutdownTimeout/2)
+	require.Equal(t, http.StatusServiceUnavailable, <-statusc)
+}
+
+func TestUpdate(t *testing.T) {
+	c, _ := runTestComponent(t, Arguments{ListenAddress: "127.0.0.1:0"})
+	addr := c.DebugInfo().(debugInfo).ListenAddress
+	require.NotEmpty(t, addr)
+
+	// Updates which don't change the address keep the server running.
+	require.NoError(t, c.Update(Arguments{ListenAddress: "127.0.0.1:0", Labels: map[string]string{"job": "x"}}))
+	require.Equal(t, addr, c.DebugInfo().(debugInfo).ListenAddress)
+
+	// Removing the address stops the server.
+	require.NoError(t, c.Update(Arguments{}))
+	require.Empty(t, c.DebugInfo().(debugInfo).ListenAddress)
+	_, err := http.Post("http://"+addr+"/loki/api/v1/raw", "text/plain", strings.NewReader("x"))
+	require.Error(t, err)
+
+	// Listening on an address which is in use fails.
+	lis := httptest.NewServer(http.NotFoundHandler())
+	defer lis.Close()
+	require.Error(t, c.Update(Arguments{ListenAddress: lis.Listener.Addr().String()}))
+}
+
+// serveAsync sends a request to the handler of the component in the
+// background, as the handler blocks until the entries are received.
+func serveAsync(c *Component, path, contentType, body string) <-chan *httptest.ResponseRecorder {
+	res := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		c.Handler().ServeHTTP(rec, req)
+		res <- rec
+	}()
+	return res
+}
+
+// infiniteReader is an io.Reader returning the same byte forever.
+type infiniteReader byte
+
+func (r infiniteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func runTestComponent(t *testing.T, args Arguments) (*Component, prometheus.Registerer) {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	c, err := New(component.Options{
+		ID:         "loki.source.api.test",
+		Logger:     util.TestLogger(t),
+		Registerer: reg,
+	}, args)
+	require.NoError(t, err)
+
+	sourcetest.Run(t, c)
+	return c, reg
+}
+
+func newMetricsFrom(t *testing.T, reg prometheus.Registerer) *metrics {
+	t.Helper()
+
+	m := newMetrics(nil)
+	for _, c := range []**prometheus.CounterVec{&m.entriesTotal, &m.requestErrorsTotal} {
+		err := reg.Register(*c)
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		require.True(t, ok, "metric wasn't registered by the component: %v", err)
+		*c = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	return m
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/loki/pkg/loghttp/push"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	promql_parser "github.com/prometheus/prometheus/promql/parser"
+)
+
+// Names of the endpoints, used as the value of the endpoint label of the
+// component's metrics.
+const (
+	pushEndpoint = "push"
+	rawEndpoint  = "raw"
+)
+
+// Limits of the requests to the push and raw endpoints, so that a single
+// request can't make the component read an unbounded amount of data.
+const (
+	maxPushRequestSize = 100 << 20 // 100MiB
+	maxRawRequestSize  = 100 << 20 // 100MiB
+	maxRawLineSize     = 256 << 10 // 256KiB
+)
+
+// handlePush handles requests to the Loki push API. The request body can
+// either be a snappy-compressed protobuf or a JSON push request.
+func (c *Component) handlePush(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, maxPushRequestSize)
+
+	req, err := push.ParseRequest(c.opts.Logger, "", r, nil)
+	if err != nil {
+		status := http.StatusBadRequest
+		// The decoders don't always wrap the errors of the body they read, but
+		// the body keeps returning its error once the limit was exceeded.
+		var maxBytesErr *http.MaxBytesError
+		if _, bodyErr := r.Body.Read(nil); errors.As(bodyErr, &maxBytesErr) {
+			err, status = bodyErr, http.StatusRequestEntityTooLarge
+		}
+
+		level.Warn(c.opts.Logger).Log("msg", "failed to parse incoming push request", "err", err)
+		c.metrics.requestErrorsTotal.WithLabelValues(pushEndpoint).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	c.mut.RLock()
+	var (
+		staticLabels   = c.labels
+		relabelConfigs = c.relabelConfigs
+		keepTimestamp  = c.args.UseIncomingTimestamp
+	)
+	c.mut.RUnlock()
+
+	var lastErr error
+	for _, stream := range req.Streams {
+		ls, err := promql_parser.ParseMetric(stream.Labels)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid stream labels %q: %w", stream.Labels, err)
+			continue
+		}
+
+		lset := processLabels(ls, staticLabels, relabelConfigs)
+		if len(lset) == 0 {
+			continue
+		}
+
+		for _, entry := range stream.Entries {
+			e := loki.Entry{
+				Labels: lset.Clone(),
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      entry.Line,
+				},
+			}
+			if keepTimestamp {
+				e.Timestamp = entry.Timestamp
+			}
+
+			select {
+			case c.handler <- e:
+				c.metrics.entriesTotal.WithLabelValues(pushEndpoint).Inc()
+			case <-r.Context().Done():
+				http.Error(w, r.Context().Err().Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+
+	if lastErr != nil {
+		level.Warn(c.opts.Logger).Log("msg", "at least one stream in the push request failed to process", "err", lastErr)
+		c.metrics.requestErrorsTotal.WithLabelValues(pushEndpoint).Inc()
+		http.Error(w, lastErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRaw handles newline-delimited input such as plain text or NDJSON.
+// Every non-empty line is forwarded as a log entry with the configured
+// labels.
+func (c *Component) handleRaw(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, maxRawRequestSize)
+
+	c.mut.RLock()
+	var (
+		staticLabels   = c.labels
+		relabelConfigs = c.relabelConfigs
+	)
+	c.mut.RUnlock()
+
+	lset := processLabels(nil, staticLabels, relabelConfigs)
+	if len(lset) == 0 {
+		level.Debug(c.opts.Logger).Log("msg", "dropping raw request as it has no labels left after relabeling")
+		// Drain the body so that the client can reuse the connection.
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Leave room for the line terminator in the buffer of the scanner.
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, maxRawLineSize+len("\r\n"))
+	var err error
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if len(line) > maxRawLineSize {
+			err = bufio.ErrTooLong
+			break
+		}
+
+		e := loki.Entry{
+			Labels: lset.Clone(),
+			Entry: logproto.Entry{
+				Timestamp: time.Now(),
+				Line:      line,
+			},
+		}
+
+		select {
+		case c.handler <- e:
+			c.metrics.entriesTotal.WithLabelValues(rawEndpoint).Inc()
+		case <-r.Context().Done():
+			http.Error(w, r.Context().Err().Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.Is(err, bufio.ErrTooLong) || errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		level.Warn(c.opts.Logger).Log("msg", "failed to read incoming raw request", "err", err)
+		c.metrics.requestErrorsTotal.WithLabelValues(rawEndpoint).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processLabels adds the static labels to ls, applies the relabeling rules
+// and drops the labels with a double underscore prefix. An empty label set is
+// returned if the relabeling rules drop the stream.
+func processLabels(ls labels.Labels, static model.LabelSet, rcs []*relabel.Config) model.LabelSet {
+	lb := labels.NewBuilder(ls)
+	for k, v := range static {
+		lb.Set(string(k), string(v))
+	}
+
+	processed := lb.Labels(nil)
+	if len(rcs) > 0 {
+		processed = relabel.Process(processed, rcs...)
+	}
+
+	res := make(model.LabelSet, len(processed))
+	for _, l := range processed {
+		if strings.HasPrefix(l.Name, "__") {
+			continue
+		}
+		res[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return res
+}
@@ -0,0 +1,33 @@
+package api
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the metrics of the loki.source.api component.
+type metrics struct {
+	entriesTotal       *prometheus.CounterVec
+	requestErrorsTotal *prometheus.CounterVec
+}
+
+// newMetrics creates a new set of API metrics. If reg is non-nil, the metrics
+// will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.entriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_source_api_entries_total",
+		Help: "Total number of log entries received by the API component.",
+	}, []string{"endpoint"})
+	m.requestErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_source_api_request_errors_total",
+		Help: "Total number of push requests which couldn't be fully processed.",
+	}, []string{"endpoint"})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.entriesTotal,
+			m.requestErrorsTotal,
+		)
+	}
+
+	return &m
+}
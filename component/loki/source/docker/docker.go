@@ -0,0 +1,259 @@
+// Package docker implements the loki.source.docker component, which follows
+// the logs of containers through the Docker Engine API.
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/dskit/backoff"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.docker",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// tailerBackoff is the backoff used by tailers between two log streams.
+var tailerBackoff = backoff.Config{
+	MinBackoff: time.Second,
+	MaxBackoff: time.Minute,
+}
+
+// Arguments holds values which are used to configure the loki.source.docker
+// component.
+type Arguments struct {
+	Host         string              `river:"host,attr"`
+	Targets      []discovery.Target  `river:"targets,attr"`
+	ForwardTo    []loki.LogsReceiver `river:"forward_to,attr"`
+	RelabelRules flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// Component implements the loki.source.docker component.
+type Component struct {
+	opts    component.Options
+	metrics *metrics
+
+	mut       sync.RWMutex
+	args      Arguments
+	client    client.APIClient
+	handler   loki.LogsReceiver
+	receivers []loki.LogsReceiver
+	posFile   positions.Positions
+	tailers   map[string]*tailer
+}
+
+// New creates a new loki.source.docker component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	err := os.MkdirAll(o.DataPath, 0750)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	positionsFile, err := positions.New(o.Logger, positions.Config{
+		SyncPeriod:        10 * time.Second,
+		PositionsFile:     filepath.Join(o.DataPath, "positions.yml"),
+		IgnoreInvalidYaml: false,
+		ReadOnly:          false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:    o,
+		metrics: newMetrics(o.Registerer),
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+		posFile:   positionsFile,
+		tailers:   make(map[string]*tailer),
+	}
+
+	// Call to Update() to start tailers and set receivers once at the start.
+	if err := c.Update(args); err != nil {
+		positionsFile.Stop()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.docker component shutting down, stopping tailers")
+		c.mut.Lock()
+		c.stopTailers()
+		if c.client != nil {
+			c.client.Close()
+		}
+		c.mut.Unlock()
+		c.posFile.Stop()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.receivers = newArgs.ForwardTo
+
+	// All tailers are restarted when the host changes, so that they follow
+	// the logs through the new client.
+	if c.client == nil || newArgs.Host != c.args.Host {
+		cli, err := client.NewClientWithOpts(
+			client.WithHost(newArgs.Host),
+			client.WithAPIVersionNegotiation(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create Docker client: %w", err)
+		}
+		c.stopTailers()
+		if c.client != nil {
+			c.client.Close()
+		}
+		c.client = cli
+	}
+	c.args = newArgs
+
+	// Containers are discovered once per exposed port, so only the first
+	// target of each container is used.
+	rcs := flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules)
+	targets := make(map[string]discovery.Target, len(newArgs.Targets))
+	for _, target := range newArgs.Targets {
+		id := target[containerIDLabel]
+		if id == "" {
+			level.Warn(c.opts.Logger).Log("msg", "ignoring target without a container ID", "target", fmt.Sprint(target))
+			continue
+		}
+		if _, ok := targets[id]; !ok {
+			targets[id] = target
+		}
+	}
+
+	// The positions of containers which aren't targeted anymore are removed,
+	// as they've most likely been removed.
+	for id, t := range c.tailers {
+		if _, ok := targets[id]; ok {
+			continue
+		}
+		t.Stop()
+		delete(c.tailers, id)
+		c.posFile.Remove(t.posKey, "")
+	}
+
+	opts := tailerOptions{
+		logger:    c.opts.Logger,
+		metrics:   c.metrics,
+		client:    c.client,
+		positions: c.posFile,
+		handler:   c.handler,
+		backoff:   tailerBackoff,
+	}
+	for id, target := range targets {
+		labels := streamLabels(target, rcs)
+
+		// Tailers whose labels haven't changed keep running, so that their
+		// streams aren't interrupted.
+		if t, ok := c.tailers[id]; ok {
+			if reflect.DeepEqual(t.labels, labels) {
+				continue
+			}
+			t.Stop()
+		}
+		level.Debug(c.opts.Logger).Log("msg", "tailing container", "container", id)
+		c.tailers[id] = newTailer(opts, id, labels)
+	}
+
+	if len(c.tailers) == 0 {
+		level.Debug(c.opts.Logger).Log("msg", "no container targets were passed, nothing will be tailed")
+	}
+	return nil
+}
+
+// stopTailers stops all the tailers. c.mut must be held.
+func (c *Component) stopTailers() {
+	for id, t := range c.tailers {
+		t.Stop()
+		delete(c.tailers, id)
+	}
+}
+
+// DebugInfo returns information about the status of tailed containers.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res debugInfo
+	for id, t := range c.tailers {
+		info := targetInfo{
+			ID:        id,
+			Labels:    t.labels[stdoutStream].String(),
+			LastEntry: c.posFile.GetString(t.posKey, ""),
+		}
+		if err := t.LastError(); err != nil {
+			info.LastError = err.Error()
+		}
+		res.TargetsInfo = append(res.TargetsInfo, info)
+	}
+	sort.Slice(res.TargetsInfo, func(i, j int) bool {
+		return res.TargetsInfo[i].ID < res.TargetsInfo[j].ID
+	})
+	return res
+}
+
+type debugInfo struct {
+	TargetsInfo []targetInfo `river:"targets_info,attr"`
+}
+
+type targetInfo struct {
+	ID        string `river:"id,attr"`
+	Labels    string `river:"labels,attr"`
+	LastEntry string `river:"last_entry,attr"`
+	LastError string `river:"last_error,attr"`
+}
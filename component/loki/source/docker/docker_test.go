@@ -0,0 +1,295 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+const testContainerID = "1a2b3c"
+
+func TestDocker(t *testing.T) {
+	useTestBackoff(t)
+
+	srv := newFakeDocker(t, false)
+	srv.add(stdoutStream, "2023-01-01T10:00:00.1Z hello\n")
+	srv.add(stderrStream, "2023-01-01T10:00:00.2Z oops\n")
+	// Long lines are split across several frames.
+	srv.add(stdoutStream, "2023-01-01T10:00:00.3Z split ")
+	srv.add(stdoutStream, "line\n")
+
+	ch := make(loki.LogsReceiver)
+	args := testArguments(srv, ch)
+	dataPath := t.TempDir()
+	c, stop := runTestComponent(t, dataPath, args)
+
+	expectEntries(t, ch,
+		testEntry{stdoutStream, "hello"},
+		testEntry{stderrStream, "oops"},
+		testEntry{stdoutStream, "split line"},
+	)
+
+	// Reconnections only request the logs since the last entry.
+	require.Eventually(t, func() bool {
+		return srv.lastSince() == "1672567200.300000000"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info := c.DebugInfo().(debugInfo)
+	require.Len(t, info.TargetsInfo, 1)
+	require.Equal(t, testContainerID, info.TargetsInfo[0].ID)
+	require.Equal(t, "2023-01-01T10:00:00.3Z", info.TargetsInfo[0].LastEntry)
+
+	// Tailing resumes from the saved position after a restart.
+	stop()
+	srv.add(stdoutStream, "2023-01-01T10:00:01Z after restart\n")
+	_, _ = runTestComponent(t, dataPath, args)
+	expectEntries(t, ch, testEntry{stdoutStream, "after restart"})
+}
+
+func TestDocker_TTY(t *testing.T) {
+	useTestBackoff(t)
+
+	srv := newFakeDocker(t, true)
+	srv.add(stdoutStream, "2023-01-01T10:00:00.1Z first\r\n2023-01-01T10:00:00.2Z second\r\n")
+
+	ch := make(loki.LogsReceiver)
+	_, _ = runTestComponent(t, t.TempDir(), testArguments(srv, ch))
+
+	expectEntries(t, ch,
+		testEntry{stdoutStream, "first"},
+		testEntry{stdoutStream, "second"},
+	)
+}
+
+func TestDocker_Update(t *testing.T) {
+	useTestBackoff(t)
+
+	srv := newFakeDocker(t, false)
+	srv.add(stdoutStream, "2023-01-01T10:00:00.1Z hello\n")
+
+	ch := make(loki.LogsReceiver)
+	args := testArguments(srv, ch)
+	args.Targets = append(args.Targets, discovery.Target{"__meta_docker_container_name": "/no-id"})
+	c, _ := runTestComponent(t, t.TempDir(), args)
+
+	expectEntries(t, ch, testEntry{stdoutStream, "hello"})
+	require.Len(t, c.tailers, 1)
+	tt := c.tailers[testContainerID]
+
+	// Updates which don't change the labels keep the tailers running.
+	require.NoError(t, c.Update(args))
+	require.Same(t, tt, c.tailers[testContainerID])
+
+	// Changing the relabeling rules restarts the tailers.
+	args.RelabelRules = args.RelabelRules[:1]
+	require.NoError(t, c.Update(args))
+	require.NotSame(t, tt, c.tailers[testContainerID])
+
+	// Removed containers are stopped and their positions are removed.
+	args.Targets = nil
+	require.NoError(t, c.Update(args))
+	require.Empty(t, c.tailers)
+	require.Empty(t, c.posFile.GetString(tt.posKey, ""))
+}
+
+func TestReadMultiplexed_SystemError(t *testing.T) {
+	var body strings.Builder
+	_, _ = stdcopy.NewStdWriter(&body, stdcopy.Systemerr).Write([]byte("daemon failure"))
+
+	// The system error ends the stream before any line is handled.
+	tt := &tailer{logger: util.TestLogger(t)}
+	err := tt.readMultiplexed(context.Background(), nil, strings.NewReader(body.String()))
+	require.EqualError(t, err, "error from the Docker daemon: daemon failure")
+}
+
+type testEntry struct {
+	stream string
+	line   string
+}
+
+// expectEntries requires the next entries to be the given lines of the test
+// container, and no other entries to follow, such as duplicates of lines which
+// were already read.
+func expectEntries(t *testing.T, ch chan loki.Entry, entries ...testEntry) {
+	t.Helper()
+
+	expected := make([]sourcetest.Entry, 0, len(entries))
+	for _, e := range entries {
+		expected = append(expected, sourcetest.Entry{
+			Line:   e.line,
+			Labels: model.LabelSet{"container": "/app", "stream": model.LabelValue(e.stream)},
+		})
+	}
+	sourcetest.ExpectEntries(t, ch, expected...)
+	sourcetest.RequireNoEntry(t, ch, 100*time.Millisecond)
+}
+
+func testArguments(srv *fakeDocker, ch loki.LogsReceiver) Arguments {
+	return Arguments{
+		Host: "tcp://" + srv.Listener.Addr().String(),
+		Targets: []discovery.Target{
+			{containerIDLabel: testContainerID, "__meta_docker_container_name": "/app", "__meta_docker_port_private": "80"},
+			{containerIDLabel: testContainerID, "__meta_docker_container_name": "/app", "__meta_docker_port_private": "443"},
+		},
+		ForwardTo: []loki.LogsReceiver{ch},
+		RelabelRules: sourcetest.RelabelRules(
+			"__meta_docker_container_name", "container",
+			logStreamLabel, "stream",
+		),
+	}
+}
+
+func useTestBackoff(t *testing.T) {
+	prev := tailerBackoff
+	tailerBackoff = backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	t.Cleanup(func() { tailerBackoff = prev })
+}
+
+// runTestComponent runs a component until either the test ends or the
+// returned function is called.
+func runTestComponent(t *testing.T, dataPath string, args Arguments) (*Component, func()) {
+	t.Helper()
+
+	c, err := New(component.Options{
+		ID:         "loki.source.docker.test",
+		Logger:     util.TestLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		DataPath:   dataPath,
+	}, args)
+	require.NoError(t, err)
+
+	return c, sourcetest.Run(t, c)
+}
+
+// fakeDocker is a fake Docker Engine API serving a single container. Its log
+// stream ends once the existing logs have been sent, as if the container had
+// stopped.
+type fakeDocker struct {
+	*httptest.Server
+	tty bool
+
+	mut    sync.Mutex
+	frames []testEntry
+	since  []string
+}
+
+var (
+	inspectPath = regexp.MustCompile(`^(/v[\d.]+)?/containers/([^/]+)/json$`)
+	logsPath    = regexp.MustCompile(`^(/v[\d.]+)?/containers/([^/]+)/logs$`)
+)
+
+func newFakeDocker(t *testing.T, tty bool) *fakeDocker {
+	f := &fakeDocker{tty: tty}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// add adds a frame to the logs of the container.
+func (f *fakeDocker) add(stream, frame string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.frames = append(f.frames, testEntry{stream: stream, line: frame})
+}
+
+func (f *fakeDocker) lastSince() string {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if len(f.since) == 0 {
+		return ""
+	}
+	return f.since[len(f.since)-1]
+}
+
+func (f *fakeDocker) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Header().Set("API-Version", "1.41")
+		_, _ = io.WriteString(w, "OK")
+
+	case inspectPath.MatchString(r.URL.Path):
+		if inspectPath.FindStringSubmatch(r.URL.Path)[2] != testContainerID {
+			http.Error(w, `{"message": "No such container"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: testContainerID},
+			Config:            &container.Config{Tty: f.tty},
+		})
+
+	case logsPath.MatchString(r.URL.Path):
+		query := r.URL.Query()
+		if query.Get("stdout") != "1" || query.Get("stderr") != "1" || query.Get("timestamps") != "1" || query.Get("follow") != "1" {
+			http.Error(w, fmt.Sprintf(`{"message": "unexpected query %q"}`, r.URL.RawQuery), http.StatusBadRequest)
+			return
+		}
+
+		f.mut.Lock()
+		f.since = append(f.since, query.Get("since"))
+		frames := append([]testEntry(nil), f.frames...)
+		f.mut.Unlock()
+
+		var (
+			since = parseSince(query.Get("since"))
+			skip  bool
+		)
+		for _, frame := range frames {
+			// Frames continuing a line don't start with a timestamp, and are
+			// only sent if the beginning of their line is.
+			rawTs, _, _ := strings.Cut(frame.line, " ")
+			if ts, err := time.Parse(time.RFC3339Nano, rawTs); err == nil {
+				skip = ts.Before(since)
+			}
+			if skip {
+				continue
+			}
+
+			var out io.Writer = w
+			if !f.tty {
+				streamType := stdcopy.Stdout
+				if frame.stream == stderrStream {
+					streamType = stdcopy.Stderr
+				}
+				out = stdcopy.NewStdWriter(w, streamType)
+			}
+			_, _ = io.WriteString(out, frame.line)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// parseSince parses the since query parameter of the logs endpoint, in the
+// format seconds.nanoseconds.
+func parseSince(since string) time.Time {
+	if since == "" {
+		return time.Time{}
+	}
+	secs, nsecs, _ := strings.Cut(since, ".")
+	s, _ := strconv.ParseInt(secs, 10, 64)
+	ns, _ := strconv.ParseInt(nsecs, 10, 64)
+	return time.Unix(s, ns)
+}
@@ -0,0 +1,33 @@
+package docker
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the metrics of the loki.source.docker component.
+type metrics struct {
+	dockerEntries prometheus.Counter
+	dockerErrors  prometheus.Counter
+}
+
+// newMetrics creates a new set of Docker metrics. If reg is non-nil, the
+// metrics will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.dockerEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_docker_target_entries_total",
+		Help: "Total number of successful entries sent to the Docker target.",
+	})
+	m.dockerErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_docker_target_parsing_errors_total",
+		Help: "Total number of parsing errors while receiving Docker messages.",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.dockerEntries,
+			m.dockerErrors,
+		)
+	}
+
+	return &m
+}
@@ -0,0 +1,227 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	docker_types "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/loki/source/internal/logstream"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+const (
+	containerIDLabel = "__meta_docker_container_id"
+	logStreamLabel   = "__meta_docker_container_log_stream"
+
+	stdoutStream = "stdout"
+	stderrStream = "stderr"
+
+	// frameHeaderLen is the length of the header of the frames of
+	// multiplexed log streams.
+	frameHeaderLen = 8
+)
+
+// tailerOptions are the dependencies of a tailer which are shared between all
+// the tailers of a component.
+type tailerOptions struct {
+	logger    log.Logger
+	metrics   *metrics
+	client    client.APIClient
+	positions positions.Positions
+	handler   loki.LogsReceiver
+	backoff   backoff.Config
+}
+
+// tailer follows the logs of a single container, reconnecting when the log
+// stream ends, for example because the container was restarted.
+type tailer struct {
+	*logstream.Tailer
+
+	opts        tailerOptions
+	logger      log.Logger
+	containerID string
+	// labels holds the labels of the entries of each log stream, which are
+	// empty if the entries are dropped by relabeling rules.
+	labels map[string]model.LabelSet
+	posKey string
+}
+
+// newTailer creates and starts a tailer for the container with the given ID.
+func newTailer(opts tailerOptions, containerID string, labels map[string]model.LabelSet) *tailer {
+	t := &tailer{
+		opts:        opts,
+		logger:      log.With(opts.logger, "container", containerID),
+		containerID: containerID,
+		labels:      labels,
+		posKey:      positions.CursorKey(containerID),
+	}
+	t.Tailer = logstream.New(logstream.Options{
+		Logger:      t.logger,
+		Handler:     opts.handler,
+		Backoff:     opts.backoff,
+		Positions:   opts.positions,
+		PositionKey: t.posKey,
+		Entries:     opts.metrics.dockerEntries,
+		ParseErrors: opts.metrics.dockerErrors,
+		OnError: func(err error, numRetries int) {
+			level.Warn(t.logger).Log("msg", "failed to read container logs", "err", err, "num_retries", numRetries)
+		},
+	}, t.tail)
+	return t
+}
+
+// tail follows the logs of the container until the log stream ends.
+func (t *tailer) tail(ctx context.Context, s *logstream.Stream) error {
+	info, err := t.opts.client.ContainerInspect(ctx, t.containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	opts := docker_types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if since := s.Since(); !since.IsZero() {
+		opts.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	}
+
+	logs, err := t.opts.client.ContainerLogs(ctx, t.containerID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to fetch container logs: %w", err)
+	}
+	defer logs.Close()
+
+	// The logs of containers with a TTY aren't multiplexed, as there's only a
+	// single output stream.
+	if info.Config != nil && info.Config.Tty {
+		return t.readRaw(ctx, s, logs)
+	}
+	return t.readMultiplexed(ctx, s, logs)
+}
+
+// readRaw forwards the lines of a raw log stream as stdout entries.
+func (t *tailer) readRaw(ctx context.Context, s *logstream.Stream, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if err := s.Handle(ctx, t.labels[stdoutStream], strings.TrimRight(line, "\r\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// readMultiplexed demultiplexes a log stream holding both stdout and stderr,
+// and forwards their lines. Each frame of the stream is prefixed by a header
+// holding the type of the stream and the length of the frame. Lines can span
+// several frames.
+func (t *tailer) readMultiplexed(ctx context.Context, s *logstream.Stream, r io.Reader) error {
+	var (
+		br      = bufio.NewReader(r)
+		header  [frameHeaderLen]byte
+		pending = make(map[string][]byte)
+	)
+
+	handle := func(stream string, line []byte) error {
+		return s.Handle(ctx, t.labels[stream], strings.TrimRight(string(line), "\r\n"))
+	}
+
+	for {
+		if _, err := io.ReadFull(br, header[:]); err == io.EOF {
+			// Forward the last lines of the streams even if they aren't
+			// terminated by a newline.
+			for _, stream := range []string{stdoutStream, stderrStream} {
+				if len(pending[stream]) > 0 {
+					if err := handle(stream, pending[stream]); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		frame := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return err
+		}
+
+		var stream string
+		switch stdcopy.StdType(header[0]) {
+		case stdcopy.Stdout:
+			stream = stdoutStream
+		case stdcopy.Stderr:
+			stream = stderrStream
+		case stdcopy.Systemerr:
+			return fmt.Errorf("error from the Docker daemon: %s", frame)
+		default:
+			return fmt.Errorf("unrecognized stream type %d", header[0])
+		}
+
+		buf := append(pending[stream], frame...)
+		for {
+			i := bytes.IndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			if err := handle(stream, buf[:i]); err != nil {
+				return err
+			}
+			buf = buf[i+1:]
+		}
+		pending[stream] = buf
+	}
+}
+
+// streamLabels returns the labels of the entries of each log stream of a
+// target, after applying the relabeling rules and dropping the labels with a
+// double underscore prefix.
+func streamLabels(target discovery.Target, rcs []*relabel.Config) map[string]model.LabelSet {
+	res := make(map[string]model.LabelSet, 2)
+	for _, stream := range []string{stdoutStream, stderrStream} {
+		lb := labels.NewBuilder(nil)
+		for k, v := range target {
+			lb.Set(k, v)
+		}
+		lb.Set(logStreamLabel, stream)
+
+		processed := lb.Labels(nil)
+		if len(rcs) > 0 {
+			processed = relabel.Process(processed, rcs...)
+		}
+
+		lset := make(model.LabelSet, len(processed))
+		for _, l := range processed {
+			if strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+				continue
+			}
+			lset[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		}
+		res[stream] = lset
+	}
+	return res
+}
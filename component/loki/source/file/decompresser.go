@@ -5,6 +5,7 @@ package file
 // compress/* packages for decoding.
 
 import (
+	"archive/zip"
 	"bufio"
 	"compress/bzip2"
 	"compress/gzip"
@@ -23,11 +24,10 @@ import (
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/common/loki/positions"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/klauspost/compress/zstd"
 	"github.com/prometheus/common/model"
+	"github.com/ulikunitz/xz"
 	"go.uber.org/atomic"
-	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/ianaindex"
-	"golang.org/x/text/transform"
 )
 
 func supportedCompressedFormats() map[string]struct{} {
@@ -36,7 +36,9 @@ func supportedCompressedFormats() map[string]struct{} {
 		".tar.gz": {},
 		".z":      {},
 		".bz2":    {},
-		// TODO: add support for .zip extension.
+		".zip":    {},
+		".zst":    {},
+		".xz":     {},
 	}
 }
 
@@ -44,10 +46,12 @@ type decompressor struct {
 	metrics   *metrics
 	logger    log.Logger
 	handler   loki.EntryHandler
+	next      loki.EntryHandler // The handler wrapped by handler.
 	positions positions.Positions
 
-	path   string
-	labels string
+	path      string
+	labels    string
+	afterRead CompressedFiles
 
 	posAndSizeMtx sync.Mutex
 	stopOnce      sync.Once
@@ -57,13 +61,15 @@ type decompressor struct {
 	posdone chan struct{}
 	done    chan struct{}
 
-	decoder *encoding.Decoder
+	decoder             *lineDecoder
+	maxLineSize         int
+	maxLineSizeTruncate bool
 
 	position int64
 	size     int64
 }
 
-func newDecompressor(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string, labels string, encodingFormat string) (*decompressor, error) {
+func newDecompressor(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string, labels string, encodingFormat string, maxLineSize int, maxLineSizeTruncate bool, afterRead CompressedFiles) (*decompressor, error) {
 	logger = log.With(logger, "component", "decompressor")
 
 	pos, err := positions.Get(path, labels)
@@ -71,29 +77,43 @@ func newDecompressor(metrics *metrics, logger log.Logger, handler loki.EntryHand
 		return nil, fmt.Errorf("failed to get positions: %w", err)
 	}
 
-	var decoder *encoding.Decoder
+	// Record the identity of the file, so that its position is kept if it's
+	// renamed, and reset if it's replaced by another file.
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := fileID(fi); ok {
+		positions.PutFileID(path, labels, id)
+	}
+
+	var decoder *lineDecoder
 	if encodingFormat != "" {
 		level.Info(logger).Log("msg", "decompressor will decode messages", "from", encodingFormat, "to", "UTF8")
-		encoder, err := ianaindex.IANA.Encoding(encodingFormat)
+		decoder, err = newLineDecoder(encodingFormat)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get IANA encoding %s: %w", encodingFormat, err)
+			return nil, err
 		}
-		decoder = encoder.NewDecoder()
 	}
 
 	decompressor := &decompressor{
 		metrics:   metrics,
 		logger:    logger,
 		handler:   loki.AddLabelsMiddleware(model.LabelSet{filenameLabel: model.LabelValue(path)}).Wrap(handler),
+		next:      handler,
 		positions: positions,
 		path:      path,
 		labels:    labels,
+		afterRead: afterRead,
 		running:   atomic.NewBool(false),
 		posquit:   make(chan struct{}),
 		posdone:   make(chan struct{}),
 		done:      make(chan struct{}),
 		position:  pos,
-		decoder:   decoder,
+
+		decoder:             decoder,
+		maxLineSize:         maxLineSize,
+		maxLineSizeTruncate: maxLineSizeTruncate,
 	}
 
 	go decompressor.readLines()
@@ -106,7 +126,7 @@ func newDecompressor(metrics *metrics, logger log.Logger, handler loki.EntryHand
 //
 // The selected reader implementation is based on the extension of the given file name.
 // It'll error if the extension isn't supported.
-func mountReader(f *os.File, logger log.Logger) (reader io.Reader, err error) {
+func mountReader(f *os.File, logger log.Logger) (reader io.ReadCloser, err error) {
 	ext := filepath.Ext(f.Name())
 	var decompressLib string
 
@@ -118,25 +138,108 @@ func mountReader(f *os.File, logger log.Logger) (reader io.Reader, err error) {
 		reader, err = zlib.NewReader(f)
 	} else if ext == ".bz2" {
 		decompressLib = "bzip2"
-		reader = bzip2.NewReader(f)
+		reader = io.NopCloser(bzip2.NewReader(f))
+	} else if ext == ".zip" {
+		decompressLib = "archive/zip"
+		reader, err = newZipReader(f)
+	} else if ext == ".zst" {
+		decompressLib = "zstd"
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(f, zstd.WithDecoderConcurrency(1)); err == nil {
+			reader = zr.IOReadCloser()
+		}
+	} else if ext == ".xz" {
+		decompressLib = "xz"
+		var xr *xz.Reader
+		if xr, err = xz.NewReader(f); err == nil {
+			reader = io.NopCloser(xr)
+		}
+	}
+
+	if decompressLib == "" {
+		supportedExtsList := strings.Builder{}
+		for ext := range supportedCompressedFormats() {
+			supportedExtsList.WriteString(ext)
+		}
+		return nil, fmt.Errorf("file %q has unsupported extension, it has to be one of %q", f.Name(), supportedExtsList.String())
 	}
-	// TODO: add support for .zip extension.
 
 	level.Debug(logger).Log("msg", fmt.Sprintf("using %q to decompress file %q", decompressLib, f.Name()))
 
-	if reader != nil {
-		return reader, nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q with %q: %w", f.Name(), decompressLib, err)
 	}
+	return reader, nil
+}
+
+// zipReader reads the content of the files of a zip archive one after the
+// other. A newline is inserted after the files which don't end with one, so
+// that lines from different files are never merged.
+type zipReader struct {
+	files   []*zip.File
+	current io.ReadCloser
+	last    byte
+}
 
-	if err != nil && err != io.EOF {
+func newZipReader(f *os.File) (*zipReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
 		return nil, err
 	}
 
-	supportedExtsList := strings.Builder{}
-	for ext := range supportedCompressedFormats() {
-		supportedExtsList.WriteString(ext)
+	r := &zipReader{last: '\n'}
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		r.files = append(r.files, file)
 	}
-	return nil, fmt.Errorf("file %q has unsupported extension, it has to be one of %q", f.Name(), supportedExtsList.String())
+	return r, nil
+}
+
+func (r *zipReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.files[0].Open()
+			if err != nil {
+				return 0, err
+			}
+			r.files = r.files[1:]
+			r.current = rc
+		}
+
+		n, err := r.current.Read(p)
+		if n > 0 {
+			r.last = p[n-1]
+			return n, nil
+		}
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if r.last != '\n' && len(p) > 0 {
+				p[0], r.last = '\n', '\n'
+				return 1, nil
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (r *zipReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Close()
 }
 
 func (d *decompressor) updatePosition() {
@@ -166,6 +269,12 @@ func (d *decompressor) updatePosition() {
 // It first decompress the file as a whole using a reader and then it will iterate
 // over its chunks, separated by '\n'.
 // During each iteration, the parsed and decoded log line is then sent to the API with the current timestamp.
+//
+// Once all the lines were read, the file is deleted or moved if configured to.
+// This only happens after every entry was handed over to the component and
+// the final position of the file was written to the positions file, so that a
+// file is never removed before its entries were forwarded, and a file which
+// couldn't be removed isn't read again.
 func (d *decompressor) readLines() {
 	level.Info(d.logger).Log("msg", "read lines routine: started", "path", d.path)
 	d.running.Store(true)
@@ -175,39 +284,85 @@ func (d *decompressor) readLines() {
 		level.Info(d.logger).Log("msg", "read lines routine finished", "path", d.path)
 		close(d.done)
 	}()
+
+	if !d.readFile() {
+		return
+	}
+	level.Info(d.logger).Log("msg", "finished reading compressed file", "path", d.path)
+
+	switch d.afterRead.AfterRead {
+	case AfterReadDelete, AfterReadMove:
+		if d.flush() {
+			d.handleReadFile()
+		}
+	}
+}
+
+// flush waits for the entries sent by readFile to be forwarded by the
+// handlers, and writes the final position of the file to the positions file.
+// It returns false if the decompressor was stopped first.
+func (d *decompressor) flush() bool {
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		// Stopping a handler waits for the entry it holds to be forwarded.
+		d.handler.Stop()
+		d.next.Stop()
+	}()
+
+	select {
+	case <-flushed:
+	case <-d.posquit:
+		return false
+	}
+
+	if err := d.MarkPositionAndSize(); err != nil {
+		level.Error(d.logger).Log("msg", "error marking file position after reading compressed file", "path", d.path, "error", err)
+		return false
+	}
+	d.positions.Sync()
+	return true
+}
+
+// readFile sends the lines of the file which weren't read yet, and returns
+// whether the end of the file was reached.
+func (d *decompressor) readFile() bool {
 	entries := d.handler.Chan()
 
 	f, err := os.Open(d.path)
 	if err != nil {
 		level.Error(d.logger).Log("msg", "error reading file", "path", d.path, "error", err)
-		return
+		return false
 	}
 	defer f.Close()
 
 	r, err := mountReader(f, d.logger)
 	if err != nil {
 		level.Error(d.logger).Log("msg", "error mounting new reader", "err", err)
-		return
+		return false
 	}
+	defer r.Close()
 
 	level.Info(d.logger).Log("msg", "successfully mounted reader", "path", d.path, "ext", filepath.Ext(d.path))
 
-	bufferSize := 4096
-	buffer := make([]byte, bufferSize)
-	maxLoglineSize := 2000000 // 2 MB
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(buffer, maxLoglineSize)
-	for line := 1; ; line++ {
-		if !scanner.Scan() {
-			break
-		}
+	br := bufio.NewReader(r)
+	if d.decoder != nil {
+		// The byte order must be known to split the lines of UTF-16 files.
+		start, _ := br.Peek(len(utf16LEBOM))
+		d.decoder.detectByteOrder(start)
+	}
+	lr := newLineReader(br, 0, d.decoder.newline(), d.decoder.maxRawLineSize(d.maxLineSize))
 
-		if scannerErr := scanner.Err(); scannerErr != nil {
-			if scannerErr != io.EOF {
-				level.Error(d.logger).Log("msg", "error scanning", "err", scannerErr)
+	for line := 1; ; line++ {
+		b, cut, err := lr.ReadLine()
+		if err == io.EOF {
+			// Send the last line even if it isn't followed by a newline.
+			if b, cut = lr.Rest(); len(b) == 0 {
+				break
 			}
-
-			break
+		} else if err != nil {
+			level.Error(d.logger).Log("msg", "error reading lines", "path", d.path, "err", err)
+			return false
 		}
 
 		if line <= int(d.position) {
@@ -215,32 +370,79 @@ func (d *decompressor) readLines() {
 			continue
 		}
 
-		text := scanner.Text()
 		var finalText string
 		if d.decoder != nil {
 			var err error
-			finalText, err = d.convertToUTF8(text)
+			finalText, err = d.convertToUTF8(string(b))
 			if err != nil {
 				level.Debug(d.logger).Log("msg", "failed to convert encoding", "error", err)
 				d.metrics.encodingFailures.WithLabelValues(d.path).Inc()
 				finalText = fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent: %s", err.Error())
 			}
 		} else {
-			finalText = text
+			finalText = string(b)
 		}
+		finalText = strings.TrimSuffix(finalText, "\r")
 
 		d.metrics.readLines.WithLabelValues(d.path).Inc()
 
-		entries <- loki.Entry{
-			Labels: model.LabelSet{},
-			Entry: logproto.Entry{
-				Timestamp: time.Now(),
-				Line:      finalText,
-			},
+		finalText, send, oversized := limitLineSize(finalText, cut, d.maxLineSize, d.maxLineSizeTruncate)
+		if oversized {
+			d.metrics.oversizedLines.WithLabelValues(d.path).Inc()
+		}
+
+		// Dropped lines still count towards the position, so that they're
+		// skipped the next time the file is opened.
+		if send {
+			entry := loki.Entry{
+				Labels: model.LabelSet{},
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      finalText,
+				},
+			}
+			select {
+			case entries <- entry:
+			case <-d.posquit:
+				// The decompressor is stopping, the remaining lines are read
+				// the next time the file is opened.
+				return false
+			}
 		}
 
+		d.posAndSizeMtx.Lock()
 		d.size = int64(unsafe.Sizeof(finalText))
 		d.position++
+		d.posAndSizeMtx.Unlock()
+	}
+	return true
+}
+
+// handleReadFile deletes or moves the file once all of its lines were read.
+func (d *decompressor) handleReadFile() {
+	switch d.afterRead.AfterRead {
+	case AfterReadDelete:
+		if err := os.Remove(d.path); err != nil {
+			level.Error(d.logger).Log("msg", "failed to delete read file", "path", d.path, "error", err)
+			return
+		}
+		level.Info(d.logger).Log("msg", "deleted read file", "path", d.path)
+
+	case AfterReadMove:
+		dst := filepath.Join(d.afterRead.MoveTo, filepath.Base(d.path))
+		if _, err := os.Stat(dst); err == nil {
+			level.Error(d.logger).Log("msg", "failed to move read file, destination already exists", "path", d.path, "destination", dst)
+			return
+		}
+		if err := os.MkdirAll(d.afterRead.MoveTo, 0750); err != nil {
+			level.Error(d.logger).Log("msg", "failed to create directory to move read file to", "path", d.path, "directory", d.afterRead.MoveTo, "error", err)
+			return
+		}
+		if err := os.Rename(d.path, dst); err != nil {
+			level.Error(d.logger).Log("msg", "failed to move read file", "path", d.path, "destination", dst, "error", err)
+			return
+		}
+		level.Info(d.logger).Log("msg", "moved read file", "path", d.path, "destination", dst)
 	}
 }
 
@@ -260,19 +462,20 @@ func (d *decompressor) Stop() {
 	// stop can be called by two separate threads in filetarget, to avoid a panic closing channels more than once
 	// we wrap the stop in a sync.Once.
 	d.stopOnce.Do(func() {
-		// Shut down the position marker thread
+		// Shut down the position marker thread, which also makes readLines()
+		// stop sending lines.
 		close(d.posquit)
 		<-d.posdone
 
-		// Save the current position before shutting down reader
+		// Wait for readLines() to exit, and save the position of the last line
+		// it sent.
+		<-d.done
 		if err := d.MarkPositionAndSize(); err != nil {
 			level.Error(d.logger).Log("msg", "error marking file position when stopping decompressor", "path", d.path, "error", err)
 		}
-
-		// Wait for readLines() to consume all the remaining messages and exit when the channel is closed
-		<-d.done
 		level.Info(d.logger).Log("msg", "stopped decompressor", "path", d.path)
 		d.handler.Stop()
+		d.next.Stop()
 	})
 }
 
@@ -281,12 +484,7 @@ func (d *decompressor) IsRunning() bool {
 }
 
 func (d *decompressor) convertToUTF8(text string) (string, error) {
-	res, _, err := transform.String(d.decoder, text)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode text to UTF8: %w", err)
-	}
-
-	return res, nil
+	return d.decoder.decode(text)
 }
 
 // cleanupMetrics removes all metrics exported by this reader
@@ -5,13 +5,16 @@ package file
 
 import (
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 )
@@ -240,4 +243,182 @@ func TestOnelineFiles(t *testing.T) {
 		require.Contains(t, firstEntry.Line, "onelinelog.log") // contains .tar.gz headers
 		require.Contains(t, firstEntry.Line, `5.202.214.160 - - [26/Jan/2019:19:45:25 +0330] "GET / HTTP/1.1" 200 30975 "https://www.zanbil.ir/" "Mozilla/5.0 (Windows NT 6.2; WOW64; rv:21.0) Gecko/20100101 Firefox/21.0" "-"`)
 	})
+
+	t.Run("zstd file", func(t *testing.T) {
+		file := "testdata/onelinelog.log.zst"
+		handler := newFakeClient(func() {})
+
+		d := &decompressor{
+			logger:  log.NewNopLogger(),
+			running: atomic.NewBool(false),
+			handler: handler,
+			path:    file,
+			done:    make(chan struct{}),
+			metrics: newMetrics(prometheus.NewRegistry()),
+		}
+
+		d.readLines()
+
+		<-d.done
+		time.Sleep(time.Millisecond * 200)
+
+		entries := handler.Received()
+		require.Equal(t, 1, len(entries))
+		require.Equal(t, string(fileContent), entries[0].Line)
+	})
+
+	t.Run("xz file", func(t *testing.T) {
+		file := "testdata/onelinelog.log.xz"
+		handler := newFakeClient(func() {})
+
+		d := &decompressor{
+			logger:  log.NewNopLogger(),
+			running: atomic.NewBool(false),
+			handler: handler,
+			path:    file,
+			done:    make(chan struct{}),
+			metrics: newMetrics(prometheus.NewRegistry()),
+		}
+
+		d.readLines()
+
+		<-d.done
+		time.Sleep(time.Millisecond * 200)
+
+		entries := handler.Received()
+		require.Equal(t, 1, len(entries))
+		require.Equal(t, string(fileContent), entries[0].Line)
+	})
+}
+
+// TestZipFile tests that all the files of a zip archive are read, without
+// merging the last line of a file with the first line of the next one.
+func TestZipFile(t *testing.T) {
+	oneline, err := os.ReadFile("testdata/onelinelog.log")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		position int64
+		want     int
+	}{
+		{name: "from the beginning", position: 0, want: 2001},
+		{name: "from a position", position: 1000, want: 1001},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newFakeClient(func() {})
+
+			d := &decompressor{
+				logger:   log.NewNopLogger(),
+				running:  atomic.NewBool(false),
+				handler:  handler,
+				path:     "testdata/multi-entry.zip",
+				done:     make(chan struct{}),
+				metrics:  newMetrics(prometheus.NewRegistry()),
+				position: tc.position,
+			}
+
+			d.readLines()
+
+			<-d.done
+			time.Sleep(time.Millisecond * 200)
+
+			entries := handler.Received()
+			require.Equal(t, tc.want, len(entries))
+			require.Equal(t, int64(2001), d.position)
+			if tc.position == 0 {
+				require.Equal(t, string(oneline), entries[0].Line)
+				require.Contains(t, entries[1].Line, "GET")
+			}
+		})
+	}
+}
+
+func TestAfterRead(t *testing.T) {
+	content, err := os.ReadFile("testdata/onelinelog.log.gz")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		afterRead CompressedFiles
+		want      []string
+	}{
+		{
+			name:      "keep",
+			afterRead: CompressedFiles{AfterRead: AfterReadKeep},
+			want:      []string{"onelinelog.log.gz"},
+		},
+		{
+			name:      "delete",
+			afterRead: CompressedFiles{AfterRead: AfterReadDelete},
+			want:      nil,
+		},
+		{
+			name:      "move",
+			afterRead: CompressedFiles{AfterRead: AfterReadMove, MoveTo: "read"},
+			want:      []string{"read/onelinelog.log.gz"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "onelinelog.log.gz")
+			require.NoError(t, os.WriteFile(path, content, 0600))
+			if tc.afterRead.MoveTo != "" {
+				tc.afterRead.MoveTo = filepath.Join(dir, tc.afterRead.MoveTo)
+			}
+
+			posCfg := positions.Config{
+				SyncPeriod:    time.Hour,
+				PositionsFile: filepath.Join(t.TempDir(), "positions.yml"),
+			}
+			pos, err := positions.New(log.NewNopLogger(), posCfg)
+			require.NoError(t, err)
+			defer pos.Stop()
+
+			// The entries go through a handler which forwards them
+			// asynchronously, as in the component.
+			handler := newFakeClient(func() {})
+			d := &decompressor{
+				logger:    log.NewNopLogger(),
+				running:   atomic.NewBool(false),
+				handler:   loki.AddLabelsMiddleware(model.LabelSet{"foo": "bar"}).Wrap(handler),
+				next:      handler,
+				positions: pos,
+				path:      path,
+				labels:    "{}",
+				afterRead: tc.afterRead,
+				done:      make(chan struct{}),
+				metrics:   newMetrics(prometheus.NewRegistry()),
+			}
+
+			d.readLines()
+
+			<-d.done
+			if tc.afterRead.AfterRead == AfterReadKeep {
+				time.Sleep(time.Millisecond * 200)
+			} else {
+				// The file is only removed once its entries were forwarded,
+				// and its final position was written to the positions file.
+				saved, err := positions.New(log.NewNopLogger(), posCfg)
+				require.NoError(t, err)
+				defer saved.Stop()
+				savedPos, err := saved.Get(path, "{}")
+				require.NoError(t, err)
+				require.Equal(t, int64(1), savedPos)
+			}
+			require.Equal(t, 1, len(handler.Received()))
+
+			var got []string
+			err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
 }
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var (
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// getEncoding returns the encoding registered under the given IANA name.
+func getEncoding(name string) (encoding.Encoding, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IANA encoding %s: %w", name, err)
+	}
+	// Some encodings are known by name but not implemented.
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %s", name)
+	}
+	return enc, nil
+}
+
+// lineDecoder converts lines to UTF-8 from the encoding of the file they were
+// read from. The lines must be split on the newlines returned by newline.
+type lineDecoder struct {
+	decoder *encoding.Decoder
+
+	utf16     bool
+	bigEndian bool
+	// detectBOM is set for the "UTF-16" encoding, whose byte order is read
+	// from the byte order mark at the start of files.
+	detectBOM bool
+}
+
+func newLineDecoder(name string) (*lineDecoder, error) {
+	enc, err := getEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &lineDecoder{}
+	switch canonical, _ := ianaindex.IANA.Name(enc); canonical {
+	case "UTF-16":
+		d.utf16, d.bigEndian, d.detectBOM = true, true, true
+	case "UTF-16BE":
+		d.utf16, d.bigEndian = true, true
+	case "UTF-16LE":
+		d.utf16 = true
+	default:
+		d.decoder = enc.NewDecoder()
+		return d, nil
+	}
+	d.setByteOrder(d.bigEndian)
+	return d, nil
+}
+
+func (d *lineDecoder) setByteOrder(bigEndian bool) {
+	d.bigEndian = bigEndian
+	if bigEndian {
+		d.decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
+	} else {
+		d.decoder = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()
+	}
+}
+
+// detectByteOrder sets the byte order of the "UTF-16" encoding from the byte
+// order mark found at the start of a file, if any. Files without a byte order
+// mark are big endian.
+func (d *lineDecoder) detectByteOrder(start []byte) {
+	if d.detectBOM && bytes.HasPrefix(start, utf16LEBOM) {
+		d.setByteOrder(false)
+	}
+}
+
+// detectFileByteOrder detects the byte order of the "UTF-16" encoding from the
+// start of the file at path, see detectByteOrder.
+func (d *lineDecoder) detectFileByteOrder(path string) error {
+	if !d.detectBOM {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	start := make([]byte, len(utf16LEBOM))
+	n, err := io.ReadFull(f, start)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	d.detectByteOrder(start[:n])
+	return nil
+}
+
+// newline returns the bytes of a newline in the encoding. Its length is the
+// size of the code units of the encoding, which lines can only be split at.
+func (d *lineDecoder) newline() []byte {
+	switch {
+	case d == nil || !d.utf16:
+		return []byte{'\n'}
+	case d.bigEndian:
+		return []byte{0, '\n'}
+	default:
+		return []byte{'\n', 0}
+	}
+}
+
+// decode converts a line to UTF-8.
+func (d *lineDecoder) decode(line string) (string, error) {
+	if d.utf16 {
+		if d.bigEndian {
+			line = strings.TrimPrefix(line, string(utf16BEBOM))
+		} else {
+			line = strings.TrimPrefix(line, string(utf16LEBOM))
+		}
+	}
+
+	res, _, err := transform.String(d.decoder, line)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode text to UTF8: %w", err)
+	}
+	return res, nil
+}
+
+// maxRawLineSize returns the number of bytes of a line to read from a file in
+// the encoding of d, so that lines of up to maxSize bytes once converted to
+// UTF-8 are read whole. d may be nil if the file is read as is. A maxSize of 0
+// disables the limit.
+func (d *lineDecoder) maxRawLineSize(maxSize int) int {
+	if d == nil {
+		return maxSize
+	}
+	// Characters take up to 4 bytes in the supported encodings, and at least
+	// 1 byte once converted to UTF-8.
+	return maxSize * 4
+}
+
+// limitLineSize enforces the maximum size of a line in bytes. Lines longer
+// than maxSize are truncated to it if truncate is set, without splitting a
+// UTF-8 character, and are dropped otherwise. cut must be set if the end of
+// the line was already discarded while reading it, as it was too long. It
+// returns the resulting line, whether it must be sent, and whether it was too
+// long. A maxSize of 0 disables the limit.
+func limitLineSize(line string, cut bool, maxSize int, truncate bool) (string, bool, bool) {
+	if maxSize <= 0 || (!cut && len(line) <= maxSize) {
+		return line, true, false
+	}
+	if !truncate {
+		return "", false, true
+	}
+	end := len(line)
+	if end > maxSize {
+		end = maxSize
+	}
+	// Drop the last character if it was split, whether by the limit or while
+	// reading the line.
+	last := end - 1
+	for last > 0 && end-last < utf8.UTFMax && !utf8.RuneStart(line[last]) {
+		last--
+	}
+	if last >= 0 && !utf8.FullRuneInString(line[last:end]) {
+		end = last
+	}
+	return line[:end], true, true
+}
@@ -0,0 +1,136 @@
+package file
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestLineDecoder(t *testing.T) {
+	// The first byte of "上" (U+4E0A) is 0x0A in UTF-16LE, which must not be
+	// mistaken for a newline.
+	lines := []string{"héllo", "", "wörld ✓", "上海"}
+
+	latin1, err := charmap.ISO8859_1.NewEncoder().String("héllo")
+	require.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		encoding string
+		content  string
+		want     []string
+	}{
+		{
+			name:     "latin1",
+			encoding: "latin1",
+			content:  latin1 + "\n",
+			want:     []string{"héllo"},
+		},
+		{
+			name:     "UTF-16LE",
+			encoding: "UTF-16LE",
+			content:  encodeUTF16(t, unicode.LittleEndian, unicode.IgnoreBOM, lines),
+			want:     lines,
+		},
+		{
+			name:     "UTF-16BE",
+			encoding: "UTF-16BE",
+			content:  encodeUTF16(t, unicode.BigEndian, unicode.IgnoreBOM, lines),
+			want:     lines,
+		},
+		{
+			name:     "UTF-16 with little endian BOM",
+			encoding: "UTF-16",
+			content:  encodeUTF16(t, unicode.LittleEndian, unicode.UseBOM, lines),
+			want:     lines,
+		},
+		{
+			name:     "UTF-16 with big endian BOM",
+			encoding: "UTF-16",
+			content:  encodeUTF16(t, unicode.BigEndian, unicode.UseBOM, lines),
+			want:     lines,
+		},
+		{
+			name:     "UTF-16 without BOM",
+			encoding: "UTF-16",
+			content:  encodeUTF16(t, unicode.BigEndian, unicode.IgnoreBOM, lines),
+			want:     lines,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := newLineDecoder(tc.encoding)
+			require.NoError(t, err)
+			d.detectByteOrder([]byte(tc.content))
+
+			// Lines are split like the readers do, which keep the bytes
+			// after the last newline until the line is complete.
+			var got []string
+			lr := newLineReader(strings.NewReader(tc.content), 0, d.newline(), 0)
+			for {
+				line, _, err := lr.ReadLine()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				decoded, err := d.decode(string(line))
+				require.NoError(t, err)
+				got = append(got, decoded)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err = newLineDecoder("UTF-7")
+	require.EqualError(t, err, "unsupported encoding UTF-7")
+}
+
+// encodeUTF16 encodes lines to UTF-16, separated and ended by newlines.
+func encodeUTF16(t *testing.T, endianness unicode.Endianness, bom unicode.BOMPolicy, lines []string) string {
+	t.Helper()
+
+	res, err := unicode.UTF16(endianness, bom).NewEncoder().String(strings.Join(lines, "\n") + "\n")
+	require.NoError(t, err)
+	return res
+}
+
+func TestLimitLineSize(t *testing.T) {
+	tt := []struct {
+		name          string
+		line          string
+		cut           bool
+		maxSize       int
+		truncate      bool
+		want          string
+		wantSend      bool
+		wantOversized bool
+	}{
+		{name: "no limit", line: "hello", maxSize: 0, want: "hello", wantSend: true},
+		{name: "under limit", line: "hello", maxSize: 5, want: "hello", wantSend: true},
+		{name: "dropped", line: "hello", maxSize: 4, want: "", wantOversized: true},
+		{name: "truncated", line: "hello", maxSize: 4, truncate: true, want: "hell", wantSend: true, wantOversized: true},
+		// "é" is encoded with 2 bytes, which must not be split.
+		{name: "truncated before multibyte character", line: "hé", maxSize: 2, truncate: true, want: "h", wantSend: true, wantOversized: true},
+		// The end of cut lines was discarded while reading them.
+		{name: "cut dropped", line: "hell", cut: true, maxSize: 4, want: "", wantOversized: true},
+		{name: "cut truncated", line: "hell", cut: true, maxSize: 4, truncate: true, want: "hell", wantSend: true, wantOversized: true},
+		// Cut lines are read up to the limit, which may split a character.
+		{name: "cut truncated before multibyte character", line: "h\xc3", cut: true, maxSize: 2, truncate: true, want: "h", wantSend: true, wantOversized: true},
+		{name: "cut truncated after multibyte character", line: "hé", cut: true, maxSize: 3, truncate: true, want: "hé", wantSend: true, wantOversized: true},
+		{name: "truncated before 4-byte character", line: "h😀", maxSize: 4, truncate: true, want: "h", wantSend: true, wantOversized: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, send, oversized := limitLineSize(tc.line, tc.cut, tc.maxSize, tc.truncate)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, tc.wantSend, send)
+			require.Equal(t, tc.wantOversized, oversized)
+		})
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
+	"github.com/bmatcuk/doublestar"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
@@ -29,16 +32,93 @@ func init() {
 }
 
 const (
-	pathLabel     = "__path__"
-	filenameLabel = "filename"
+	pathLabel        = "__path__"
+	pathExcludeLabel = "__path_exclude__"
+	filenameLabel    = "filename"
 )
 
 // Arguments holds values which are used to configure the loki.source.file
 // component.
-// TODO(@tpaschalis) Allow users to configure the encoding of the tailed files.
 type Arguments struct {
-	Targets   []discovery.Target  `river:"targets,attr"`
-	ForwardTo []loki.LogsReceiver `river:"forward_to,attr"`
+	Targets             []discovery.Target  `river:"targets,attr"`
+	ForwardTo           []loki.LogsReceiver `river:"forward_to,attr"`
+	SyncPeriod          time.Duration       `river:"sync_period,attr,optional"`
+	Encoding            string              `river:"encoding,attr,optional"`
+	MaxLineSize         units.Base2Bytes    `river:"max_line_size,attr,optional"`
+	MaxLineSizeTruncate bool                `river:"max_line_size_truncate,attr,optional"`
+	CompressedFiles     CompressedFiles     `river:"compressed_files,block,optional"`
+}
+
+// DefaultArguments defines the default settings for loki.source.file.
+var DefaultArguments = Arguments{
+	SyncPeriod:      10 * time.Second,
+	CompressedFiles: DefaultCompressedFiles,
+}
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (a *Arguments) UnmarshalRiver(f func(interface{}) error) error {
+	*a = DefaultArguments
+
+	type arguments Arguments
+	if err := f((*arguments)(a)); err != nil {
+		return err
+	}
+
+	if a.SyncPeriod <= 0 {
+		return fmt.Errorf("sync_period must be greater than 0")
+	}
+	if a.Encoding != "" {
+		if _, err := getEncoding(a.Encoding); err != nil {
+			return err
+		}
+	}
+	if a.MaxLineSize < 0 {
+		return fmt.Errorf("max_line_size must not be negative")
+	}
+	return nil
+}
+
+// Actions which can be taken on compressed files once they've been read.
+const (
+	AfterReadKeep   = "keep"
+	AfterReadDelete = "delete"
+	AfterReadMove   = "move"
+)
+
+// CompressedFiles configures what happens to compressed files once all of
+// their lines were read.
+type CompressedFiles struct {
+	AfterRead string `river:"after_read,attr,optional"`
+	MoveTo    string `river:"move_to,attr,optional"`
+}
+
+// DefaultCompressedFiles keeps compressed files once they've been read.
+var DefaultCompressedFiles = CompressedFiles{
+	AfterRead: AfterReadKeep,
+}
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (c *CompressedFiles) UnmarshalRiver(f func(interface{}) error) error {
+	*c = DefaultCompressedFiles
+
+	type compressedFiles CompressedFiles
+	if err := f((*compressedFiles)(c)); err != nil {
+		return err
+	}
+
+	switch c.AfterRead {
+	case AfterReadKeep, AfterReadDelete:
+		if c.MoveTo != "" {
+			return fmt.Errorf("move_to can only be set when after_read is %q", AfterReadMove)
+		}
+	case AfterReadMove:
+		if c.MoveTo == "" {
+			return fmt.Errorf("move_to must be set when after_read is %q", AfterReadMove)
+		}
+	default:
+		return fmt.Errorf("unknown after_read action %q, must be one of %q, %q or %q", c.AfterRead, AfterReadKeep, AfterReadDelete, AfterReadMove)
+	}
+	return nil
 }
 
 var (
@@ -50,12 +130,17 @@ type Component struct {
 	opts    component.Options
 	metrics *metrics
 
-	mut       sync.RWMutex
-	args      Arguments
-	handler   loki.LogsReceiver
-	receivers []loki.LogsReceiver
-	posFile   positions.Positions
-	readers   map[positions.Entry]reader
+	mut     sync.RWMutex
+	args    Arguments
+	handler loki.LogsReceiver
+	posFile positions.Positions
+	readers map[positions.Entry]reader
+	ticker  *time.Ticker
+
+	// receivers has its own mutex so that entries keep being forwarded while
+	// readers are stopped with mut held.
+	receiversMut sync.RWMutex
+	receivers    []loki.LogsReceiver
 }
 
 // New creates a new loki.source.file component.
@@ -93,15 +178,38 @@ func New(o component.Options, args Arguments) (*Component, error) {
 }
 
 // Run implements component.Component.
-// TODO(@tpaschalis). Should we periodically re-check? What happens if a target
-// comes alive _after_ it's been passed to us and we never receive another
-// Update()? Or should it be a responsibility of the discovery component?
 func (c *Component) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
 	defer func() {
+		// Wait for the sync loop to exit so that it doesn't start new readers
+		// while they're being stopped.
+		wg.Wait()
+
 		level.Info(c.opts.Logger).Log("msg", "loki.source.file component shutting down, stopping readers")
+		c.mut.Lock()
+		c.ticker.Stop()
 		for _, r := range c.readers {
 			r.Stop()
 		}
+		c.readers = make(map[positions.Entry]reader)
+		c.mut.Unlock()
+
+		c.posFile.Stop()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.ticker.C:
+				c.mut.Lock()
+				c.sync()
+				c.mut.Unlock()
+			}
+		}
 	}()
 
 	for {
@@ -109,8 +217,16 @@ func (c *Component) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case entry := <-c.handler:
-			for _, receiver := range c.receivers {
-				receiver <- entry
+			c.receiversMut.RLock()
+			receivers := c.receivers
+			c.receiversMut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
 			}
 		}
 	}
@@ -119,42 +235,160 @@ func (c *Component) Run(ctx context.Context) error {
 // Update implements component.Component.
 func (c *Component) Update(args component.Arguments) error {
 	newArgs := args.(Arguments)
+	if newArgs.SyncPeriod <= 0 {
+		newArgs.SyncPeriod = DefaultArguments.SyncPeriod
+	}
+
+	c.receiversMut.Lock()
+	c.receivers = newArgs.ForwardTo
+	c.receiversMut.Unlock()
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
+
+	if c.ticker == nil {
+		c.ticker = time.NewTicker(newArgs.SyncPeriod)
+	} else if newArgs.SyncPeriod != c.args.SyncPeriod {
+		c.ticker.Reset(newArgs.SyncPeriod)
+	}
+
+	// Readers are keyed by their path and labels, so the readers of files
+	// whose labels changed are restarted by the sync below. All the readers
+	// are restarted when the way files are read changed.
+	if newArgs.Encoding != c.args.Encoding ||
+		newArgs.MaxLineSize != c.args.MaxLineSize ||
+		newArgs.MaxLineSizeTruncate != c.args.MaxLineSizeTruncate ||
+		newArgs.CompressedFiles != c.args.CompressedFiles {
+
+		for key, r := range c.readers {
+			r.Stop()
+			delete(c.readers, key)
+		}
+	}
+
 	c.args = newArgs
-	c.receivers = newArgs.ForwardTo
+	c.sync()
 
-	oldPaths := make(map[positions.Entry]struct{})
-
-	// Stop all readers and recreate them below. This avoids the issue we saw
-	// with stranded wrapped handlers staying behind until they were GC'ed and
-	// sending duplicate message to the global handler. It also makes sure that
-	// we update everything with the new labels. Simply zeroing out the
-	// c.readers map did not work correctly to shut down the wrapped handlers
-	// in time.
-	// TODO (@tpaschalis) We should be able to optimize this somehow and eg.
-	// cache readers for paths we already know about, and whose labels have not
-	// changed. Once we do that we should:
-	// a) Call to c.pruneStoppedReaders to give cached but errored readers a
-	// chance to restart.
-	// b) Stop tailing any files that were no longer in the new targets
-	// and conditionally remove their readers only by calling toStopTailing
-	// and c.stopTailingAndRemovePosition.
-	for p, r := range c.readers {
-		oldPaths[p] = struct{}{}
+	return nil
+}
+
+// file is a file matched by the targets of the component.
+type file struct {
+	labels model.LabelSet
+	id     positions.FileID
+	hasID  bool
+}
+
+// sync matches the targets against the filesystem, starts reading the files
+// which were found, and stops reading the files which aren't matched
+// anymore. Readers which exited, for example because the file they were
+// reading was rotated, are restarted. c.mut must be held when calling sync.
+func (c *Component) sync() {
+	files := c.matchFiles()
+
+	// Stop the readers of files which aren't matched anymore, and clean up
+	// the readers which exited.
+	unmatched := make(map[positions.Entry]struct{})
+	for key, r := range c.readers {
+		if _, matched := files[key]; matched && r.IsRunning() {
+			continue
+		}
 		r.Stop()
+		delete(c.readers, key)
+		if _, matched := files[key]; !matched {
+			unmatched[key] = struct{}{}
+		}
 	}
-	c.readers = make(map[positions.Entry]reader)
 
-	if len(newArgs.Targets) == 0 {
-		level.Debug(c.opts.Logger).Log("msg", "no files targets were passed, nothing will be tailed")
-		return nil
+	newFiles := make([]positions.Entry, 0, len(files))
+	for key := range files {
+		if _, ok := c.readers[key]; !ok {
+			newFiles = append(newFiles, key)
+		}
+	}
+	sort.Slice(newFiles, func(i, j int) bool {
+		if newFiles[i].Path != newFiles[j].Path {
+			return newFiles[i].Path < newFiles[j].Path
+		}
+		return newFiles[i].Labels < newFiles[j].Labels
+	})
+
+	// Files which were renamed, for example by log rotation, keep the
+	// position which was recorded for their previous path. This is done for
+	// all files before the positions of the files whose path now holds a
+	// different file are reset below, as those may be the previous path of a
+	// renamed file.
+	deferred := make(map[positions.Entry]struct{})
+	for _, key := range newFiles {
+		f := files[key]
+		if !f.hasID {
+			continue
+		}
+		if id, ok := c.posFile.GetFileID(key.Path, key.Labels); ok && id == f.id {
+			continue
+		}
+		prevPath, ok := c.posFile.FindFileID(key.Labels, f.id)
+		if !ok || prevPath == key.Path {
+			continue
+		}
+		if r, ok := c.readers[positions.Entry{Path: prevPath, Labels: key.Labels}]; ok && r.IsRunning() {
+			// The file is still being read from its previous path, wait for
+			// its reader to reach the end of the file and exit.
+			deferred[key] = struct{}{}
+			continue
+		}
+
+		pos, err := c.posFile.Get(prevPath, key.Labels)
+		if err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "failed to get position of renamed file", "filename", key.Path, "previous", prevPath, "error", err)
+			continue
+		}
+		level.Debug(c.opts.Logger).Log("msg", "file was renamed, resuming from its previous position", "filename", key.Path, "previous", prevPath, "position", pos)
+		c.posFile.Put(key.Path, key.Labels, pos)
+		c.posFile.PutFileID(key.Path, key.Labels, f.id)
+		c.posFile.Remove(prevPath, key.Labels)
+	}
+
+	for _, key := range newFiles {
+		if _, ok := deferred[key]; ok {
+			continue
+		}
+		f := files[key]
+
+		// The path now holds a different file than the one whose position was
+		// recorded, which must be read from its beginning.
+		if id, ok := c.posFile.GetFileID(key.Path, key.Labels); ok && f.hasID && id != f.id {
+			level.Debug(c.opts.Logger).Log("msg", "file was replaced, reading it from the beginning", "filename", key.Path)
+			c.posFile.Remove(key.Path, key.Labels)
+		}
+
+		c.reportSize(key.Path, key.Labels)
+		handler := loki.AddLabelsMiddleware(f.labels).Wrap(loki.NewEntryHandler(c.handler, func() {}))
+
+		reader, err := c.startTailing(key.Path, f.labels, handler)
+		if err != nil {
+			continue
+		}
+		c.readers[key] = reader
 	}
 
-	for _, target := range newArgs.Targets {
-		path := target[pathLabel]
+	// Remove from the positions file any entries of files that were read
+	// before, but aren't matched anymore.
+	for key := range unmatched {
+		c.posFile.Remove(key.Path, key.Labels)
+	}
+}
+
+// matchFiles expands the path patterns of the targets into the files to read.
+func (c *Component) matchFiles() map[positions.Entry]file {
+	res := make(map[positions.Entry]file)
 
+	if len(c.args.Targets) == 0 {
+		level.Debug(c.opts.Logger).Log("msg", "no files targets were passed, nothing will be tailed")
+		return res
+	}
+
+	for _, target := range c.args.Targets {
 		var labels = make(model.LabelSet)
 		for k, v := range target {
 			if strings.HasPrefix(k, model.ReservedLabelPrefix) {
@@ -163,30 +397,47 @@ func (c *Component) Update(args component.Arguments) error {
 			labels[model.LabelName(k)] = model.LabelValue(v)
 		}
 
-		c.reportSize(path, labels.String())
-		handler := loki.AddLabelsMiddleware(labels).Wrap(loki.NewEntryHandler(c.handler, func() {}))
-
-		reader, err := c.startTailing(path, labels, handler)
+		paths, err := doublestar.Glob(target[pathLabel])
 		if err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to match path pattern", "pattern", target[pathLabel], "error", err)
 			continue
 		}
+		if len(paths) == 0 {
+			level.Debug(c.opts.Logger).Log("msg", "no files matched path pattern", "pattern", target[pathLabel])
+		}
 
-		c.readers[positions.Entry{Path: path, Labels: labels.String()}] = reader
-	}
+		exclude := target[pathExcludeLabel]
+		for _, path := range paths {
+			if exclude != "" {
+				if match, _ := doublestar.PathMatch(exclude, path); match {
+					continue
+				}
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil || fi.IsDir() {
+				continue
+			}
 
-	// Remove from the positions file any entries that had a Reader before, but
-	// are no longer in the updated set of Targets.
-	for r := range missing(c.readers, oldPaths) {
-		c.posFile.Remove(r.Path, r.Labels)
+			id, hasID := fileID(fi)
+			res[positions.Entry{Path: path, Labels: labels.String()}] = file{
+				labels: labels,
+				id:     id,
+				hasID:  hasID,
+			}
+		}
 	}
 
-	return nil
+	return res
 }
 
 // DebugInfo returns information about the status of tailed targets.
 // TODO(@tpaschalis) Decorate with more debug information once it's made
 // available, such as the last time a log line was read.
 func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
 	var res readerDebugInfo
 	for e, reader := range c.readers {
 		offset, _ := c.posFile.Get(e.Path, e.Labels)
@@ -211,17 +462,6 @@ type targetInfo struct {
 	ReadOffset int64  `river:"read_offset,attr"`
 }
 
-// Returns the elements from set b which are missing from set a
-func missing(as map[positions.Entry]reader, bs map[positions.Entry]struct{}) map[positions.Entry]struct{} {
-	c := map[positions.Entry]struct{}{}
-	for a := range bs {
-		if _, ok := as[a]; !ok {
-			c[a] = struct{}{}
-		}
-	}
-	return c
-}
-
 // startTailing starts and returns a reader for the given path. For most files,
 // this will be a tailer implementation. If the file suffix alludes to it being
 // a compressed file, then a decompressor will be started instead.
@@ -249,7 +489,10 @@ func (c *Component) startTailing(path string, labels model.LabelSet, handler lok
 			c.posFile,
 			path,
 			labels.String(),
-			"",
+			c.args.Encoding,
+			int(c.args.MaxLineSize),
+			c.args.MaxLineSizeTruncate,
+			c.args.CompressedFiles,
 		)
 		if err != nil {
 			level.Error(c.opts.Logger).Log("msg", "failed to start decompressor", "error", err, "filename", path)
@@ -265,7 +508,9 @@ func (c *Component) startTailing(path string, labels model.LabelSet, handler lok
 			c.posFile,
 			path,
 			labels.String(),
-			"",
+			c.args.Encoding,
+			int(c.args.MaxLineSize),
+			c.args.MaxLineSizeTruncate,
 		)
 		if err != nil {
 			level.Error(c.opts.Logger).Log("msg", "failed to start tailer", "error", err, "filename", path)
@@ -4,15 +4,21 @@ import (
 	"context"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
 	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/river"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func Test(t *testing.T) {
@@ -65,3 +71,197 @@ func Test(t *testing.T) {
 		}
 	}
 }
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		targets    = [{"__path__" = "/var/log/*.log"}]
+		forward_to = []
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, DefaultArguments, Arguments{
+		SyncPeriod:      args.SyncPeriod,
+		CompressedFiles: args.CompressedFiles,
+	})
+
+	err = river.Unmarshal([]byte(`
+		targets     = []
+		forward_to  = []
+		sync_period = "0s"
+	`), &args)
+	require.EqualError(t, err, "sync_period must be greater than 0")
+
+	err = river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+
+		compressed_files {
+			after_read = "move"
+			move_to    = "/var/log/archive/read"
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, CompressedFiles{AfterRead: AfterReadMove, MoveTo: "/var/log/archive/read"}, args.CompressedFiles)
+
+	err = river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+
+		compressed_files {
+			after_read = "move"
+		}
+	`), &args)
+	require.EqualError(t, err, `move_to must be set when after_read is "move"`)
+
+	err = river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+		encoding   = "UTF-16"
+		max_line_size = "16KiB"
+		max_line_size_truncate = true
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, units.Base2Bytes(16*1024), args.MaxLineSize)
+
+	err = river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+		encoding   = "foo"
+	`), &args)
+	require.EqualError(t, err, "failed to get IANA encoding foo: ianaindex: invalid encoding name")
+}
+
+func TestGlobAndExclude(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan loki.Entry)
+
+	args := Arguments{
+		Targets: []discovery.Target{{
+			"__path__":         filepath.Join(dir, "**", "*.log"),
+			"__path_exclude__": filepath.Join(dir, "**", "excluded.log"),
+		}},
+		ForwardTo:  []loki.LogsReceiver{ch},
+		SyncPeriod: 50 * time.Millisecond,
+	}
+	runTestComponent(t, args)
+
+	// Files created after the component started are picked up by the next
+	// sync.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0750))
+	writeFile(t, filepath.Join(dir, "sub", "excluded.log"), "excluded\n")
+	writeFile(t, filepath.Join(dir, "sub", "other.txt"), "not matched\n")
+	writeFile(t, filepath.Join(dir, "sub", "app.log"), "included\n")
+
+	entry := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, "included", entry.Line)
+	require.Equal(t, model.LabelValue(filepath.Join(dir, "sub", "app.log")), entry.Labels["filename"])
+	sourcetest.RequireNoEntry(t, ch, time.Second)
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan loki.Entry)
+
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "first\n")
+
+	args := Arguments{
+		Targets: []discovery.Target{{
+			"__path__": filepath.Join(dir, "app.log*"),
+		}},
+		ForwardTo:  []loki.LogsReceiver{ch},
+		SyncPeriod: 50 * time.Millisecond,
+	}
+	runTestComponent(t, args)
+	require.Equal(t, "first", sourcetest.ReceiveEntry(t, ch).Line)
+
+	// Rotate the file by renaming it, while it's still being written to.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, os.Rename(path, path+".1"))
+	_, err = f.WriteString("second\n")
+	require.NoError(t, err)
+	writeFile(t, path, "third\n")
+
+	// Every line must be read exactly once, from either path.
+	lines := map[string]int{}
+	for i := 0; i < 2; i++ {
+		lines[sourcetest.ReceiveEntry(t, ch).Line]++
+	}
+	require.Equal(t, map[string]int{"second": 1, "third": 1}, lines)
+	sourcetest.RequireNoEntry(t, ch, time.Second)
+}
+
+func TestEncoding(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan loki.Entry)
+
+	path := filepath.Join(dir, "app.log")
+	// "上" (U+4E0A) contains a 0x0A byte in UTF-16LE, and the long line is cut
+	// while it's read.
+	lines := "first\nsecond ✓\n上海\n" + strings.Repeat("x", 100000) + "\nlast\n"
+	content, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(lines)
+	require.NoError(t, err)
+	writeFile(t, path, content)
+
+	args := Arguments{
+		Targets:             []discovery.Target{{"__path__": path}},
+		ForwardTo:           []loki.LogsReceiver{ch},
+		Encoding:            "UTF-16",
+		MaxLineSize:         5,
+		MaxLineSizeTruncate: true,
+	}
+	runTestComponent(t, args)
+
+	require.Equal(t, "first", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "secon", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "上", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "xxxxx", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "last", sourcetest.ReceiveEntry(t, ch).Line)
+}
+
+func TestLineEndings(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan loki.Entry)
+
+	path := filepath.Join(dir, "app.log")
+	// "è" is encoded with 2 bytes, and the second line is cut in the middle
+	// of it while it's read.
+	writeFile(t, path, "one\r\nfourè\nlast\r\n")
+
+	args := Arguments{
+		Targets:             []discovery.Target{{"__path__": path}},
+		ForwardTo:           []loki.LogsReceiver{ch},
+		MaxLineSize:         5,
+		MaxLineSizeTruncate: true,
+	}
+	runTestComponent(t, args)
+
+	require.Equal(t, "one", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "four", sourcetest.ReceiveEntry(t, ch).Line)
+	require.Equal(t, "last", sourcetest.ReceiveEntry(t, ch).Line)
+}
+
+func runTestComponent(t *testing.T, args Arguments) {
+	t.Helper()
+
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+	opts := component.Options{Logger: l, DataPath: t.TempDir()}
+
+	c, err := New(opts, args)
+	require.NoError(t, err)
+
+	sourcetest.Run(t, c)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/grafana/agent/component/common/loki/positions"
+)
+
+// fileID returns the identity of a file from its device and inode numbers.
+func fileID(fi os.FileInfo) (positions.FileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return positions.FileID{}, false
+	}
+	return positions.FileID{
+		Device: uint64(st.Dev),
+		Inode:  uint64(st.Ino),
+	}, true
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"os"
+
+	"github.com/grafana/agent/component/common/loki/positions"
+)
+
+// fileID is not supported on Windows, where the file index isn't available
+// from os.FileInfo. Files are then only identified by their path.
+func fileID(fi os.FileInfo) (positions.FileID, bool) {
+	return positions.FileID{}, false
+}
@@ -0,0 +1,134 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// lineReader reads the lines of a file in a given encoding.
+//
+// Lines are split on the newlines of the encoding, which are only looked for
+// at the boundaries of its code units, so that the lines of UTF-16 files
+// aren't split on the 0x0A bytes of other characters, such as the first byte
+// of U+4E0A in little endian.
+//
+// The size of the lines kept in memory is bounded: once a line is longer
+// than the limit, the rest of it is discarded while it's read.
+type lineReader struct {
+	r       *bufio.Reader
+	newline []byte
+	maxSize int
+
+	offset  int64 // Offset of the next byte to read.
+	lineEnd int64 // Offset right after the last line returned.
+
+	line []byte // The current line, which may be incomplete.
+	cut  bool   // Whether bytes of the current line were discarded.
+}
+
+// newLineReader creates a lineReader which reads from r, found at offset in
+// its file. newline is the newline of the encoding, whose length is the size
+// of its code units. Lines longer than maxSize bytes are cut; a maxSize of 0
+// disables the limit.
+func newLineReader(r io.Reader, offset int64, newline []byte, maxSize int) *lineReader {
+	return &lineReader{
+		r:       bufio.NewReader(r),
+		newline: newline,
+		maxSize: maxSize,
+		offset:  offset,
+		lineEnd: offset,
+	}
+}
+
+// reset makes the reader read from r, found at offset in its file, dropping
+// the incomplete line.
+func (lr *lineReader) reset(r io.Reader, offset int64) {
+	lr.r.Reset(r)
+	lr.offset, lr.lineEnd = offset, offset
+	lr.line, lr.cut = lr.line[:0], false
+}
+
+// ReadLine returns the next line without its newline, and whether it was cut
+// because it was longer than the limit. The line is only valid until the next
+// call.
+//
+// io.EOF is returned when the end of the input is reached before a newline.
+// The incomplete line is kept, so that it's returned once its newline is read
+// if more data is appended to the input, or by Rest otherwise.
+func (lr *lineReader) ReadLine() ([]byte, bool, error) {
+	width := int64(len(lr.newline))
+
+	// Skip the end of the code unit the reader started in the middle of.
+	if skip := int(lr.offset % width); skip != 0 {
+		n, err := lr.r.Discard(int(width) - skip)
+		lr.offset += int64(n)
+		lr.lineEnd = lr.offset
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	for {
+		if lr.r.Buffered() < int(width) {
+			if _, err := lr.r.Peek(int(width)); err != nil {
+				return nil, false, err
+			}
+		}
+		data, _ := lr.r.Peek(lr.r.Buffered())
+
+		// Only whole code units are consumed.
+		scanned := len(data) - len(data)%int(width)
+		if i := lr.indexNewline(data[:scanned]); i >= 0 {
+			lr.appendLine(data[:i])
+			n, _ := lr.r.Discard(i + int(width))
+			lr.offset += int64(n)
+			lr.lineEnd = lr.offset
+
+			line, cut := lr.line, lr.cut
+			lr.line, lr.cut = lr.line[:0], false
+			return line, cut, nil
+		}
+
+		lr.appendLine(data[:scanned])
+		n, _ := lr.r.Discard(scanned)
+		lr.offset += int64(n)
+	}
+}
+
+// Rest returns the incomplete line left once the end of the input is
+// reached, and whether it was cut.
+func (lr *lineReader) Rest() ([]byte, bool) {
+	line, cut := lr.line, lr.cut
+	lr.line, lr.cut = lr.line[:0], false
+	lr.lineEnd = lr.offset
+	return line, cut
+}
+
+// Offset returns the offset in the file right after the last line returned.
+func (lr *lineReader) Offset() int64 {
+	return lr.lineEnd
+}
+
+// indexNewline returns the index of the first newline found at the boundary
+// of a code unit in data, or -1.
+func (lr *lineReader) indexNewline(data []byte) int {
+	if len(lr.newline) == 1 {
+		return bytes.IndexByte(data, lr.newline[0])
+	}
+	for i := 0; i+len(lr.newline) <= len(data); i += len(lr.newline) {
+		if bytes.Equal(data[i:i+len(lr.newline)], lr.newline) {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendLine appends b to the current line, up to the size limit.
+func (lr *lineReader) appendLine(b []byte) {
+	if lr.maxSize > 0 && len(lr.line)+len(b) > lr.maxSize {
+		b = b[:lr.maxSize-len(lr.line)]
+		lr.cut = true
+	}
+	lr.line = append(lr.line, b...)
+}
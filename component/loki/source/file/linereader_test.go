@@ -0,0 +1,87 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineReader(t *testing.T) {
+	t.Run("aligned newlines", func(t *testing.T) {
+		// "上" (U+4E0A) is encoded as 0A 4E in UTF-16LE.
+		content := "\x0a\x4e\x0a\x00a\x00\x0a\x00"
+		lr := newLineReader(strings.NewReader(content), 0, []byte{'\n', 0}, 0)
+
+		line, cut, err := lr.ReadLine()
+		require.NoError(t, err)
+		require.False(t, cut)
+		require.Equal(t, "\x0a\x4e", string(line))
+		require.Equal(t, int64(4), lr.Offset())
+
+		line, _, err = lr.ReadLine()
+		require.NoError(t, err)
+		require.Equal(t, "a\x00", string(line))
+		require.Equal(t, int64(8), lr.Offset())
+
+		_, _, err = lr.ReadLine()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("incomplete line", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.WriteString("hello\nwor")
+		lr := newLineReader(&buf, 0, []byte{'\n'}, 0)
+
+		line, _, err := lr.ReadLine()
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(line))
+
+		// The incomplete line is returned once its newline is written.
+		_, _, err = lr.ReadLine()
+		require.Equal(t, io.EOF, err)
+		require.Equal(t, int64(6), lr.Offset())
+
+		buf.WriteString("ld\nend")
+		line, _, err = lr.ReadLine()
+		require.NoError(t, err)
+		require.Equal(t, "world", string(line))
+		require.Equal(t, int64(12), lr.Offset())
+
+		_, _, err = lr.ReadLine()
+		require.Equal(t, io.EOF, err)
+		line, cut := lr.Rest()
+		require.Equal(t, "end", string(line))
+		require.False(t, cut)
+		require.Equal(t, int64(15), lr.Offset())
+	})
+
+	t.Run("long lines are cut", func(t *testing.T) {
+		content := strings.Repeat("a", 10000) + "\nb\n"
+		lr := newLineReader(strings.NewReader(content), 0, []byte{'\n'}, 4)
+
+		line, cut, err := lr.ReadLine()
+		require.NoError(t, err)
+		require.True(t, cut)
+		require.Equal(t, "aaaa", string(line))
+		require.Equal(t, int64(10001), lr.Offset())
+
+		line, cut, err = lr.ReadLine()
+		require.NoError(t, err)
+		require.False(t, cut)
+		require.Equal(t, "b", string(line))
+	})
+
+	t.Run("misaligned offset", func(t *testing.T) {
+		// Reading starts in the middle of "a", whose last byte is skipped.
+		content := "\x00a\x00b\x00\x0a"
+		lr := newLineReader(strings.NewReader(content[1:]), 1, []byte{0, '\n'}, 0)
+
+		line, _, err := lr.ReadLine()
+		require.NoError(t, err)
+		require.Equal(t, "\x00b", string(line))
+		require.Equal(t, int64(6), lr.Offset())
+	})
+}
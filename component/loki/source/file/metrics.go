@@ -16,6 +16,7 @@ type metrics struct {
 	totalBytes       *prometheus.GaugeVec
 	readLines        *prometheus.CounterVec
 	encodingFailures *prometheus.CounterVec
+	oversizedLines   *prometheus.CounterVec
 	filesActive      prometheus.Gauge
 }
 
@@ -41,6 +42,10 @@ func newMetrics(reg prometheus.Registerer) *metrics {
 		Name: "loki_source_file_encoding_failures_total",
 		Help: "Number of encoding failures.",
 	}, []string{"path"})
+	m.oversizedLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_source_file_oversized_lines_total",
+		Help: "Number of lines longer than max_line_size which were truncated or dropped.",
+	}, []string{"path"})
 	m.filesActive = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "loki_source_file_files_active_total",
 		Help: "Number of active files.",
@@ -52,6 +57,7 @@ func newMetrics(reg prometheus.Registerer) *metrics {
 			m.totalBytes,
 			m.readLines,
 			m.encodingFailures,
+			m.oversizedLines,
 			m.filesActive,
 		)
 	}
@@ -1,11 +1,14 @@
 package file
 
 // This code is copied from Promtail. tailer implements the reader interface by
-// using the github.com/hpcloud/tail package to tail files.
+// following files with the watcher of the github.com/hpcloud/tail package.
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,15 +17,17 @@ import (
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/common/loki/positions"
 	"github.com/grafana/loki/pkg/logproto"
-	"github.com/grafana/loki/pkg/util"
 	"github.com/hpcloud/tail"
+	"github.com/hpcloud/tail/watch"
 	"github.com/prometheus/common/model"
 	"go.uber.org/atomic"
-	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/ianaindex"
-	"golang.org/x/text/transform"
+	"gopkg.in/tomb.v1"
 )
 
+// errFileRemoved is returned when the tailed file was renamed or deleted, and
+// isn't reopened.
+var errFileRemoved = errors.New("file was removed")
+
 type tailer struct {
 	metrics   *metrics
 	logger    log.Logger
@@ -31,7 +36,21 @@ type tailer struct {
 
 	path   string
 	labels string
-	tail   *tail.Tail
+
+	// reopen is set when the file can't be identified, in which case the file
+	// at the path is reopened once it's been renamed or deleted. Otherwise the
+	// tailer exits, and the file which replaces it is read by a new tailer.
+	reopen  bool
+	watcher *watch.PollingFileWatcher
+	changes *watch.FileChanges
+	tomb    tomb.Tomb
+	reader  *lineReader
+
+	// file is the tailed file. It's guarded by posAndSizeMtx, as it's replaced
+	// or closed by readLines while its size is read by MarkPositionAndSize.
+	file *os.File
+	// position is the offset right after the last line which was read.
+	position *atomic.Int64
 
 	posAndSizeMtx sync.Mutex
 	stopOnce      sync.Once
@@ -41,40 +60,55 @@ type tailer struct {
 	posdone chan struct{}
 	done    chan struct{}
 
-	decoder *encoding.Decoder
+	decoder             *lineDecoder
+	maxLineSize         int
+	maxLineSizeTruncate bool
 }
 
-func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string, labels string, encoding string) (*tailer, error) {
-	// Simple check to make sure the file we are tailing doesn't
-	// have a position already saved which is past the end of the file.
-	fi, err := os.Stat(path)
+func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string, labels string, encoding string, maxLineSize int, maxLineSizeTruncate bool) (*tailer, error) {
+	pos, err := positions.Get(path, labels)
 	if err != nil {
 		return nil, err
 	}
-	pos, err := positions.Get(path, labels)
+
+	var decoder *lineDecoder
+	if encoding != "" {
+		level.Info(logger).Log("msg", "Will decode messages", "from", encoding, "to", "UTF8")
+		decoder, err = newLineDecoder(encoding)
+		if err != nil {
+			return nil, err
+		}
+		if err := decoder.detectFileByteOrder(path); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := tail.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
+	// Simple check to make sure the file we are tailing doesn't
+	// have a position already saved which is past the end of the file.
 	if fi.Size() < pos {
 		positions.Remove(path, labels)
+		pos = 0
 	}
-
-	tail, err := tail.TailFile(path, tail.Config{
-		Follow:    true,
-		Poll:      true,
-		ReOpen:    true,
-		MustExist: true,
-		Location: &tail.SeekInfo{
-			Offset: pos,
-			Whence: 0,
-		},
-		Logger: util.NewLogAdapter(logger),
-	})
-	if err != nil {
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		f.Close()
 		return nil, err
 	}
 
+	id, hasID := fileID(fi)
+	if hasID {
+		positions.PutFileID(path, labels, id)
+	}
+
 	logger = log.With(logger, "component", "tailer")
 	tailer := &tailer{
 		metrics:   metrics,
@@ -83,21 +117,19 @@ func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, p
 		positions: positions,
 		path:      path,
 		labels:    labels,
-		tail:      tail,
+		reopen:    !hasID,
+		watcher:   watch.NewPollingFileWatcher(path),
+		reader:    newLineReader(f, pos, decoder.newline(), decoder.maxRawLineSize(maxLineSize)),
+		file:      f,
+		position:  atomic.NewInt64(pos),
 		running:   atomic.NewBool(false),
 		posquit:   make(chan struct{}),
 		posdone:   make(chan struct{}),
 		done:      make(chan struct{}),
-	}
 
-	if encoding != "" {
-		level.Info(tailer.logger).Log("msg", "Will decode messages", "from", encoding, "to", "UTF8")
-		encoder, err := ianaindex.IANA.Encoding(encoding)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get IANA encoding %s: %w", encoding, err)
-		}
-		decoder := encoder.NewDecoder()
-		tailer.decoder = decoder
+		decoder:             decoder,
+		maxLineSize:         maxLineSize,
+		maxLineSizeTruncate: maxLineSizeTruncate,
 	}
 
 	go tailer.readLines()
@@ -126,10 +158,7 @@ func (t *tailer) updatePosition() {
 			err := t.MarkPositionAndSize()
 			if err != nil {
 				level.Error(t.logger).Log("msg", "position timer: error getting tail position and/or size, stopping tailer", "path", t.path, "error", err)
-				err := t.tail.Stop()
-				if err != nil {
-					level.Error(t.logger).Log("msg", "position timer: error stopping tailer", "path", t.path, "error", err)
-				}
+				t.tomb.Kill(err)
 				return
 			}
 		case <-t.posquit:
@@ -138,12 +167,8 @@ func (t *tailer) updatePosition() {
 	}
 }
 
-// readLines runs in a goroutine and consumes the t.tail.Lines channel from the
-// underlying tailer. Et will only exit when that channel is closed. This is
-// important to avoid a deadlock in the underlying tailer which can happen if
-// there are unread lines in this channel and the Stop method on the tailer is
-// called, the underlying tailer will never exit if there are unread lines in
-// the t.tail.Lines channel
+// readLines runs in a goroutine and follows the file until the tailer is
+// stopped, the file is removed, or an error occurs.
 func (t *tailer) readLines() {
 	level.Info(t.logger).Log("msg", "tail routine: started", "path", t.path)
 
@@ -152,47 +177,172 @@ func (t *tailer) readLines() {
 	// This function runs in a goroutine, if it exits this tailer will never do any more tailing.
 	// Clean everything up.
 	defer func() {
+		// Stops the file watcher.
+		t.tomb.Kill(nil)
 		t.cleanupMetrics()
 		t.running.Store(false)
 		level.Info(t.logger).Log("msg", "tail routine: exited", "path", t.path)
 		close(t.done)
 	}()
-	entries := t.handler.Chan()
+
+	err := t.follow()
+	switch {
+	case errors.Is(err, errFileRemoved):
+		level.Info(t.logger).Log("msg", "tail routine: file was removed, stopping tailer", "path", t.path)
+		t.markFinalPosition()
+	case err != nil && !errors.Is(err, tomb.ErrDying):
+		level.Error(t.logger).Log("msg", "tail routine: error tailing file, stopping tailer", "path", t.path, "error", err)
+	}
+}
+
+// follow reads the lines of the file as they're written, until the tailer is
+// stopped or the file is removed.
+func (t *tailer) follow() error {
 	for {
-		line, ok := <-t.tail.Lines
-		if !ok {
-			level.Info(t.logger).Log("msg", "tail routine: tail channel closed, stopping tailer", "path", t.path, "reason", t.tail.Tomb.Err())
-			return
+		if err := t.readAvailable(); err != nil {
+			return err
+		}
+		if err := t.waitForChanges(); err != nil {
+			return err
+		}
+	}
+}
+
+// readAvailable sends the lines of the file until its end is reached. A line
+// which isn't followed by a newline yet is kept by the reader.
+func (t *tailer) readAvailable() error {
+	for {
+		line, cut, err := t.reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading line: %w", err)
+		}
+		if err := t.handleLine(line, cut); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForChanges waits until the file is appended to, truncated or removed.
+// Truncated files are read from the start, and removed files are reopened if
+// t.reopen is set.
+func (t *tailer) waitForChanges() error {
+	if t.changes == nil {
+		offset, err := t.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		t.changes, err = t.watcher.ChangeEvents(&t.tomb, offset)
+		if os.IsNotExist(err) {
+			return t.handleRemoved()
+		} else if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-t.changes.Modified:
+		return nil
+	case <-t.changes.Truncated:
+		level.Info(t.logger).Log("msg", "file was truncated, reading it from the start", "path", t.path)
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.reader.reset(t.file, 0)
+		t.position.Store(0)
+		return nil
+	case <-t.changes.Deleted:
+		t.changes = nil
+		return t.handleRemoved()
+	case <-t.tomb.Dying():
+		return tomb.ErrDying
+	}
+}
+
+// handleRemoved sends the rest of the file once it's been renamed or deleted,
+// and reopens the file at the path if t.reopen is set. Changes may be missed
+// when polling, so the file is read once more before giving up on it.
+func (t *tailer) handleRemoved() error {
+	if err := t.readAvailable(); err != nil {
+		return err
+	}
+	// The last line won't be followed by a newline anymore.
+	if line, cut := t.reader.Rest(); len(line) > 0 {
+		if err := t.handleLine(line, cut); err != nil {
+			return err
 		}
+	}
+	if !t.reopen {
+		return errFileRemoved
+	}
 
-		// Note currently the tail implementation hardcodes Err to nil, this should never hit.
-		if line.Err != nil {
-			level.Error(t.logger).Log("msg", "tail routine: error reading line", "path", t.path, "error", line.Err)
+	level.Info(t.logger).Log("msg", "re-opening moved/deleted file", "path", t.path)
+	for {
+		if err := t.watcher.BlockUntilExists(&t.tomb); err != nil {
+			return err
+		}
+		f, err := tail.OpenFile(t.path)
+		if os.IsNotExist(err) {
+			// The file was removed again.
 			continue
+		} else if err != nil {
+			return err
 		}
 
-		var text string
-		if t.decoder != nil {
-			var err error
-			text, err = t.convertToUTF8(line.Text)
-			if err != nil {
-				level.Debug(t.logger).Log("msg", "failed to convert encoding", "error", err)
-				t.metrics.encodingFailures.WithLabelValues(t.path).Inc()
-				text = fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent Flow: %s", err.Error())
-			}
-		} else {
-			text = line.Text
+		t.posAndSizeMtx.Lock()
+		t.file.Close()
+		t.file = f
+		t.posAndSizeMtx.Unlock()
+
+		t.reader.reset(f, 0)
+		t.position.Store(0)
+		return nil
+	}
+}
+
+// handleLine converts a line to UTF-8, enforces its maximum size and sends it.
+// cut is set if the end of the line was discarded while it was read.
+func (t *tailer) handleLine(line []byte, cut bool) error {
+	var text string
+	if t.decoder != nil {
+		var err error
+		text, err = t.convertToUTF8(string(line))
+		if err != nil {
+			level.Debug(t.logger).Log("msg", "failed to convert encoding", "error", err)
+			t.metrics.encodingFailures.WithLabelValues(t.path).Inc()
+			text = fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent Flow: %s", err.Error())
 		}
+	} else {
+		text = string(line)
+	}
+	text = strings.TrimSuffix(text, "\r")
+
+	t.metrics.readLines.WithLabelValues(t.path).Inc()
 
-		t.metrics.readLines.WithLabelValues(t.path).Inc()
-		entries <- loki.Entry{
+	text, send, oversized := limitLineSize(text, cut, t.maxLineSize, t.maxLineSizeTruncate)
+	if oversized {
+		t.metrics.oversizedLines.WithLabelValues(t.path).Inc()
+	}
+
+	// Dropped lines still count towards the position, so that they're
+	// skipped the next time the file is opened.
+	if send {
+		entry := loki.Entry{
 			Labels: model.LabelSet{},
 			Entry: logproto.Entry{
-				Timestamp: line.Time,
+				Timestamp: time.Now(),
 				Line:      text,
 			},
 		}
+		select {
+		case t.handler.Chan() <- entry:
+		case <-t.tomb.Dying():
+			return tomb.ErrDying
+		}
 	}
+	t.position.Store(t.reader.Offset())
+	return nil
 }
 
 func (t *tailer) MarkPositionAndSize() error {
@@ -200,27 +350,39 @@ func (t *tailer) MarkPositionAndSize() error {
 	t.posAndSizeMtx.Lock()
 	defer t.posAndSizeMtx.Unlock()
 
-	size, err := t.tail.Size()
-	if err != nil {
-		// If the file no longer exists, no need to save position information
-		if err == os.ErrNotExist {
-			level.Info(t.logger).Log("msg", "skipping update of position for a file which does not currently exist", "path", t.path)
-			return nil
-		}
-		return err
+	// The file is closed once its final position was recorded.
+	if t.file == nil {
+		return nil
 	}
-	t.metrics.totalBytes.WithLabelValues(t.path).Set(float64(size))
-
-	pos, err := t.tail.Tell()
+	fi, err := t.file.Stat()
 	if err != nil {
 		return err
 	}
+	t.metrics.totalBytes.WithLabelValues(t.path).Set(float64(fi.Size()))
+
+	pos := t.position.Load()
 	t.metrics.readBytes.WithLabelValues(t.path).Set(float64(pos))
 	t.positions.Put(t.path, t.labels, pos)
 
 	return nil
 }
 
+// markFinalPosition records the size of the file as its position once it was
+// read up to its end because it was renamed or deleted, and closes it.
+func (t *tailer) markFinalPosition() {
+	t.posAndSizeMtx.Lock()
+	defer t.posAndSizeMtx.Unlock()
+
+	fi, err := t.file.Stat()
+	if err != nil {
+		level.Error(t.logger).Log("msg", "error getting final size of file", "path", t.path, "error", err)
+	} else {
+		t.positions.Put(t.path, t.labels, fi.Size())
+	}
+	t.file.Close()
+	t.file = nil
+}
+
 func (t *tailer) Stop() {
 	// stop can be called by two separate threads in filetarget, to avoid a panic closing channels more than once
 	// we wrap the stop in a sync.Once.
@@ -229,19 +391,24 @@ func (t *tailer) Stop() {
 		close(t.posquit)
 		<-t.posdone
 
-		// Save the current position before shutting down tailer
+		// Wait for readLines() to exit, so that no line is read after the
+		// position is saved.
+		t.tomb.Kill(nil)
+		<-t.done
+
+		// Save the current position before closing the file
 		err := t.MarkPositionAndSize()
 		if err != nil {
 			level.Error(t.logger).Log("msg", "error marking file position when stopping tailer", "path", t.path, "error", err)
 		}
 
-		// Stop the underlying tailer
-		err = t.tail.Stop()
-		if err != nil {
-			level.Error(t.logger).Log("msg", "error stopping tailer", "path", t.path, "error", err)
+		t.posAndSizeMtx.Lock()
+		if t.file != nil {
+			t.file.Close()
+			t.file = nil
 		}
-		// Wait for readLines() to consume all the remaining messages and exit when the channel is closed
-		<-t.done
+		t.posAndSizeMtx.Unlock()
+
 		level.Info(t.logger).Log("msg", "stopped tailing file", "path", t.path)
 		t.handler.Stop()
 	})
@@ -252,12 +419,7 @@ func (t *tailer) IsRunning() bool {
 }
 
 func (t *tailer) convertToUTF8(text string) (string, error) {
-	res, _, err := transform.String(t.decoder, text)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode text to UTF8: %w", err)
-	}
-
-	return res, nil
+	return t.decoder.decode(text)
 }
 
 // cleanupMetrics removes all metrics exported by this tailer
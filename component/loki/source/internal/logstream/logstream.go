@@ -0,0 +1,197 @@
+// Package logstream follows log streams whose lines are prefixed by their
+// timestamp, such as the logs of Docker containers or Kubernetes pods.
+//
+// The timestamp of the newest line read is stored as the position of the
+// stream, so that the next log stream can be requested from it after the
+// previous one ends or after a restart. Lines which aren't newer than the
+// position a log stream was requested from have already been read and are
+// skipped. Within a log stream, lines aren't required to be in order, as
+// streams such as stdout and stderr may be interleaved.
+package logstream
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Options configure a Tailer.
+type Options struct {
+	Logger  log.Logger
+	Handler loki.LogsReceiver
+	Backoff backoff.Config
+
+	// Positions stores the timestamp of the last line read under the key
+	// PositionKey and the labels PositionLabels.
+	Positions      positions.Positions
+	PositionKey    string
+	PositionLabels string
+
+	// Entries counts the forwarded entries, and ParseErrors the lines whose
+	// timestamp couldn't be parsed.
+	Entries     prometheus.Counter
+	ParseErrors prometheus.Counter
+
+	// OnError is called with the error which ended a log stream, along with
+	// the number of retries so far. It isn't called once the Tailer is
+	// stopped.
+	OnError func(err error, numRetries int)
+}
+
+// TailFunc reads a log stream until it ends, and passes its lines to s.
+type TailFunc func(ctx context.Context, s *Stream) error
+
+// Tailer reads log streams with a TailFunc until it's stopped, waiting with a
+// backoff between two log streams.
+type Tailer struct {
+	opts Options
+	tail TailFunc
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mut     sync.RWMutex
+	lastErr error
+}
+
+// New creates and starts a Tailer.
+func New(opts Options, tail TailFunc) *Tailer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Tailer{
+		opts: opts,
+		tail: tail,
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go t.run(ctx)
+	return t
+}
+
+func (t *Tailer) run(ctx context.Context) {
+	defer close(t.done)
+
+	bo := backoff.New(ctx, t.opts.Backoff)
+	for bo.Ongoing() {
+		since := t.lastTimestamp()
+		s := &Stream{t: t, since: since, lastTs: since}
+		err := t.tail(ctx, s)
+		if ctx.Err() != nil {
+			return
+		}
+		t.setLastError(err)
+		if err != nil && t.opts.OnError != nil {
+			t.opts.OnError(err, bo.NumRetries())
+		}
+
+		// Reconnect right away if the stream was making progress; it most
+		// likely ended because the source of the logs stopped.
+		if s.n > 0 {
+			bo.Reset()
+		}
+		bo.Wait()
+	}
+}
+
+// lastTimestamp returns the timestamp of the last line read, or a zero time
+// if none was stored yet.
+func (t *Tailer) lastTimestamp() time.Time {
+	pos := t.opts.Positions.GetString(t.opts.PositionKey, t.opts.PositionLabels)
+	if pos == "" {
+		return time.Time{}
+	}
+	ts, err := time.Parse(time.RFC3339Nano, pos)
+	if err != nil {
+		level.Warn(t.opts.Logger).Log("msg", "ignoring invalid position", "position", pos, "err", err)
+		return time.Time{}
+	}
+	return ts
+}
+
+func (t *Tailer) setLastError(err error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.lastErr = err
+}
+
+// LastError returns the error which ended the last log stream, if any.
+func (t *Tailer) LastError() error {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	return t.lastErr
+}
+
+// Stop stops the Tailer and waits for it to exit.
+func (t *Tailer) Stop() {
+	t.cancel()
+	<-t.done
+}
+
+// Stream handles the lines of a single log stream of a Tailer.
+type Stream struct {
+	t      *Tailer
+	since  time.Time // Position the log stream is read from.
+	lastTs time.Time // Timestamp of the newest line read.
+	n      int
+}
+
+// Since returns the timestamp of the newest line read by the previous log
+// streams, from which the log stream should be requested. A zero time means
+// that no line was read yet.
+func (s *Stream) Since() time.Time {
+	return s.since
+}
+
+// Handle forwards a log line prefixed by its timestamp with the given labels,
+// and stores its position. The line must not include its terminator. Lines
+// which aren't newer than Since have already been read and are skipped, and
+// lines with empty labels are dropped. An error is only returned
+// if ctx is canceled before the entry is forwarded.
+func (s *Stream) Handle(ctx context.Context, lset model.LabelSet, line string) error {
+	rawTs, msg, _ := strings.Cut(line, " ")
+
+	ts, err := time.Parse(time.RFC3339Nano, rawTs)
+	if err != nil {
+		s.t.opts.ParseErrors.Inc()
+		level.Debug(s.t.opts.Logger).Log("msg", "failed to parse log line timestamp, skipping line", "err", err)
+		return nil
+	}
+	if !ts.After(s.since) {
+		return nil
+	}
+
+	if len(lset) > 0 {
+		entry := loki.Entry{
+			Labels: lset.Clone(),
+			Entry: logproto.Entry{
+				Timestamp: ts,
+				Line:      msg,
+			},
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case s.t.opts.Handler <- entry:
+		}
+		s.t.opts.Entries.Inc()
+	}
+
+	// Lines of interleaved streams may be older than the previous one, which
+	// must not move the position back.
+	if ts.After(s.lastTs) {
+		s.t.opts.Positions.PutString(s.t.opts.PositionKey, s.t.opts.PositionLabels, ts.Format(time.RFC3339Nano))
+		s.lastTs = ts
+	}
+	s.n++
+	return nil
+}
@@ -0,0 +1,174 @@
+package logstream
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailer(t *testing.T) {
+	var (
+		lset    = model.LabelSet{"job": "app"}
+		errDone = errors.New("stream ended")
+		lines   = []string{
+			"2023-01-01T10:00:00.1Z first",
+			"not a timestamped line",
+			"2023-01-01T10:00:00.2Z second",
+			"2023-01-01T10:00:00.3Z third",
+		}
+
+		mut    sync.Mutex
+		sinces []time.Time
+	)
+
+	// Every log stream serves all the lines, so that the lines which were
+	// already read must be skipped. The third line is dropped.
+	tail := func(ctx context.Context, s *Stream) error {
+		mut.Lock()
+		sinces = append(sinces, s.Since())
+		mut.Unlock()
+
+		for i, line := range lines {
+			labels := lset
+			if i == 3 {
+				labels = nil
+			}
+			if err := s.Handle(ctx, labels, line); err != nil {
+				return err
+			}
+		}
+		return errDone
+	}
+
+	pos := newTestPositions(t)
+	pos.PutString("key", lset.String(), "2023-01-01T10:00:00.1Z")
+
+	var (
+		ch      = make(loki.LogsReceiver)
+		entries = prometheus.NewCounter(prometheus.CounterOpts{})
+		parse   = prometheus.NewCounter(prometheus.CounterOpts{})
+		errs    = make(chan error, 10)
+	)
+	tt := New(Options{
+		Logger:         util.TestLogger(t),
+		Handler:        ch,
+		Backoff:        backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+		Positions:      pos,
+		PositionKey:    "key",
+		PositionLabels: lset.String(),
+		Entries:        entries,
+		ParseErrors:    parse,
+		OnError: func(err error, _ int) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}, tail)
+	defer tt.Stop()
+
+	select {
+	case e := <-ch:
+		require.Equal(t, "second", e.Line)
+		require.Equal(t, lset, e.Labels)
+		require.True(t, time.Date(2023, 1, 1, 10, 0, 0, 200_000_000, time.UTC).Equal(e.Timestamp))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for log entry")
+	}
+
+	// The following log streams are requested from the last line, and no
+	// other entries are forwarded.
+	require.ErrorIs(t, <-errs, errDone)
+	require.ErrorIs(t, <-errs, errDone)
+	select {
+	case e := <-ch:
+		require.FailNow(t, "unexpected log entry", "got %q", e.Line)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mut.Lock()
+	require.Equal(t, "2023-01-01T10:00:00.1Z", sinces[0].Format(time.RFC3339Nano))
+	require.Equal(t, "2023-01-01T10:00:00.3Z", sinces[1].Format(time.RFC3339Nano))
+	mut.Unlock()
+
+	require.Equal(t, "2023-01-01T10:00:00.3Z", pos.GetString("key", lset.String()))
+	require.Equal(t, 1.0, testutil.ToFloat64(entries))
+	require.GreaterOrEqual(t, testutil.ToFloat64(parse), 1.0)
+	require.ErrorIs(t, tt.LastError(), errDone)
+}
+
+// TestTailer_Interleaved verifies that lines of interleaved streams, such as
+// stdout and stderr, are forwarded even if they're older than the previous
+// line.
+func TestTailer_Interleaved(t *testing.T) {
+	var (
+		lset  = model.LabelSet{"job": "app"}
+		lines = []string{
+			"2023-01-01T10:00:00.1Z skipped",
+			"2023-01-01T10:00:00.3Z stdout",
+			"2023-01-01T10:00:00.2Z stderr",
+		}
+	)
+	tail := func(ctx context.Context, s *Stream) error {
+		for _, line := range lines {
+			if err := s.Handle(ctx, lset, line); err != nil {
+				return err
+			}
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	pos := newTestPositions(t)
+	pos.PutString("key", lset.String(), "2023-01-01T10:00:00.1Z")
+
+	ch := make(loki.LogsReceiver)
+	tt := New(Options{
+		Logger:         util.TestLogger(t),
+		Handler:        ch,
+		Positions:      pos,
+		PositionKey:    "key",
+		PositionLabels: lset.String(),
+		Entries:        prometheus.NewCounter(prometheus.CounterOpts{}),
+		ParseErrors:    prometheus.NewCounter(prometheus.CounterOpts{}),
+	}, tail)
+	defer tt.Stop()
+
+	for _, want := range []string{"stdout", "stderr"} {
+		select {
+		case e := <-ch:
+			require.Equal(t, want, e.Line)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log entry")
+		}
+	}
+
+	// The older line doesn't move the position back.
+	require.Eventually(t, func() bool {
+		return pos.GetString("key", lset.String()) == "2023-01-01T10:00:00.3Z"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func newTestPositions(t *testing.T) positions.Positions {
+	t.Helper()
+
+	pos, err := positions.New(util.TestLogger(t), positions.Config{
+		SyncPeriod:    time.Minute,
+		PositionsFile: filepath.Join(t.TempDir(), "positions.yml"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(pos.Stop)
+	return pos
+}
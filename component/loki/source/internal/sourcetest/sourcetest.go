@@ -0,0 +1,98 @@
+// Package sourcetest provides utilities for testing loki.source components.
+package sourcetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs c until either the test ends or the returned function is called,
+// which waits for c to exit.
+func Run(t *testing.T, c component.Component) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// ReceiveEntry returns the next entry received from ch, failing the test if
+// none is received in time.
+func ReceiveEntry(t *testing.T, ch chan loki.Entry) loki.Entry {
+	t.Helper()
+
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for log entry")
+	}
+	return loki.Entry{}
+}
+
+// RequireNoEntry fails the test if an entry is received from ch within wait.
+func RequireNoEntry(t *testing.T, ch chan loki.Entry, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case e := <-ch:
+		require.FailNow(t, "unexpected log entry", "got %q", e.Line)
+	case <-time.After(wait):
+	}
+}
+
+// Entry is the line and labels of an expected log entry.
+type Entry struct {
+	Line   string
+	Labels model.LabelSet
+}
+
+// ExpectEntries requires the next entries received from ch to have the lines
+// and labels of entries, in order.
+func ExpectEntries(t *testing.T, ch chan loki.Entry, entries ...Entry) {
+	t.Helper()
+
+	for _, expect := range entries {
+		select {
+		case e := <-ch:
+			require.Equal(t, expect.Line, e.Line)
+			require.Equal(t, expect.Labels, e.Labels)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log entry", "expected %q", expect.Line)
+		}
+	}
+}
+
+// RelabelRules returns rules which copy each source label to the target label
+// following it.
+func RelabelRules(labels ...string) flow_relabel.Rules {
+	var rules flow_relabel.Rules
+	for i := 0; i < len(labels); i += 2 {
+		rule := flow_relabel.DefaultRelabelConfig
+		rule.SourceLabels = []string{labels[i]}
+		rule.TargetLabel = labels[i+1]
+		rules = append(rules, &rule)
+	}
+	return rules
+}
@@ -0,0 +1,184 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exportReader reads a file written in the journal export format, as
+// produced by `journalctl -o export`. The file is read once; Next returns
+// io.EOF once all of its entries have been read.
+//
+// See https://systemd.io/JOURNAL_EXPORT_FORMATS/ for a description of the
+// format.
+type exportReader struct {
+	cfg readerConfig
+	f   *os.File
+	r   *bufio.Reader
+}
+
+var _ journalReader = (*exportReader)(nil)
+
+// newExportReader opens the export file at cfg.Path. If the file holds the
+// entry at cfg.Cursor, reading starts right after it.
+func newExportReader(cfg readerConfig) (*exportReader, error) {
+	f, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	er := &exportReader{cfg: cfg, f: f, r: bufio.NewReader(f)}
+
+	if cfg.Cursor != "" {
+		found, err := er.skipToCursor(cfg.Cursor)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if !found {
+			// The cursor isn't part of this file; read it from the start.
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+			er.r.Reset(f)
+		}
+	}
+	return er, nil
+}
+
+// skipToCursor reads entries until the one at cursor, and reports whether it
+// was found.
+func (er *exportReader) skipToCursor(cursor string) (bool, error) {
+	for {
+		e, err := er.readEntry()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if e.Cursor == cursor {
+			// Entries older than the max age are still skipped by Next.
+			return true, nil
+		}
+	}
+}
+
+// Next implements journalReader.
+func (er *exportReader) Next(ctx context.Context) (*journalEntry, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		e, err := er.readEntry()
+		if err != nil {
+			return nil, err
+		}
+		if e.Time().Before(er.cfg.Since) || !matchesEntry(er.cfg.Matches, e.Fields) {
+			continue
+		}
+		return e, nil
+	}
+}
+
+// readEntry reads the next entry of the file.
+func (er *exportReader) readEntry() (*journalEntry, error) {
+	e := &journalEntry{Fields: make(map[string]string)}
+	var read bool
+
+	for {
+		line, err := er.r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			if !read {
+				return nil, io.EOF
+			}
+			// The last entry of the file isn't followed by an empty line.
+			return e, e.validate()
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if len(line) == 0 {
+			if !read {
+				// Tolerate extra empty lines between entries.
+				continue
+			}
+			return e, e.validate()
+		}
+		read = true
+
+		var field, value string
+		if i := bytes.IndexByte(line, '='); i >= 0 {
+			field, value = string(line[:i]), string(line[i+1:])
+		} else {
+			// A field without '=' is followed by its binary value, prefixed
+			// with its size as a little-endian 64-bit integer.
+			field = string(line)
+			if value, err = er.readBinaryValue(); err != nil {
+				return nil, fmt.Errorf("read value of journal field %s: %w", field, err)
+			}
+		}
+
+		switch {
+		case field == "__CURSOR":
+			e.Cursor = value
+		case field == "__REALTIME_TIMESTAMP":
+			ts, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid __REALTIME_TIMESTAMP %q: %w", value, err)
+			}
+			e.RealtimeTimestamp = ts
+		case strings.HasPrefix(field, "__"):
+			// Other address fields, like __MONOTONIC_TIMESTAMP, aren't part
+			// of the entry's fields.
+		default:
+			e.Fields[field] = value
+		}
+	}
+}
+
+func (er *exportReader) readBinaryValue() (string, error) {
+	var size uint64
+	if err := binary.Read(er.r, binary.LittleEndian, &size); err != nil {
+		return "", err
+	}
+	if size > maxExportFieldSize {
+		return "", fmt.Errorf("field of %d bytes exceeds the maximum of %d bytes", size, maxExportFieldSize)
+	}
+	buf := make([]byte, size+1)
+	if _, err := io.ReadFull(er.r, buf); err != nil {
+		return "", err
+	}
+	if buf[size] != '\n' {
+		return "", errors.New("binary field isn't terminated by a newline")
+	}
+	return string(buf[:size]), nil
+}
+
+// maxExportFieldSize bounds the size of binary fields, to avoid allocating
+// arbitrary amounts of memory when reading a corrupted file.
+const maxExportFieldSize = 64 * 1024 * 1024
+
+func (e *journalEntry) validate() error {
+	if e.Cursor == "" {
+		return errors.New("journal entry has no __CURSOR field")
+	}
+	if e.RealtimeTimestamp == 0 {
+		return errors.New("journal entry has no __REALTIME_TIMESTAMP field")
+	}
+	return nil
+}
+
+// Close implements journalReader.
+func (er *exportReader) Close() error {
+	return er.f.Close()
+}
@@ -0,0 +1,152 @@
+package journal
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testExportFile = "testdata/journal.export"
+
+func TestParseMatches(t *testing.T) {
+	matches, err := parseMatches("_SYSTEMD_UNIT=sshd.service  PRIORITY=3\n_SYSTEMD_UNIT=")
+	require.NoError(t, err)
+	require.Equal(t, []match{
+		{Field: "_SYSTEMD_UNIT", Value: "sshd.service"},
+		{Field: "PRIORITY", Value: "3"},
+		{Field: "_SYSTEMD_UNIT", Value: ""},
+	}, matches)
+
+	_, err = parseMatches("_SYSTEMD_UNIT")
+	require.EqualError(t, err, `invalid journal match "_SYSTEMD_UNIT", expected FIELD=value`)
+	_, err = parseMatches("=sshd.service")
+	require.Error(t, err)
+}
+
+func TestMatchesEntry(t *testing.T) {
+	fields := map[string]string{"_SYSTEMD_UNIT": "sshd.service", "PRIORITY": "6"}
+
+	tests := map[string]struct {
+		matches string
+		want    bool
+	}{
+		"no matches":              {matches: "", want: true},
+		"single match":            {matches: "_SYSTEMD_UNIT=sshd.service", want: true},
+		"mismatch":                {matches: "_SYSTEMD_UNIT=nginx.service", want: false},
+		"same field is ORed":      {matches: "_SYSTEMD_UNIT=nginx.service _SYSTEMD_UNIT=sshd.service", want: true},
+		"different fields ANDed":  {matches: "_SYSTEMD_UNIT=sshd.service PRIORITY=3", want: false},
+		"all fields match":        {matches: "_SYSTEMD_UNIT=sshd.service PRIORITY=6", want: true},
+		"missing field":           {matches: "_TRANSPORT=kernel", want: false},
+		"missing field alongside": {matches: "_TRANSPORT=kernel _SYSTEMD_UNIT=sshd.service", want: false},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			matches, err := parseMatches(tt.matches)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, matchesEntry(matches, fields))
+		})
+	}
+}
+
+func TestExportReader(t *testing.T) {
+	t.Run("all entries", func(t *testing.T) {
+		entries := readExportEntries(t, readerConfig{Path: testExportFile})
+		require.Len(t, entries, 5)
+
+		first := entries[0]
+		require.Equal(t, "s=1;i=1;b=2f4e2a1b6a8f4e1c9d3b7a5e6c1d2f3a;t=5f128840d4000", first.Cursor)
+		require.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), first.Time().UTC())
+		require.Equal(t, map[string]string{
+			"_SYSTEMD_UNIT":     "sshd.service",
+			"PRIORITY":          "6",
+			"SYSLOG_IDENTIFIER": "sshd",
+			"_HOSTNAME":         "host-1",
+			"MESSAGE":           "Server listening on 0.0.0.0 port 22.",
+		}, first.Fields)
+
+		// Fields holding binary data or newlines are written with their size.
+		require.Equal(t, "Accepted publickey for root\nfrom 10.0.0.1", entries[2].Fields["MESSAGE"])
+	})
+
+	t.Run("matches", func(t *testing.T) {
+		matches, err := parseMatches("_SYSTEMD_UNIT=nginx.service")
+		require.NoError(t, err)
+		entries := readExportEntries(t, readerConfig{Path: testExportFile, Matches: matches})
+		require.Len(t, entries, 2)
+		require.Equal(t, "connect() failed (111: Connection refused)", entries[0].Fields["MESSAGE"])
+		require.Equal(t, "reloading configuration", entries[1].Fields["MESSAGE"])
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		all := readExportEntries(t, readerConfig{Path: testExportFile})
+
+		entries := readExportEntries(t, readerConfig{Path: testExportFile, Cursor: all[2].Cursor})
+		require.Equal(t, all[3:], entries)
+
+		// Unknown cursors make the reader start from the beginning.
+		entries = readExportEntries(t, readerConfig{Path: testExportFile, Cursor: "s=2;i=1"})
+		require.Equal(t, all, entries)
+	})
+
+	t.Run("since", func(t *testing.T) {
+		all := readExportEntries(t, readerConfig{Path: testExportFile})
+
+		entries := readExportEntries(t, readerConfig{Path: testExportFile, Since: all[1].Time()})
+		require.Equal(t, all[1:], entries)
+
+		// Since takes precedence over older cursors.
+		entries = readExportEntries(t, readerConfig{Path: testExportFile, Cursor: all[0].Cursor, Since: all[3].Time()})
+		require.Equal(t, all[3:], entries)
+	})
+
+	t.Run("trailing entry without empty line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.export")
+		require.NoError(t, os.WriteFile(path, []byte("__CURSOR=c\n__REALTIME_TIMESTAMP=1\nMESSAGE=hello"), 0o644))
+
+		entries := readExportEntries(t, readerConfig{Path: path})
+		require.Len(t, entries, 1)
+		require.Equal(t, "hello", entries[0].Fields["MESSAGE"])
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		for _, content := range []string{
+			"MESSAGE=no cursor\n\n",
+			"__CURSOR=c\n__REALTIME_TIMESTAMP=yesterday\n\n",
+			"__CURSOR=c\n__REALTIME_TIMESTAMP=1\nMESSAGE\n\x05\x00\x00",
+		} {
+			path := filepath.Join(t.TempDir(), "journal.export")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+			r, err := newExportReader(readerConfig{Path: path})
+			require.NoError(t, err)
+			_, err = r.Next(context.Background())
+			require.Error(t, err)
+			require.NotErrorIs(t, err, io.EOF)
+			require.NoError(t, r.Close())
+		}
+	})
+}
+
+func readExportEntries(t *testing.T, cfg readerConfig) []*journalEntry {
+	t.Helper()
+
+	r, err := newExportReader(cfg)
+	require.NoError(t, err)
+	defer r.Close()
+
+	var entries []*journalEntry
+	for {
+		e, err := r.Next(context.Background())
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, e)
+	}
+}
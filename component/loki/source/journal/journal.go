@@ -0,0 +1,253 @@
+// Package journal implements the loki.source.journal component, which reads
+// log entries from the systemd journal.
+package journal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/prometheus/common/model"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.journal",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the loki.source.journal
+// component.
+type Arguments struct {
+	FormatAsJson bool                `river:"format_as_json,attr,optional"`
+	MaxAge       time.Duration       `river:"max_age,attr,optional"`
+	Path         string              `river:"path,attr,optional"`
+	RelabelRules flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+	Matches      string              `river:"matches,attr,optional"`
+	Labels       map[string]string   `river:"labels,attr,optional"`
+	ForwardTo    []loki.LogsReceiver `river:"forward_to,attr"`
+}
+
+// DefaultArguments provides the default arguments for the
+// loki.source.journal component.
+var DefaultArguments = Arguments{
+	// The default earliest entry that will be read if there's no saved
+	// position newer than the max age.
+	MaxAge: 7 * time.Hour,
+}
+
+var _ river.Unmarshaler = (*Arguments)(nil)
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (a *Arguments) UnmarshalRiver(f func(interface{}) error) error {
+	*a = DefaultArguments
+
+	type arguments Arguments
+	if err := f((*arguments)(a)); err != nil {
+		return err
+	}
+
+	if a.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	if _, err := parseMatches(a.Matches); err != nil {
+		return err
+	}
+	return nil
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// Component implements the loki.source.journal component.
+type Component struct {
+	opts    component.Options
+	metrics *metrics
+
+	mut       sync.RWMutex
+	args      Arguments
+	handler   loki.LogsReceiver
+	receivers []loki.LogsReceiver
+	posFile   positions.Positions
+	target    *target
+
+	// newSystemdReader opens the systemd journal. It's overridden in tests.
+	newSystemdReader func(readerConfig) (journalReader, error)
+}
+
+// New creates a new loki.source.journal component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	err := os.MkdirAll(o.DataPath, 0750)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	positionsFile, err := positions.New(o.Logger, positions.Config{
+		SyncPeriod:        10 * time.Second,
+		PositionsFile:     filepath.Join(o.DataPath, "positions.yml"),
+		IgnoreInvalidYaml: false,
+		ReadOnly:          false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:    o,
+		metrics: newMetrics(o.Registerer),
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+		posFile:   positionsFile,
+
+		newSystemdReader: newSystemdReader,
+	}
+
+	// Call to Update() to start reading the journal and set receivers once at
+	// the start.
+	if err := c.Update(args); err != nil {
+		positionsFile.Stop()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.journal component shutting down, stopping reader")
+		c.mut.Lock()
+		if c.target != nil {
+			c.target.Stop()
+		}
+		c.mut.Unlock()
+		c.posFile.Stop()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	matches, err := parseMatches(newArgs.Matches)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.args = newArgs
+	c.receivers = newArgs.ForwardTo
+
+	// Always restart reading from the saved cursor, so that the new matches
+	// and labels apply to the entries read from now on.
+	if c.target != nil {
+		c.target.Stop()
+		c.target = nil
+	}
+
+	positionKey := positions.CursorKey(c.opts.ID)
+	cfg := readerConfig{
+		Path:    newArgs.Path,
+		Matches: matches,
+		Cursor:  c.posFile.GetString(positionKey, ""),
+	}
+	if newArgs.MaxAge > 0 {
+		cfg.Since = time.Now().Add(-newArgs.MaxAge)
+	}
+	r, err := c.openReader(cfg)
+	if err != nil {
+		return fmt.Errorf("creating journal reader: %w", err)
+	}
+
+	labels := make(model.LabelSet, len(newArgs.Labels))
+	for k, v := range newArgs.Labels {
+		labels[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	c.target = newTarget(
+		c.opts.Logger,
+		c.metrics,
+		c.handler,
+		c.posFile,
+		positionKey,
+		flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules),
+		labels,
+		newArgs.FormatAsJson,
+		r,
+	)
+	return nil
+}
+
+// openReader opens the journal at cfg.Path. Regular files are read as journal
+// export files, while directories and the empty path are read as systemd
+// journals.
+func (c *Component) openReader(cfg readerConfig) (journalReader, error) {
+	if cfg.Path != "" {
+		fi, err := os.Stat(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode().IsRegular() {
+			return newExportReader(cfg)
+		}
+	}
+	return c.newSystemdReader(cfg)
+}
+
+// DebugInfo returns information about the status of the journal reader.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res readerDebugInfo
+	res.Path = c.args.Path
+	res.Cursor = c.posFile.GetString(positions.CursorKey(c.opts.ID), "")
+	if c.target != nil {
+		if err := c.target.Err(); err != nil {
+			res.Error = err.Error()
+		}
+	}
+	return res
+}
+
+type readerDebugInfo struct {
+	Path   string `river:"path,attr,optional"`
+	Cursor string `river:"cursor,attr"`
+	Error  string `river:"error,attr,optional"`
+}
@@ -0,0 +1,193 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		forward_to = []
+		matches    = "_SYSTEMD_UNIT=sshd.service"
+	`), &args))
+	require.Equal(t, 7*time.Hour, args.MaxAge)
+	require.Equal(t, "_SYSTEMD_UNIT=sshd.service", args.Matches)
+
+	require.EqualError(t, river.Unmarshal([]byte(`
+		forward_to = []
+		matches    = "_SYSTEMD_UNIT"
+	`), &args), `invalid journal match "_SYSTEMD_UNIT", expected FIELD=value`)
+
+	require.EqualError(t, river.Unmarshal([]byte(`
+		forward_to = []
+		max_age    = "-1h"
+	`), &args), "max_age must not be negative")
+}
+
+func TestJournal(t *testing.T) {
+	dataPath := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal.export")
+	content, err := os.ReadFile(testExportFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(journalPath, content, 0o644))
+
+	ch := make(chan loki.Entry)
+	args := Arguments{
+		Path:      journalPath,
+		Labels:    map[string]string{"job": "journal"},
+		ForwardTo: []loki.LogsReceiver{ch},
+		RelabelRules: flow_relabel.Rules{
+			{
+				SourceLabels: []string{"__journal__systemd_unit"},
+				Regex:        flow_relabel.Regexp{Regexp: flow_relabel.DefaultRelabelConfig.Regex.Regexp},
+				Separator:    ";",
+				Replacement:  "$1",
+				TargetLabel:  "unit",
+				Action:       flow_relabel.Replace,
+			},
+			{
+				SourceLabels: []string{"__journal_priority_keyword"},
+				Regex:        flow_relabel.Regexp{Regexp: flow_relabel.DefaultRelabelConfig.Regex.Regexp},
+				Separator:    ";",
+				Replacement:  "$1",
+				TargetLabel:  "level",
+				Action:       flow_relabel.Replace,
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	stop := runTestComponent(t, dataPath, registry, args)
+
+	// The entry without a MESSAGE field is skipped.
+	expected := []struct {
+		unit, level, line string
+		ts                time.Time
+	}{
+		{"sshd.service", "info", "Server listening on 0.0.0.0 port 22.", time.Unix(1672531200, 0)},
+		{"nginx.service", "error", "connect() failed (111: Connection refused)", time.Unix(1672531201, 0)},
+		{"sshd.service", "notice", "Accepted publickey for root\nfrom 10.0.0.1", time.Unix(1672531202, 0)},
+		{"nginx.service", "info", "reloading configuration", time.Unix(1672531204, 0)},
+	}
+	for _, want := range expected {
+		e := sourcetest.ReceiveEntry(t, ch)
+		require.Equal(t, model.LabelSet{"job": "journal", "unit": model.LabelValue(want.unit), "level": model.LabelValue(want.level)}, e.Labels)
+		require.Equal(t, want.line, e.Line)
+		require.True(t, want.ts.Equal(e.Timestamp))
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(newMetricsFrom(t, registry).journalErrors.WithLabelValues(noMessageError)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	// Restarting the component resumes reading after the saved cursor.
+	f, err := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = fmt.Fprint(f, "__CURSOR=s=1;i=6\n__REALTIME_TIMESTAMP=1672531205000000\n_SYSTEMD_UNIT=sshd.service\nPRIORITY=6\nMESSAGE=new entry\n\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	stop = runTestComponent(t, dataPath, prometheus.NewRegistry(), args)
+	defer stop()
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, "new entry", e.Line)
+	select {
+	case e := <-ch:
+		require.FailNow(t, "unexpected entry", "line: %s", e.Line)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestJournal_FormatAsJSON(t *testing.T) {
+	ch := make(chan loki.Entry)
+	stop := runTestComponent(t, t.TempDir(), prometheus.NewRegistry(), Arguments{
+		Path:         testExportFile,
+		Matches:      "_TRANSPORT=kernel",
+		FormatAsJson: true,
+		Labels:       map[string]string{"job": "journal"},
+		ForwardTo:    []loki.LogsReceiver{ch},
+	})
+	defer stop()
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"job": "journal"}, e.Labels)
+	require.JSONEq(t, `{"_SYSTEMD_UNIT": "kernel.service", "PRIORITY": "4", "_TRANSPORT": "kernel"}`, e.Line)
+}
+
+func TestJournal_EmptyLabels(t *testing.T) {
+	ch := make(chan loki.Entry)
+	registry := prometheus.NewRegistry()
+	stop := runTestComponent(t, t.TempDir(), registry, Arguments{
+		Path:      testExportFile,
+		ForwardTo: []loki.LogsReceiver{ch},
+	})
+	defer stop()
+
+	// Journal fields are only exposed as internal labels, so entries are
+	// dropped unless relabeling rules or labels are given.
+	m := newMetricsFrom(t, registry)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.journalErrors.WithLabelValues(emptyLabelsError)) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 0.0, testutil.ToFloat64(m.journalLines))
+}
+
+func TestJournal_InvalidPath(t *testing.T) {
+	_, err := New(component.Options{
+		ID:       "loki.source.journal.test",
+		Logger:   util.TestLogger(t),
+		DataPath: t.TempDir(),
+	}, Arguments{Path: filepath.Join(t.TempDir(), "missing")})
+	require.ErrorContains(t, err, "creating journal reader")
+}
+
+// runTestComponent runs a loki.source.journal component, and returns a
+// function which stops it and waits for it to exit.
+func runTestComponent(t *testing.T, dataPath string, reg prometheus.Registerer, args Arguments) func() {
+	t.Helper()
+
+	c, err := New(component.Options{
+		ID:         "loki.source.journal.test",
+		Logger:     util.TestLogger(t),
+		Registerer: reg,
+		DataPath:   dataPath,
+	}, args)
+	require.NoError(t, err)
+
+	return sourcetest.Run(t, c)
+}
+
+// newMetricsFrom returns the metrics registered to reg by a component.
+func newMetricsFrom(t *testing.T, reg prometheus.Registerer) *metrics {
+	t.Helper()
+
+	m := newMetrics(nil)
+	for _, c := range []prometheus.Collector{m.journalLines, m.journalErrors} {
+		err := reg.Register(c)
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		require.True(t, ok, "metric wasn't registered by the component: %v", err)
+		switch existing := are.ExistingCollector.(type) {
+		case prometheus.Counter:
+			m.journalLines = existing
+		case *prometheus.CounterVec:
+			m.journalErrors = existing
+		}
+	}
+	return m
+}
@@ -0,0 +1,39 @@
+package journal
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Reasons for which journal entries are dropped.
+const (
+	noMessageError   = "no_message"
+	emptyLabelsError = "empty_labels"
+)
+
+// metrics holds the metrics of the loki.source.journal component.
+type metrics struct {
+	journalLines  prometheus.Counter
+	journalErrors *prometheus.CounterVec
+}
+
+// newMetrics creates a new set of journal metrics. If reg is non-nil, the
+// metrics will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.journalLines = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_journal_target_lines_total",
+		Help: "Total number of successful journal lines read.",
+	})
+	m.journalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_source_journal_target_parsing_errors_total",
+		Help: "Total number of journal entries which couldn't be turned into log entries.",
+	}, []string{"error"})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.journalLines,
+			m.journalErrors,
+		)
+	}
+
+	return &m
+}
@@ -0,0 +1,98 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// journalEntry is a single entry read from the journal.
+type journalEntry struct {
+	// Cursor uniquely identifies the entry in the journal.
+	Cursor string
+	// RealtimeTimestamp is the wallclock time at which the entry was
+	// received by the journal, in microseconds since the epoch.
+	RealtimeTimestamp uint64
+	// Fields holds the fields of the entry, without the address fields
+	// (__CURSOR, __REALTIME_TIMESTAMP, ...).
+	Fields map[string]string
+}
+
+// Time returns the realtime timestamp of the entry.
+func (e *journalEntry) Time() time.Time {
+	return time.UnixMicro(int64(e.RealtimeTimestamp))
+}
+
+// journalReader reads entries from a journal.
+type journalReader interface {
+	io.Closer
+
+	// Next blocks until the next entry matching the reader's configuration is
+	// available or ctx is canceled. Next returns io.EOF if there will never be
+	// any more entries to read.
+	Next(ctx context.Context) (*journalEntry, error)
+}
+
+// readerConfig configures where a journalReader starts reading and which
+// entries it returns.
+type readerConfig struct {
+	// Path is the path to the journal. An empty path reads the local system
+	// journal.
+	Path string
+	// Matches filters the entries which are read. Matches on different fields
+	// must all be satisfied, while matches on the same field are alternatives.
+	Matches []match
+	// Cursor is the position of the last entry which has been read. Reading
+	// starts after it.
+	Cursor string
+	// Since is the time of the oldest entry to read. If Cursor points to an
+	// older entry, reading starts from Since instead. The zero value reads
+	// the whole journal.
+	Since time.Time
+}
+
+// match filters journal entries on the value of one of their fields.
+type match struct {
+	Field string
+	Value string
+}
+
+// String returns the match in the FIELD=value form used by journalctl.
+func (m match) String() string {
+	return m.Field + "=" + m.Value
+}
+
+// parseMatches parses a whitespace-separated list of FIELD=value matches.
+func parseMatches(s string) ([]match, error) {
+	var matches []match
+	for _, m := range strings.Fields(s) {
+		field, value, ok := strings.Cut(m, "=")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid journal match %q, expected FIELD=value", m)
+		}
+		matches = append(matches, match{Field: field, Value: value})
+	}
+	return matches, nil
+}
+
+// matchesEntry reports whether fields satisfy the matches, following the
+// semantics of sd_journal_add_match: matches on different fields are ANDed,
+// and matches on the same field are ORed.
+func matchesEntry(matches []match, fields map[string]string) bool {
+	satisfied := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		if v, ok := fields[m.Field]; ok && v == m.Value {
+			satisfied[m.Field] = true
+		} else if _, seen := satisfied[m.Field]; !seen {
+			satisfied[m.Field] = false
+		}
+	}
+	for _, ok := range satisfied {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
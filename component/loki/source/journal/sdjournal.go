@@ -0,0 +1,120 @@
+//go:build linux && cgo && promtail_journal_enabled
+
+package journal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// waitTimeout is how long sdjournalReader waits for new entries before
+// checking whether it's been canceled.
+const waitTimeout = time.Second
+
+// sdjournalReader reads the systemd journal through libsystemd.
+type sdjournalReader struct {
+	cfg readerConfig
+	j   *sdjournal.Journal
+}
+
+var _ journalReader = (*sdjournalReader)(nil)
+
+// newSystemdReader opens the journal at cfg.Path, or the local system journal
+// if the path is empty.
+func newSystemdReader(cfg readerConfig) (journalReader, error) {
+	var (
+		j   *sdjournal.Journal
+		err error
+	)
+	if cfg.Path != "" {
+		j, err = sdjournal.NewJournalFromDir(cfg.Path)
+	} else {
+		j, err = sdjournal.NewJournal()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	r := &sdjournalReader{cfg: cfg, j: j}
+	if err := r.init(); err != nil {
+		_ = j.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *sdjournalReader) init() error {
+	for _, m := range r.cfg.Matches {
+		if err := r.j.AddMatch(m.String()); err != nil {
+			return fmt.Errorf("add journal match %s: %w", m, err)
+		}
+	}
+
+	// Prefer the cursor, as it uniquely identifies the last entry which was
+	// read, unless that entry is older than the max age. Seeking to the
+	// cursor and moving to its entry means the next call to Next returns the
+	// entry right after it.
+	if r.cfg.Cursor != "" {
+		if err := r.j.SeekCursor(r.cfg.Cursor); err == nil {
+			if n, err := r.j.Next(); err == nil && n > 0 {
+				if e, err := r.j.GetEntry(); err == nil && e.Cursor == r.cfg.Cursor && !r.toEntry(e).Time().Before(r.cfg.Since) {
+					return nil
+				}
+			}
+		}
+	}
+
+	var err error
+	if r.cfg.Since.IsZero() {
+		err = r.j.SeekHead()
+	} else {
+		err = r.j.SeekRealtimeUsec(uint64(r.cfg.Since.UnixMicro()))
+	}
+	if err != nil {
+		return fmt.Errorf("seek journal: %w", err)
+	}
+	return nil
+}
+
+// Next implements journalReader.
+func (r *sdjournalReader) Next(ctx context.Context) (*journalEntry, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, err := r.j.Next()
+		if err != nil {
+			return nil, fmt.Errorf("read journal: %w", err)
+		}
+		if n == 0 {
+			// We've reached the end of the journal; wait for new entries.
+			r.j.Wait(waitTimeout)
+			continue
+		}
+
+		e, err := r.j.GetEntry()
+		if err != nil {
+			return nil, err
+		}
+		return r.toEntry(e), nil
+	}
+}
+
+func (r *sdjournalReader) toEntry(e *sdjournal.JournalEntry) *journalEntry {
+	// The address fields of the entry, like __CURSOR, are only set in the
+	// dedicated fields of e and not in e.Fields.
+	return &journalEntry{
+		Cursor:            e.Cursor,
+		RealtimeTimestamp: e.RealtimeTimestamp,
+		Fields:            e.Fields,
+	}
+}
+
+// Close implements journalReader.
+func (r *sdjournalReader) Close() error {
+	return r.j.Close()
+}
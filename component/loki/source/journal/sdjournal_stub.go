@@ -0,0 +1,12 @@
+//go:build !(linux && cgo && promtail_journal_enabled)
+
+package journal
+
+import "errors"
+
+// newSystemdReader returns an error, as reading the systemd journal requires
+// building the agent for Linux with cgo and the promtail_journal_enabled build
+// tag.
+func newSystemdReader(cfg readerConfig) (journalReader, error) {
+	return nil, errors.New("reading the systemd journal is not supported by this build of the agent; only journal export files can be read")
+}
@@ -0,0 +1,214 @@
+package journal
+
+// This code is adapted from Promtail's journal target. Reading the journal
+// is abstracted behind the journalReader interface, so that journal export
+// files can be read as well.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// target reads entries from a journal and sends them to a handler, after
+// turning their fields into labels.
+type target struct {
+	logger      log.Logger
+	metrics     *metrics
+	handler     loki.LogsReceiver
+	positions   positions.Positions
+	positionKey string
+
+	relabelConfig []*relabel.Config
+	labels        model.LabelSet
+	formatAsJSON  bool
+
+	r      journalReader
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mut sync.Mutex
+	err error
+}
+
+// newTarget starts reading from r. The target takes ownership of r and closes
+// it once stopped.
+func newTarget(
+	logger log.Logger,
+	metrics *metrics,
+	handler loki.LogsReceiver,
+	pos positions.Positions,
+	positionKey string,
+	relabelConfig []*relabel.Config,
+	labels model.LabelSet,
+	formatAsJSON bool,
+	r journalReader,
+) *target {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &target{
+		logger:        logger,
+		metrics:       metrics,
+		handler:       handler,
+		positions:     pos,
+		positionKey:   positionKey,
+		relabelConfig: relabelConfig,
+		labels:        labels,
+		formatAsJSON:  formatAsJSON,
+
+		r:      r,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go t.run(ctx)
+	return t
+}
+
+func (t *target) run(ctx context.Context) {
+	defer close(t.done)
+	defer t.r.Close()
+
+	for {
+		e, err := t.r.Next(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, io.EOF):
+			level.Info(t.logger).Log("msg", "reached the end of the journal, no more entries will be read")
+			return
+		case err != nil:
+			level.Error(t.logger).Log("msg", "unable to read journal, no more entries will be read", "err", err)
+			t.mut.Lock()
+			t.err = err
+			t.mut.Unlock()
+			return
+		}
+
+		if !t.handleEntry(ctx, e) {
+			return
+		}
+	}
+}
+
+// handleEntry sends a journal entry to the handler and records its cursor. It
+// returns false if ctx was canceled before the entry could be sent.
+func (t *target) handleEntry(ctx context.Context, e *journalEntry) bool {
+	var line string
+	if t.formatAsJSON {
+		bb, err := json.Marshal(e.Fields)
+		if err != nil {
+			level.Error(t.logger).Log("msg", "could not marshal journal fields to JSON", "err", err, "unit", e.Fields["_SYSTEMD_UNIT"])
+			return true
+		}
+		line = string(bb)
+	} else {
+		var ok bool
+		line, ok = e.Fields["MESSAGE"]
+		if !ok {
+			level.Debug(t.logger).Log("msg", "received journal entry with no MESSAGE field", "unit", e.Fields["_SYSTEMD_UNIT"])
+			t.metrics.journalErrors.WithLabelValues(noMessageError).Inc()
+			t.positions.PutString(t.positionKey, "", e.Cursor)
+			return true
+		}
+	}
+
+	entryLabels := makeJournalFields(e.Fields)
+	for k, v := range t.labels {
+		entryLabels[string(k)] = string(v)
+	}
+
+	processed := relabel.Process(labels.FromMap(entryLabels), t.relabelConfig...)
+
+	lset := make(model.LabelSet, len(processed))
+	for _, l := range processed {
+		if strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+			continue
+		}
+		lset[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	if len(lset) == 0 {
+		// No labels, drop journal entry.
+		level.Debug(t.logger).Log("msg", "received journal entry with no labels", "unit", e.Fields["_SYSTEMD_UNIT"])
+		t.metrics.journalErrors.WithLabelValues(emptyLabelsError).Inc()
+		t.positions.PutString(t.positionKey, "", e.Cursor)
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case t.handler <- loki.Entry{
+		Labels: lset,
+		Entry: logproto.Entry{
+			Timestamp: e.Time(),
+			Line:      line,
+		},
+	}:
+	}
+
+	t.metrics.journalLines.Inc()
+	t.positions.PutString(t.positionKey, "", e.Cursor)
+	return true
+}
+
+// Err returns the error which made the target stop reading, if any.
+func (t *target) Err() error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.err
+}
+
+// Stop stops reading the journal and waits for the target to exit.
+func (t *target) Stop() {
+	t.cancel()
+	<-t.done
+}
+
+// makeJournalFields turns the fields of a journal entry into internal labels,
+// with a __journal_ prefix and lowercased names. The PRIORITY field is also
+// exposed as a keyword.
+func makeJournalFields(fields map[string]string) map[string]string {
+	result := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if k == "PRIORITY" {
+			result[fmt.Sprintf("__journal_%s_%s", strings.ToLower(k), "keyword")] = makeJournalPriority(v)
+		}
+		result[fmt.Sprintf("__journal_%s", strings.ToLower(k))] = v
+	}
+	return result
+}
+
+func makeJournalPriority(priority string) string {
+	switch priority {
+	case "0":
+		return "emerg"
+	case "1":
+		return "alert"
+	case "2":
+		return "crit"
+	case "3":
+		return "error"
+	case "4":
+		return "warning"
+	case "5":
+		return "notice"
+	case "6":
+		return "info"
+	case "7":
+		return "debug"
+	}
+	return priority
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/pkg/flow/rivertypes"
+	"github.com/grafana/agent/pkg/river"
+	prom_config "github.com/prometheus/common/config"
+	"github.com/xdg-go/scram"
+)
+
+// Supported authentication types.
+const (
+	authenticationTypeNone = "none"
+	authenticationTypeSSL  = "ssl"
+	authenticationTypeSASL = "sasl"
+)
+
+// Authentication configures how to authenticate with the Kafka brokers.
+type Authentication struct {
+	Type       string           `river:"type,attr,optional"`
+	TLSConfig  config.TLSConfig `river:"tls_config,block,optional"`
+	SASLConfig SASLConfig       `river:"sasl_config,block,optional"`
+}
+
+// DefaultAuthentication provides the default authentication settings.
+var DefaultAuthentication = Authentication{
+	Type:       authenticationTypeNone,
+	SASLConfig: DefaultSASLConfig,
+}
+
+var _ river.Unmarshaler = (*Authentication)(nil)
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (a *Authentication) UnmarshalRiver(f func(interface{}) error) error {
+	*a = DefaultAuthentication
+
+	type authentication Authentication
+	if err := f((*authentication)(a)); err != nil {
+		return err
+	}
+
+	switch a.Type {
+	case authenticationTypeNone, authenticationTypeSSL:
+	case authenticationTypeSASL:
+		switch a.SASLConfig.Mechanism {
+		case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		default:
+			return fmt.Errorf("invalid SASL mechanism %q, expected one of %q, %q or %q", a.SASLConfig.Mechanism,
+				sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512)
+		}
+	default:
+		return fmt.Errorf("invalid authentication type %q, expected one of %q, %q or %q", a.Type,
+			authenticationTypeNone, authenticationTypeSSL, authenticationTypeSASL)
+	}
+	return nil
+}
+
+// SASLConfig configures SASL authentication with the Kafka brokers.
+type SASLConfig struct {
+	Mechanism string            `river:"mechanism,attr,optional"`
+	User      string            `river:"user,attr,optional"`
+	Password  rivertypes.Secret `river:"password,attr,optional"`
+	UseTLS    bool              `river:"use_tls,attr,optional"`
+	TLSConfig config.TLSConfig  `river:"tls_config,block,optional"`
+}
+
+// DefaultSASLConfig provides the default SASL settings.
+var DefaultSASLConfig = SASLConfig{
+	Mechanism: sarama.SASLTypePlaintext,
+}
+
+var _ river.Unmarshaler = (*SASLConfig)(nil)
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (c *SASLConfig) UnmarshalRiver(f func(interface{}) error) error {
+	*c = DefaultSASLConfig
+
+	type saslConfig SASLConfig
+	return f((*saslConfig)(c))
+}
+
+// saramaConfig returns the configuration of the Kafka client for the given
+// arguments.
+func saramaConfig(args Arguments) (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(args.Version)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := balanceStrategy(args.Assignor)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := sarama.NewConfig()
+	cfg.Version = version
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{strategy}
+
+	auth := args.Authentication
+	switch auth.Type {
+	case authenticationTypeSSL:
+		tlsConfig, err := prom_config.NewTLSConfig(auth.TLSConfig.Convert())
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+
+	case authenticationTypeSASL:
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(auth.SASLConfig.Mechanism)
+		cfg.Net.SASL.User = auth.SASLConfig.User
+		cfg.Net.SASL.Password = string(auth.SASLConfig.Password)
+
+		switch cfg.Net.SASL.Mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{HashGeneratorFcn: sha256.New}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{HashGeneratorFcn: sha512.New}
+			}
+		}
+
+		if auth.SASLConfig.UseTLS {
+			tlsConfig, err := prom_config.NewTLSConfig(auth.SASLConfig.TLSConfig.Convert())
+			if err != nil {
+				return nil, err
+			}
+			cfg.Net.TLS.Enable = true
+			cfg.Net.TLS.Config = tlsConfig
+		}
+	}
+
+	return cfg, nil
+}
+
+// scramClient implements sarama.SCRAMClient.
+type scramClient struct {
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
@@ -0,0 +1,347 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+const (
+	topicLabel      = "__meta_kafka_topic"
+	partitionLabel  = "__meta_kafka_partition"
+	memberIDLabel   = "__meta_kafka_member_id"
+	groupIDLabel    = "__meta_kafka_group_id"
+	messageKeyLabel = "__meta_kafka_message_key"
+)
+
+var (
+	// topicPollInterval is how often the topics of the cluster are listed to
+	// find the ones matching the configured topics.
+	topicPollInterval = 30 * time.Second
+
+	// consumerBackoff is the backoff used when joining the consumer group
+	// fails.
+	consumerBackoff = backoff.Config{
+		MinBackoff: time.Second,
+		MaxBackoff: time.Minute,
+	}
+)
+
+// consumer consumes the partitions assigned to it within a consumer group,
+// following the topics which match the configured topics.
+type consumer struct {
+	logger  log.Logger
+	metrics *metrics
+	handler loki.LogsReceiver
+	args    Arguments
+	rcs     []*relabel.Config
+
+	client sarama.Client
+	group  sarama.ConsumerGroup
+	topics *topicMatcher
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mut     sync.RWMutex
+	current []string
+	claims  map[claimKey]claimInfo
+	lastErr error
+}
+
+type claimKey struct {
+	topic     string
+	partition int32
+}
+
+var _ sarama.ConsumerGroupHandler = (*consumer)(nil)
+
+// newConsumer creates and starts a consumer.
+func newConsumer(logger log.Logger, metrics *metrics, handler loki.LogsReceiver, args Arguments) (*consumer, error) {
+	cfg, err := saramaConfig(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka client: %w", err)
+	}
+	client, err := sarama.NewClient(args.Brokers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	group, err := sarama.NewConsumerGroupFromClient(args.GroupID, client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &consumer{
+		logger:  logger,
+		metrics: metrics,
+		handler: handler,
+		args:    args,
+		rcs:     flow_relabel.ComponentToPromRelabelConfigs(args.RelabelRules),
+
+		client: client,
+		group:  group,
+		topics: newTopicMatcher(client, args.Topics),
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		claims: make(map[claimKey]claimInfo),
+	}
+	go c.run(ctx)
+	return c, nil
+}
+
+// run periodically lists the matching topics, and restarts consuming when
+// they change.
+func (c *consumer) run(ctx context.Context) {
+	defer close(c.done)
+
+	var stopConsuming func()
+	defer func() {
+		if stopConsuming != nil {
+			stopConsuming()
+		}
+	}()
+
+	ticker := time.NewTicker(topicPollInterval)
+	defer ticker.Stop()
+
+	for {
+		topics, err := c.topics.Topics()
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "failed to list Kafka topics", "err", err)
+			c.setLastError(err)
+		} else if !equalTopics(topics, c.currentTopics()) {
+			level.Info(c.logger).Log("msg", "consuming new set of topics", "topics", strings.Join(topics, ","))
+			if stopConsuming != nil {
+				stopConsuming()
+				stopConsuming = nil
+			}
+			c.setCurrentTopics(topics)
+			if len(topics) > 0 {
+				stopConsuming = c.consume(ctx, topics)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// consume starts consuming the given topics in the background until the
+// returned function is called.
+func (c *consumer) consume(ctx context.Context, topics []string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		bo := backoff.New(ctx, consumerBackoff)
+		for bo.Ongoing() {
+			// Consume returns whenever the consumer group is rebalanced, and
+			// must then be called again to get the new claims.
+			err := c.group.Consume(ctx, topics, c)
+			if ctx.Err() != nil {
+				return
+			}
+			c.setLastError(err)
+			if err != nil {
+				level.Warn(c.logger).Log("msg", "failed to consume topics", "err", err, "num_retries", bo.NumRetries())
+				bo.Wait()
+				continue
+			}
+			bo.Reset()
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (c *consumer) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (c *consumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler. It forwards the
+// messages of a partition until the consumer group session ends.
+func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	key := claimKey{topic: claim.Topic(), partition: claim.Partition()}
+	c.mut.Lock()
+	c.claims[key] = claimInfo{
+		Topic:         claim.Topic(),
+		Partition:     claim.Partition(),
+		MemberID:      session.MemberID(),
+		InitialOffset: claim.InitialOffset(),
+	}
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.claims, key)
+		c.mut.Unlock()
+	}()
+
+	level.Debug(c.logger).Log("msg", "consuming partition", "topic", claim.Topic(), "partition", claim.Partition(), "initial_offset", claim.InitialOffset())
+
+	lb := labels.NewBuilder(nil)
+	for k, v := range c.args.Labels {
+		lb.Set(k, v)
+	}
+	lb.Set(topicLabel, claim.Topic())
+	lb.Set(partitionLabel, strconv.Itoa(int(claim.Partition())))
+	lb.Set(memberIDLabel, session.MemberID())
+	lb.Set(groupIDLabel, c.args.GroupID)
+
+	ctx := session.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !c.handleMessage(ctx, lb, msg) {
+				return nil
+			}
+			session.MarkMessage(msg, "")
+		}
+	}
+}
+
+// handleMessage forwards a message as a log entry. It returns false if the
+// message couldn't be forwarded before ctx was canceled.
+func (c *consumer) handleMessage(ctx context.Context, lb *labels.Builder, msg *sarama.ConsumerMessage) bool {
+	lb.Set(messageKeyLabel, string(msg.Key))
+	lset := processLabels(lb.Labels(nil), c.rcs)
+	if len(lset) == 0 {
+		c.metrics.kafkaDroppedEntries.Inc()
+		return true
+	}
+
+	ts := time.Now()
+	if c.args.UseIncomingTimestamp && !msg.Timestamp.IsZero() {
+		ts = msg.Timestamp
+	}
+	entry := loki.Entry{
+		Labels: lset,
+		Entry: logproto.Entry{
+			Timestamp: ts,
+			Line:      string(msg.Value),
+		},
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case c.handler <- entry:
+		c.metrics.kafkaEntries.Inc()
+		return true
+	}
+}
+
+// processLabels applies the relabeling rules to the labels of a message, and
+// drops the labels with a double underscore prefix.
+func processLabels(lbls labels.Labels, rcs []*relabel.Config) model.LabelSet {
+	if len(rcs) > 0 {
+		lbls = relabel.Process(lbls, rcs...)
+	}
+
+	lset := make(model.LabelSet, len(lbls))
+	for _, l := range lbls {
+		if strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+			continue
+		}
+		lset[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return lset
+}
+
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *consumer) currentTopics() []string {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.current
+}
+
+func (c *consumer) setCurrentTopics(topics []string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.current = topics
+}
+
+func (c *consumer) setLastError(err error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.lastErr = err
+}
+
+// DebugInfo returns the consumed topics and partitions.
+func (c *consumer) DebugInfo() debugInfo {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	res := debugInfo{Topics: c.current}
+	for _, info := range c.claims {
+		res.Claims = append(res.Claims, info)
+	}
+	sort.Slice(res.Claims, func(i, j int) bool {
+		if res.Claims[i].Topic != res.Claims[j].Topic {
+			return res.Claims[i].Topic < res.Claims[j].Topic
+		}
+		return res.Claims[i].Partition < res.Claims[j].Partition
+	})
+	if c.lastErr != nil {
+		res.LastError = c.lastErr.Error()
+	}
+	return res
+}
+
+// Stop stops consuming, leaves the consumer group and closes the connections
+// to the brokers.
+func (c *consumer) Stop() {
+	c.cancel()
+	<-c.done
+
+	if err := c.group.Close(); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to close consumer group", "err", err)
+	}
+	if err := c.client.Close(); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to close Kafka client", "err", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package kafka implements the loki.source.kafka component, which consumes
+// log lines from Kafka topics as part of a consumer group.
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/pkg/river"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.kafka",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the loki.source.kafka
+// component.
+type Arguments struct {
+	Brokers              []string            `river:"brokers,attr"`
+	Topics               []string            `river:"topics,attr"`
+	GroupID              string              `river:"group_id,attr,optional"`
+	Assignor             string              `river:"assignor,attr,optional"`
+	Version              string              `river:"version,attr,optional"`
+	Authentication       Authentication      `river:"authentication,block,optional"`
+	UseIncomingTimestamp bool                `river:"use_incoming_timestamp,attr,optional"`
+	Labels               map[string]string   `river:"labels,attr,optional"`
+	ForwardTo            []loki.LogsReceiver `river:"forward_to,attr"`
+	RelabelRules         flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+}
+
+// DefaultArguments provides the default arguments for the loki.source.kafka
+// component.
+var DefaultArguments = Arguments{
+	GroupID:  "loki.source.kafka",
+	Assignor: sarama.RangeBalanceStrategyName,
+	Version:  "2.2.1",
+
+	Authentication: DefaultAuthentication,
+}
+
+var _ river.Unmarshaler = (*Arguments)(nil)
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (args *Arguments) UnmarshalRiver(f func(interface{}) error) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := f((*arguments)(args)); err != nil {
+		return err
+	}
+
+	if len(args.Brokers) == 0 {
+		return fmt.Errorf("brokers must not be empty")
+	}
+	if len(args.Topics) == 0 {
+		return fmt.Errorf("topics must not be empty")
+	}
+	for _, topic := range args.Topics {
+		if topic == "" {
+			return fmt.Errorf("topics must not contain an empty topic")
+		}
+		if strings.HasPrefix(topic, "^") {
+			if _, err := regexp.Compile(topic); err != nil {
+				return fmt.Errorf("invalid topic pattern %q: %w", topic, err)
+			}
+		}
+	}
+	if args.GroupID == "" {
+		return fmt.Errorf("group_id must not be empty")
+	}
+	if _, err := balanceStrategy(args.Assignor); err != nil {
+		return err
+	}
+	version, err := sarama.ParseKafkaVersion(args.Version)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %w", args.Version, err)
+	}
+	if !version.IsAtLeast(sarama.V0_10_2_0) {
+		return fmt.Errorf("version must be at least %s to use consumer groups", sarama.V0_10_2_0)
+	}
+	return nil
+}
+
+// balanceStrategy returns the consumer group partition assignment strategy
+// with the given name.
+func balanceStrategy(assignor string) (sarama.BalanceStrategy, error) {
+	switch assignor {
+	case sarama.RangeBalanceStrategyName:
+		return sarama.BalanceStrategyRange, nil
+	case sarama.RoundRobinBalanceStrategyName:
+		return sarama.BalanceStrategyRoundRobin, nil
+	case sarama.StickyBalanceStrategyName:
+		return sarama.BalanceStrategySticky, nil
+	default:
+		return nil, fmt.Errorf("invalid assignor %q, expected one of %q, %q or %q", assignor,
+			sarama.RangeBalanceStrategyName, sarama.RoundRobinBalanceStrategyName, sarama.StickyBalanceStrategyName)
+	}
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// Component implements the loki.source.kafka component.
+type Component struct {
+	opts    component.Options
+	metrics *metrics
+
+	mut       sync.RWMutex
+	args      Arguments
+	handler   loki.LogsReceiver
+	receivers []loki.LogsReceiver
+	consumer  *consumer
+}
+
+// New creates a new loki.source.kafka component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:    o,
+		metrics: newMetrics(o.Registerer),
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+	}
+
+	// Call to Update() to start the consumer and set receivers once at the
+	// start.
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.kafka component shutting down, stopping consumer")
+		c.mut.Lock()
+		if c.consumer != nil {
+			c.consumer.Stop()
+			c.consumer = nil
+		}
+		c.mut.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.receivers = newArgs.ForwardTo
+
+	// Restarting the consumer makes the consumer group rebalance, so it's only
+	// done when its configuration changes.
+	if c.consumer != nil && consumerArgsEqual(c.args, newArgs) {
+		c.args = newArgs
+		return nil
+	}
+	c.args = newArgs
+
+	// The previous consumer leaves the group before the new one joins it, so
+	// that its partitions can be assigned to the new one right away.
+	if c.consumer != nil {
+		c.consumer.Stop()
+		c.consumer = nil
+	}
+	cons, err := newConsumer(c.opts.Logger, c.metrics, c.handler, newArgs)
+	if err != nil {
+		return err
+	}
+	c.consumer = cons
+	return nil
+}
+
+// consumerArgsEqual returns whether two sets of arguments configure the
+// consumer the same way.
+func consumerArgsEqual(a, b Arguments) bool {
+	a.ForwardTo, b.ForwardTo = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// DebugInfo returns information about the topics and partitions which are
+// consumed.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	if c.consumer == nil {
+		return debugInfo{}
+	}
+	return c.consumer.DebugInfo()
+}
+
+type debugInfo struct {
+	Topics    []string    `river:"topics,attr"`
+	Claims    []claimInfo `river:"claims,attr"`
+	LastError string      `river:"last_error,attr"`
+}
+
+type claimInfo struct {
+	Topic         string `river:"topic,attr"`
+	Partition     int32  `river:"partition,attr"`
+	MemberID      string `river:"member_id,attr"`
+	InitialOffset int64  `river:"initial_offset,attr"`
+}
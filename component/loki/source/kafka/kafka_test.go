@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name: "defaults",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["logs", "^app-.*"]
+				forward_to = []
+			`,
+		},
+		{
+			name: "sasl",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["logs"]
+				forward_to = []
+
+				authentication {
+					type = "sasl"
+					sasl_config {
+						mechanism = "SCRAM-SHA-512"
+						user      = "agent"
+						password  = "secret"
+					}
+				}
+			`,
+		},
+		{
+			name: "invalid topic pattern",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["^app-(.*"]
+				forward_to = []
+			`,
+			err: "invalid topic pattern \"^app-(.*\": error parsing regexp: missing closing ): `^app-(.*`",
+		},
+		{
+			name: "invalid assignor",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["logs"]
+				assignor   = "random"
+				forward_to = []
+			`,
+			err: `invalid assignor "random", expected one of "range", "roundrobin" or "sticky"`,
+		},
+		{
+			name: "version too old",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["logs"]
+				version    = "0.10.1.0"
+				forward_to = []
+			`,
+			err: "version must be at least 0.10.2.0 to use consumer groups",
+		},
+		{
+			name: "invalid SASL mechanism",
+			config: `
+				brokers    = ["localhost:9092"]
+				topics     = ["logs"]
+				forward_to = []
+
+				authentication {
+					type = "sasl"
+					sasl_config {
+						mechanism = "GSSAPI"
+					}
+				}
+			`,
+			err: `invalid SASL mechanism "GSSAPI", expected one of "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var args Arguments
+			err := river.Unmarshal([]byte(tc.config), &args)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			_, err = saramaConfig(args)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestKafka(t *testing.T) {
+	broker := newMockBroker(t)
+
+	ch := make(loki.LogsReceiver)
+	args := testArguments(broker, ch)
+	c := runTestComponent(t, args)
+
+	sourcetest.ExpectEntries(t, ch,
+		sourcetest.Entry{Line: "first", Labels: model.LabelSet{"job": "kafka", "topic": "logs-a", "partition": "0", "key": "k1"}},
+		sourcetest.Entry{Line: "second", Labels: model.LabelSet{"job": "kafka", "topic": "logs-a", "partition": "0"}},
+	)
+
+	info := c.DebugInfo().(debugInfo)
+	require.Equal(t, []string{"logs-a"}, info.Topics)
+	require.Empty(t, info.LastError)
+
+	// Updates which only change the receivers keep the consumer running.
+	cons := c.consumer
+	args.ForwardTo = []loki.LogsReceiver{make(loki.LogsReceiver)}
+	require.NoError(t, c.Update(args))
+	require.Same(t, cons, c.consumer)
+
+	// Other changes restart it.
+	args.Labels = map[string]string{"job": "other"}
+	require.NoError(t, c.Update(args))
+	require.NotSame(t, cons, c.consumer)
+}
+
+func TestTopicMatcher(t *testing.T) {
+	client := &fakeTopicClient{topics: []string{"logs-b", "other", "logs-a", "app", "application"}}
+	m := newTopicMatcher(client, []string{"^logs-.*", "app"})
+
+	topics, err := m.Topics()
+	require.NoError(t, err)
+	require.Equal(t, []string{"app", "logs-a", "logs-b"}, topics)
+}
+
+type fakeTopicClient struct {
+	topics []string
+}
+
+func (c *fakeTopicClient) RefreshMetadata(...string) error { return nil }
+func (c *fakeTopicClient) Topics() ([]string, error)       { return c.topics, nil }
+
+func testArguments(broker *sarama.MockBroker, ch loki.LogsReceiver) Arguments {
+	args := DefaultArguments
+	args.Brokers = []string{broker.Addr()}
+	args.Topics = []string{"^logs-.*"}
+	args.GroupID = "test-group"
+	args.Labels = map[string]string{"job": "kafka"}
+	args.ForwardTo = []loki.LogsReceiver{ch}
+	args.RelabelRules = sourcetest.RelabelRules(
+		topicLabel, "topic",
+		partitionLabel, "partition",
+		messageKeyLabel, "key",
+	)
+	return args
+}
+
+// newMockBroker creates a Kafka broker which is the coordinator of the
+// consumer group, and serves the logs-a and ignored topics. The consumer is
+// always assigned the first partition of logs-a.
+func newMockBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 0)
+	t.Cleanup(broker.Close)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs-a", 0, broker.BrokerID()).
+			SetLeader("ignored", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("logs-a", 0, sarama.OffsetOldest, 0).
+			SetOffset("logs-a", 0, sarama.OffsetNewest, 2),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "test-group", broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).
+			SetMemberAssignment(&sarama.ConsumerGroupMemberAssignment{
+				Topics: map[string][]int32{"logs-a": {0}},
+			}),
+		"HeartbeatRequest": sarama.NewMockHeartbeatResponse(t),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("test-group", "logs-a", 0, 0, "", sarama.ErrNoError).
+			SetError(sarama.ErrNoError),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 2).
+			SetMessageWithKey("logs-a", 0, 0, sarama.StringEncoder("k1"), sarama.StringEncoder("first")).
+			SetMessage("logs-a", 0, 1, sarama.StringEncoder("second")).
+			SetHighWaterMark("logs-a", 0, 2),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+	})
+	return broker
+}
+
+// runTestComponent runs a component until the test ends.
+func runTestComponent(t *testing.T, args Arguments) *Component {
+	t.Helper()
+
+	c, err := New(component.Options{
+		ID:         "loki.source.kafka.test",
+		Logger:     util.TestLogger(t),
+		Registerer: prometheus.NewRegistry(),
+	}, args)
+	require.NoError(t, err)
+
+	sourcetest.Run(t, c)
+	return c
+}
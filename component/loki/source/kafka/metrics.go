@@ -0,0 +1,33 @@
+package kafka
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the metrics of the loki.source.kafka component.
+type metrics struct {
+	kafkaEntries        prometheus.Counter
+	kafkaDroppedEntries prometheus.Counter
+}
+
+// newMetrics creates a new set of Kafka metrics. If reg is non-nil, the
+// metrics will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.kafkaEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_kafka_entries_total",
+		Help: "Total number of successful entries sent by the Kafka component.",
+	})
+	m.kafkaDroppedEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_kafka_dropped_entries_total",
+		Help: "Total number of messages dropped because they had no labels left after relabeling.",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.kafkaEntries,
+			m.kafkaDroppedEntries,
+		)
+	}
+
+	return &m
+}
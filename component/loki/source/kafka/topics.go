@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// topicClient lists the topics of a Kafka cluster.
+type topicClient interface {
+	RefreshMetadata(topics ...string) error
+	Topics() ([]string, error)
+}
+
+// topicMatcher finds the topics of a Kafka cluster matching a list of topic
+// names and patterns. Topics starting with a '^' are regular expressions
+// which can match several topics.
+type topicMatcher struct {
+	client   topicClient
+	names    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// newTopicMatcher creates a topicMatcher. The topic patterns must have been
+// validated beforehand.
+func newTopicMatcher(client topicClient, topics []string) *topicMatcher {
+	m := &topicMatcher{
+		client: client,
+		names:  make(map[string]struct{}),
+	}
+	for _, topic := range topics {
+		if strings.HasPrefix(topic, "^") {
+			m.patterns = append(m.patterns, regexp.MustCompile(topic))
+		} else {
+			m.names[topic] = struct{}{}
+		}
+	}
+	return m
+}
+
+// Topics returns the sorted list of existing topics which match.
+func (m *topicMatcher) Topics() ([]string, error) {
+	if err := m.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	topics, err := m.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, topic := range topics {
+		if m.matches(topic) {
+			res = append(res, topic)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *topicMatcher) matches(topic string) bool {
+	if _, ok := m.names[topic]; ok {
+		return true
+	}
+	for _, p := range m.patterns {
+		if p.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/grafana/agent/component/common/config"
+	promconfig "github.com/prometheus/common/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClientArguments controls how loki.source.kubernetes connects to the
+// Kubernetes API server.
+type ClientArguments struct {
+	APIServer        config.URL              `river:"api_server,attr,optional"`
+	KubeConfig       string                  `river:"kubeconfig_file,attr,optional"`
+	HTTPClientConfig config.HTTPClientConfig `river:"http_client_config,block,optional"`
+}
+
+// DefaultClientArguments holds default settings for the client block.
+var DefaultClientArguments = ClientArguments{
+	HTTPClientConfig: config.DefaultHTTPClientConfig,
+}
+
+// UnmarshalRiver implements river.Unmarshaler and applies default settings.
+func (args *ClientArguments) UnmarshalRiver(f func(interface{}) error) error {
+	*args = DefaultClientArguments
+
+	type arguments ClientArguments
+	if err := f((*arguments)(args)); err != nil {
+		return err
+	}
+
+	if args.APIServer.URL != nil && args.KubeConfig != "" {
+		return fmt.Errorf("only one of api_server and kubeconfig_file can be set")
+	}
+	return nil
+}
+
+// clientFunc builds a Kubernetes client from ClientArguments.
+type clientFunc func(args ClientArguments) (kubernetes.Interface, error)
+
+// newClient builds a Kubernetes client the same way discovery.kubernetes
+// does: from a kubeconfig file if one is given, from the in-cluster service
+// account if no API server is given, or with the HTTP client settings
+// otherwise.
+func newClient(args ClientArguments) (kubernetes.Interface, error) {
+	var (
+		restConfig *rest.Config
+		err        error
+	)
+	switch {
+	case args.KubeConfig != "":
+		restConfig, err = clientcmd.BuildConfigFromFlags("", args.KubeConfig)
+		if err != nil {
+			return nil, err
+		}
+	case args.APIServer.URL == nil:
+		restConfig, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		rt, err := promconfig.NewRoundTripperFromConfig(*args.HTTPClientConfig.Convert(), "loki.source.kubernetes")
+		if err != nil {
+			return nil, err
+		}
+		restConfig = &rest.Config{
+			Host:      args.APIServer.String(),
+			Transport: rt,
+		}
+	}
+
+	restConfig.UserAgent = "GrafanaAgent/loki.source.kubernetes"
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// streamFunc opens a stream of the logs of a container.
+type streamFunc func(ctx context.Context, client kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error)
+
+// streamLogs streams the logs of a container through the log endpoint of the
+// API server.
+func streamLogs(ctx context.Context, client kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return client.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+}
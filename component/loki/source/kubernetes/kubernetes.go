@@ -0,0 +1,294 @@
+// Package kubernetes implements the loki.source.kubernetes component, which
+// streams the logs of containers through the Kubernetes API.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/common/model"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.kubernetes",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Labels of discovery.kubernetes pod targets which identify the container
+// to read logs from.
+const (
+	namespaceLabel     = "__meta_kubernetes_namespace"
+	podNameLabel       = "__meta_kubernetes_pod_name"
+	containerNameLabel = "__meta_kubernetes_pod_container_name"
+)
+
+// tailerBackoff is the backoff used by tailers between two log streams.
+var tailerBackoff = backoff.Config{
+	MinBackoff: time.Second,
+	MaxBackoff: time.Minute,
+}
+
+// Arguments holds values which are used to configure the
+// loki.source.kubernetes component.
+type Arguments struct {
+	Targets   []discovery.Target  `river:"targets,attr"`
+	ForwardTo []loki.LogsReceiver `river:"forward_to,attr"`
+	Client    ClientArguments     `river:"client,block,optional"`
+}
+
+// DefaultArguments provides the default arguments for the
+// loki.source.kubernetes component.
+var DefaultArguments = Arguments{
+	Client: DefaultClientArguments,
+}
+
+// UnmarshalRiver implements river.Unmarshaler and applies default settings.
+func (args *Arguments) UnmarshalRiver(f func(interface{}) error) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	return f((*arguments)(args))
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// Component implements the loki.source.kubernetes component.
+type Component struct {
+	opts       component.Options
+	metrics    *metrics
+	newClient  clientFunc
+	streamLogs streamFunc
+
+	mut       sync.RWMutex
+	args      Arguments
+	client    kubernetes.Interface
+	handler   loki.LogsReceiver
+	receivers []loki.LogsReceiver
+	posFile   positions.Positions
+	tailers   map[tailerKey]*tailer
+}
+
+// tailerKey identifies a tailer. The same container can be given with
+// different labels, in which case its logs are read once for each set of
+// labels.
+type tailerKey struct {
+	ref    containerRef
+	labels string
+}
+
+// New creates a new loki.source.kubernetes component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	return newComponent(o, args, newClient, streamLogs)
+}
+
+func newComponent(o component.Options, args Arguments, newClient clientFunc, streamLogs streamFunc) (*Component, error) {
+	err := os.MkdirAll(o.DataPath, 0750)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	positionsFile, err := positions.New(o.Logger, positions.Config{
+		SyncPeriod:        10 * time.Second,
+		PositionsFile:     filepath.Join(o.DataPath, "positions.yml"),
+		IgnoreInvalidYaml: false,
+		ReadOnly:          false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:       o,
+		metrics:    newMetrics(o.Registerer),
+		newClient:  newClient,
+		streamLogs: streamLogs,
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+		posFile:   positionsFile,
+		tailers:   make(map[tailerKey]*tailer),
+	}
+
+	// Call to Update() to start tailers and set receivers once at the start.
+	if err := c.Update(args); err != nil {
+		positionsFile.Stop()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.kubernetes component shutting down, stopping tailers")
+		c.mut.Lock()
+		c.stopTailers()
+		c.mut.Unlock()
+		c.posFile.Stop()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.receivers = newArgs.ForwardTo
+
+	// All tailers are restarted when the client changes, so that they stream
+	// through the new one.
+	if c.client == nil || !reflect.DeepEqual(newArgs.Client, c.args.Client) {
+		client, err := c.newClient(newArgs.Client)
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		c.stopTailers()
+		c.client = client
+	}
+	c.args = newArgs
+
+	targets := make(map[tailerKey]model.LabelSet, len(newArgs.Targets))
+	for _, target := range newArgs.Targets {
+		ref := containerRef{
+			Namespace: target[namespaceLabel],
+			Pod:       target[podNameLabel],
+			Container: target[containerNameLabel],
+		}
+		if ref.Namespace == "" || ref.Pod == "" || ref.Container == "" {
+			level.Warn(c.opts.Logger).Log("msg", "ignoring target which isn't a container of a pod", "target", fmt.Sprint(target))
+			continue
+		}
+
+		labels := make(model.LabelSet)
+		for k, v := range target {
+			if strings.HasPrefix(k, model.ReservedLabelPrefix) {
+				continue
+			}
+			labels[model.LabelName(k)] = model.LabelValue(v)
+		}
+		targets[tailerKey{ref: ref, labels: labels.String()}] = labels
+	}
+
+	// Tailers of containers which are still targeted keep running, so that
+	// their streams aren't interrupted. The positions of the others are
+	// removed, as their pods are most likely gone.
+	for key, t := range c.tailers {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		t.Stop()
+		delete(c.tailers, key)
+		c.posFile.Remove(t.posKey, key.labels)
+	}
+
+	opts := tailerOptions{
+		logger:     c.opts.Logger,
+		metrics:    c.metrics,
+		client:     c.client,
+		streamLogs: c.streamLogs,
+		positions:  c.posFile,
+		handler:    c.handler,
+		backoff:    tailerBackoff,
+	}
+	for key, labels := range targets {
+		if _, ok := c.tailers[key]; ok {
+			continue
+		}
+		level.Debug(c.opts.Logger).Log("msg", "tailing new container", "container", key.ref.String())
+		c.tailers[key] = newTailer(opts, key.ref, labels)
+	}
+
+	if len(c.tailers) == 0 {
+		level.Debug(c.opts.Logger).Log("msg", "no container targets were passed, nothing will be tailed")
+	}
+	return nil
+}
+
+// stopTailers stops all the tailers. c.mut must be held.
+func (c *Component) stopTailers() {
+	for key, t := range c.tailers {
+		t.Stop()
+		delete(c.tailers, key)
+	}
+}
+
+// DebugInfo returns information about the status of tailed containers.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res debugInfo
+	for key, t := range c.tailers {
+		info := targetInfo{
+			Container: key.ref.String(),
+			Labels:    key.labels,
+			LastEntry: c.posFile.GetString(t.posKey, key.labels),
+		}
+		if err := t.LastError(); err != nil {
+			info.LastError = err.Error()
+		}
+		res.TargetsInfo = append(res.TargetsInfo, info)
+	}
+	sort.Slice(res.TargetsInfo, func(i, j int) bool {
+		a, b := res.TargetsInfo[i], res.TargetsInfo[j]
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		return a.Labels < b.Labels
+	})
+	return res
+}
+
+type debugInfo struct {
+	TargetsInfo []targetInfo `river:"targets_info,attr"`
+}
+
+type targetInfo struct {
+	Container string `river:"container,attr"`
+	Labels    string `river:"labels,attr"`
+	LastEntry string `river:"last_entry,attr"`
+	LastError string `river:"last_error,attr"`
+}
@@ -0,0 +1,142 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+	`), &args))
+	require.Equal(t, DefaultClientArguments, args.Client)
+
+	require.NoError(t, river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+
+		client {
+			api_server = "https://kubernetes.default.svc"
+		}
+	`), &args))
+	require.Equal(t, "https://kubernetes.default.svc", args.Client.APIServer.String())
+	require.True(t, args.Client.HTTPClientConfig.FollowRedirects)
+
+	require.EqualError(t, river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = []
+
+		client {
+			api_server      = "https://kubernetes.default.svc"
+			kubeconfig_file = "/etc/kubeconfig"
+		}
+	`), &args), "only one of api_server and kubeconfig_file can be set")
+}
+
+func TestComponent(t *testing.T) {
+	defer func(bo backoff.Config) { tailerBackoff = bo }(tailerBackoff)
+	tailerBackoff = backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	logs := newFakeLogs()
+	logs.set([]string{"2023-01-01T10:00:00.1Z hello"}, nil)
+
+	var clients int
+	newTestClient := func(ClientArguments) (kubernetes.Interface, error) {
+		clients++
+		return fake.NewSimpleClientset(testPod(runningStatus(nil))), nil
+	}
+
+	target := discovery.Target{
+		namespaceLabel:     testRef.Namespace,
+		podNameLabel:       testRef.Pod,
+		containerNameLabel: testRef.Container,
+		"job":              "app",
+	}
+	// The same container can be discovered once per port.
+	otherPort := discovery.Target{"__meta_kubernetes_pod_container_port_name": "metrics"}
+	for k, v := range target {
+		otherPort[k] = v
+	}
+
+	ch := make(loki.LogsReceiver)
+	args := Arguments{
+		Targets: []discovery.Target{
+			target,
+			otherPort,
+			{"job": "not-a-container"},
+		},
+		ForwardTo: []loki.LogsReceiver{ch},
+		Client:    DefaultClientArguments,
+	}
+
+	c, err := newComponent(component.Options{
+		ID:         "loki.source.kubernetes.test",
+		Logger:     util.TestLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		DataPath:   t.TempDir(),
+	}, args, newTestClient, logs.stream)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	expectLines(t, ch, "hello")
+	require.Len(t, c.tailers, 1)
+
+	require.Eventually(t, func() bool {
+		info := c.DebugInfo().(debugInfo)
+		return len(info.TargetsInfo) == 1 && info.TargetsInfo[0].LastEntry == "2023-01-01T10:00:00.1Z"
+	}, 5*time.Second, 10*time.Millisecond)
+	info := c.DebugInfo().(debugInfo).TargetsInfo[0]
+	require.Equal(t, "default/app-0:app", info.Container)
+	require.Equal(t, `{job="app"}`, info.Labels)
+
+	// Updating with the same targets and client keeps the tailers running.
+	var tt *tailer
+	for _, running := range c.tailers {
+		tt = running
+	}
+	require.NoError(t, c.Update(args))
+	require.Len(t, c.tailers, 1)
+	for _, running := range c.tailers {
+		require.Same(t, tt, running)
+	}
+	require.Equal(t, 1, clients)
+
+	// A new client restarts the tailers, which resume from their positions.
+	args.Client.KubeConfig = "/etc/kubeconfig"
+	require.NoError(t, c.Update(args))
+	require.Equal(t, 2, clients)
+	for _, running := range c.tailers {
+		require.NotSame(t, tt, running)
+	}
+	expectLines(t, ch)
+
+	// Removed targets are stopped and their positions are removed.
+	args.Targets = nil
+	require.NoError(t, c.Update(args))
+	require.Empty(t, c.tailers)
+	require.Empty(t, c.posFile.GetString(tt.posKey, tt.labelsStr))
+}
@@ -0,0 +1,39 @@
+package kubernetes
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the metrics of the loki.source.kubernetes component.
+type metrics struct {
+	entriesTotal      prometheus.Counter
+	streamErrorsTotal prometheus.Counter
+	parsingErrors     prometheus.Counter
+}
+
+// newMetrics creates a new set of Kubernetes metrics. If reg is non-nil, the
+// metrics will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.entriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_kubernetes_entries_total",
+		Help: "Total number of log entries read from containers.",
+	})
+	m.streamErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_kubernetes_stream_errors_total",
+		Help: "Total number of errors while streaming logs from the Kubernetes API.",
+	})
+	m.parsingErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_kubernetes_parsing_errors_total",
+		Help: "Total number of log lines whose timestamp couldn't be parsed.",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.entriesTotal,
+			m.streamErrorsTotal,
+			m.parsingErrors,
+		)
+	}
+
+	return &m
+}
@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/agent/component/loki/source/internal/logstream"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errContainerNotRunning is returned while a container is waiting to be
+// started, for example when it's in a crash loop.
+var errContainerNotRunning = errors.New("container isn't running")
+
+// containerRef identifies a container of a pod.
+type containerRef struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+func (r containerRef) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Namespace, r.Pod, r.Container)
+}
+
+// tailerOptions are the dependencies of a tailer which are shared between all
+// the tailers of a component.
+type tailerOptions struct {
+	logger     log.Logger
+	metrics    *metrics
+	client     kubernetes.Interface
+	streamLogs streamFunc
+	positions  positions.Positions
+	handler    loki.LogsReceiver
+	backoff    backoff.Config
+}
+
+// tailer streams the logs of a single container, reconnecting when the
+// stream ends, for example because the container was restarted.
+type tailer struct {
+	*logstream.Tailer
+
+	opts      tailerOptions
+	logger    log.Logger
+	ref       containerRef
+	labels    model.LabelSet
+	labelsStr string
+	posKey    string
+}
+
+// newTailer creates and starts a tailer for the container ref. Log entries
+// are sent with the given labels.
+func newTailer(opts tailerOptions, ref containerRef, labels model.LabelSet) *tailer {
+	t := &tailer{
+		opts:      opts,
+		logger:    log.With(opts.logger, "container", ref.String()),
+		ref:       ref,
+		labels:    labels,
+		labelsStr: labels.String(),
+		posKey:    positions.CursorKey(ref.String()),
+	}
+	t.Tailer = logstream.New(logstream.Options{
+		Logger:         t.logger,
+		Handler:        opts.handler,
+		Backoff:        opts.backoff,
+		Positions:      opts.positions,
+		PositionKey:    t.posKey,
+		PositionLabels: t.labelsStr,
+		Entries:        opts.metrics.entriesTotal,
+		ParseErrors:    opts.metrics.parsingErrors,
+		OnError:        t.handleError,
+	}, t.tail)
+	return t
+}
+
+// handleError logs the error which ended a log stream.
+func (t *tailer) handleError(err error, numRetries int) {
+	if errors.Is(err, errContainerNotRunning) {
+		level.Debug(t.logger).Log("msg", "container isn't running, retrying later")
+		return
+	}
+	t.opts.metrics.streamErrorsTotal.Inc()
+	level.Warn(t.logger).Log("msg", "failed to stream container logs", "err", err, "num_retries", numRetries)
+}
+
+// tail reads the logs of the container until the log stream ends.
+func (t *tailer) tail(ctx context.Context, s *logstream.Stream) error {
+	pod, err := t.opts.client.CoreV1().Pods(t.ref.Namespace).Get(ctx, t.ref.Pod, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod: %w", err)
+	}
+	status, ok := findContainerStatus(pod, t.ref.Container)
+	if !ok {
+		return fmt.Errorf("container not found in the status of the pod")
+	}
+
+	// If the container was restarted after the last entry we read, the logs
+	// of the previous instance are read first, as they're only available until
+	// the container restarts again. Termination times are truncated to the
+	// second, so the comparison is done at that granularity.
+	since := s.Since()
+	if term := status.LastTerminationState.Terminated; term != nil && !since.IsZero() && !term.FinishedAt.Time.Before(since.Truncate(time.Second)) {
+		if err := t.readStream(ctx, s, t.logOptions(since, true, false)); err != nil {
+			return fmt.Errorf("failed to read logs of previous container: %w", err)
+		}
+	}
+
+	if status.State.Running == nil && status.State.Terminated == nil {
+		return errContainerNotRunning
+	}
+
+	return t.readStream(ctx, s, t.logOptions(s.Since(), false, status.State.Running != nil))
+}
+
+// logOptions returns the options to read the logs of the container since the
+// given time. A zero since reads all the available logs.
+func (t *tailer) logOptions(since time.Time, previous, follow bool) *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{
+		Container:  t.ref.Container,
+		Follow:     follow,
+		Previous:   previous,
+		Timestamps: true,
+	}
+	if !since.IsZero() {
+		sinceTime := metav1.NewTime(since)
+		opts.SinceTime = &sinceTime
+	}
+	return opts
+}
+
+// readStream forwards the entries of a log stream until it ends. Lines which
+// were already read are skipped by s, as the API server only filters them by
+// the second.
+func (t *tailer) readStream(ctx context.Context, s *logstream.Stream, opts *corev1.PodLogOptions) error {
+	stream, err := t.opts.streamLogs(ctx, t.opts.client, t.ref.Namespace, t.ref.Pod, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	r := bufio.NewReader(stream)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			if err := s.Handle(ctx, t.labels, strings.TrimSuffix(line, "\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// findContainerStatus returns the status of a container or an init container
+// of the pod.
+func findContainerStatus(pod *corev1.Pod, container string) (corev1.ContainerStatus, bool) {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+		for _, status := range statuses {
+			if status.Name == container {
+				return status, true
+			}
+		}
+	}
+	return corev1.ContainerStatus{}, false
+}
@@ -0,0 +1,237 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testRef = containerRef{Namespace: "default", Pod: "app-0", Container: "app"}
+
+func TestTailer_Restart(t *testing.T) {
+	client := fake.NewSimpleClientset(testPod(runningStatus(nil)))
+	logs := newFakeLogs()
+	logs.set([]string{"2023-01-01T10:00:00.1Z first", "2023-01-01T10:00:00.2Z second"}, nil)
+
+	ch, tt := runTestTailer(t, client, logs, nil)
+	expectLines(t, ch, "first", "second")
+
+	// The container restarts: the previous instance wrote another line before
+	// exiting, which wasn't read, and the new instance writes a new one.
+	finished := time.Date(2023, 1, 1, 10, 0, 1, 0, time.UTC)
+	_, err := client.CoreV1().Pods(testRef.Namespace).UpdateStatus(context.Background(), testPod(runningStatus(&finished)), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	logs.set(
+		[]string{"2023-01-01T10:00:02Z fourth"},
+		[]string{"2023-01-01T10:00:00.1Z first", "2023-01-01T10:00:00.2Z second", "2023-01-01T10:00:00.3Z third"},
+	)
+
+	expectLines(t, ch, "third", "fourth")
+
+	require.Eventually(t, func() bool {
+		return tt.opts.positions.GetString(tt.posKey, tt.labelsStr) == "2023-01-01T10:00:02Z"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The previous logs are only requested from the last stored position.
+	var previous []corev1.PodLogOptions
+	for _, opts := range logs.getRequests() {
+		if opts.Previous {
+			previous = append(previous, opts)
+		}
+	}
+	require.NotEmpty(t, previous)
+	require.Equal(t, "2023-01-01T10:00:00.2Z", previous[0].SinceTime.Time.Format(time.RFC3339Nano))
+	require.False(t, previous[0].Follow)
+}
+
+func TestTailer_ResumeFromPosition(t *testing.T) {
+	client := fake.NewSimpleClientset(testPod(runningStatus(nil)))
+	logs := newFakeLogs()
+	logs.set([]string{
+		"2023-01-01T10:00:00.1Z first",
+		"2023-01-01T10:00:00.2Z second",
+		"not a timestamped line",
+		"2023-01-01T10:00:00.3Z third",
+	}, nil)
+
+	pos := newTestPositions(t)
+	pos.PutString(positions.CursorKey(testRef.String()), model.LabelSet{"job": "app"}.String(), "2023-01-01T10:00:00.1Z")
+
+	ch, tt := runTestTailer(t, client, logs, pos)
+	expectLines(t, ch, "second", "third")
+
+	opts := logs.getRequests()[0]
+	require.True(t, opts.Follow)
+	require.True(t, opts.Timestamps)
+	require.Equal(t, testRef.Container, opts.Container)
+	require.Equal(t, "2023-01-01T10:00:00.1Z", opts.SinceTime.Time.Format(time.RFC3339Nano))
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(tt.opts.metrics.parsingErrors) >= 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTailer_ContainerWaiting(t *testing.T) {
+	client := fake.NewSimpleClientset(testPod(corev1.ContainerStatus{
+		Name:  testRef.Container,
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}))
+	logs := newFakeLogs()
+
+	_, tt := runTestTailer(t, client, logs, nil)
+
+	require.Eventually(t, func() bool {
+		return tt.LastError() == errContainerNotRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, logs.getRequests())
+}
+
+func TestTailer_MissingPod(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	_, tt := runTestTailer(t, client, newFakeLogs(), nil)
+
+	require.Eventually(t, func() bool {
+		err := tt.LastError()
+		return err != nil && strings.Contains(err.Error(), "failed to get pod")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// fakeLogs serves the logs of the test container. SinceTime is applied with
+// the granularity of a second, as the API server does.
+type fakeLogs struct {
+	mut      sync.Mutex
+	current  []string
+	previous []string
+	requests []corev1.PodLogOptions
+}
+
+func newFakeLogs() *fakeLogs {
+	return &fakeLogs{}
+}
+
+// set replaces the logs of the current and previous instances of the
+// container at once.
+func (f *fakeLogs) set(current, previous []string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.current = current
+	f.previous = previous
+}
+
+func (f *fakeLogs) getRequests() []corev1.PodLogOptions {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return append([]corev1.PodLogOptions(nil), f.requests...)
+}
+
+func (f *fakeLogs) stream(_ context.Context, _ kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.requests = append(f.requests, *opts)
+
+	lines := f.current
+	if opts.Previous {
+		lines = f.previous
+	}
+
+	var sb strings.Builder
+	for _, line := range lines {
+		rawTs, _, _ := strings.Cut(line, " ")
+		if ts, err := time.Parse(time.RFC3339Nano, rawTs); err == nil && opts.SinceTime != nil && ts.Before(opts.SinceTime.Time.Truncate(time.Second)) {
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
+	return io.NopCloser(strings.NewReader(sb.String())), nil
+}
+
+func testPod(status corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testRef.Namespace, Name: testRef.Pod},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{status}},
+	}
+}
+
+// runningStatus returns the status of a running container, which was
+// restarted at finished if it's non-nil.
+func runningStatus(finished *time.Time) corev1.ContainerStatus {
+	status := corev1.ContainerStatus{
+		Name:  testRef.Container,
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}
+	if finished != nil {
+		status.RestartCount = 1
+		status.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{FinishedAt: metav1.NewTime(*finished)}
+	}
+	return status
+}
+
+func newTestPositions(t *testing.T) positions.Positions {
+	t.Helper()
+
+	pos, err := positions.New(util.TestLogger(t), positions.Config{
+		SyncPeriod:    time.Minute,
+		PositionsFile: filepath.Join(t.TempDir(), "positions.yml"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(pos.Stop)
+	return pos
+}
+
+func runTestTailer(t *testing.T, client kubernetes.Interface, logs *fakeLogs, pos positions.Positions) (loki.LogsReceiver, *tailer) {
+	t.Helper()
+
+	if pos == nil {
+		pos = newTestPositions(t)
+	}
+	ch := make(loki.LogsReceiver)
+	tt := newTailer(tailerOptions{
+		logger:     util.TestLogger(t),
+		metrics:    newMetrics(nil),
+		client:     client,
+		streamLogs: logs.stream,
+		positions:  pos,
+		handler:    ch,
+		backoff:    backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+	}, testRef, model.LabelSet{"job": "app"})
+	t.Cleanup(tt.Stop)
+	return ch, tt
+}
+
+func expectLines(t *testing.T, ch chan loki.Entry, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		select {
+		case e := <-ch:
+			require.Equal(t, line, e.Line)
+			require.Equal(t, model.LabelSet{"job": "app"}, e.Labels)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log entry", "expected %q", line)
+		}
+	}
+
+	// No other entries are expected, such as duplicates of lines which were
+	// already read.
+	select {
+	case e := <-ch:
+		require.FailNow(t, "unexpected log entry", "got %q", e.Line)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,39 @@
+package syslog
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the metrics of the loki.source.syslog component.
+type metrics struct {
+	syslogEntries       prometheus.Counter
+	syslogParsingErrors prometheus.Counter
+	syslogEmptyMessages prometheus.Counter
+}
+
+// newMetrics creates a new set of syslog metrics. If reg is non-nil, the
+// metrics will be registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.syslogEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_syslog_entries_total",
+		Help: "Total number of successful entries sent to the syslog component.",
+	})
+	m.syslogParsingErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_syslog_parsing_errors_total",
+		Help: "Total number of parsing errors while receiving syslog messages.",
+	})
+	m.syslogEmptyMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_syslog_empty_messages_total",
+		Help: "Total number of empty messages received from the syslog component.",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.syslogEntries,
+			m.syslogParsingErrors,
+			m.syslogEmptyMessages,
+		)
+	}
+
+	return &m
+}
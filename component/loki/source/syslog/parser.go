@@ -0,0 +1,148 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+)
+
+// maxFrameLengthDigits is the maximum number of digits in the length prefix
+// of an octet-counted frame.
+const maxFrameLengthDigits = 10
+
+// newMachine returns a parser for syslog messages of the given format.
+// Machines aren't safe for concurrent use.
+func newMachine(format string) syslog.Machine {
+	if format == formatRFC3164 {
+		return rfc3164.NewMachine(
+			rfc3164.WithBestEffort(),
+			rfc3164.WithYear(rfc3164.CurrentYear{}),
+			rfc3164.WithRFC3339(),
+		)
+	}
+	return rfc5424.NewMachine(rfc5424.WithBestEffort())
+}
+
+// parseMessage parses a single syslog message. Partially parsed messages are
+// kept as long as they're valid.
+func parseMessage(m syslog.Machine, frame []byte) (syslog.Message, error) {
+	msg, err := m.Parse(frame)
+	if msg != nil && msg.Valid() {
+		return msg, nil
+	}
+	if err == nil {
+		err = errors.New("invalid syslog message")
+	}
+	return nil, err
+}
+
+// parseStream splits a stream of syslog messages into frames, and calls fn
+// for each of them. The framing is detected from the first byte of the
+// stream: messages are either octet-counted (RFC 6587 section 3.4.1) or
+// separated by newlines (RFC 6587 section 3.4.2).
+//
+// Frames longer than maxMessageLength are reported to fn as errors and
+// skipped. parseStream returns on EOF or unrecoverable errors.
+func parseStream(r io.Reader, maxMessageLength int, fn func(frame []byte, err error)) error {
+	// The buffer must hold a whole frame, along with its length prefix or
+	// trailing newline.
+	buf := bufio.NewReaderSize(r, maxMessageLength+maxFrameLengthDigits+1)
+
+	b, err := buf.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case b[0] == '<':
+		return parseNonTransparent(buf, maxMessageLength, fn)
+	case b[0] >= '0' && b[0] <= '9':
+		return parseOctetCounting(buf, maxMessageLength, fn)
+	default:
+		return fmt.Errorf("invalid or unsupported framing, first byte: %q", b[0])
+	}
+}
+
+func parseNonTransparent(r *bufio.Reader, maxMessageLength int, fn func([]byte, error)) error {
+	var tooLong bool
+	for {
+		line, err := r.ReadSlice('\n')
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			// Discard the rest of the frame.
+			tooLong = true
+			continue
+		case errors.Is(err, io.EOF):
+			if len(line) > 0 && !tooLong {
+				emitFrame(bytes.TrimRight(line, "\r"), maxMessageLength, fn)
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if tooLong {
+			tooLong = false
+			fn(nil, fmt.Errorf("message exceeds the maximum length of %d bytes", maxMessageLength))
+			continue
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			continue
+		}
+		emitFrame(line, maxMessageLength, fn)
+	}
+}
+
+func parseOctetCounting(r *bufio.Reader, maxMessageLength int, fn func([]byte, error)) error {
+	for {
+		prefix, err := r.ReadSlice(' ')
+		switch {
+		case errors.Is(err, io.EOF) && len(prefix) == 0:
+			return nil
+		case errors.Is(err, io.EOF) || (err == nil && len(prefix) > maxFrameLengthDigits+1):
+			return fmt.Errorf("invalid octet-counted frame length %q", prefix)
+		case errors.Is(err, bufio.ErrBufferFull):
+			return fmt.Errorf("invalid octet-counted frame length %q...", prefix[:maxFrameLengthDigits])
+		case err != nil:
+			return err
+		}
+
+		length, err := strconv.ParseUint(string(prefix[:len(prefix)-1]), 10, 64)
+		if err != nil || length == 0 {
+			return fmt.Errorf("invalid octet-counted frame length %q", prefix[:len(prefix)-1])
+		}
+
+		if length > uint64(maxMessageLength) {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return err
+			}
+			fn(nil, fmt.Errorf("message exceeds the maximum length of %d bytes", maxMessageLength))
+			continue
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+		fn(frame, nil)
+	}
+}
+
+func emitFrame(frame []byte, maxMessageLength int, fn func([]byte, error)) {
+	if len(frame) > maxMessageLength {
+		fn(nil, fmt.Errorf("message exceeds the maximum length of %d bytes", maxMessageLength))
+		return
+	}
+	// The frame is only valid until the next read, so it's copied.
+	fn(append([]byte(nil), frame...), nil)
+}
@@ -0,0 +1,100 @@
+package syslog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStream(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		frames []string
+		errs   int
+		err    string
+	}{
+		"empty": {
+			input: "",
+		},
+		"newline framed": {
+			input:  "<34>1 - - - - - - first\n<34>1 - - - - - - second\r\n\n<34>1 - - - - - - third",
+			frames: []string{"<34>1 - - - - - - first", "<34>1 - - - - - - second", "<34>1 - - - - - - third"},
+		},
+		"octet counted": {
+			input:  "23 <34>1 - - - - - - first24 <34>1 - - - - - - second",
+			frames: []string{"<34>1 - - - - - - first", "<34>1 - - - - - - second"},
+		},
+		"octet counted with newlines in messages": {
+			input:  "22 <34>1 - - - - - - a\nb\n",
+			frames: []string{"<34>1 - - - - - - a\nb\n"},
+		},
+		"newline framed too long": {
+			input:  "<34>1 - - - - - - " + strings.Repeat("x", 100) + "\n<34>1 - - - - - - ok\n",
+			frames: []string{"<34>1 - - - - - - ok"},
+			errs:   1,
+		},
+		"octet counted too long": {
+			input:  "118 <34>1 - - - - - - " + strings.Repeat("x", 100) + "20 <34>1 - - - - - - ok",
+			frames: []string{"<34>1 - - - - - - ok"},
+			errs:   1,
+		},
+		"invalid framing": {
+			input: "hello",
+			err:   `invalid or unsupported framing, first byte: 'h'`,
+		},
+		"invalid frame length": {
+			input: "12a <34>1 - - - - - - x",
+			err:   `invalid octet-counted frame length "12a"`,
+		},
+		"truncated frame": {
+			input:  "23 <34>1 - - - - - - first50 <34>1",
+			frames: []string{"<34>1 - - - - - - first"},
+			err:    "unexpected EOF",
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			var (
+				frames []string
+				errs   int
+			)
+			err := parseStream(strings.NewReader(tt.input), 64, func(frame []byte, err error) {
+				if err != nil {
+					errs++
+					return
+				}
+				frames = append(frames, string(frame))
+			})
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.frames, frames)
+			require.Equal(t, tt.errs, errs)
+		})
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	msg, err := parseMessage(newMachine(formatRFC5424), []byte(`<165>1 2023-01-01T10:00:00Z host app 1234 ID47 [exampleSDID@32473 iut="3"] hello`))
+	require.NoError(t, err)
+	rfc5424Msg := msg.(*rfc5424.SyslogMessage)
+	require.Equal(t, "hello", *rfc5424Msg.Message)
+	require.Equal(t, "host", *rfc5424Msg.Hostname)
+	require.Equal(t, map[string]map[string]string{"exampleSDID@32473": {"iut": "3"}}, *rfc5424Msg.StructuredData)
+
+	msg, err = parseMessage(newMachine(formatRFC3164), []byte(`<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`))
+	require.NoError(t, err)
+	rfc3164Msg := msg.(*rfc3164.SyslogMessage)
+	require.Equal(t, "mymachine", *rfc3164Msg.Hostname)
+	require.Equal(t, "su", *rfc3164Msg.Appname)
+	require.Equal(t, "'su root' failed for lonvick on /dev/pts/8", *rfc3164Msg.Message)
+
+	_, err = parseMessage(newMachine(formatRFC5424), []byte("not syslog"))
+	require.Error(t, err)
+}
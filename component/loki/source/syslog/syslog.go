@@ -0,0 +1,162 @@
+// Package syslog implements the loki.source.syslog component, which listens
+// for syslog messages over TCP and UDP.
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.syslog",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the loki.source.syslog
+// component.
+type Arguments struct {
+	SyslogListeners []ListenerConfig    `river:"listener,block"`
+	ForwardTo       []loki.LogsReceiver `river:"forward_to,attr"`
+	RelabelRules    flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// Component implements the loki.source.syslog component.
+type Component struct {
+	opts    component.Options
+	metrics *metrics
+
+	mut       sync.RWMutex
+	args      Arguments
+	handler   loki.LogsReceiver
+	receivers []loki.LogsReceiver
+	targets   []*target
+}
+
+// New creates a new loki.source.syslog component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:    o,
+		metrics: newMetrics(o.Registerer),
+
+		handler:   make(loki.LogsReceiver),
+		receivers: args.ForwardTo,
+	}
+
+	// Call to Update() to start the listeners and set receivers once at the
+	// start.
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.syslog component shutting down, stopping listeners")
+		c.mut.Lock()
+		c.stopTargets()
+		c.mut.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler:
+			c.mut.RLock()
+			receivers := c.receivers
+			c.mut.RUnlock()
+
+			for _, receiver := range receivers {
+				select {
+				case <-ctx.Done():
+					return nil
+				case receiver <- entry:
+				}
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.args = newArgs
+	c.receivers = newArgs.ForwardTo
+
+	// Stop all the listeners before starting the new ones, as they may be
+	// listening on the same addresses.
+	c.stopTargets()
+
+	rcs := flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules)
+	for _, cfg := range newArgs.SyslogListeners {
+		logger := log.With(c.opts.Logger, "listener", cfg.ListenAddress, "protocol", cfg.ListenProtocol)
+		t, err := newTarget(c.metrics, logger, c.handler, rcs, cfg)
+		if err != nil {
+			c.stopTargets()
+			return fmt.Errorf("failed to start syslog listener on %s: %w", cfg.ListenAddress, err)
+		}
+		c.targets = append(c.targets, t)
+	}
+
+	return nil
+}
+
+// stopTargets stops all the listeners. c.mut must be held.
+func (c *Component) stopTargets() {
+	for _, t := range c.targets {
+		if err := t.Stop(); err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "error while stopping syslog listener", "err", err)
+		}
+	}
+	c.targets = nil
+}
+
+// DebugInfo returns information about the status of the listeners.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res debugInfo
+	for _, t := range c.targets {
+		res.Listeners = append(res.Listeners, listenerInfo{
+			Address:  t.Addr().String(),
+			Protocol: t.config.ListenProtocol,
+			Format:   t.config.SyslogFormat,
+		})
+	}
+	return res
+}
+
+type debugInfo struct {
+	Listeners []listenerInfo `river:"listener,block,optional"`
+}
+
+type listenerInfo struct {
+	Address  string `river:"address,attr"`
+	Protocol string `river:"protocol,attr"`
+	Format   string `river:"syslog_format,attr"`
+}
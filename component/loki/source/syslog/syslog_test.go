@@ -0,0 +1,312 @@
+package syslog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/loki/source/internal/sourcetest"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerConfig(t *testing.T) {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		forward_to = []
+
+		listener {
+			address = "127.0.0.1:1514"
+		}
+
+		listener {
+			address       = "127.0.0.1:1514"
+			protocol      = "udp"
+			syslog_format = "rfc3164"
+		}
+	`), &args))
+	require.Len(t, args.SyslogListeners, 2)
+
+	expected := DefaultListenerConfig
+	expected.ListenAddress = "127.0.0.1:1514"
+	require.Equal(t, expected, args.SyslogListeners[0])
+	require.Equal(t, protocolUDP, args.SyslogListeners[1].ListenProtocol)
+	require.Equal(t, formatRFC3164, args.SyslogListeners[1].SyslogFormat)
+
+	for _, tt := range []struct{ listener, err string }{
+		{`protocol = "sctp"`, `invalid protocol "sctp", expected "tcp" or "udp"`},
+		{`syslog_format = "rfc9999"`, `invalid syslog_format "rfc9999", expected "rfc5424" or "rfc3164"`},
+		{"syslog_format = \"rfc3164\"\nuse_rfc5424_message = true", `use_rfc5424_message can only be set for the "rfc5424" syslog_format`},
+		{"protocol = \"udp\"\ntls {}", `tls can only be used with the "tcp" protocol`},
+		{`max_message_length = 0`, "max_message_length must be greater than 0"},
+	} {
+		err := river.Unmarshal([]byte(fmt.Sprintf(`
+			forward_to = []
+			listener {
+				address = "127.0.0.1:1514"
+				%s
+			}
+		`, tt.listener)), &args)
+		require.EqualError(t, err, tt.err)
+	}
+}
+
+func TestSyslog_TCP(t *testing.T) {
+	ch := make(chan loki.Entry)
+	c, reg := runTestComponent(t, Arguments{
+		SyslogListeners: []ListenerConfig{testListener(protocolTCP, func(lc *ListenerConfig) {
+			lc.Labels = map[string]string{"job": "syslog"}
+			lc.UseIncomingTimestamp = true
+		})},
+		ForwardTo:    []loki.LogsReceiver{ch},
+		RelabelRules: sourcetest.RelabelRules("__syslog_message_hostname", "host", "__syslog_message_sd_custom_32473_env", "env"),
+	})
+
+	conn, err := net.Dial("tcp", listenerAddr(t, c, 0))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Newline-framed messages.
+	_, err = fmt.Fprint(conn, "<165>1 2023-01-01T10:00:00Z host-a app 1234 ID47 [custom@32473 env=\"prod\"] first message\n")
+	require.NoError(t, err)
+	_, err = fmt.Fprint(conn, "<165>1 2023-01-01T10:00:01Z host-b app - - - second message\n")
+	require.NoError(t, err)
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"job": "syslog", "host": "host-a", "env": "prod"}, e.Labels)
+	require.Equal(t, "first message", e.Line)
+	require.Equal(t, time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC), e.Timestamp.UTC())
+
+	e = sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"job": "syslog", "host": "host-b"}, e.Labels)
+	require.Equal(t, "second message", e.Line)
+
+	// Octet-counted messages, in a new connection.
+	conn2, err := net.Dial("tcp", listenerAddr(t, c, 0))
+	require.NoError(t, err)
+	defer conn2.Close()
+
+	for _, msg := range []string{
+		"<165>1 2023-01-01T10:00:02Z host-c app - - - octet\ncounted",
+		"not a syslog message",
+	} {
+		_, err = fmt.Fprintf(conn2, "%d %s", len(msg), msg)
+		require.NoError(t, err)
+	}
+
+	e = sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"job": "syslog", "host": "host-c"}, e.Labels)
+	require.Equal(t, "octet\ncounted", e.Line)
+
+	m := newMetricsFrom(t, reg)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.syslogParsingErrors) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 3.0, testutil.ToFloat64(m.syslogEntries))
+}
+
+func TestSyslog_UDP(t *testing.T) {
+	ch := make(chan loki.Entry)
+	c, _ := runTestComponent(t, Arguments{
+		SyslogListeners: []ListenerConfig{
+			testListener(protocolUDP, func(lc *ListenerConfig) {
+				lc.Labels = map[string]string{"format": "rfc5424"}
+				lc.UseRFC5424Message = true
+			}),
+			testListener(protocolUDP, func(lc *ListenerConfig) {
+				lc.Labels = map[string]string{"format": "rfc3164"}
+				lc.SyslogFormat = formatRFC3164
+			}),
+		},
+		ForwardTo:    []loki.LogsReceiver{ch},
+		RelabelRules: sourcetest.RelabelRules("__syslog_message_app_name", "app", "__syslog_message_severity", "level"),
+	})
+
+	conn, err := net.Dial("udp", listenerAddr(t, c, 0))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprint(conn, "<165>1 2023-01-01T10:00:00Z host app 1234 - - full message\n")
+	require.NoError(t, err)
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"format": "rfc5424", "app": "app", "level": "notice"}, e.Labels)
+	require.Equal(t, "<165>1 2023-01-01T10:00:00Z host app 1234 - - full message", e.Line)
+
+	conn2, err := net.Dial("udp", listenerAddr(t, c, 1))
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = fmt.Fprint(conn2, "<34>Oct 11 22:14:15 mymachine su: 'su root' failed")
+	require.NoError(t, err)
+
+	e = sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"format": "rfc3164", "app": "su", "level": "critical"}, e.Labels)
+	require.Equal(t, "'su root' failed", e.Line)
+	require.WithinDuration(t, time.Now(), e.Timestamp, 5*time.Second)
+}
+
+func TestSyslog_TLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	ch := make(chan loki.Entry)
+	c, _ := runTestComponent(t, Arguments{
+		SyslogListeners: []ListenerConfig{testListener(protocolTCP, func(lc *ListenerConfig) {
+			lc.Labels = map[string]string{"job": "syslog"}
+			lc.TLSConfig = &otelcol.TLSServerArguments{CertFile: certFile, KeyFile: keyFile}
+		})},
+		ForwardTo: []loki.LogsReceiver{ch},
+	})
+
+	pool := x509.NewCertPool()
+	caPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+
+	conn, err := tls.Dial("tcp", listenerAddr(t, c, 0), &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "<165>1 2023-01-01T10:00:00Z host app - - - secure message\n")
+	require.NoError(t, err)
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"job": "syslog"}, e.Labels)
+	require.Equal(t, "secure message", e.Line)
+
+	// Plain text connections are rejected.
+	plain, err := net.Dial("tcp", listenerAddr(t, c, 0))
+	require.NoError(t, err)
+	defer plain.Close()
+	_, err = fmt.Fprint(plain, "<165>1 2023-01-01T10:00:00Z host app - - - insecure message\n")
+	require.NoError(t, err)
+	select {
+	case e := <-ch:
+		require.FailNow(t, "unexpected entry", "line: %s", e.Line)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSyslog_Update(t *testing.T) {
+	ch := make(chan loki.Entry)
+	args := Arguments{
+		SyslogListeners: []ListenerConfig{testListener(protocolTCP, func(lc *ListenerConfig) {
+			lc.Labels = map[string]string{"version": "1"}
+		})},
+		ForwardTo: []loki.LogsReceiver{ch},
+	}
+	c, _ := runTestComponent(t, args)
+
+	// Reuse the address, to make sure the previous listener is closed first.
+	addr := listenerAddr(t, c, 0)
+	args.SyslogListeners[0].ListenAddress = addr
+	args.SyslogListeners[0].Labels = map[string]string{"version": "2"}
+	require.NoError(t, c.Update(args))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprint(conn, "<165>1 2023-01-01T10:00:00Z host app - - - message\n")
+	require.NoError(t, err)
+
+	e := sourcetest.ReceiveEntry(t, ch)
+	require.Equal(t, model.LabelSet{"version": "2"}, e.Labels)
+
+	// Listeners which fail to start make the update fail.
+	args.SyslogListeners[0].ListenAddress = "256.0.0.1:0"
+	require.Error(t, c.Update(args))
+}
+
+func testListener(protocol string, fn func(*ListenerConfig)) ListenerConfig {
+	lc := DefaultListenerConfig
+	lc.ListenAddress = "127.0.0.1:0"
+	lc.ListenProtocol = protocol
+	fn(&lc)
+	return lc
+}
+
+// runTestComponent runs a loki.source.syslog component until the end of the
+// test.
+func runTestComponent(t *testing.T, args Arguments) (*Component, prometheus.Registerer) {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	c, err := New(component.Options{
+		ID:         "loki.source.syslog.test",
+		Logger:     util.TestLogger(t),
+		Registerer: reg,
+	}, args)
+	require.NoError(t, err)
+
+	sourcetest.Run(t, c)
+	return c, reg
+}
+
+func listenerAddr(t *testing.T, c *Component, i int) string {
+	t.Helper()
+
+	info := c.DebugInfo().(debugInfo)
+	require.Greater(t, len(info.Listeners), i)
+	return info.Listeners[i].Address
+}
+
+// newMetricsFrom returns the metrics registered to reg by a component.
+func newMetricsFrom(t *testing.T, reg prometheus.Registerer) *metrics {
+	t.Helper()
+
+	m := newMetrics(nil)
+	for _, c := range []*prometheus.Counter{&m.syslogEntries, &m.syslogParsingErrors, &m.syslogEmptyMessages} {
+		err := reg.Register(*c)
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		require.True(t, ok, "metric wasn't registered by the component: %v", err)
+		*c = are.ExistingCollector.(prometheus.Counter)
+	}
+	return m
+}
+
+// writeTestCertificate writes a self-signed certificate for localhost, and
+// returns the paths to the certificate and its key.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
@@ -0,0 +1,190 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// target listens for syslog messages and sends them to a handler, after
+// turning their metadata into labels.
+type target struct {
+	metrics       *metrics
+	logger        log.Logger
+	handler       loki.LogsReceiver
+	config        ListenerConfig
+	relabelConfig []*relabel.Config
+
+	transport transport
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newTarget starts listening for syslog messages as configured by config.
+func newTarget(
+	metrics *metrics,
+	logger log.Logger,
+	handler loki.LogsReceiver,
+	relabel []*relabel.Config,
+	config ListenerConfig,
+) (*target, error) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &target{
+		metrics:       metrics,
+		logger:        logger,
+		handler:       handler,
+		config:        config,
+		relabelConfig: relabel,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	switch config.ListenProtocol {
+	case protocolTCP:
+		t.transport = newTCPTransport(config, t.handleMessage, t.handleMessageError, logger)
+	case protocolUDP:
+		t.transport = newUDPTransport(config, t.handleMessage, t.handleMessageError, logger)
+	default:
+		cancel()
+		return nil, fmt.Errorf("invalid transport protocol. expected 'tcp' or 'udp', got '%s'", config.ListenProtocol)
+	}
+
+	if err := t.transport.Run(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *target) handleMessageError(err error) {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		level.Debug(t.logger).Log("msg", "connection timed out", "err", ne)
+		return
+	}
+	level.Warn(t.logger).Log("msg", "error parsing syslog stream", "err", err)
+	t.metrics.syslogParsingErrors.Inc()
+}
+
+func (t *target) handleMessage(connLabels labels.Labels, msg syslog.Message) {
+	var (
+		base           *syslog.Base
+		structuredData *map[string]map[string]string
+	)
+	switch m := msg.(type) {
+	case *rfc5424.SyslogMessage:
+		base, structuredData = &m.Base, m.StructuredData
+	case *rfc3164.SyslogMessage:
+		base = &m.Base
+	default:
+		level.Warn(t.logger).Log("msg", "unexpected syslog message type", "type", fmt.Sprintf("%T", msg))
+		return
+	}
+
+	if base.Message == nil {
+		t.metrics.syslogEmptyMessages.Inc()
+		return
+	}
+
+	lb := labels.NewBuilder(connLabels)
+	if v := msg.SeverityLevel(); v != nil {
+		lb.Set("__syslog_message_severity", *v)
+	}
+	if v := msg.FacilityLevel(); v != nil {
+		lb.Set("__syslog_message_facility", *v)
+	}
+	if v := base.Hostname; v != nil {
+		lb.Set("__syslog_message_hostname", *v)
+	}
+	if v := base.Appname; v != nil {
+		lb.Set("__syslog_message_app_name", *v)
+	}
+	if v := base.ProcID; v != nil {
+		lb.Set("__syslog_message_proc_id", *v)
+	}
+	if v := base.MsgID; v != nil {
+		lb.Set("__syslog_message_msg_id", *v)
+	}
+	if structuredData != nil {
+		for id, params := range *structuredData {
+			id = strings.ReplaceAll(id, "@", "_")
+			for name, value := range params {
+				lb.Set("__syslog_message_sd_"+id+"_"+name, value)
+			}
+		}
+	}
+
+	processed := relabel.Process(lb.Labels(nil), t.relabelConfig...)
+
+	filtered := make(model.LabelSet)
+	for _, lbl := range processed {
+		if strings.HasPrefix(lbl.Name, model.ReservedLabelPrefix) {
+			continue
+		}
+		filtered[model.LabelName(lbl.Name)] = model.LabelValue(lbl.Value)
+	}
+	if len(filtered) == 0 {
+		level.Debug(t.logger).Log("msg", "dropping syslog message with no labels")
+		return
+	}
+
+	var timestamp time.Time
+	if t.config.UseIncomingTimestamp && base.Timestamp != nil {
+		timestamp = *base.Timestamp
+	} else {
+		timestamp = time.Now()
+	}
+
+	line := *base.Message
+	if m, ok := msg.(*rfc5424.SyslogMessage); ok && t.config.UseRFC5424Message {
+		fullMsg, err := m.String()
+		if err != nil {
+			level.Debug(t.logger).Log("msg", "failed to convert rfc5424 message to string; using message field instead", "err", err)
+		} else {
+			line = fullMsg
+		}
+	}
+
+	select {
+	case <-t.ctx.Done():
+		return
+	case t.handler <- loki.Entry{
+		Labels: filtered,
+		Entry: logproto.Entry{
+			Timestamp: timestamp,
+			Line:      line,
+		},
+	}:
+		t.metrics.syslogEntries.Inc()
+	}
+}
+
+// Addr returns the address the target is listening on.
+func (t *target) Addr() net.Addr {
+	return t.transport.Addr()
+}
+
+// Stop stops listening and waits for all the connections to be closed.
+func (t *target) Stop() error {
+	t.cancel()
+	err := t.transport.Close()
+	t.transport.Wait()
+	return err
+}
@@ -0,0 +1,357 @@
+package syslog
+
+// This code is adapted from Promtail's syslog target. Unlike Promtail, the
+// framing of TCP streams is handled here so that both RFC5424 and RFC3164
+// messages can be parsed, and every UDP datagram is parsed as a single
+// message.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/backoff"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// hostnameCacheSize is the number of reverse DNS lookups cached by the UDP
+// transport, which can't look up the sender of each datagram.
+const hostnameCacheSize = 1000
+
+// transport receives syslog messages over the network.
+type transport interface {
+	// Run starts listening for syslog messages.
+	Run() error
+	// Addr returns the address the transport is listening on.
+	Addr() net.Addr
+	// Close stops listening and closes open connections.
+	Close() error
+	// Wait waits for all the connections to be closed.
+	Wait()
+}
+
+type (
+	handleMessage      func(labels.Labels, syslog.Message)
+	handleMessageError func(error)
+)
+
+type baseTransport struct {
+	config ListenerConfig
+	logger log.Logger
+
+	openConnections *sync.WaitGroup
+
+	handleMessage      handleMessage
+	handleMessageError handleMessageError
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+}
+
+func newBaseTransport(config ListenerConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) *baseTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &baseTransport{
+		config:             config,
+		logger:             logger,
+		openConnections:    new(sync.WaitGroup),
+		handleMessage:      handleMessage,
+		handleMessageError: handleError,
+		ctx:                ctx,
+		ctxCancel:          cancel,
+	}
+}
+
+func (t *baseTransport) close() {
+	t.ctxCancel()
+}
+
+func (t *baseTransport) running() bool {
+	return t.ctx.Err() == nil
+}
+
+func (t *baseTransport) connectionLabels(ip, hostname string) labels.Labels {
+	lb := labels.NewBuilder(nil)
+	for k, v := range t.config.Labels {
+		lb.Set(k, v)
+	}
+
+	lb.Set("__syslog_connection_ip_address", ip)
+	lb.Set("__syslog_connection_hostname", hostname)
+
+	return lb.Labels(nil)
+}
+
+// handleFrame parses a syslog message and hands it over to the target.
+func (t *baseTransport) handleFrame(m syslog.Machine, lbs labels.Labels, frame []byte, err error) {
+	if err == nil {
+		var msg syslog.Message
+		if msg, err = parseMessage(m, frame); err == nil {
+			t.handleMessage(lbs.Copy(), msg)
+			return
+		}
+	}
+	t.handleMessageError(err)
+}
+
+func lookupAddr(addr string) string {
+	names, _ := net.LookupAddr(addr)
+	return strings.Join(names, ",")
+}
+
+type idleTimeoutConn struct {
+	net.Conn
+	idleTimeout time.Duration
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	c.setDeadline()
+	return c.Conn.Write(p)
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	c.setDeadline()
+	return c.Conn.Read(b)
+}
+
+func (c *idleTimeoutConn) setDeadline() {
+	if c.idleTimeout > 0 {
+		_ = c.Conn.SetDeadline(time.Now().Add(c.idleTimeout))
+	}
+}
+
+// tcpTransport receives octet-counted or newline-framed syslog messages over
+// TCP connections, optionally secured with TLS.
+type tcpTransport struct {
+	*baseTransport
+	listener net.Listener
+}
+
+var _ transport = (*tcpTransport)(nil)
+
+func newTCPTransport(config ListenerConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) *tcpTransport {
+	return &tcpTransport{
+		baseTransport: newBaseTransport(config, handleMessage, handleError, logger),
+	}
+}
+
+// Run implements transport.
+func (t *tcpTransport) Run() error {
+	var tlsConfig *tls.Config
+	if t.config.TLSConfig != nil {
+		var err error
+		tlsConfig, err = t.config.TLSConfig.Convert().LoadTLSConfig()
+		if err != nil {
+			return fmt.Errorf("error setting up syslog TLS: %w", err)
+		}
+	}
+
+	l, err := net.Listen(protocolTCP, t.config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("error setting up syslog listener: %w", err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	t.listener = l
+	level.Info(t.logger).Log("msg", "syslog listening on address", "address", t.Addr().String(), "protocol", protocolTCP, "tls", tlsConfig != nil)
+
+	t.openConnections.Add(1)
+	go t.acceptConnections()
+
+	return nil
+}
+
+func (t *tcpTransport) acceptConnections() {
+	defer t.openConnections.Done()
+
+	l := log.With(t.logger, "address", t.listener.Addr().String())
+
+	backoff := backoff.New(t.ctx, backoff.Config{
+		MinBackoff: 5 * time.Millisecond,
+		MaxBackoff: 1 * time.Second,
+	})
+
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			if !t.running() {
+				level.Info(l).Log("msg", "syslog server shutting down", "protocol", protocolTCP, "err", t.ctx.Err())
+				return
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) {
+				level.Warn(l).Log("msg", "failed to accept syslog connection", "err", err, "num_retries", backoff.NumRetries())
+				backoff.Wait()
+				continue
+			}
+
+			level.Error(l).Log("msg", "failed to accept syslog connection. quiting", "err", err)
+			return
+		}
+		backoff.Reset()
+
+		t.openConnections.Add(1)
+		go t.handleConnection(c)
+	}
+}
+
+func (t *tcpTransport) handleConnection(cn net.Conn) {
+	defer t.openConnections.Done()
+
+	c := &idleTimeoutConn{cn, t.config.IdleTimeout}
+
+	handlerCtx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	go func() {
+		<-handlerCtx.Done()
+		_ = c.Close()
+	}()
+
+	var ip string
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP.String()
+	}
+	lbs := t.connectionLabels(ip, lookupAddr(ip))
+
+	m := newMachine(t.config.SyslogFormat)
+	err := parseStream(c, t.config.MaxMessageLength, func(frame []byte, err error) {
+		t.handleFrame(m, lbs, frame, err)
+	})
+	if err != nil && t.running() {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			level.Debug(t.logger).Log("msg", "connection timed out", "err", ne)
+			return
+		}
+		level.Warn(t.logger).Log("msg", "error reading syslog stream", "err", err)
+		t.handleMessageError(err)
+	}
+}
+
+// Close implements transport.
+func (t *tcpTransport) Close() error {
+	t.baseTransport.close()
+	return t.listener.Close()
+}
+
+// Wait implements transport.
+func (t *tcpTransport) Wait() {
+	t.openConnections.Wait()
+}
+
+// Addr implements transport.
+func (t *tcpTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// udpTransport receives syslog messages over UDP, one message per datagram
+// as described in RFC5426.
+type udpTransport struct {
+	*baseTransport
+	udpConn   *net.UDPConn
+	hostnames *lru.Cache
+}
+
+var _ transport = (*udpTransport)(nil)
+
+func newUDPTransport(config ListenerConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) *udpTransport {
+	hostnames, _ := lru.New(hostnameCacheSize)
+	return &udpTransport{
+		baseTransport: newBaseTransport(config, handleMessage, handleError, logger),
+		hostnames:     hostnames,
+	}
+}
+
+// Run implements transport.
+func (t *udpTransport) Run() error {
+	addr, err := net.ResolveUDPAddr(protocolUDP, t.config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("error resolving UDP address: %w", err)
+	}
+	t.udpConn, err = net.ListenUDP(protocolUDP, addr)
+	if err != nil {
+		return fmt.Errorf("error setting up syslog listener: %w", err)
+	}
+	_ = t.udpConn.SetReadBuffer(1024 * 1024)
+	level.Info(t.logger).Log("msg", "syslog listening on address", "address", t.Addr().String(), "protocol", protocolUDP)
+
+	t.openConnections.Add(1)
+	go t.acceptPackets()
+	return nil
+}
+
+func (t *udpTransport) acceptPackets() {
+	defer t.openConnections.Done()
+
+	// Datagrams larger than the buffer are truncated, which makes them
+	// exceed the maximum message length below.
+	buf := make([]byte, t.config.MaxMessageLength+1)
+	m := newMachine(t.config.SyslogFormat)
+
+	for {
+		n, addr, err := t.udpConn.ReadFromUDP(buf)
+		if !t.running() {
+			level.Info(t.logger).Log("msg", "syslog server shutting down", "protocol", protocolUDP, "err", t.ctx.Err())
+			return
+		}
+		if err != nil {
+			level.Warn(t.logger).Log("msg", "failed to read packets", "addr", addr, "err", err)
+			continue
+		}
+
+		// Some senders terminate datagrams with a newline or NUL character
+		// anyway.
+		frame := bytes.TrimRight(buf[:n], "\r\n\x00")
+		if len(frame) == 0 {
+			continue
+		}
+
+		ip := addr.IP.String()
+		lbs := t.connectionLabels(ip, t.lookupAddr(ip))
+
+		if len(frame) > t.config.MaxMessageLength {
+			t.handleFrame(m, lbs, nil, fmt.Errorf("message exceeds the maximum length of %d bytes", t.config.MaxMessageLength))
+			continue
+		}
+		t.handleFrame(m, lbs, frame, nil)
+	}
+}
+
+// lookupAddr looks up the hostname of the sender of a datagram, caching the
+// results.
+func (t *udpTransport) lookupAddr(ip string) string {
+	if name, ok := t.hostnames.Get(ip); ok {
+		return name.(string)
+	}
+	name := lookupAddr(ip)
+	t.hostnames.Add(ip, name)
+	return name
+}
+
+// Close implements transport.
+func (t *udpTransport) Close() error {
+	t.baseTransport.close()
+	return t.udpConn.Close()
+}
+
+// Wait implements transport.
+func (t *udpTransport) Wait() {
+	t.openConnections.Wait()
+}
+
+// Addr implements transport.
+func (t *udpTransport) Addr() net.Addr {
+	return t.udpConn.LocalAddr()
+}
@@ -0,0 +1,79 @@
+package syslog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/pkg/river"
+)
+
+// Supported listener protocols.
+const (
+	protocolTCP = "tcp"
+	protocolUDP = "udp"
+)
+
+// Supported syslog message formats.
+const (
+	formatRFC5424 = "rfc5424"
+	formatRFC3164 = "rfc3164"
+)
+
+// ListenerConfig configures a single listener of the loki.source.syslog
+// component.
+type ListenerConfig struct {
+	ListenAddress        string                      `river:"address,attr"`
+	ListenProtocol       string                      `river:"protocol,attr,optional"`
+	IdleTimeout          time.Duration               `river:"idle_timeout,attr,optional"`
+	SyslogFormat         string                      `river:"syslog_format,attr,optional"`
+	UseIncomingTimestamp bool                        `river:"use_incoming_timestamp,attr,optional"`
+	UseRFC5424Message    bool                        `river:"use_rfc5424_message,attr,optional"`
+	MaxMessageLength     int                         `river:"max_message_length,attr,optional"`
+	Labels               map[string]string           `river:"labels,attr,optional"`
+	TLSConfig            *otelcol.TLSServerArguments `river:"tls,block,optional"`
+}
+
+// DefaultListenerConfig provides the default arguments for a syslog listener.
+var DefaultListenerConfig = ListenerConfig{
+	ListenProtocol:   protocolTCP,
+	IdleTimeout:      120 * time.Second,
+	SyslogFormat:     formatRFC5424,
+	MaxMessageLength: 8192,
+}
+
+var _ river.Unmarshaler = (*ListenerConfig)(nil)
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (lc *ListenerConfig) UnmarshalRiver(f func(interface{}) error) error {
+	*lc = DefaultListenerConfig
+
+	type listenerConfig ListenerConfig
+	if err := f((*listenerConfig)(lc)); err != nil {
+		return err
+	}
+
+	switch lc.ListenProtocol {
+	case protocolTCP, protocolUDP:
+	default:
+		return fmt.Errorf("invalid protocol %q, expected %q or %q", lc.ListenProtocol, protocolTCP, protocolUDP)
+	}
+	switch lc.SyslogFormat {
+	case formatRFC5424, formatRFC3164:
+	default:
+		return fmt.Errorf("invalid syslog_format %q, expected %q or %q", lc.SyslogFormat, formatRFC5424, formatRFC3164)
+	}
+	if lc.UseRFC5424Message && lc.SyslogFormat != formatRFC5424 {
+		return fmt.Errorf("use_rfc5424_message can only be set for the %q syslog_format", formatRFC5424)
+	}
+	if lc.TLSConfig != nil && lc.ListenProtocol != protocolTCP {
+		return fmt.Errorf("tls can only be used with the %q protocol", protocolTCP)
+	}
+	if lc.MaxMessageLength <= 0 {
+		return fmt.Errorf("max_message_length must be greater than 0")
+	}
+	if lc.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package write
+
+import (
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/loki/write/internal/client"
+	"github.com/grafana/agent/component/loki/write/internal/wal"
+)
+
+// deliveryTracker acknowledges entries in the WAL once every client has
+// delivered them. Entries which a client failed to deliver are never
+// acknowledged, so that they're replayed the next time the WAL is opened.
+type deliveryTracker struct {
+	logger  log.Logger
+	wal     *wal.WAL
+	clients int
+
+	mut sync.Mutex
+	// pending holds the number of clients which have yet to deliver each
+	// entry, by WAL ID.
+	pending map[uint64]int
+}
+
+func newDeliveryTracker(logger log.Logger, w *wal.WAL, clients int) *deliveryTracker {
+	return &deliveryTracker{
+		logger:  logger,
+		wal:     w,
+		clients: clients,
+		pending: make(map[uint64]int),
+	}
+}
+
+// track starts tracking the delivery of the entry with the given WAL ID. It
+// must be called before the entry is handed to the clients.
+func (t *deliveryTracker) track(id uint64) {
+	if t.clients == 0 {
+		t.ack([]uint64{id})
+		return
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.pending[id] = t.clients
+}
+
+// clientHandler returns the client.DeliveryHandler of a client created when
+// the next WAL ID was base. Every entry logged to the WAL from then on must
+// be handed to the client in the same order.
+func (t *deliveryTracker) clientHandler(base uint64) client.DeliveryHandler {
+	return &clientDelivery{tracker: t, base: base}
+}
+
+func (t *deliveryTracker) delivered(ids []uint64) {
+	var acked []uint64
+
+	t.mut.Lock()
+	for _, id := range ids {
+		n, ok := t.pending[id]
+		if !ok {
+			continue
+		}
+		if n > 1 {
+			t.pending[id] = n - 1
+			continue
+		}
+		delete(t.pending, id)
+		acked = append(acked, id)
+	}
+	t.mut.Unlock()
+
+	t.ack(acked)
+}
+
+func (t *deliveryTracker) dropped(ids []uint64) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	for _, id := range ids {
+		delete(t.pending, id)
+	}
+}
+
+func (t *deliveryTracker) ack(ids []uint64) {
+	if err := t.wal.Ack(ids); err != nil {
+		level.Error(t.logger).Log("msg", "failed to acknowledge delivered entries in the WAL", "err", err)
+	}
+}
+
+// clientDelivery maps the indexes of the entries received by a client to
+// their WAL IDs.
+type clientDelivery struct {
+	tracker *deliveryTracker
+	base    uint64
+}
+
+var _ client.DeliveryHandler = (*clientDelivery)(nil)
+
+// Delivered implements client.DeliveryHandler.
+func (d *clientDelivery) Delivered(indexes []uint64) {
+	d.tracker.delivered(d.ids(indexes))
+}
+
+// Dropped implements client.DeliveryHandler.
+func (d *clientDelivery) Dropped(indexes []uint64) {
+	d.tracker.dropped(d.ids(indexes))
+}
+
+func (d *clientDelivery) ids(indexes []uint64) []uint64 {
+	ids := make([]uint64, len(indexes))
+	for i, index := range indexes {
+		ids[i] = d.base + index
+	}
+	return ids
+}
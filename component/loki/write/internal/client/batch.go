@@ -30,6 +30,10 @@ type batch struct {
 	createdAt time.Time
 
 	maxStreams int
+
+	// indexes holds the indexes of the entries of the batch, when the client
+	// notifies a DeliveryHandler.
+	indexes []uint64
 }
 
 func newBatch(maxStreams int, entries ...loki.Entry) *batch {
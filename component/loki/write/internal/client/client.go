@@ -34,7 +34,7 @@ const (
 
 	// Label reserved to override the tenant ID while processing
 	// pipeline stages
-	ReservedLabelTenantID = "__tenant_id__"
+	ReservedLabelTenantID = loki.ReservedLabelTenantID
 
 	LatencyLabel = "filename"
 	HostLabel    = "host"
@@ -130,6 +130,17 @@ type Client interface {
 	Name() string
 }
 
+// DeliveryHandler is notified of the outcome of sending the entries handed to
+// a client. Entries are identified by their index in the sequence of entries
+// received by the client, starting at 0.
+type DeliveryHandler interface {
+	// Delivered is called with the entries which have been sent to Loki,
+	// including the ones it rejected as they'd be rejected again if resent.
+	Delivered(indexes []uint64)
+	// Dropped is called with the entries which failed to be sent to Loki.
+	Dropped(indexes []uint64)
+}
+
 // Client for pushing logs in snappy-compressed protos over HTTP.
 type client struct {
 	name            string
@@ -140,6 +151,11 @@ type client struct {
 	client          *http.Client
 	entries         chan loki.Entry
 
+	// delivery is notified of the outcome of sending each entry, if set.
+	// received is the number of entries received so far.
+	delivery DeliveryHandler
+	received uint64
+
 	once sync.Once
 	wg   sync.WaitGroup
 
@@ -163,6 +179,10 @@ func New(metrics *Metrics, cfg Config, streamLagLabels []string, maxStreams int,
 }
 
 func newClient(metrics *Metrics, cfg Config, streamLagLabels []string, maxStreams int, logger log.Logger) (*client, error) {
+	return newClientWithDeliveryHandler(metrics, cfg, streamLagLabels, maxStreams, logger, nil)
+}
+
+func newClientWithDeliveryHandler(metrics *Metrics, cfg Config, streamLagLabels []string, maxStreams int, logger log.Logger, h DeliveryHandler) (*client, error) {
 	if cfg.URL.URL == nil {
 		return nil, errors.New("client needs target URL")
 	}
@@ -176,6 +196,7 @@ func newClient(metrics *Metrics, cfg Config, streamLagLabels []string, maxStream
 		metrics:         metrics,
 		streamLagLabels: streamLagLabels,
 		name:            asSha256(cfg),
+		delivery:        h,
 
 		externalLabels: cfg.ExternalLabels.LabelSet,
 		ctx:            ctx,
@@ -209,6 +230,15 @@ func newClient(metrics *Metrics, cfg Config, streamLagLabels []string, maxStream
 	return c, nil
 }
 
+// NewWithDeliveryHandler creates a new Loki client which notifies h of the
+// entries it delivered or dropped.
+func NewWithDeliveryHandler(metrics *Metrics, cfg Config, streamLagLabels []string, maxStreams int, logger log.Logger, h DeliveryHandler) (Client, error) {
+	if cfg.StreamLagLabels.String() != "" {
+		return nil, fmt.Errorf("client config stream_lag_labels is deprecated in favour of the config file options block field, and will be ignored: %+v", cfg.StreamLagLabels.String())
+	}
+	return newClientWithDeliveryHandler(metrics, cfg, streamLagLabels, maxStreams, logger, h)
+}
+
 // NewWithTripperware creates a new Loki client with a custom tripperware.
 func NewWithTripperware(metrics *Metrics, cfg Config, streamLagLabels []string, maxStreams int, logger log.Logger, tp Tripperware) (Client, error) {
 	c, err := newClient(metrics, cfg, streamLagLabels, maxStreams, logger)
@@ -257,11 +287,13 @@ func (c *client) run() {
 				return
 			}
 			e, tenantID := c.processEntry(e)
+			index := c.received
+			c.received++
 			batch, ok := batches[tenantID]
 
 			// If the batch doesn't exist yet, we create a new one with the entry
 			if !ok {
-				batches[tenantID] = newBatch(c.maxStreams, e)
+				batches[tenantID] = c.newBatch(e, index)
 				break
 			}
 
@@ -270,7 +302,7 @@ func (c *client) run() {
 			if batch.sizeBytesAfter(e) > c.cfg.BatchSize {
 				c.sendBatch(tenantID, batch)
 
-				batches[tenantID] = newBatch(c.maxStreams, e)
+				batches[tenantID] = c.newBatch(e, index)
 				break
 			}
 
@@ -279,8 +311,12 @@ func (c *client) run() {
 			if err != nil {
 				level.Error(c.logger).Log("msg", "batch add err", "error", err)
 				c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host).Inc()
+				if c.delivery != nil {
+					c.delivery.Dropped([]uint64{index})
+				}
 				return
 			}
+			c.trackIndex(batch, index)
 		case <-maxWaitCheck.C:
 			// Send all batches whose max wait time has been reached
 			for tenantID, batch := range batches {
@@ -299,6 +335,21 @@ func (c *client) Chan() chan<- loki.Entry {
 	return c.entries
 }
 
+// newBatch creates a batch holding the entry with the given index.
+func (c *client) newBatch(e loki.Entry, index uint64) *batch {
+	b := newBatch(c.maxStreams, e)
+	c.trackIndex(b, index)
+	return b
+}
+
+// trackIndex records that the entry with the given index was added to b, so
+// that the delivery handler can be notified once b is sent.
+func (c *client) trackIndex(b *batch, index uint64) {
+	if c.delivery != nil {
+		b.indexes = append(b.indexes, index)
+	}
+}
+
 func asSha256(o interface{}) string {
 	h := sha256.New()
 	h.Write([]byte(fmt.Sprintf("%v", o)))
@@ -311,6 +362,9 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 	buf, entriesCount, err := batch.encode()
 	if err != nil {
 		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
+		if c.delivery != nil {
+			c.delivery.Dropped(batch.indexes)
+		}
 		return
 	}
 	bufBytes := float64(len(buf))
@@ -326,6 +380,9 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 		c.metrics.requestDuration.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host).Observe(time.Since(start).Seconds())
 
 		if err == nil {
+			if c.delivery != nil {
+				c.delivery.Delivered(batch.indexes)
+			}
 			c.metrics.sentBytes.WithLabelValues(c.cfg.URL.Host).Add(bufBytes)
 			c.metrics.sentEntries.WithLabelValues(c.cfg.URL.Host).Add(float64(entriesCount))
 			for _, s := range batch.streams {
@@ -384,6 +441,16 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 		level.Error(c.logger).Log("msg", "final error sending batch", "status", status, "error", err)
 		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host).Add(bufBytes)
 		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host).Add(float64(entriesCount))
+
+		// A batch which Loki rejected would be rejected again if it was
+		// resent, so it's reported as delivered.
+		if c.delivery != nil {
+			if status > 0 && status != 429 && status/100 != 5 {
+				c.delivery.Delivered(batch.indexes)
+			} else {
+				c.delivery.Dropped(batch.indexes)
+			}
+		}
 	}
 }
 
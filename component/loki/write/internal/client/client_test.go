@@ -495,3 +495,58 @@ func Test_Tripperware(t *testing.T) {
 	c.Stop()
 	require.True(t, called)
 }
+
+type testDeliveryHandler struct {
+	delivered, dropped []uint64
+}
+
+func (h *testDeliveryHandler) Delivered(indexes []uint64) {
+	h.delivered = append(h.delivered, indexes...)
+}
+
+func (h *testDeliveryHandler) Dropped(indexes []uint64) {
+	h.dropped = append(h.dropped, indexes...)
+}
+
+func TestClient_DeliveryHandler(t *testing.T) {
+	// Entries of the first tenant are accepted, entries of the second one
+	// fail, and entries of the third one are rejected.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Scope-OrgID") {
+		case "tenant-1":
+			w.WriteHeader(http.StatusNoContent)
+		case "tenant-2":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(srv.URL))
+
+	var h testDeliveryHandler
+	c, err := NewWithDeliveryHandler(metrics, Config{
+		URL:            serverURL,
+		BatchWait:      time.Hour,
+		BatchSize:      1024 * 1024,
+		Client:         config.HTTPClientConfig{},
+		BackoffConfig:  backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 2},
+		Timeout:        1 * time.Second,
+		TenantID:       "tenant-3",
+		ExternalLabels: lokiflag.LabelSet{},
+	}, nil, 0, log.NewNopLogger(), &h)
+	require.NoError(t, err)
+
+	for _, tenant := range []string{"tenant-1", "tenant-2", "tenant-1", "tenant-3", "tenant-2"} {
+		c.Chan() <- loki.Entry{
+			Labels: model.LabelSet{"__tenant_id__": model.LabelValue(tenant)},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: "line"},
+		}
+	}
+	c.Stop()
+
+	require.ElementsMatch(t, []uint64{0, 2, 3}, h.delivered)
+	require.ElementsMatch(t, []uint64{1, 4}, h.dropped)
+}
@@ -0,0 +1,133 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+)
+
+// recordType is the first byte of every record written to the WAL, so that
+// new kinds of records can be added without breaking existing WALs.
+type recordType byte
+
+const (
+	recordTypeEntry recordType = 1
+	recordTypeAck   recordType = 2
+)
+
+var errUnknownRecordType = errors.New("unknown record type")
+
+// getRecordType returns the type of an encoded record.
+func getRecordType(rec []byte) recordType {
+	if len(rec) == 0 {
+		return 0
+	}
+	return recordType(rec[0])
+}
+
+// encodeEntry appends the encoded form of an entry with the given ID to b and
+// returns the resulting slice.
+//
+// The labels are written in a sorted order so that the same entry is always
+// encoded in the same way.
+func encodeEntry(id uint64, e loki.Entry, b []byte) []byte {
+	buf := encoding.Encbuf{B: b}
+	buf.PutByte(byte(recordTypeEntry))
+	buf.PutUvarint64(id)
+	buf.PutVarint64(e.Timestamp.UnixNano())
+
+	names := make([]string, 0, len(e.Labels))
+	for name := range e.Labels {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	buf.PutUvarint(len(names))
+	for _, name := range names {
+		buf.PutUvarintStr(name)
+		buf.PutUvarintStr(string(e.Labels[model.LabelName(name)]))
+	}
+	buf.PutUvarintStr(e.Line)
+
+	return buf.Get()
+}
+
+// decodeEntry decodes an entry and its ID previously encoded by encodeEntry.
+func decodeEntry(rec []byte) (uint64, loki.Entry, error) {
+	dec := encoding.Decbuf{B: rec}
+	if t := recordType(dec.Byte()); t != recordTypeEntry {
+		if dec.Err() != nil {
+			return 0, loki.Entry{}, dec.Err()
+		}
+		return 0, loki.Entry{}, fmt.Errorf("%w: %d", errUnknownRecordType, t)
+	}
+	id := dec.Uvarint64()
+	ts := dec.Varint64()
+
+	n := dec.Uvarint()
+	labels := make(model.LabelSet, n)
+	for i := 0; i < n && dec.Err() == nil; i++ {
+		name := dec.UvarintStr()
+		labels[model.LabelName(name)] = model.LabelValue(dec.UvarintStr())
+	}
+	line := dec.UvarintStr()
+
+	if dec.Err() != nil {
+		return 0, loki.Entry{}, fmt.Errorf("decode entry: %w", dec.Err())
+	}
+	if dec.Len() > 0 {
+		return 0, loki.Entry{}, fmt.Errorf("decode entry: %d unused bytes", dec.Len())
+	}
+
+	return id, loki.Entry{
+		Labels: labels,
+		Entry: logproto.Entry{
+			Timestamp: time.Unix(0, ts),
+			Line:      line,
+		},
+	}, nil
+}
+
+// encodeAck appends the encoded form of an acknowledgement of the entries
+// with the given IDs to b and returns the resulting slice.
+func encodeAck(ids []uint64, b []byte) []byte {
+	buf := encoding.Encbuf{B: b}
+	buf.PutByte(byte(recordTypeAck))
+	buf.PutUvarint(len(ids))
+	for _, id := range ids {
+		buf.PutUvarint64(id)
+	}
+	return buf.Get()
+}
+
+// decodeAck decodes the IDs of the entries acknowledged by a record
+// previously encoded by encodeAck.
+func decodeAck(rec []byte) ([]uint64, error) {
+	dec := encoding.Decbuf{B: rec}
+	if t := recordType(dec.Byte()); t != recordTypeAck {
+		if dec.Err() != nil {
+			return nil, dec.Err()
+		}
+		return nil, fmt.Errorf("%w: %d", errUnknownRecordType, t)
+	}
+
+	n := dec.Uvarint()
+	ids := make([]uint64, 0, n)
+	for i := 0; i < n && dec.Err() == nil; i++ {
+		ids = append(ids, dec.Uvarint64())
+	}
+
+	if dec.Err() != nil {
+		return nil, fmt.Errorf("decode ack: %w", dec.Err())
+	}
+	if dec.Len() > 0 {
+		return nil, fmt.Errorf("decode ack: %d unused bytes", dec.Len())
+	}
+	return ids, nil
+}
@@ -0,0 +1,532 @@
+// Package wal implements the write-ahead log of the loki.write component.
+// Entries are appended to the WAL before they're batched by the clients, so
+// that entries which were never delivered to Loki can be replayed after a
+// restart.
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+const (
+	// segmentSize is the maximum size of a single WAL segment. It is kept
+	// smaller than for the metrics WAL, as segments are the unit of
+	// truncation.
+	segmentSize = 8 * 1024 * 1024
+
+	// truncateFrequency is how often a new segment is started and the oldest
+	// segments are checked for removal.
+	truncateFrequency = time.Minute
+)
+
+// ErrClosed is returned when appending to a WAL which has been closed.
+var ErrClosed = errors.New("WAL closed")
+
+// Config configures the WAL.
+type Config struct {
+	// Dir is the directory holding the WAL segments.
+	Dir string
+	// MaxSize is the maximum size of the WAL on disk, in bytes. The oldest
+	// segments are removed once it's exceeded. Zero means no limit.
+	MaxSize int64
+	// MaxSegmentAge is the maximum time a segment is kept after it was last
+	// written to. Zero means no limit.
+	MaxSegmentAge time.Duration
+}
+
+// Metrics holds the metrics of a WAL.
+type Metrics struct {
+	size            prometheus.Gauge
+	appendedEntries prometheus.Counter
+	removedSegments prometheus.Counter
+	replayedEntries prometheus.Counter
+	replayProgress  prometheus.Gauge
+}
+
+// NewMetrics creates the metrics of a WAL and registers them with reg, if
+// it's not nil.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	var m Metrics
+
+	m.size = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_write_wal_size_bytes",
+		Help: "Size of the WAL on disk, refreshed every time the WAL is truncated.",
+	})
+	m.appendedEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_write_wal_entries_appended_total",
+		Help: "Number of log entries appended to the WAL.",
+	})
+	m.removedSegments = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_write_wal_segments_removed_total",
+		Help: "Number of WAL segments holding undelivered entries removed because they exceeded the maximum age or size of the WAL.",
+	})
+	m.replayedEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_write_wal_replayed_entries_total",
+		Help: "Number of log entries replayed from the WAL.",
+	})
+	m.replayProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_write_wal_replay_progress",
+		Help: "Ratio of the WAL segments found on startup which have been replayed.",
+	})
+
+	if reg != nil {
+		m.size = mustRegisterOrGet(reg, m.size).(prometheus.Gauge)
+		m.appendedEntries = mustRegisterOrGet(reg, m.appendedEntries).(prometheus.Counter)
+		m.removedSegments = mustRegisterOrGet(reg, m.removedSegments).(prometheus.Counter)
+		m.replayedEntries = mustRegisterOrGet(reg, m.replayedEntries).(prometheus.Counter)
+		m.replayProgress = mustRegisterOrGet(reg, m.replayProgress).(prometheus.Gauge)
+	}
+
+	return &m
+}
+
+func mustRegisterOrGet(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// WAL is a write-ahead log of log entries.
+//
+// Every entry logged to the WAL is given an ID, which is used to acknowledge
+// the entry once it has been delivered. Acknowledgements are logged to the
+// WAL too, so that only the entries which haven't been delivered are replayed
+// after a restart or a crash. Segments are removed once all of their entries
+// have been acknowledged, or once they exceed the configured limits.
+//
+// The segments which already exist when the WAL is opened are handed over
+// once to Replay. Their entries which weren't acknowledged are logged again
+// when they're replayed, so that they can be acknowledged like new entries.
+type WAL struct {
+	logger  log.Logger
+	metrics *Metrics
+	wl      *wlog.WL
+
+	mut    sync.Mutex
+	cfg    Config
+	closed bool
+	buf    []byte
+
+	// nextID is the ID given to the next logged entry.
+	nextID uint64
+	// segmentByID holds the segment of every entry logged since the WAL was
+	// opened which hasn't been acknowledged yet, and unacked the number of
+	// such entries in each segment.
+	segmentByID map[uint64]int
+	unacked     map[int]int
+
+	// Range of the segments to replay, or -1 if there is nothing to replay.
+	replayFirst, replayLast int
+	replayed                bool
+	// replayAcked holds the IDs of the entries of the segments to replay which
+	// have been acknowledged or logged again.
+	replayAcked map[uint64]struct{}
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New opens the WAL in cfg.Dir, creating it if needed.
+func New(cfg Config, metrics *Metrics, logger log.Logger) (*WAL, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o777); err != nil {
+		return nil, fmt.Errorf("create WAL directory: %w", err)
+	}
+
+	// Look for existing segments before opening the WAL, which always starts
+	// writing to a new segment.
+	first, last, err := wlog.Segments(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("list WAL segments: %w", err)
+	}
+
+	// The WAL metrics are left unregistered, as they'd clash between
+	// reloads of the component.
+	wl, err := wlog.NewSize(logger, nil, cfg.Dir, segmentSize, true)
+	if err != nil {
+		return nil, fmt.Errorf("open WAL: %w", err)
+	}
+
+	w := &WAL{
+		logger:      logger,
+		metrics:     metrics,
+		wl:          wl,
+		cfg:         cfg,
+		segmentByID: make(map[uint64]int),
+		unacked:     make(map[int]int),
+		replayFirst: first,
+		replayLast:  last,
+		replayAcked: make(map[uint64]struct{}),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if first >= 0 {
+		w.readAcks()
+	}
+	w.updateSize()
+
+	go w.run()
+	return w, nil
+}
+
+// readAcks reads the segments to replay to find out which of their entries
+// have been acknowledged, and the ID to give to the next entry.
+func (w *WAL) readAcks() {
+	for i := w.replayFirst; i <= w.replayLast; i++ {
+		w.readSegment(i, func(rec []byte) bool {
+			switch getRecordType(rec) {
+			case recordTypeEntry:
+				id, _, err := decodeEntry(rec)
+				if err == nil && id >= w.nextID {
+					w.nextID = id + 1
+				}
+			case recordTypeAck:
+				ids, err := decodeAck(rec)
+				if err != nil {
+					level.Warn(w.logger).Log("msg", "failed to decode WAL record, skipping it", "segment", i, "err", err)
+					break
+				}
+				for _, id := range ids {
+					w.replayAcked[id] = struct{}{}
+					if id >= w.nextID {
+						w.nextID = id + 1
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// readSegment calls fn for every record of a segment, stopping early if fn
+// returns false. It returns false if fn asked to stop.
+func (w *WAL) readSegment(i int, fn func(rec []byte) bool) bool {
+	sr, err := wlog.NewSegmentsRangeReader(wlog.SegmentRange{Dir: w.cfg.Dir, First: i, Last: i})
+	if err != nil {
+		// The segment may have been removed in the meantime.
+		level.Warn(w.logger).Log("msg", "failed to open WAL segment, skipping it", "segment", i, "err", err)
+		return true
+	}
+	defer sr.Close()
+
+	r := wlog.NewReader(sr)
+	for r.Next() {
+		if !fn(r.Record()) {
+			return false
+		}
+	}
+	if err := r.Err(); err != nil {
+		level.Warn(w.logger).Log("msg", "WAL segment is corrupted, skipping the rest of it", "segment", i, "err", err)
+	}
+	return true
+}
+
+func (w *WAL) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(truncateFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+			if err := w.truncate(time.Now()); err != nil {
+				level.Error(w.logger).Log("msg", "failed to truncate WAL", "err", err)
+			}
+		}
+	}
+}
+
+// SetConfig updates the limits of the WAL. The directory of the WAL can't be
+// changed.
+func (w *WAL) SetConfig(cfg Config) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	cfg.Dir = w.cfg.Dir
+	w.cfg = cfg
+}
+
+// NextID returns the ID which will be given to the next logged entry. IDs are
+// given in sequence, including to entries which failed to be logged.
+func (w *WAL) NextID() uint64 {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.nextID
+}
+
+// Log appends an entry to the WAL, and returns the ID it was given. The ID is
+// returned even if logging the entry failed.
+func (w *WAL) Log(e loki.Entry) (uint64, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.log(e)
+}
+
+// log appends an entry and the given extra records to the WAL. w.mut must be
+// held.
+func (w *WAL) log(e loki.Entry, extra ...[]byte) (uint64, error) {
+	id := w.nextID
+	w.nextID++
+	if w.closed {
+		return id, ErrClosed
+	}
+
+	w.buf = encodeEntry(id, e, w.buf[:0])
+	if err := w.wl.Log(append([][]byte{w.buf}, extra...)...); err != nil {
+		return id, err
+	}
+	w.metrics.appendedEntries.Inc()
+
+	// Records never span segments, so the entry is in the last one.
+	segment, _, err := w.wl.LastSegmentAndOffset()
+	if err != nil {
+		return id, err
+	}
+	w.segmentByID[id] = segment
+	w.unacked[segment]++
+	return id, nil
+}
+
+// Ack acknowledges that the entries with the given IDs have been delivered,
+// so that they aren't replayed and their segments can be removed.
+func (w *WAL) Ack(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+
+	if err := w.wl.Log(encodeAck(ids, nil)); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		segment, ok := w.segmentByID[id]
+		if !ok {
+			continue
+		}
+		delete(w.segmentByID, id)
+		if w.unacked[segment]--; w.unacked[segment] <= 0 {
+			delete(w.unacked, segment)
+		}
+	}
+	return nil
+}
+
+// Replay calls fn for every entry of the segments which existed when the WAL
+// was opened and which wasn't acknowledged, stopping early if fn returns
+// false. Before fn is called, the entry is logged again with a new ID, which
+// is passed to fn and must be acknowledged instead of the original one.
+// Corrupted segments are skipped. Replay does nothing once a replay has run to
+// completion.
+func (w *WAL) Replay(fn func(id uint64, e loki.Entry) bool) error {
+	w.mut.Lock()
+	first, last, replayed := w.replayFirst, w.replayLast, w.replayed
+	w.mut.Unlock()
+
+	if replayed || first < 0 {
+		w.metrics.replayProgress.Set(1)
+		w.markReplayed()
+		return nil
+	}
+
+	w.metrics.replayProgress.Set(0)
+	level.Info(w.logger).Log("msg", "replaying WAL", "first_segment", first, "last_segment", last)
+
+	for i := first; i <= last; i++ {
+		if !w.replaySegment(i, fn) {
+			level.Info(w.logger).Log("msg", "WAL replay interrupted", "segment", i)
+			return nil
+		}
+		w.metrics.replayProgress.Set(float64(i-first+1) / float64(last-first+1))
+	}
+
+	level.Info(w.logger).Log("msg", "WAL replay completed")
+	w.markReplayed()
+	return nil
+}
+
+// replaySegment replays a single segment, and returns false if fn asked to
+// stop.
+func (w *WAL) replaySegment(i int, fn func(id uint64, e loki.Entry) bool) bool {
+	return w.readSegment(i, func(rec []byte) bool {
+		if getRecordType(rec) != recordTypeEntry {
+			return true
+		}
+		oldID, e, err := decodeEntry(rec)
+		if err != nil {
+			level.Warn(w.logger).Log("msg", "failed to decode WAL record, skipping it", "segment", i, "err", err)
+			return true
+		}
+
+		id, ok, err := w.relog(oldID, e)
+		if err != nil {
+			level.Error(w.logger).Log("msg", "failed to log replayed entry to the WAL", "segment", i, "err", err)
+		}
+		if !ok {
+			return true
+		}
+		w.metrics.replayedEntries.Inc()
+		return fn(id, e)
+	})
+}
+
+// relog logs again an entry with the given ID from the segments to replay,
+// along with the acknowledgement of its original ID. It returns false if the
+// entry was acknowledged already and must not be replayed.
+func (w *WAL) relog(oldID uint64, e loki.Entry) (uint64, bool, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if _, acked := w.replayAcked[oldID]; acked {
+		return 0, false, nil
+	}
+	w.replayAcked[oldID] = struct{}{}
+
+	id, err := w.log(e, encodeAck([]uint64{oldID}, nil))
+	return id, true, err
+}
+
+func (w *WAL) markReplayed() {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.replayed = true
+	w.replayAcked = nil
+}
+
+// truncate starts a new segment and removes the oldest segments whose entries
+// have all been acknowledged, which are older than the maximum segment age,
+// or which make the WAL exceed its maximum size. Segments which are still to
+// be replayed are never removed.
+func (w *WAL) truncate(now time.Time) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.closed {
+		return nil
+	}
+	defer w.updateSize()
+
+	// Close the active segment, so that the entries written since the last
+	// truncation can age out.
+	if _, offset, err := w.wl.LastSegmentAndOffset(); err != nil {
+		return err
+	} else if offset > 0 {
+		if _, err := w.wl.NextSegment(); err != nil {
+			return err
+		}
+	}
+
+	first, last, err := wlog.Segments(w.cfg.Dir)
+	if err != nil || first < 0 {
+		return err
+	}
+
+	type segment struct {
+		size    int64
+		modTime time.Time
+	}
+	var (
+		segments = make([]segment, 0, last-first+1)
+		total    int64
+	)
+	for i := first; i <= last; i++ {
+		fi, err := os.Stat(wlog.SegmentName(w.cfg.Dir, i))
+		if err != nil {
+			return err
+		}
+		segments = append(segments, segment{size: fi.Size(), modTime: fi.ModTime()})
+		total += fi.Size()
+	}
+
+	// The last segment is the active one and is always kept. Acknowledgements
+	// may refer to entries of older segments, so only the oldest segments are
+	// removed.
+	cut := first
+	for i := first; i < last; i++ {
+		if !w.replayed && i <= w.replayLast {
+			break
+		}
+		s := segments[i-first]
+		delivered := w.unacked[i] == 0
+		tooOld := w.cfg.MaxSegmentAge > 0 && now.Sub(s.modTime) > w.cfg.MaxSegmentAge
+		tooBig := w.cfg.MaxSize > 0 && total > w.cfg.MaxSize
+		if !delivered && !tooOld && !tooBig {
+			break
+		}
+		if !delivered {
+			if tooBig && !tooOld {
+				level.Warn(w.logger).Log("msg", "WAL exceeds its maximum size, removing oldest segment", "segment", i, "size", total, "max_size", w.cfg.MaxSize)
+			}
+			w.metrics.removedSegments.Inc()
+		}
+		total -= s.size
+		cut = i + 1
+	}
+	if cut == first {
+		return nil
+	}
+
+	if err := w.wl.Truncate(cut); err != nil {
+		return err
+	}
+	for id, segment := range w.segmentByID {
+		if segment < cut {
+			delete(w.segmentByID, id)
+		}
+	}
+	for segment := range w.unacked {
+		if segment < cut {
+			delete(w.unacked, segment)
+		}
+	}
+	return nil
+}
+
+// Close closes the WAL, removing the oldest segments whose entries have all
+// been acknowledged. Entries which haven't been acknowledged are kept on disk
+// and replayed the next time the WAL is opened.
+func (w *WAL) Close() error {
+	if err := w.truncate(time.Now()); err != nil {
+		level.Warn(w.logger).Log("msg", "failed to truncate WAL", "err", err)
+	}
+
+	w.mut.Lock()
+	if w.closed {
+		w.mut.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mut.Unlock()
+
+	close(w.quit)
+	<-w.done
+	return w.wl.Close()
+}
+
+// updateSize refreshes the WAL size metric. w.mut must be held.
+func (w *WAL) updateSize() {
+	size, err := w.wl.Size()
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to compute WAL size", "err", err)
+		return
+	}
+	w.metrics.size.Set(float64(size))
+}
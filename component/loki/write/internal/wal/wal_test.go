@@ -0,0 +1,318 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryRecord(t *testing.T) {
+	entry := loki.Entry{
+		Labels: model.LabelSet{"job": "test", "filename": "/var/log/app.log"},
+		Entry: logproto.Entry{
+			Timestamp: time.Unix(1, 2),
+			Line:      "some log line",
+		},
+	}
+
+	id, decoded, err := decodeEntry(encodeEntry(42, entry, nil))
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), id)
+	require.Equal(t, entry.Labels, decoded.Labels)
+	require.Equal(t, entry.Line, decoded.Line)
+	require.True(t, entry.Timestamp.Equal(decoded.Timestamp))
+
+	_, _, err = decodeEntry([]byte{0xff})
+	require.ErrorIs(t, err, errUnknownRecordType)
+
+	rec := encodeEntry(42, entry, nil)
+	_, _, err = decodeEntry(rec[:len(rec)-1])
+	require.Error(t, err)
+}
+
+func TestAckRecord(t *testing.T) {
+	ids := []uint64{1, 300, 70000}
+	rec := encodeAck(ids, nil)
+	require.Equal(t, recordTypeAck, getRecordType(rec))
+
+	decoded, err := decodeAck(rec)
+	require.NoError(t, err)
+	require.Equal(t, ids, decoded)
+
+	_, err = decodeAck(encodeEntry(1, testEntries(1)[0], nil))
+	require.ErrorIs(t, err, errUnknownRecordType)
+
+	_, err = decodeAck(rec[:len(rec)-1])
+	require.Error(t, err)
+}
+
+func TestWAL_Replay(t *testing.T) {
+	dir := t.TempDir()
+	entries := testEntries(10)
+
+	w := newTestWAL(t, Config{Dir: dir})
+	require.NoError(t, w.Replay(func(uint64, loki.Entry) bool {
+		require.FailNow(t, "a new WAL has nothing to replay")
+		return true
+	}))
+	for i, e := range entries {
+		id, err := w.Log(e)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), id)
+	}
+	require.NoError(t, w.Close())
+	_, err := w.Log(entries[0])
+	require.ErrorIs(t, err, ErrClosed)
+
+	// Reopening the WAL replays the entries, only once, with new IDs.
+	metrics := NewMetrics(prometheus.NewRegistry())
+	w, err = New(Config{Dir: dir}, metrics, util.TestLogger(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	require.Equal(t, uint64(len(entries)), w.NextID())
+
+	var (
+		replayed    []loki.Entry
+		replayedIDs []uint64
+	)
+	require.NoError(t, w.Replay(func(id uint64, e loki.Entry) bool {
+		replayed = append(replayed, e)
+		replayedIDs = append(replayedIDs, id)
+		return true
+	}))
+	requireEntries(t, entries, replayed)
+	require.Equal(t, uint64(len(entries)), replayedIDs[0])
+	require.Equal(t, 10.0, testutil.ToFloat64(metrics.replayedEntries))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.replayProgress))
+
+	require.NoError(t, w.Replay(func(uint64, loki.Entry) bool {
+		require.FailNow(t, "entries must only be replayed once")
+		return true
+	}))
+
+	// Only the replayed entries which weren't acknowledged are replayed
+	// again.
+	require.NoError(t, w.Ack(replayedIDs[:8]))
+	require.NoError(t, w.Close())
+
+	w = newTestWAL(t, Config{Dir: dir})
+	replayed = nil
+	require.NoError(t, w.Replay(func(_ uint64, e loki.Entry) bool {
+		replayed = append(replayed, e)
+		return true
+	}))
+	requireEntries(t, entries[8:], replayed)
+}
+
+func TestWAL_Ack(t *testing.T) {
+	dir := t.TempDir()
+	entries := testEntries(10)
+
+	w := newTestWAL(t, Config{Dir: dir})
+	require.NoError(t, w.Replay(func(uint64, loki.Entry) bool { return true }))
+
+	// Entries are acknowledged out of order, as batches of different tenants
+	// are sent independently.
+	var ids []uint64
+	for _, e := range entries {
+		id, err := w.Log(e)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, w.Ack([]uint64{ids[1], ids[3], ids[5], ids[7], ids[9]}))
+	require.NoError(t, w.Ack([]uint64{ids[0], ids[4]}))
+
+	// The segment holding undelivered entries is kept.
+	require.NoError(t, w.truncate(time.Now()))
+	require.Equal(t, 2, segmentCount(t, dir))
+	require.NoError(t, w.Close())
+
+	w = newTestWAL(t, Config{Dir: dir})
+	var replayed []loki.Entry
+	require.NoError(t, w.Replay(func(_ uint64, e loki.Entry) bool {
+		replayed = append(replayed, e)
+		return true
+	}))
+	requireEntries(t, []loki.Entry{entries[2], entries[6], entries[8]}, replayed)
+
+	// Once replayed, the entries are only kept in the active segment. New
+	// entries aren't given the IDs of entries from previous runs.
+	require.NoError(t, w.truncate(time.Now()))
+	require.Equal(t, 2, segmentCount(t, dir))
+	id, err := w.Log(entries[0])
+	require.NoError(t, err)
+	require.Greater(t, id, ids[9]+3)
+
+	// Segments are removed once all their entries have been acknowledged.
+	require.NoError(t, w.Ack([]uint64{ids[9] + 1, ids[9] + 2, ids[9] + 3, id}))
+	require.NoError(t, w.truncate(time.Now()))
+	require.Equal(t, 1, segmentCount(t, dir))
+	require.NoError(t, w.Close())
+
+	w = newTestWAL(t, Config{Dir: dir})
+	require.NoError(t, w.Replay(func(uint64, loki.Entry) bool {
+		require.FailNow(t, "all entries were acknowledged")
+		return true
+	}))
+}
+
+func TestWAL_InterruptedReplay(t *testing.T) {
+	dir := t.TempDir()
+	entries := testEntries(10)
+
+	w := newTestWAL(t, Config{Dir: dir})
+	for _, e := range entries {
+		_, err := w.Log(e)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	w = newTestWAL(t, Config{Dir: dir, MaxSegmentAge: time.Minute})
+	var replayed int
+	require.NoError(t, w.Replay(func(uint64, loki.Entry) bool {
+		replayed++
+		return replayed < 5
+	}))
+	require.Equal(t, 5, replayed)
+
+	// Segments which weren't fully replayed aren't truncated.
+	require.NoError(t, w.truncate(time.Now().Add(time.Hour)))
+	require.NoError(t, w.Close())
+
+	// The entries which were replayed, but not acknowledged, are replayed
+	// again along with the others.
+	w = newTestWAL(t, Config{Dir: dir})
+	var replayedEntries []loki.Entry
+	require.NoError(t, w.Replay(func(_ uint64, e loki.Entry) bool {
+		replayedEntries = append(replayedEntries, e)
+		return true
+	}))
+	requireEntries(t, entries, sortEntries(replayedEntries))
+}
+
+func TestWAL_Truncate(t *testing.T) {
+	t.Run("max segment age", func(t *testing.T) {
+		dir := t.TempDir()
+		metrics := NewMetrics(prometheus.NewRegistry())
+		w, err := New(Config{Dir: dir, MaxSegmentAge: time.Hour}, metrics, util.TestLogger(t))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = w.Close() })
+		require.NoError(t, w.Replay(func(uint64, loki.Entry) bool { return true }))
+
+		// Every truncation starts a new segment if the active one was written
+		// to.
+		for i := 0; i < 3; i++ {
+			_, err := w.Log(testEntries(1)[0])
+			require.NoError(t, err)
+			require.NoError(t, w.truncate(time.Now()))
+		}
+		require.Equal(t, 4, segmentCount(t, dir))
+		require.Equal(t, 0.0, testutil.ToFloat64(metrics.removedSegments))
+
+		// Once they're old enough, all segments but the active one are
+		// removed.
+		require.NoError(t, w.truncate(time.Now().Add(2*time.Hour)))
+		require.Equal(t, 1, segmentCount(t, dir))
+		require.Equal(t, 3.0, testutil.ToFloat64(metrics.removedSegments))
+
+		size, err := w.wl.Size()
+		require.NoError(t, err)
+		require.Equal(t, float64(size), testutil.ToFloat64(metrics.size))
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		dir := t.TempDir()
+		w := newTestWAL(t, Config{Dir: dir})
+		require.NoError(t, w.Replay(func(uint64, loki.Entry) bool { return true }))
+
+		for i := 0; i < 3; i++ {
+			for _, e := range testEntries(100) {
+				_, err := w.Log(e)
+				require.NoError(t, err)
+			}
+			require.NoError(t, w.truncate(time.Now()))
+		}
+		require.Equal(t, 4, segmentCount(t, dir))
+
+		// The oldest segments are removed until the WAL fits, but the active
+		// segment is always kept.
+		size, err := w.wl.Size()
+		require.NoError(t, err)
+		w.SetConfig(Config{MaxSize: size - 1})
+		require.NoError(t, w.truncate(time.Now()))
+		require.Equal(t, 3, segmentCount(t, dir))
+		require.Equal(t, dir, w.cfg.Dir)
+
+		w.SetConfig(Config{MaxSize: 1})
+		require.NoError(t, w.truncate(time.Now()))
+		require.Equal(t, 1, segmentCount(t, dir))
+	})
+}
+
+func newTestWAL(t *testing.T, cfg Config) *WAL {
+	t.Helper()
+
+	w, err := New(cfg, NewMetrics(nil), util.TestLogger(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func testEntries(n int) []loki.Entry {
+	entries := make([]loki.Entry, 0, n)
+	for i := 0; i < n; i++ {
+		entries = append(entries, loki.Entry{
+			Labels: model.LabelSet{"job": "test", "stream": model.LabelValue(fmt.Sprint(i % 2))},
+			Entry: logproto.Entry{
+				Timestamp: time.Unix(int64(i), 0),
+				Line:      fmt.Sprintf("line %d", i),
+			},
+		})
+	}
+	return entries
+}
+
+func requireEntries(t *testing.T, expected, actual []loki.Entry) {
+	t.Helper()
+
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.Equal(t, expected[i].Labels, actual[i].Labels)
+		require.Equal(t, expected[i].Line, actual[i].Line)
+		require.True(t, expected[i].Timestamp.Equal(actual[i].Timestamp))
+	}
+}
+
+// sortEntries sorts entries by timestamp.
+func sortEntries(entries []loki.Entry) []loki.Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
+
+func segmentCount(t *testing.T, dir string) int {
+	t.Helper()
+
+	first, last, err := wlog.Segments(dir)
+	require.NoError(t, err)
+	if first < 0 {
+		return 0
+	}
+	for i := first; i <= last; i++ {
+		_, err := os.Stat(wlog.SegmentName(dir, i))
+		require.NoError(t, err)
+	}
+	return last - first + 1
+}
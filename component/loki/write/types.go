@@ -3,11 +3,13 @@ package write
 import (
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/alecthomas/units"
 	types "github.com/grafana/agent/component/common/config"
 	"github.com/grafana/agent/component/loki/write/internal/client"
+	"github.com/grafana/agent/component/loki/write/internal/wal"
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/flagext"
 	lokiflagext "github.com/grafana/loki/pkg/util/flagext"
@@ -58,6 +60,39 @@ func (r *EndpointOptions) UnmarshalRiver(f func(v interface{}) error) error {
 	return nil
 }
 
+// WALArguments configures the write-ahead log of the component.
+type WALArguments struct {
+	Enabled       bool             `river:"enabled,attr,optional"`
+	MaxSize       units.Base2Bytes `river:"max_size,attr,optional"`
+	MaxSegmentAge time.Duration    `river:"max_segment_age,attr,optional"`
+}
+
+// DefaultWALArguments defines the default settings of the write-ahead log.
+var DefaultWALArguments = WALArguments{
+	Enabled:       false,
+	MaxSize:       1 * units.GiB,
+	MaxSegmentAge: 1 * time.Hour,
+}
+
+// UnmarshalRiver implements river.Unmarshaler.
+func (r *WALArguments) UnmarshalRiver(f func(v interface{}) error) error {
+	*r = DefaultWALArguments
+
+	type arguments WALArguments
+	if err := f((*arguments)(r)); err != nil {
+		return err
+	}
+
+	if r.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative, got %s", r.MaxSize)
+	}
+	if r.MaxSegmentAge < 0 {
+		return fmt.Errorf("max_segment_age must not be negative, got %s", r.MaxSegmentAge)
+	}
+
+	return nil
+}
+
 func (args Arguments) convertClientConfigs() []client.Config {
 	var res []client.Config
 	for _, cfg := range args.Endpoints {
@@ -83,6 +118,14 @@ func (args Arguments) convertClientConfigs() []client.Config {
 	return res
 }
 
+func (args Arguments) convertWALConfig(dataPath string) wal.Config {
+	return wal.Config{
+		Dir:           filepath.Join(dataPath, "wal"),
+		MaxSize:       int64(args.WAL.MaxSize),
+		MaxSegmentAge: args.WAL.MaxSegmentAge,
+	}
+}
+
 func toLabelSet(in map[string]string) model.LabelSet {
 	res := make(model.LabelSet, len(in))
 	for k, v := range in {
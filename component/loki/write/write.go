@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/loki/write/internal/client"
+	"github.com/grafana/agent/component/loki/write/internal/wal"
 	"github.com/grafana/agent/pkg/build"
 )
 
@@ -32,6 +35,7 @@ type Arguments struct {
 	Endpoints      []EndpointOptions `river:"endpoint,block,optional"`
 	ExternalLabels map[string]string `river:"external_labels,attr,optional"`
 	MaxStreams     int               `river:"max_streams,attr,optional"`
+	WAL            WALArguments      `river:"wal,block,optional"`
 }
 
 // Exports holds the receiver that is used to send log entries to the
@@ -46,20 +50,29 @@ var (
 
 // Component implements the loki.write component.
 type Component struct {
-	opts    component.Options
-	metrics *client.Metrics
+	opts       component.Options
+	metrics    *client.Metrics
+	walMetrics *wal.Metrics
+
+	// replay is signaled when a WAL is opened, so that Run replays the
+	// entries which it holds from a previous run.
+	replay chan struct{}
 
 	mut      sync.RWMutex
 	args     Arguments
 	receiver loki.LogsReceiver
 	clients  []client.Client
+	wal      *wal.WAL
+	tracker  *deliveryTracker
 }
 
 // New creates a new loki.write component.
 func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
-		opts:    o,
-		metrics: client.NewMetrics(o.Registerer, streamLagLabels),
+		opts:       o,
+		metrics:    client.NewMetrics(o.Registerer, streamLagLabels),
+		walMetrics: wal.NewMetrics(o.Registerer),
+		replay:     make(chan struct{}, 1),
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -77,23 +90,102 @@ func New(o component.Options, args Arguments) (*Component, error) {
 
 // Run implements component.Component.
 func (c *Component) Run(ctx context.Context) error {
+	defer c.stop()
+
+	// Replay the WAL before accepting new entries.
+	select {
+	case <-c.replay:
+		c.replayWAL(ctx)
+	default:
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-c.replay:
+			c.replayWAL(ctx)
 		case entry := <-c.receiver:
-			for _, client := range c.clients {
-				if client != nil {
-					select {
-					case <-ctx.Done():
-						return nil
-					case client.Chan() <- entry:
-						// no-op
-					}
+			c.mut.RLock()
+			if c.wal != nil {
+				id, err := c.wal.Log(entry)
+				if err != nil {
+					level.Error(c.opts.Logger).Log("msg", "failed to append entry to the WAL", "err", err)
 				}
+				c.tracker.track(id)
+			}
+			sent := c.send(ctx, entry)
+			c.mut.RUnlock()
+			if !sent {
+				return nil
+			}
+		}
+	}
+}
+
+// send fans out an entry to all clients. It returns false if ctx was
+// canceled before the entry was handed to every client. c.mut must be held.
+func (c *Component) send(ctx context.Context, entry loki.Entry) bool {
+	for _, client := range c.clients {
+		if client != nil {
+			select {
+			case <-ctx.Done():
+				return false
+			case client.Chan() <- entry:
+				// no-op
 			}
 		}
 	}
+	return true
+}
+
+// replayWAL sends the entries left in the WAL by a previous run to the
+// clients. The lock is held for the whole replay so that the clients aren't
+// replaced in the meantime.
+func (c *Component) replayWAL(ctx context.Context) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.wal == nil {
+		return
+	}
+
+	err := c.wal.Replay(func(id uint64, entry loki.Entry) bool {
+		c.tracker.track(id)
+		return c.send(ctx, entry)
+	})
+	if err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to replay WAL", "err", err)
+	}
+}
+
+// stop stops the clients, which flush their pending batches, and then closes
+// the WAL. The entries which the clients failed to deliver are kept in the
+// WAL.
+func (c *Component) stop() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, client := range c.clients {
+		if client != nil {
+			client.Stop()
+		}
+	}
+	c.clients = nil
+
+	c.closeWAL()
+}
+
+// closeWAL closes the WAL, if any. It must only be called once the clients
+// have been stopped, so that the entries they delivered are acknowledged.
+// c.mut must be held.
+func (c *Component) closeWAL() {
+	if c.wal == nil {
+		return
+	}
+	if err := c.wal.Close(); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to close WAL", "err", err)
+	}
+	c.wal, c.tracker = nil, nil
 }
 
 // Update implements component.Component.
@@ -111,16 +203,54 @@ func (c *Component) Update(args component.Arguments) error {
 	}
 	c.clients = make([]client.Client, len(newArgs.Endpoints))
 
+	// The stopped clients have flushed the entries they were handed, and
+	// acknowledged the ones they delivered, so the WAL can be closed if it's
+	// disabled.
+	switch walCfg := newArgs.convertWALConfig(c.opts.DataPath); {
+	case !newArgs.WAL.Enabled:
+		c.closeWAL()
+	case c.wal == nil:
+		w, err := wal.New(walCfg, c.walMetrics, log.With(c.opts.Logger, "subcomponent", "wal"))
+		if err != nil {
+			return err
+		}
+		c.wal = w
+		select {
+		case c.replay <- struct{}{}:
+		default:
+		}
+	default:
+		c.wal.SetConfig(walCfg)
+	}
+
 	cfgs := newArgs.convertClientConfigs()
+
+	// Entries are acknowledged in the WAL once every new client delivered
+	// them. The clients are handed every entry logged to the WAL from now on,
+	// in order, so the index of an entry in a client maps to its WAL ID.
+	var base uint64
+	if c.wal != nil {
+		c.tracker = newDeliveryTracker(c.opts.Logger, c.wal, len(cfgs))
+		base = c.wal.NextID()
+	}
+
 	// TODO (@tpaschalis) We could use a client.NewMulti here to push the
 	// fanout logic back to the client layer, but I opted to keep it explicit
 	// here a) for easier debugging and b) possible improvements in the future.
 	for _, cfg := range cfgs {
-		client, err := client.New(c.metrics, cfg, streamLagLabels, newArgs.MaxStreams, c.opts.Logger)
+		var (
+			cl  client.Client
+			err error
+		)
+		if c.tracker != nil {
+			cl, err = client.NewWithDeliveryHandler(c.metrics, cfg, streamLagLabels, newArgs.MaxStreams, c.opts.Logger, c.tracker.clientHandler(base))
+		} else {
+			cl, err = client.New(c.metrics, cfg, streamLagLabels, newArgs.MaxStreams, c.opts.Logger)
+		}
 		if err != nil {
 			return err
 		}
-		c.clients = append(c.clients, client)
+		c.clients = append(c.clients, cl)
 	}
 
 	return nil
@@ -6,15 +6,19 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/loki/write/internal/wal"
 	"github.com/grafana/agent/pkg/flow/componenttest"
 	"github.com/grafana/agent/pkg/river"
 	"github.com/grafana/agent/pkg/util"
 	"github.com/grafana/loki/pkg/logproto"
 	loki_util "github.com/grafana/loki/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 )
@@ -82,3 +86,205 @@ func Test(t *testing.T) {
 		require.Equal(t, req.Streams[0].Entries[1].Line, logEntry.Line)
 	}
 }
+
+func TestWALReplay(t *testing.T) {
+	// Set up the server that will receive the log entries, and expose them on
+	// ch.
+	ch := make(chan logproto.PushRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pushReq logproto.PushRequest
+		err := loki_util.ParseProtoReader(context.Background(), r.Body, int(r.ContentLength), math.MaxInt32, &pushReq, loki_util.RawSnappy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ch <- pushReq
+	}))
+	defer srv.Close()
+
+	cfg := fmt.Sprintf(`
+		endpoint {
+			url        = "%s"
+			batch_wait = "10ms"
+		}
+
+		wal {
+			enabled = true
+		}
+	`, srv.URL)
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+	require.Equal(t, DefaultWALArguments.MaxSegmentAge, args.WAL.MaxSegmentAge)
+
+	// Leave an entry in the WAL, as if the previous run of the component had
+	// crashed before delivering it.
+	dataPath := t.TempDir()
+	logEntry := loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry: logproto.Entry{
+			Timestamp: time.Now(),
+			Line:      "entry from the previous run",
+		},
+	}
+	w, err := wal.New(args.convertWALConfig(dataPath), wal.NewMetrics(nil), util.TestLogger(t))
+	require.NoError(t, err)
+	_, err = w.Log(logEntry)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	c, err := New(component.Options{
+		ID:            "loki.write.test",
+		Logger:        util.TestLogger(t),
+		DataPath:      dataPath,
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prometheus.NewRegistry(),
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+
+	select {
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "failed waiting for the replayed entry")
+	case req := <-ch:
+		require.Len(t, req.Streams, 1)
+		require.Equal(t, logEntry.Labels.String(), req.Streams[0].Labels)
+		require.Len(t, req.Streams[0].Entries, 1)
+		require.Equal(t, logEntry.Line, req.Streams[0].Entries[0].Line)
+	}
+
+	// New entries are appended to the WAL too, and are acknowledged once
+	// they're delivered, so that nothing is left to replay once the component
+	// exits.
+	logEntry.Line = "entry from the current run"
+	c.receiver <- logEntry
+	select {
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "failed waiting for the new entry")
+	case req := <-ch:
+		require.Equal(t, logEntry.Line, req.Streams[0].Entries[0].Line)
+	}
+	cancel()
+	<-done
+
+	w, err = wal.New(args.convertWALConfig(dataPath), wal.NewMetrics(nil), util.TestLogger(t))
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Replay(func(_ uint64, e loki.Entry) bool {
+		require.FailNow(t, "delivered entries must not be replayed", "entry: %v", e)
+		return true
+	}))
+}
+
+func TestWALEndpointFailure(t *testing.T) {
+	// Set up the server that will receive the log entries, and expose them on
+	// ch. It fails every request while failing is set.
+	var failing atomic.Bool
+	ch := make(chan logproto.PushRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var pushReq logproto.PushRequest
+		err := loki_util.ParseProtoReader(context.Background(), r.Body, int(r.ContentLength), math.MaxInt32, &pushReq, loki_util.RawSnappy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ch <- pushReq
+	}))
+	defer srv.Close()
+
+	cfg := fmt.Sprintf(`
+		endpoint {
+			url                 = "%s"
+			batch_wait          = "10ms"
+			min_backoff_period  = "1ms"
+			max_backoff_period  = "2ms"
+			max_backoff_retries = 2
+		}
+
+		wal {
+			enabled = true
+		}
+	`, srv.URL)
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	dataPath := t.TempDir()
+	start := func() (c *Component, stop func()) {
+		c, err := New(component.Options{
+			ID:            "loki.write.test",
+			Logger:        util.TestLogger(t),
+			DataPath:      dataPath,
+			OnStateChange: func(e component.Exports) {},
+			Registerer:    prometheus.NewRegistry(),
+		}, args)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			require.NoError(t, c.Run(ctx))
+		}()
+		return c, func() {
+			cancel()
+			<-done
+		}
+	}
+	receive := func(line string) {
+		select {
+		case <-time.After(2 * time.Second):
+			require.FailNow(t, "failed waiting for logs", "line: %s", line)
+		case req := <-ch:
+			require.Len(t, req.Streams, 1)
+			require.Len(t, req.Streams[0].Entries, 1)
+			require.Equal(t, line, req.Streams[0].Entries[0].Line)
+		}
+	}
+
+	logEntry := loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry: logproto.Entry{
+			Timestamp: time.Now(),
+			Line:      "delivered before the outage",
+		},
+	}
+	c, stop := start()
+	c.receiver <- logEntry
+	receive(logEntry.Line)
+
+	// The component is stopped during an outage of the endpoint, after giving
+	// up on delivering an entry.
+	failing.Store(true)
+	logEntry.Line = "sent during the outage"
+	c.receiver <- logEntry
+	stop()
+
+	// Once the endpoint recovers, only the entry which wasn't delivered is
+	// replayed.
+	failing.Store(false)
+	_, stop = start()
+	receive(logEntry.Line)
+	select {
+	case req := <-ch:
+		require.FailNow(t, "delivered entries must not be replayed", "request: %v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+	stop()
+
+	w, err := wal.New(args.convertWALConfig(dataPath), wal.NewMetrics(nil), util.TestLogger(t))
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Replay(func(_ uint64, e loki.Entry) bool {
+		require.FailNow(t, "delivered entries must not be replayed", "entry: %v", e)
+		return true
+	}))
+}
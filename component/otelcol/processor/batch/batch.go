@@ -2,13 +2,13 @@
 package batch
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/otelcol"
 	"github.com/grafana/agent/component/otelcol/processor"
 	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/diag"
 	otelcomponent "go.opentelemetry.io/collector/component"
 	otelconfig "go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/processor/batchprocessor"
@@ -59,7 +59,7 @@ func (args *Arguments) UnmarshalRiver(f func(interface{}) error) error {
 	}
 
 	if args.SendBatchMaxSize > 0 && args.SendBatchMaxSize < args.SendBatchSize {
-		return fmt.Errorf("send_batch_max_size must be greater or equal to send_batch_size when not 0")
+		return diag.AttributeErrorf("send_batch_max_size", "must be greater or equal to send_batch_size when not 0")
 	}
 	return nil
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/grafana/agent/component/otelcol"
 	"github.com/grafana/agent/component/otelcol/processor"
 	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/diag"
 	otelcomponent "go.opentelemetry.io/collector/component"
 	otelconfig "go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/processor/memorylimiterprocessor"
@@ -30,11 +31,11 @@ func init() {
 
 // Arguments configures the otelcol.processor.memory_limiter component.
 type Arguments struct {
-	CheckInterval         time.Duration    `river:"check_interval,attr"`
-	MemoryLimit           units.Base2Bytes `river:"limit,attr,optional"`
-	MemorySpikeLimit      units.Base2Bytes `river:"spike_limit,attr,optional"`
-	MemoryLimitPercentage uint32           `river:"limit_percentage,attr,optional"`
-	MemorySpikePercentage uint32           `river:"spike_limit_percentage,attr,optional"`
+	CheckInterval         time.Duration    `river:"check_interval,attr" validate:"gt=0s"`
+	MemoryLimit           units.Base2Bytes `river:"limit,attr,optional" validate:"min=0"`
+	MemorySpikeLimit      units.Base2Bytes `river:"spike_limit,attr,optional" validate:"min=0"`
+	MemoryLimitPercentage uint32           `river:"limit_percentage,attr,optional" validate:"max=100"`
+	MemorySpikePercentage uint32           `river:"spike_limit_percentage,attr,optional" validate:"max=100"`
 
 	// Output configures where to send processed data. Required.
 	Output *otelcol.ConsumerArguments `river:"output,block"`
@@ -64,30 +65,22 @@ func (args *Arguments) UnmarshalRiver(f func(interface{}) error) error {
 		return err
 	}
 
-	if args.CheckInterval <= 0 {
-		return fmt.Errorf("check_interval must me greater than zero")
-	}
-
-	if args.MemoryLimit > 0 && args.MemoryLimitPercentage > 0 {
-		return fmt.Errorf("either limit or limit_percentage must be set, but not both")
-	}
-
-	if args.MemoryLimit > 0 {
+	// Either limit may be explicitly set to zero next to the other one, so
+	// they're only exclusive when both are set to greater than zero.
+	switch {
+	case args.MemoryLimit > 0 && args.MemoryLimitPercentage > 0:
+		return diag.AttributeErrorf("limit_percentage", "must not be set together with limit")
+	case args.MemoryLimit > 0:
 		if args.MemorySpikeLimit >= args.MemoryLimit {
-			return fmt.Errorf("spike_limit must be less than limit")
+			return diag.AttributeErrorf("spike_limit", "must be less than limit")
 		}
 		if args.MemorySpikeLimit == 0 {
 			args.MemorySpikeLimit = args.MemoryLimit / 5
 		}
 		return nil
-	}
-	if args.MemoryLimitPercentage > 0 {
-		if args.MemoryLimitPercentage <= 0 ||
-			args.MemoryLimitPercentage > 100 ||
-			args.MemorySpikePercentage <= 0 ||
-			args.MemorySpikePercentage > 100 {
-
-			return fmt.Errorf("limit_percentage and spike_limit_percentage must be greater than 0 and and less or equal than 100")
+	case args.MemoryLimitPercentage > 0:
+		if args.MemorySpikePercentage == 0 {
+			return diag.AttributeErrorf("spike_limit_percentage", "must be set when limit_percentage is set")
 		}
 		return nil
 	}
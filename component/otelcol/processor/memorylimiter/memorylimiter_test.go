@@ -79,6 +79,73 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestArguments(t *testing.T) {
+	tt := []struct {
+		name      string
+		cfg       string
+		expectErr string
+	}{
+		{
+			name: "limit",
+			cfg: `
+				check_interval = "1s"
+				limit          = "20MiB"
+				output {}
+			`,
+		},
+		{
+			name: "limit_percentage with explicit zero limit",
+			cfg: `
+				check_interval         = "1s"
+				limit                  = 0
+				limit_percentage       = 50
+				spike_limit_percentage = 20
+				output {}
+			`,
+		},
+		{
+			name: "limit with explicit zero limit_percentage",
+			cfg: `
+				check_interval         = "1s"
+				limit                  = "20MiB"
+				limit_percentage       = 0
+				spike_limit_percentage = 0
+				output {}
+			`,
+		},
+		{
+			name: "both limits",
+			cfg: `
+				check_interval   = "1s"
+				limit            = "20MiB"
+				limit_percentage = 50
+				output {}
+			`,
+			expectErr: `attribute "limit_percentage" must not be set together with limit`,
+		},
+		{
+			name: "no limit",
+			cfg: `
+				check_interval = "1s"
+				output {}
+			`,
+			expectErr: "either limit or limit_percentage must be set to greater than zero",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var args memorylimiter.Arguments
+			err := river.Unmarshal([]byte(tc.cfg), &args)
+			if tc.expectErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectErr)
+			}
+		})
+	}
+}
+
 // makeTracesOutput returns ConsumerArguments which will forward traces to the
 // provided channel.
 func makeTracesOutput(ch chan ptrace.Traces) *otelcol.ConsumerArguments {
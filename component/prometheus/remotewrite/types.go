@@ -13,6 +13,7 @@ import (
 
 	types "github.com/grafana/agent/component/common/config"
 	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/diag"
 	common "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 )
@@ -159,7 +160,7 @@ func (o *MetadataOptions) toPrometheusType() config.MetadataConfig {
 
 // WALOptions configures behavior within the WAL.
 type WALOptions struct {
-	TruncateFrequency time.Duration `river:"truncate_frequency,attr,optional"`
+	TruncateFrequency time.Duration `river:"truncate_frequency,attr,optional" validate:"gt=0s"`
 	MinKeepaliveTime  time.Duration `river:"min_keepalive_time,attr,optional"`
 	MaxKeepaliveTime  time.Duration `river:"max_keepalive_time,attr,optional"`
 }
@@ -173,13 +174,9 @@ func (o *WALOptions) UnmarshalRiver(f func(interface{}) error) error {
 		return err
 	}
 
-	switch {
-	case o.TruncateFrequency == 0:
-		return fmt.Errorf("truncate_frequency must not be 0")
-	case o.MaxKeepaliveTime <= o.MinKeepaliveTime:
-		return fmt.Errorf("min_keepalive_time must be smaller than max_keepalive_time")
+	if o.MaxKeepaliveTime <= o.MinKeepaliveTime {
+		return diag.AttributeErrorf("min_keepalive_time", "must be smaller than max_keepalive_time")
 	}
-
 	return nil
 }
 
@@ -1,7 +1,6 @@
 package s3
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/grafana/agent/pkg/river"
@@ -16,7 +15,7 @@ type Arguments struct {
 	Path string `river:"path,attr"`
 	// PollFrequency determines the frequency to check for changes
 	// defaults to 10m.
-	PollFrequency time.Duration `river:"poll_frequency,attr,optional"`
+	PollFrequency time.Duration `river:"poll_frequency,attr,optional" validate:"gt=30s"`
 	// IsSecret determines if the content should be displayed to the user.
 	IsSecret bool `river:"is_secret,attr,optional"`
 	// Options allows the overriding of default settings.
@@ -33,8 +32,6 @@ type ClientOptions struct {
 	Region       string            `river:"region,attr,optional"`
 }
 
-const minimumPollFrequency = 30 * time.Second
-
 // DefaultArguments sets the poll frequency
 var DefaultArguments = Arguments{
 	PollFrequency: 10 * time.Minute,
@@ -44,14 +41,7 @@ var DefaultArguments = Arguments{
 func (a *Arguments) UnmarshalRiver(f func(v interface{}) error) error {
 	*a = DefaultArguments
 	type arguments Arguments
-	err := f((*arguments)(a))
-	if err != nil {
-		return err
-	}
-	if a.PollFrequency <= minimumPollFrequency {
-		return fmt.Errorf("poll_frequency must be greater than 30s")
-	}
-	return nil
+	return f((*arguments)(a))
 }
 
 // Exports implements the file content
@@ -0,0 +1,54 @@
+// Package converter exposes utilities to convert config files from other
+// programs to Grafana Agent Flow configurations.
+package converter
+
+import (
+	"fmt"
+
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/prometheusconvert"
+	"github.com/grafana/agent/converter/internal/promtailconvert"
+	"github.com/grafana/agent/converter/internal/staticconvert"
+)
+
+// Input represents the type of config file being fed into the converter.
+type Input string
+
+const (
+	// InputPrometheus indicates that the input file is a Prometheus YAML file.
+	InputPrometheus Input = "prometheus"
+	// InputPromtail indicates that the input file is a Promtail YAML file.
+	InputPromtail Input = "promtail"
+	// InputStatic indicates that the input file is a Grafana Agent static
+	// mode YAML file.
+	InputStatic Input = "static"
+)
+
+// SupportedFormats returns the list of formats which can be passed to Convert.
+var SupportedFormats = []string{
+	string(InputPrometheus),
+	string(InputPromtail),
+	string(InputStatic),
+}
+
+// Convert generates a Grafana Agent Flow config given an input configuration
+// file.
+//
+// Conversions are made as literally as possible, so the resulting config file
+// is unlikely to be idiomatic. Conversions which can't be made are reported
+// as diagnostics alongside the output. The output is only nil when a
+// diagnostic of severity diag.SeverityLevelCritical is reported.
+func Convert(in []byte, kind Input) ([]byte, diag.Diagnostics) {
+	switch kind {
+	case InputPrometheus:
+		return prometheusconvert.Convert(in)
+	case InputPromtail:
+		return promtailconvert.Convert(in)
+	case InputStatic:
+		return staticconvert.Convert(in)
+	}
+
+	var diags diag.Diagnostics
+	diags.Add(diag.SeverityLevelCritical, fmt.Sprintf("unrecognized kind of input %q", kind))
+	return nil, diags
+}
@@ -0,0 +1,91 @@
+// Package diag exposes diagnostics reported while converting configuration
+// files.
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity denotes the severity level of a diagnostic.
+type Severity int
+
+// Supported severity levels. Conversions which report a diagnostic at
+// SeverityLevelError or higher didn't preserve the meaning of the input.
+const (
+	// SeverityLevelInfo is used for informational diagnostics, such as
+	// defaults which changed between formats.
+	SeverityLevelInfo Severity = iota
+	// SeverityLevelWarn is used when the input was converted, but the
+	// converted output may behave differently.
+	SeverityLevelWarn
+	// SeverityLevelError is used when part of the input couldn't be
+	// converted.
+	SeverityLevelError
+	// SeverityLevelCritical is used when the input couldn't be converted at
+	// all.
+	SeverityLevelCritical
+)
+
+// String returns the name of the severity level.
+func (s Severity) String() string {
+	switch s {
+	case SeverityLevelInfo:
+		return "Info"
+	case SeverityLevelWarn:
+		return "Warning"
+	case SeverityLevelError:
+		return "Error"
+	case SeverityLevelCritical:
+		return "Critical"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is an individual diagnostic message.
+type Diagnostic struct {
+	Severity Severity
+	Summary  string
+}
+
+// Error implements error.
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("(%s) %s", d.Severity, d.Summary)
+}
+
+// Diagnostics is a collection of diagnostic messages.
+type Diagnostics []Diagnostic
+
+// Add adds a new diagnostic.
+func (ds *Diagnostics) Add(severity Severity, summary string) {
+	*ds = append(*ds, Diagnostic{Severity: severity, Summary: summary})
+}
+
+// AddAll adds all diagnostics from other.
+func (ds *Diagnostics) AddAll(other Diagnostics) {
+	*ds = append(*ds, other...)
+}
+
+// Error implements error.
+func (ds Diagnostics) Error() string {
+	var sb strings.Builder
+	for ix, diag := range ds {
+		if ix > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(diag.Error())
+	}
+	return sb.String()
+}
+
+// HasSeverity returns true if any diagnostic has a severity of at least
+// severity.
+func (ds Diagnostics) HasSeverity(severity Severity) bool {
+	for _, diag := range ds {
+		if diag.Severity >= severity {
+			return true
+		}
+	}
+	return false
+}
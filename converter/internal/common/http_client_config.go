@@ -0,0 +1,89 @@
+package common
+
+import (
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/pkg/flow/rivertypes"
+	prom_config "github.com/prometheus/common/config"
+)
+
+// ToHTTPClientConfig converts a Prometheus HTTP client config into its
+// River equivalent.
+func ToHTTPClientConfig(httpClientConfig *prom_config.HTTPClientConfig) *config.HTTPClientConfig {
+	if httpClientConfig == nil {
+		return nil
+	}
+
+	return &config.HTTPClientConfig{
+		BasicAuth:       toBasicAuth(httpClientConfig.BasicAuth),
+		Authorization:   toAuthorization(httpClientConfig.Authorization),
+		OAuth2:          toOAuth2(httpClientConfig.OAuth2),
+		BearerToken:     rivertypes.Secret(httpClientConfig.BearerToken),
+		BearerTokenFile: httpClientConfig.BearerTokenFile,
+		ProxyURL:        config.URL{URL: httpClientConfig.ProxyURL.URL},
+		TLSConfig:       *ToTLSConfig(&httpClientConfig.TLSConfig),
+		FollowRedirects: httpClientConfig.FollowRedirects,
+		EnableHTTP2:     httpClientConfig.EnableHTTP2,
+	}
+}
+
+func toBasicAuth(basicAuth *prom_config.BasicAuth) *config.BasicAuth {
+	if basicAuth == nil {
+		return nil
+	}
+
+	return &config.BasicAuth{
+		Username:     basicAuth.Username,
+		Password:     rivertypes.Secret(basicAuth.Password),
+		PasswordFile: basicAuth.PasswordFile,
+	}
+}
+
+func toAuthorization(authorization *prom_config.Authorization) *config.Authorization {
+	if authorization == nil {
+		return nil
+	}
+
+	return &config.Authorization{
+		Type:            authorization.Type,
+		Credentials:     rivertypes.Secret(authorization.Credentials),
+		CredentialsFile: authorization.CredentialsFile,
+	}
+}
+
+func toOAuth2(oauth2 *prom_config.OAuth2) *config.OAuth2Config {
+	if oauth2 == nil {
+		return nil
+	}
+
+	var tlsConfig *config.TLSConfig
+	if oauth2.TLSConfig != (prom_config.TLSConfig{}) {
+		tlsConfig = ToTLSConfig(&oauth2.TLSConfig)
+	}
+
+	return &config.OAuth2Config{
+		ClientID:         oauth2.ClientID,
+		ClientSecret:     rivertypes.Secret(oauth2.ClientSecret),
+		ClientSecretFile: oauth2.ClientSecretFile,
+		Scopes:           oauth2.Scopes,
+		TokenURL:         oauth2.TokenURL,
+		EndpointParams:   oauth2.EndpointParams,
+		ProxyURL:         config.URL{URL: oauth2.ProxyURL.URL},
+		TLSConfig:        tlsConfig,
+	}
+}
+
+// ToTLSConfig converts a Prometheus TLS config into its River equivalent.
+func ToTLSConfig(tlsConfig *prom_config.TLSConfig) *config.TLSConfig {
+	if tlsConfig == nil {
+		return nil
+	}
+
+	return &config.TLSConfig{
+		CAFile:             tlsConfig.CAFile,
+		CertFile:           tlsConfig.CertFile,
+		KeyFile:            tlsConfig.KeyFile,
+		ServerName:         tlsConfig.ServerName,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+		MinVersion:         config.TLSVersion(tlsConfig.MinVersion),
+	}
+}
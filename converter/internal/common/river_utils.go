@@ -0,0 +1,174 @@
+// Package common holds helpers shared by the individual converters.
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/agent/component/common/config"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/pkg/flow/rivertypes"
+	"github.com/grafana/agent/pkg/river/token"
+	"github.com/grafana/agent/pkg/river/token/builder"
+)
+
+// NewBlockWithOverride creates a new block named name and labeled label
+// whose body holds args. Only arguments which differ from their defaults are
+// written.
+//
+// Values which River would otherwise hide or render differently from how
+// they're decoded, such as secrets, are written in their decodable form so the
+// converted output preserves the original configuration.
+func NewBlockWithOverride(name []string, label string, args interface{}) *builder.Block {
+	block := builder.NewBlock(name, label)
+	block.Body().SetValueOverrideHook(valueOverrideHook)
+	block.Body().AppendFromWithDefaults(args)
+	return block
+}
+
+func valueOverrideHook(val interface{}) interface{} {
+	switch val := val.(type) {
+	case rivertypes.Secret:
+		return string(val)
+	case rivertypes.OptionalSecret:
+		return val.Value
+	case config.URL:
+		// config.URL redacts passwords when marshaled.
+		if val.URL == nil {
+			return ""
+		}
+		return val.URL.String()
+	case flow_relabel.Regexp:
+		return unanchorRegexp(val)
+	case []discovery.Target:
+		return targetsValue(val)
+	}
+	return val
+}
+
+// unanchorRegexp returns the original expression of re, which is anchored
+// when it's compiled.
+func unanchorRegexp(re flow_relabel.Regexp) string {
+	if re.Regexp == nil {
+		return ""
+	}
+	str := re.String()
+	if strings.HasPrefix(str, "^(?:") && strings.HasSuffix(str, ")$") {
+		return str[len("^(?:") : len(str)-len(")$")]
+	}
+	return str
+}
+
+// PrettyPrint renders f as formatted River text, terminated by a newline.
+func PrettyPrint(f *builder.File) ([]byte, diag.Diagnostics) {
+	var (
+		buf   bytes.Buffer
+		diags diag.Diagnostics
+	)
+	if _, err := f.WriteTo(&buf); err != nil {
+		diags.Add(diag.SeverityLevelCritical, fmt.Sprintf("failed to render converted config: %s", err))
+		return nil, diags
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), diags
+}
+
+// Expr is a raw River expression, such as a reference to the exports of
+// another component. Expr is written as-is when used as a value with
+// builder.
+type Expr string
+
+var _ builder.Tokenizer = Expr("")
+
+// RiverTokenize implements builder.Tokenizer.
+func (e Expr) RiverTokenize() []builder.Token {
+	return []builder.Token{{Tok: token.LITERAL, Lit: string(e)}}
+}
+
+// exprTargetKey is a label used by ExprTarget to mark a target as holding an
+// expression.
+const exprTargetKey = "__converter_expr__"
+
+// ExprTarget returns a target which represents the list of targets evaluated
+// by expr. ExprTargets can be mixed with regular targets to build arguments
+// whose targets come from both static lists and other components.
+func ExprTarget(expr Expr) discovery.Target {
+	return discovery.Target{exprTargetKey: string(expr)}
+}
+
+// targetsValue returns the value to write for a list of targets. Static
+// targets are written as a list, while targets created by ExprTarget are
+// written as their expression. When there are multiple sources of targets, they
+// are combined with concat.
+func targetsValue(targets []discovery.Target) interface{} {
+	var (
+		parts  []string
+		static []discovery.Target
+	)
+	flushStatic := func() {
+		if len(static) == 0 {
+			return
+		}
+		expr := builder.NewExpr()
+		expr.SetValue(static)
+		parts = append(parts, string(expr.Bytes()))
+		static = nil
+	}
+
+	for _, target := range targets {
+		if expr, ok := target[exprTargetKey]; ok {
+			flushStatic()
+			parts = append(parts, expr)
+			continue
+		}
+		static = append(static, target)
+	}
+
+	switch {
+	case len(parts) == 0:
+		// Only static targets; write them normally.
+		return static
+	case len(static) == 0 && len(parts) == 1:
+		return Expr(parts[0])
+	}
+
+	flushStatic()
+	return Expr(fmt.Sprintf("concat(%s)", strings.Join(parts, ", ")))
+}
+
+// SanitizeIdentifier returns a valid River identifier derived from in.
+// Invalid characters are replaced with underscores.
+func SanitizeIdentifier(in string) string {
+	var sb strings.Builder
+	for i, r := range in {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+			sb.WriteRune(r)
+		case '0' <= r && r <= '9':
+			if i == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+// LabelForParts joins parts into a single block label, ignoring empty parts.
+func LabelForParts(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return SanitizeIdentifier(strings.Join(nonEmpty, "_"))
+}
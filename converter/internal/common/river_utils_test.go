@@ -0,0 +1,108 @@
+package common_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/config"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/discovery"
+	disc_relabel "github.com/grafana/agent/component/discovery/relabel"
+	"github.com/grafana/agent/component/prometheus/remotewrite"
+	"github.com/grafana/agent/component/prometheus/scrape"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	"github.com/grafana/agent/pkg/river/vm"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip writes args with NewBlockWithOverride and decodes the written
+// block back into out.
+func roundTrip(t *testing.T, args interface{}, out interface{}) {
+	t.Helper()
+
+	f := builder.NewFile()
+	f.Body().AppendBlock(common.NewBlockWithOverride([]string{"test"}, "label", args))
+
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	require.NoError(t, err)
+
+	file, err := parser.ParseFile("", buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, file.Body, 1)
+	require.NoError(t, vm.New(file.Body[0].(*ast.BlockStmt).Body).Evaluate(nil, out), "invalid River:\n%s", buf.String())
+}
+
+func TestNewBlockWithOverride_Scrape(t *testing.T) {
+	var args scrape.Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		targets    = [{__address__ = "localhost:9090"}]
+		forward_to = []
+	`), &args))
+
+	args.JobName = "job"
+	args.HonorTimestamps = false
+	args.ScrapeInterval = 15 * time.Second
+	args.HTTPClientConfig.BasicAuth = &config.BasicAuth{
+		Username: "user",
+		Password: "secret",
+	}
+
+	var actual scrape.Arguments
+	roundTrip(t, &args, &actual)
+	require.Equal(t, args, actual)
+}
+
+func TestNewBlockWithOverride_RemoteWrite(t *testing.T) {
+	var endpoint remotewrite.EndpointOptions
+	require.NoError(t, river.Unmarshal([]byte(`url = "http://localhost:9009/api/prom/push"`), &endpoint))
+	endpoint.SendExemplars = false
+	queueOptions := remotewrite.DefaultQueueOptions
+	queueOptions.Capacity = 5000
+	endpoint.QueueOptions = &queueOptions
+
+	var args remotewrite.Arguments
+	require.NoError(t, river.Unmarshal(nil, &args))
+	args.ExternalLabels = map[string]string{"cluster": "prod"}
+	args.Endpoints = []*remotewrite.EndpointOptions{&endpoint}
+
+	var actual remotewrite.Arguments
+	roundTrip(t, &args, &actual)
+	require.Equal(t, args, actual)
+}
+
+func TestNewBlockWithOverride_Relabel(t *testing.T) {
+	var args disc_relabel.Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		targets = []
+		rule {
+			source_labels = ["__name__"]
+			regex         = "go_.*"
+			action        = "drop"
+		}
+	`), &args))
+
+	// Mix static targets with targets from another component.
+	args.Targets = []discovery.Target{
+		common.ExprTarget("[{__address__ = \"localhost:1234\"}]"),
+		{"__address__": "localhost:9090"},
+	}
+
+	var actual disc_relabel.Arguments
+	roundTrip(t, &args, &actual)
+
+	require.Equal(t, []discovery.Target{
+		{"__address__": "localhost:1234"},
+		{"__address__": "localhost:9090"},
+	}, actual.Targets)
+
+	require.Len(t, actual.RelabelConfigs, 1)
+	require.Equal(t, args.RelabelConfigs[0].Regex.String(), actual.RelabelConfigs[0].Regex.String())
+	require.Equal(t, flow_relabel.Drop, actual.RelabelConfigs[0].Action)
+	require.Equal(t, args.RelabelConfigs[0].SourceLabels, actual.RelabelConfigs[0].SourceLabels)
+}
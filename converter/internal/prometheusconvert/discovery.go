@@ -0,0 +1,142 @@
+package prometheusconvert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/discovery/docker"
+	"github.com/grafana/agent/component/discovery/kubernetes"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	prom_discovery "github.com/prometheus/prometheus/discovery"
+	prom_kubernetes "github.com/prometheus/prometheus/discovery/kubernetes"
+	prom_docker "github.com/prometheus/prometheus/discovery/moby"
+)
+
+// AppendServiceDiscoveryConfigs appends discovery components to f for each
+// service discovery config in sdConfigs. The returned targets hold the
+// static targets along with references to the targets of the created
+// components, and are meant to be used as the targets of a downstream
+// component.
+func AppendServiceDiscoveryConfigs(f *builder.File, label string, sdConfigs prom_discovery.Configs) ([]discovery.Target, diag.Diagnostics) {
+	return appendDiscovery(f, label, sdConfigs)
+}
+
+func appendDiscovery(f *builder.File, label string, sdConfigs prom_discovery.Configs) ([]discovery.Target, diag.Diagnostics) {
+	var (
+		targets []discovery.Target
+		diags   diag.Diagnostics
+	)
+
+	// Count the configs of each type so labels only get an index suffix when
+	// the same type of discovery is used more than once.
+	counts := make(map[string]int)
+	for _, sdConfig := range sdConfigs {
+		counts[sdConfig.Name()]++
+	}
+	seen := make(map[string]int)
+	labelFor := func(sdConfig prom_discovery.Config) string {
+		name := sdConfig.Name()
+		seen[name]++
+		if counts[name] == 1 {
+			return label
+		}
+		return common.LabelForParts(label, fmt.Sprint(seen[name]-1))
+	}
+
+	for _, sdConfig := range sdConfigs {
+		switch sdConfig := sdConfig.(type) {
+		case prom_discovery.StaticConfig:
+			targets = append(targets, toStaticTargets(sdConfig)...)
+
+		case *prom_kubernetes.SDConfig:
+			sdLabel := labelFor(sdConfig)
+			args, sdDiags := toDiscoveryKubernetes(sdConfig)
+			diags.AddAll(sdDiags)
+			f.Body().AppendBlock(common.NewBlockWithOverride([]string{"discovery", "kubernetes"}, sdLabel, args))
+			targets = append(targets, common.ExprTarget(common.Expr(fmt.Sprintf("discovery.kubernetes.%s.targets", sdLabel))))
+
+		case *prom_docker.DockerSDConfig:
+			sdLabel := labelFor(sdConfig)
+			args := toDiscoveryDocker(sdConfig)
+			f.Body().AppendBlock(common.NewBlockWithOverride([]string{"discovery", "docker"}, sdLabel, args))
+			targets = append(targets, common.ExprTarget(common.Expr(fmt.Sprintf("discovery.docker.%s.targets", sdLabel))))
+
+		default:
+			diags.Add(diag.SeverityLevelError, fmt.Sprintf("%s service discovery used by %q is not supported and was not converted", sdConfig.Name(), label))
+		}
+	}
+
+	return targets, diags
+}
+
+// toStaticTargets converts static target groups into a list of targets,
+// merging the labels of each group into its targets.
+func toStaticTargets(staticConfig prom_discovery.StaticConfig) []discovery.Target {
+	var targets []discovery.Target
+
+	for _, group := range staticConfig {
+		for _, groupTarget := range group.Targets {
+			target := make(discovery.Target, len(group.Labels)+len(groupTarget))
+			for name, value := range group.Labels {
+				target[string(name)] = string(value)
+			}
+			for name, value := range groupTarget {
+				target[string(name)] = string(value)
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+func toDiscoveryKubernetes(sdConfig *prom_kubernetes.SDConfig) (*kubernetes.Arguments, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	if sdConfig.AttachMetadata.Node {
+		diags.Add(diag.SeverityLevelError, "attach_metadata in kubernetes_sd_configs is not supported by discovery.kubernetes and was not converted")
+	}
+
+	selectors := make([]kubernetes.SelectorConfig, 0, len(sdConfig.Selectors))
+	for _, s := range sdConfig.Selectors {
+		selectors = append(selectors, kubernetes.SelectorConfig{
+			Role:  string(s.Role),
+			Label: s.Label,
+			Field: s.Field,
+		})
+	}
+
+	return &kubernetes.Arguments{
+		APIServer:        config.URL{URL: sdConfig.APIServer.URL},
+		Role:             string(sdConfig.Role),
+		KubeConfig:       sdConfig.KubeConfig,
+		HTTPClientConfig: *common.ToHTTPClientConfig(&sdConfig.HTTPClientConfig),
+		NamespaceDiscovery: kubernetes.NamespaceDiscovery{
+			IncludeOwnNamespace: sdConfig.NamespaceDiscovery.IncludeOwnNamespace,
+			Names:               sdConfig.NamespaceDiscovery.Names,
+		},
+		Selectors: selectors,
+	}, diags
+}
+
+func toDiscoveryDocker(sdConfig *prom_docker.DockerSDConfig) *docker.Arguments {
+	filters := make([]docker.Filter, 0, len(sdConfig.Filters))
+	for _, filter := range sdConfig.Filters {
+		filters = append(filters, docker.Filter{
+			Name:   filter.Name,
+			Values: filter.Values,
+		})
+	}
+
+	return &docker.Arguments{
+		Host:               sdConfig.Host,
+		Port:               sdConfig.Port,
+		HostNetworkingHost: sdConfig.HostNetworkingHost,
+		RefreshInterval:    time.Duration(sdConfig.RefreshInterval),
+		Filters:            filters,
+		HTTPClientConfig:   *common.ToHTTPClientConfig(&sdConfig.HTTPClientConfig),
+	}
+}
@@ -0,0 +1,143 @@
+// Package prometheusconvert converts Prometheus scrape and remote_write
+// configuration into Grafana Agent Flow components.
+package prometheusconvert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/prometheus/scrape"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	prom_config "github.com/prometheus/prometheus/config"
+)
+
+// Convert converts a Prometheus config file into a River file holding Flow
+// components.
+func Convert(in []byte) ([]byte, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	promConfig, err := prom_config.Load(string(in), false, log.NewNopLogger())
+	if err != nil {
+		diags.Add(diag.SeverityLevelCritical, fmt.Sprintf("failed to parse Prometheus config: %s", err))
+		return nil, diags
+	}
+
+	f := builder.NewFile()
+	diags.AddAll(AppendAll(f, promConfig, ""))
+
+	out, printDiags := common.PrettyPrint(f)
+	diags.AddAll(printDiags)
+	return out, diags
+}
+
+// validateUnsupported reports the parts of promConfig which have no Flow
+// equivalent.
+func validateUnsupported(promConfig *prom_config.Config) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if len(promConfig.AlertingConfig.AlertmanagerConfigs) > 0 || len(promConfig.AlertingConfig.AlertRelabelConfigs) > 0 {
+		diags.Add(diag.SeverityLevelError, "alerting is not supported and was not converted")
+	}
+	if len(promConfig.RuleFiles) > 0 {
+		diags.Add(diag.SeverityLevelError, "rule_files are not supported and were not converted")
+	}
+	if len(promConfig.RemoteReadConfigs) > 0 {
+		diags.Add(diag.SeverityLevelError, "remote_read is not supported and was not converted")
+	}
+	if promConfig.StorageConfig.ExemplarsConfig != nil {
+		diags.Add(diag.SeverityLevelWarn, "storage.exemplars is not supported and was not converted")
+	}
+	if promConfig.TracingConfig.Endpoint != "" {
+		diags.Add(diag.SeverityLevelWarn, "tracing is not supported and was not converted; configure tracing for the agent instead")
+	}
+
+	return diags
+}
+
+// AppendAll appends components to f for the scrape configs and remote_write
+// configs in promConfig. labelPrefix, if set, is prepended to the labels of
+// all created components to allow AppendAll to be called multiple times for
+// the same file.
+func AppendAll(f *builder.File, promConfig *prom_config.Config, labelPrefix string) diag.Diagnostics {
+	diags := validateUnsupported(promConfig)
+
+	var forwardTo []common.Expr
+	if len(promConfig.RemoteWriteConfigs) > 0 {
+		label := common.LabelForParts(labelPrefix)
+		if labelPrefix == "" {
+			label = "default"
+		}
+
+		receiver, rwDiags := AppendRemoteWrite(f, label, promConfig.RemoteWriteConfigs, promConfig.GlobalConfig.ExternalLabels)
+		diags.AddAll(rwDiags)
+		forwardTo = append(forwardTo, receiver)
+	} else if len(promConfig.ScrapeConfigs) > 0 {
+		diags.Add(diag.SeverityLevelWarn, "no remote_write is configured; scraped metrics will not be sent anywhere")
+	}
+
+	for _, scrapeConfig := range promConfig.ScrapeConfigs {
+		diags.AddAll(appendScrapeConfig(f, common.LabelForParts(labelPrefix, scrapeConfig.JobName), scrapeConfig, forwardTo))
+	}
+
+	return diags
+}
+
+// appendScrapeConfig appends a prometheus.scrape component along with the
+// discovery and relabeling components needed to implement scrapeConfig.
+func appendScrapeConfig(f *builder.File, label string, scrapeConfig *prom_config.ScrapeConfig, forwardTo []common.Expr) diag.Diagnostics {
+	targets, diags := appendDiscovery(f, label, scrapeConfig.ServiceDiscoveryConfigs)
+	diags.AddAll(AppendScrape(f, label, scrapeConfig, targets, forwardTo))
+	return diags
+}
+
+// AppendScrape appends a prometheus.scrape component which scrapes targets
+// using the settings of scrapeConfig, along with the relabeling components
+// needed to implement scrapeConfig. The service discovery configs of
+// scrapeConfig are ignored.
+func AppendScrape(f *builder.File, label string, scrapeConfig *prom_config.ScrapeConfig, targets []discovery.Target, forwardTo []common.Expr) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if len(scrapeConfig.RelabelConfigs) > 0 {
+		output, relabelDiags := AppendDiscoveryRelabel(f, label, targets, scrapeConfig.RelabelConfigs)
+		diags.AddAll(relabelDiags)
+		targets = []discovery.Target{common.ExprTarget(output)}
+	}
+
+	if len(scrapeConfig.MetricRelabelConfigs) > 0 {
+		receiver, relabelDiags := AppendPrometheusRelabel(f, label, scrapeConfig.MetricRelabelConfigs, forwardTo)
+		diags.AddAll(relabelDiags)
+		forwardTo = []common.Expr{receiver}
+	}
+
+	args := toScrapeArguments(scrapeConfig, targets)
+	block := common.NewBlockWithOverride([]string{"prometheus", "scrape"}, label, args)
+	block.Body().SetAttributeValue("forward_to", forwardTo)
+	f.Body().AppendBlock(block)
+
+	return diags
+}
+
+func toScrapeArguments(scrapeConfig *prom_config.ScrapeConfig, targets []discovery.Target) *scrape.Arguments {
+	return &scrape.Arguments{
+		Targets:               targets,
+		JobName:               scrapeConfig.JobName,
+		HonorLabels:           scrapeConfig.HonorLabels,
+		HonorTimestamps:       scrapeConfig.HonorTimestamps,
+		Params:                scrapeConfig.Params,
+		ScrapeInterval:        time.Duration(scrapeConfig.ScrapeInterval),
+		ScrapeTimeout:         time.Duration(scrapeConfig.ScrapeTimeout),
+		MetricsPath:           scrapeConfig.MetricsPath,
+		Scheme:                scrapeConfig.Scheme,
+		BodySizeLimit:         scrapeConfig.BodySizeLimit,
+		SampleLimit:           scrapeConfig.SampleLimit,
+		TargetLimit:           scrapeConfig.TargetLimit,
+		LabelLimit:            scrapeConfig.LabelLimit,
+		LabelNameLengthLimit:  scrapeConfig.LabelNameLengthLimit,
+		LabelValueLengthLimit: scrapeConfig.LabelValueLengthLimit,
+		HTTPClientConfig:      *common.ToHTTPClientConfig(&scrapeConfig.HTTPClientConfig),
+	}
+}
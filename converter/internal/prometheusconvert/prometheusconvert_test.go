@@ -0,0 +1,58 @@
+package prometheusconvert_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/converter/internal/prometheusconvert"
+	"github.com/grafana/agent/converter/internal/test_common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	prom_config "github.com/prometheus/prometheus/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendAll(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".yaml")
+
+		t.Run(name, func(t *testing.T) {
+			inputBytes, err := os.ReadFile(input)
+			require.NoError(t, err)
+			expectBytes, err := os.ReadFile(strings.TrimSuffix(input, ".yaml") + ".river")
+			require.NoError(t, err)
+
+			promConfig, err := prom_config.Load(string(inputBytes), false, log.NewNopLogger())
+			require.NoError(t, err)
+
+			f := builder.NewFile()
+			diags := prometheusconvert.AppendAll(f, promConfig, "")
+
+			var expectDiags []string
+			if bb, err := os.ReadFile(strings.TrimSuffix(input, ".yaml") + ".diags"); err == nil {
+				expectDiags = strings.Split(strings.TrimSpace(string(bb)), "\n")
+			}
+			var actualDiags []string
+			for _, d := range diags {
+				actualDiags = append(actualDiags, d.Error())
+			}
+			require.Equal(t, expectDiags, actualDiags)
+
+			var buf bytes.Buffer
+			_, err = f.WriteTo(&buf)
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimSpace(string(expectBytes)), strings.TrimSpace(buf.String()))
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	test_common.TestDirectory(t, "testdata", ".yaml", prometheusconvert.Convert)
+}
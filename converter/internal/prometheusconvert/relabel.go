@@ -0,0 +1,85 @@
+package prometheusconvert
+
+import (
+	"fmt"
+
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/discovery"
+	disc_relabel "github.com/grafana/agent/component/discovery/relabel"
+	prom_relabel "github.com/grafana/agent/component/prometheus/relabel"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// AppendDiscoveryRelabel appends a discovery.relabel component which applies
+// relabelConfigs to targets. The expression for the relabeled targets is
+// returned.
+func AppendDiscoveryRelabel(f *builder.File, label string, targets []discovery.Target, relabelConfigs []*relabel.Config) (common.Expr, diag.Diagnostics) {
+	rules, diags := ToFlowRelabelConfigs(relabelConfigs)
+
+	args := &disc_relabel.Arguments{
+		Targets:        targets,
+		RelabelConfigs: rules,
+	}
+	f.Body().AppendBlock(common.NewBlockWithOverride([]string{"discovery", "relabel"}, label, args))
+	return common.Expr(fmt.Sprintf("discovery.relabel.%s.output", label)), diags
+}
+
+// AppendPrometheusRelabel appends a prometheus.relabel component which applies
+// relabelConfigs to metrics before forwarding them to forwardTo. The
+// expression for the component's receiver is returned.
+func AppendPrometheusRelabel(f *builder.File, label string, relabelConfigs []*relabel.Config, forwardTo []common.Expr) (common.Expr, diag.Diagnostics) {
+	rules, diags := ToFlowRelabelConfigs(relabelConfigs)
+
+	args := &prom_relabel.Arguments{
+		MetricRelabelConfigs: rules,
+	}
+	block := common.NewBlockWithOverride([]string{"prometheus", "relabel"}, label, args)
+	block.Body().SetAttributeValue("forward_to", forwardTo)
+	f.Body().AppendBlock(block)
+	return common.Expr(fmt.Sprintf("prometheus.relabel.%s.receiver", label)), diags
+}
+
+// ToFlowRelabelConfigs converts Prometheus relabel configs into rules used
+// by Flow relabeling components.
+func ToFlowRelabelConfigs(relabelConfigs []*relabel.Config) ([]*flow_relabel.Config, diag.Diagnostics) {
+	var (
+		res   = make([]*flow_relabel.Config, 0, len(relabelConfigs))
+		diags diag.Diagnostics
+	)
+
+	for _, rc := range relabelConfigs {
+		var action flow_relabel.Action
+		if err := action.UnmarshalText([]byte(rc.Action)); err != nil {
+			diags.Add(diag.SeverityLevelError, fmt.Sprintf("relabel action %q is not supported and the rule was not converted", rc.Action))
+			continue
+		}
+
+		var regex flow_relabel.Regexp
+		if rc.Regex.Regexp != nil {
+			if err := regex.UnmarshalText([]byte(rc.Regex.String())); err != nil {
+				diags.Add(diag.SeverityLevelError, fmt.Sprintf("relabel regex %q could not be converted: %s", rc.Regex.String(), err))
+				continue
+			}
+		}
+
+		var sourceLabels []string
+		for _, l := range rc.SourceLabels {
+			sourceLabels = append(sourceLabels, string(l))
+		}
+
+		res = append(res, &flow_relabel.Config{
+			SourceLabels: sourceLabels,
+			Separator:    rc.Separator,
+			Regex:        regex,
+			Modulus:      rc.Modulus,
+			TargetLabel:  rc.TargetLabel,
+			Replacement:  rc.Replacement,
+			Action:       action,
+		})
+	}
+
+	return res, diags
+}
@@ -0,0 +1,74 @@
+package prometheusconvert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component/prometheus/remotewrite"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	prom_config "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// AppendRemoteWrite appends a prometheus.remote_write component which sends
+// metrics to each of remoteWriteConfigs. The expression for the component's
+// receiver is returned.
+func AppendRemoteWrite(f *builder.File, label string, remoteWriteConfigs []*prom_config.RemoteWriteConfig, externalLabels labels.Labels) (common.Expr, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	args := &remotewrite.Arguments{
+		ExternalLabels: externalLabels.Map(),
+		WALOptions:     remotewrite.DefaultWALOptions,
+	}
+	if len(args.ExternalLabels) == 0 {
+		args.ExternalLabels = nil
+	}
+
+	for _, rwConfig := range remoteWriteConfigs {
+		endpoint, endpointDiags := toEndpointOptions(rwConfig)
+		diags.AddAll(endpointDiags)
+		args.Endpoints = append(args.Endpoints, endpoint)
+	}
+
+	f.Body().AppendBlock(common.NewBlockWithOverride([]string{"prometheus", "remote_write"}, label, args))
+	return common.Expr(fmt.Sprintf("prometheus.remote_write.%s.receiver", label)), diags
+}
+
+func toEndpointOptions(rwConfig *prom_config.RemoteWriteConfig) (*remotewrite.EndpointOptions, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	url := rwConfig.URL.String()
+	if len(rwConfig.WriteRelabelConfigs) > 0 {
+		diags.Add(diag.SeverityLevelError, fmt.Sprintf("write_relabel_configs for remote_write %q is not supported by prometheus.remote_write and was not converted", url))
+	}
+	if rwConfig.SigV4Config != nil {
+		diags.Add(diag.SeverityLevelError, fmt.Sprintf("sigv4 for remote_write %q is not supported by prometheus.remote_write and was not converted", url))
+	}
+
+	return &remotewrite.EndpointOptions{
+		Name:                 rwConfig.Name,
+		URL:                  url,
+		RemoteTimeout:        time.Duration(rwConfig.RemoteTimeout),
+		Headers:              rwConfig.Headers,
+		SendExemplars:        rwConfig.SendExemplars,
+		SendNativeHistograms: rwConfig.SendNativeHistograms,
+		HTTPClientConfig:     common.ToHTTPClientConfig(&rwConfig.HTTPClientConfig),
+		QueueOptions: &remotewrite.QueueOptions{
+			Capacity:          rwConfig.QueueConfig.Capacity,
+			MaxShards:         rwConfig.QueueConfig.MaxShards,
+			MinShards:         rwConfig.QueueConfig.MinShards,
+			MaxSamplesPerSend: rwConfig.QueueConfig.MaxSamplesPerSend,
+			BatchSendDeadline: time.Duration(rwConfig.QueueConfig.BatchSendDeadline),
+			MinBackoff:        time.Duration(rwConfig.QueueConfig.MinBackoff),
+			MaxBackoff:        time.Duration(rwConfig.QueueConfig.MaxBackoff),
+			RetryOnHTTP429:    rwConfig.QueueConfig.RetryOnRateLimit,
+		},
+		MetadataOptions: &remotewrite.MetadataOptions{
+			Send:              rwConfig.MetadataConfig.Send,
+			SendInterval:      time.Duration(rwConfig.MetadataConfig.SendInterval),
+			MaxSamplesPerSend: rwConfig.MetadataConfig.MaxSamplesPerSend,
+		},
+	}, diags
+}
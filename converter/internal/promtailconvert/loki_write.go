@@ -0,0 +1,54 @@
+package promtailconvert
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/units"
+	"github.com/grafana/agent/component/loki/write"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	"github.com/grafana/loki/clients/pkg/promtail/client"
+)
+
+// appendLokiWrite appends a loki.write component which sends logs to the
+// client described by clientConfig, limited to maxStreams active streams. The
+// expression for the component's receiver is returned.
+func appendLokiWrite(f *builder.File, label string, clientConfig *client.Config, maxStreams int) (common.Expr, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	if len(clientConfig.StreamLagLabels) > 0 {
+		diags.Add(diag.SeverityLevelWarn, "stream_lag_labels is deprecated and was not converted")
+	}
+
+	var url string
+	if clientConfig.URL.URL != nil {
+		url = clientConfig.URL.String()
+	}
+
+	args := &write.Arguments{
+		Endpoints: []write.EndpointOptions{{
+			Name:              clientConfig.Name,
+			URL:               url,
+			BatchWait:         clientConfig.BatchWait,
+			BatchSize:         units.Base2Bytes(clientConfig.BatchSize),
+			RemoteTimeout:     clientConfig.Timeout,
+			MinBackoff:        clientConfig.BackoffConfig.MinBackoff,
+			MaxBackoff:        clientConfig.BackoffConfig.MaxBackoff,
+			MaxBackoffRetries: clientConfig.BackoffConfig.MaxRetries,
+			TenantID:          clientConfig.TenantID,
+			HTTPClientConfig:  common.ToHTTPClientConfig(&clientConfig.Client),
+		}},
+		MaxStreams: maxStreams,
+	}
+
+	if len(clientConfig.ExternalLabels.LabelSet) > 0 {
+		args.ExternalLabels = make(map[string]string, len(clientConfig.ExternalLabels.LabelSet))
+		for name, value := range clientConfig.ExternalLabels.LabelSet {
+			args.ExternalLabels[string(name)] = string(value)
+		}
+	}
+
+	f.Body().AppendBlock(common.NewBlockWithOverride([]string{"loki", "write"}, label, args))
+	return common.Expr(fmt.Sprintf("loki.write.%s.receiver", label)), diags
+}
@@ -0,0 +1,411 @@
+package promtailconvert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+
+	"github.com/grafana/agent/component/loki/process"
+	"github.com/grafana/agent/component/loki/process/metric"
+	"github.com/grafana/agent/component/loki/process/stages"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	promtail_metric "github.com/grafana/loki/clients/pkg/logentry/metric"
+	promtail_stages "github.com/grafana/loki/clients/pkg/logentry/stages"
+	"github.com/grafana/loki/pkg/util/flagext"
+	"github.com/mitchellh/mapstructure"
+)
+
+// appendLokiProcess appends a loki.process component which runs
+// pipelineStages before forwarding entries to forwardTo. The expression for
+// the component's receiver is returned.
+func appendLokiProcess(f *builder.File, label string, pipelineStages promtail_stages.PipelineStages, forwardTo []common.Expr) (common.Expr, diag.Diagnostics) {
+	flowStages, diags := toStages(pipelineStages)
+
+	args := &process.Arguments{
+		Stages: flowStages,
+	}
+	block := common.NewBlockWithOverride([]string{"loki", "process"}, label, args)
+	block.Body().SetAttributeValue("forward_to", forwardTo)
+	f.Body().AppendBlock(block)
+	return common.Expr(fmt.Sprintf("loki.process.%s.receiver", label)), diags
+}
+
+// toStages converts Promtail pipeline stages into loki.process stages.
+// Stages which can't be converted are reported and skipped.
+func toStages(pipelineStages promtail_stages.PipelineStages) ([]stages.StageConfig, diag.Diagnostics) {
+	var (
+		res   []stages.StageConfig
+		diags diag.Diagnostics
+	)
+
+	for _, raw := range pipelineStages {
+		stageMap, ok := raw.(map[interface{}]interface{})
+		if !ok || len(stageMap) != 1 {
+			diags.Add(diag.SeverityLevelError, fmt.Sprintf("invalid pipeline stage %v: stages must be a map with exactly one key", raw))
+			continue
+		}
+
+		for key, config := range stageMap {
+			name, ok := key.(string)
+			if !ok {
+				diags.Add(diag.SeverityLevelError, fmt.Sprintf("invalid pipeline stage name %v", key))
+				continue
+			}
+
+			stage, err := toStage(name, config)
+			if err != nil {
+				diags.Add(diag.SeverityLevelError, fmt.Sprintf("failed to convert %s pipeline stage: %s", name, err))
+				continue
+			} else if stage == nil {
+				diags.Add(diag.SeverityLevelError, fmt.Sprintf("the %s pipeline stage is not supported and was not converted", name))
+				continue
+			}
+			res = append(res, *stage)
+		}
+	}
+
+	return res, diags
+}
+
+// toStage converts an individual Promtail stage into a loki.process stage.
+// toStage returns nil if the stage is not supported.
+func toStage(name string, config interface{}) (*stages.StageConfig, error) {
+	switch name {
+	case promtail_stages.StageTypeJSON:
+		var cfg promtail_stages.JSONConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{JSONConfig: &stages.JSONConfig{
+			Expressions:   cfg.Expressions,
+			Source:        cfg.Source,
+			DropMalformed: cfg.DropMalformed,
+		}}, nil
+
+	case promtail_stages.StageTypeLabel:
+		var cfg promtail_stages.LabelsConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		// An empty source extracts the value of the label's own name, which
+		// Promtail also allows to be left unset.
+		values := make(map[string]*string, len(cfg))
+		for name, source := range cfg {
+			if source == nil {
+				source = new(string)
+			}
+			values[name] = source
+		}
+		return &stages.StageConfig{LabelsConfig: &stages.LabelsConfig{
+			Values: values,
+		}}, nil
+
+	case promtail_stages.StageTypeLogfmt:
+		var cfg promtail_stages.LogfmtConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{LogfmtConfig: &stages.LogfmtConfig{
+			Mapping: cfg.Mapping,
+			Source:  cfg.Source,
+		}}, nil
+
+	case promtail_stages.StageTypeRegex:
+		var cfg promtail_stages.RegexConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{RegexConfig: &stages.RegexConfig{
+			Expression: cfg.Expression,
+			Source:     cfg.Source,
+		}}, nil
+
+	case promtail_stages.StageTypeReplace:
+		var cfg promtail_stages.ReplaceConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{ReplaceConfig: &stages.ReplaceConfig{
+			Expression: cfg.Expression,
+			Source:     cfg.Source,
+			Replace:    cfg.Replace,
+		}}, nil
+
+	case promtail_stages.StageTypeTimestamp:
+		var cfg promtail_stages.TimestampConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{TimestampConfig: &stages.TimestampConfig{
+			Source:          cfg.Source,
+			Format:          cfg.Format,
+			FallbackFormats: cfg.FallbackFormats,
+			Location:        cfg.Location,
+			ActionOnFailure: cfg.ActionOnFailure,
+		}}, nil
+
+	case promtail_stages.StageTypeOutput:
+		var cfg promtail_stages.OutputConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{OutputConfig: &stages.OutputConfig{
+			Source: cfg.Source,
+		}}, nil
+
+	case promtail_stages.StageTypeTemplate:
+		var cfg promtail_stages.TemplateConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{TemplateConfig: &stages.TemplateConfig{
+			Source:   cfg.Source,
+			Template: cfg.Template,
+		}}, nil
+
+	case promtail_stages.StageTypeStaticLabels:
+		var cfg promtail_stages.StaticLabelConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{StaticLabelsConfig: &stages.StaticLabelsConfig{
+			Values: cfg,
+		}}, nil
+
+	case promtail_stages.StageTypeMatch:
+		var cfg promtail_stages.MatcherConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		nested, diags := toStages(cfg.Stages)
+		if len(diags) > 0 {
+			return nil, diags
+		}
+		return &stages.StageConfig{MatchConfig: &stages.MatchConfig{
+			PipelineName: cfg.PipelineName,
+			Selector:     cfg.Selector,
+			Stages:       nested,
+			Action:       cfg.Action,
+			DropReason:   cfg.DropReason,
+		}}, nil
+
+	case promtail_stages.StageTypeDrop:
+		var cfg promtail_stages.DropConfig
+		if err := mapstructure.WeakDecode(config, &cfg); err != nil {
+			return nil, err
+		}
+		res := &stages.DropConfig{
+			DropReason: cfg.DropReason,
+			Source:     cfg.Source,
+			Value:      cfg.Value,
+			Expression: cfg.Expression,
+		}
+		if cfg.OlderThan != nil {
+			olderThan, err := time.ParseDuration(*cfg.OlderThan)
+			if err != nil {
+				return nil, err
+			}
+			res.OlderThan = &olderThan
+		}
+		if cfg.LongerThan != nil {
+			var longerThan flagext.ByteSize
+			if err := longerThan.Set(*cfg.LongerThan); err != nil {
+				return nil, err
+			}
+			b := units.Base2Bytes(longerThan.Val())
+			res.LongerThan = &b
+		}
+		return &stages.StageConfig{DropConfig: res}, nil
+
+	case promtail_stages.StageTypeLimit:
+		var cfg promtail_stages.LimitConfig
+		if err := mapstructure.WeakDecode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{LimitConfig: &stages.LimitConfig{
+			Rate:  cfg.Rate,
+			Burst: cfg.Burst,
+			Drop:  cfg.Drop,
+		}}, nil
+
+	case promtail_stages.StageTypeMultiline:
+		var cfg promtail_stages.MultilineConfig
+		if err := mapstructure.WeakDecode(config, &cfg); err != nil {
+			return nil, err
+		}
+		res := &stages.MultilineConfig{
+			Expression: valueOrEmpty(cfg.Expression),
+		}
+		if cfg.MaxLines != nil {
+			res.MaxLines = *cfg.MaxLines
+		}
+		if cfg.MaxWaitTime != nil {
+			maxWait, err := time.ParseDuration(*cfg.MaxWaitTime)
+			if err != nil {
+				return nil, err
+			}
+			res.MaxWaitTime = maxWait
+		}
+		return &stages.StageConfig{MultilineConfig: res}, nil
+
+	case promtail_stages.StageTypeDocker:
+		return &stages.StageConfig{DockerConfig: &stages.DockerConfig{}}, nil
+
+	case promtail_stages.StageTypeCRI:
+		return &stages.StageConfig{CRIConfig: &stages.CRIConfig{}}, nil
+
+	case promtail_stages.StageTypePack:
+		var cfg promtail_stages.PackConfig
+		if err := mapstructure.WeakDecode(config, &cfg); err != nil {
+			return nil, err
+		}
+		res := stages.DefaultPackConfig
+		res.Labels = cfg.Labels
+		if cfg.IngestTimestamp != nil {
+			res.IngestTimestamp = *cfg.IngestTimestamp
+		}
+		return &stages.StageConfig{PackConfig: &res}, nil
+
+	case promtail_stages.StageTypeTenant:
+		var cfg promtail_stages.TenantConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{TenantConfig: &stages.TenantConfig{
+			Label:  cfg.Label,
+			Source: cfg.Source,
+			Value:  cfg.Value,
+		}}, nil
+
+	case promtail_stages.StageTypeLabelDrop:
+		var cfg promtail_stages.LabelDropConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{LabelDropConfig: &stages.LabelDropConfig{
+			Values: cfg,
+		}}, nil
+
+	case promtail_stages.StageTypeLabelAllow:
+		var cfg promtail_stages.LabelAllowConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{LabelAllowConfig: &stages.LabelAllowConfig{
+			Values: cfg,
+		}}, nil
+
+	case promtail_stages.StageTypeMetric:
+		var cfg promtail_stages.MetricsConfig
+		if err := mapstructure.Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		res, err := toMetricsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &stages.StageConfig{MetricsConfig: res}, nil
+	}
+
+	return nil, nil
+}
+
+// promtailMetricsPrefix is the prefix Promtail uses for metrics which don't
+// set one. It's set explicitly on converted metrics so that they keep their
+// names, as loki.process uses a different default prefix.
+const promtailMetricsPrefix = "promtail_custom_"
+
+// toMetricsConfig converts the metrics of a Promtail metrics stage. Metrics
+// are converted in the order of their names, as Promtail defines them in a
+// map.
+func toMetricsConfig(cfg promtail_stages.MetricsConfig) (*stages.MetricsConfig, error) {
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var res stages.MetricsConfig
+	for _, name := range names {
+		m := cfg[name]
+
+		var source string
+		if m.Source != nil {
+			source = *m.Source
+		}
+		prefix := m.Prefix
+		if prefix == "" {
+			prefix = promtailMetricsPrefix
+		}
+		var maxIdle time.Duration
+		if m.IdleDuration != nil {
+			d, err := time.ParseDuration(*m.IdleDuration)
+			if err != nil {
+				return nil, fmt.Errorf("metric %q: %w", name, err)
+			}
+			maxIdle = d
+		}
+
+		switch strings.ToLower(m.MetricType) {
+		case promtail_stages.MetricTypeCounter:
+			var c promtail_metric.CounterConfig
+			if err := mapstructure.Decode(m.Config, &c); err != nil {
+				return nil, fmt.Errorf("metric %q: %w", name, err)
+			}
+			res.Counters = append(res.Counters, metric.CounterConfig{
+				Name:            name,
+				Description:     m.Description,
+				Source:          source,
+				Prefix:          prefix,
+				MaxIdle:         maxIdle,
+				Value:           valueOrEmpty(c.Value),
+				Action:          c.Action,
+				MatchAll:        c.MatchAll != nil && *c.MatchAll,
+				CountEntryBytes: c.CountBytes != nil && *c.CountBytes,
+			})
+		case promtail_stages.MetricTypeGauge:
+			var g promtail_metric.GaugeConfig
+			if err := mapstructure.Decode(m.Config, &g); err != nil {
+				return nil, fmt.Errorf("metric %q: %w", name, err)
+			}
+			res.Gauges = append(res.Gauges, metric.GaugeConfig{
+				Name:        name,
+				Description: m.Description,
+				Source:      source,
+				Prefix:      prefix,
+				MaxIdle:     maxIdle,
+				Value:       valueOrEmpty(g.Value),
+				Action:      g.Action,
+			})
+		case promtail_stages.MetricTypeHistogram:
+			var h promtail_metric.HistogramConfig
+			if err := mapstructure.Decode(m.Config, &h); err != nil {
+				return nil, fmt.Errorf("metric %q: %w", name, err)
+			}
+			res.Histograms = append(res.Histograms, metric.HistogramConfig{
+				Name:        name,
+				Description: m.Description,
+				Source:      source,
+				Prefix:      prefix,
+				MaxIdle:     maxIdle,
+				Value:       valueOrEmpty(h.Value),
+				Buckets:     h.Buckets,
+			})
+		default:
+			return nil, fmt.Errorf(promtail_stages.ErrMetricsStageInvalidType, m.MetricType)
+		}
+	}
+	return &res, nil
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,193 @@
+// Package promtailconvert converts Promtail configuration into Grafana Agent
+// Flow components.
+package promtailconvert
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/discovery/file"
+	lokisourcefile "github.com/grafana/agent/component/loki/source/file"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/converter/internal/prometheusconvert"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	"github.com/grafana/loki/clients/pkg/promtail/client"
+	promtail_config "github.com/grafana/loki/clients/pkg/promtail/config"
+	"github.com/grafana/loki/clients/pkg/promtail/limit"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+	"github.com/grafana/loki/clients/pkg/promtail/scrapeconfig"
+	promtailfile "github.com/grafana/loki/clients/pkg/promtail/targets/file"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds the subset of Promtail configuration which can be converted.
+type Config struct {
+	ClientConfigs   []client.Config
+	PositionsConfig positions.Config
+	ScrapeConfigs   []scrapeconfig.Config
+	TargetConfig    promtailfile.Config
+	LimitsConfig    limit.Config
+}
+
+// Convert converts a Promtail config file into a River file holding Flow
+// components.
+func Convert(in []byte) ([]byte, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	promtailConfig, err := load(in)
+	if err != nil {
+		diags.Add(diag.SeverityLevelCritical, fmt.Sprintf("failed to parse Promtail config: %s", err))
+		return nil, diags
+	}
+
+	if len(promtailConfig.Options.StreamLagLabels) > 0 {
+		diags.Add(diag.SeverityLevelWarn, "stream_lag_labels is deprecated and was not converted")
+	}
+
+	f := builder.NewFile()
+	diags.AddAll(AppendAll(f, &Config{
+		ClientConfigs:   promtailConfig.ClientConfigs,
+		PositionsConfig: promtailConfig.PositionsConfig,
+		ScrapeConfigs:   promtailConfig.ScrapeConfig,
+		TargetConfig:    promtailConfig.TargetConfig,
+		LimitsConfig:    promtailConfig.LimitsConfig,
+	}, ""))
+
+	out, printDiags := common.PrettyPrint(f)
+	diags.AddAll(printDiags)
+	return out, diags
+}
+
+// load loads in as a Promtail config file, applying the same defaults as
+// Promtail does.
+func load(in []byte) (*promtail_config.Config, error) {
+	var cfg promtail_config.Config
+
+	// Promtail defaults are hidden behind flags. Register flags to a fake
+	// flagset just to set the defaults in the config.
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+
+	if err := yaml.UnmarshalStrict(in, &cfg); err != nil {
+		return nil, err
+	}
+
+	// The deprecated client block is used alongside clients.
+	if cfg.ClientConfig.URL.URL != nil {
+		cfg.ClientConfigs = append(cfg.ClientConfigs, cfg.ClientConfig)
+	}
+	return &cfg, nil
+}
+
+// AppendAll appends components to f which read the log files found by the
+// scrape configs in cfg and send them to the clients in cfg. labelPrefix, if
+// set, is prepended to the labels of all created components to allow
+// AppendAll to be called multiple times for the same file.
+func AppendAll(f *builder.File, cfg *Config, labelPrefix string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if cfg.PositionsConfig.PositionsFile != "" {
+		diags.Add(diag.SeverityLevelInfo, fmt.Sprintf("positions file %q was not converted; loki.source.file stores positions in its own data directory", cfg.PositionsConfig.PositionsFile))
+	}
+	if cfg.TargetConfig.Stdin {
+		diags.Add(diag.SeverityLevelError, "reading logs from stdin is not supported and was not converted")
+	}
+	if cfg.LimitsConfig.ReadlineRateEnabled {
+		diags.Add(diag.SeverityLevelError, "readline rate limits are not supported and were not converted")
+	}
+
+	var forwardTo []common.Expr
+	for i, clientConfig := range cfg.ClientConfigs {
+		label := "default"
+		if labelPrefix != "" {
+			label = common.LabelForParts(labelPrefix)
+		}
+		if len(cfg.ClientConfigs) > 1 {
+			label = common.LabelForParts(label, fmt.Sprint(i))
+		}
+
+		receiver, clientDiags := appendLokiWrite(f, label, &clientConfig, cfg.LimitsConfig.MaxStreams)
+		diags.AddAll(clientDiags)
+		forwardTo = append(forwardTo, receiver)
+	}
+	if len(forwardTo) == 0 && len(cfg.ScrapeConfigs) > 0 {
+		diags.Add(diag.SeverityLevelWarn, "no clients are configured; collected logs will not be sent anywhere")
+	}
+
+	for _, scrapeConfig := range cfg.ScrapeConfigs {
+		label := common.LabelForParts(labelPrefix, scrapeConfig.JobName)
+		diags.AddAll(appendScrapeConfig(f, label, &scrapeConfig, &cfg.TargetConfig, forwardTo))
+	}
+
+	return diags
+}
+
+// appendScrapeConfig appends the components to discover and tail the files
+// of scrapeConfig.
+func appendScrapeConfig(f *builder.File, label string, scrapeConfig *scrapeconfig.Config, targetConfig *promtailfile.Config, forwardTo []common.Expr) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for _, unsupported := range unsupportedTargets(scrapeConfig) {
+		diags.Add(diag.SeverityLevelError, fmt.Sprintf("%s in scrape config %q is not supported and was not converted", unsupported, scrapeConfig.JobName))
+	}
+
+	targets, sdDiags := prometheusconvert.AppendServiceDiscoveryConfigs(f, label, scrapeConfig.ServiceDiscoveryConfig.Configs())
+	diags.AddAll(sdDiags)
+	if len(targets) == 0 {
+		// Nothing to tail for this scrape config.
+		return diags
+	}
+
+	if len(scrapeConfig.RelabelConfigs) > 0 {
+		output, relabelDiags := prometheusconvert.AppendDiscoveryRelabel(f, label, targets, scrapeConfig.RelabelConfigs)
+		diags.AddAll(relabelDiags)
+		targets = []discovery.Target{common.ExprTarget(output)}
+	}
+
+	// Promtail expands globs in __path__, which Flow does through discovery.file.
+	fileArgs := &file.Arguments{
+		PathTargets: targets,
+		SyncPeriod:  targetConfig.SyncPeriod,
+	}
+	f.Body().AppendBlock(common.NewBlockWithOverride([]string{"discovery", "file"}, label, fileArgs))
+
+	if len(scrapeConfig.PipelineStages) > 0 {
+		receiver, processDiags := appendLokiProcess(f, label, scrapeConfig.PipelineStages, forwardTo)
+		diags.AddAll(processDiags)
+		forwardTo = []common.Expr{receiver}
+	}
+
+	sourceArgs := lokisourcefile.DefaultArguments
+	sourceArgs.Targets = []discovery.Target{common.ExprTarget(common.Expr(fmt.Sprintf("discovery.file.%s.targets", label)))}
+	sourceArgs.Encoding = scrapeConfig.Encoding
+	block := common.NewBlockWithOverride([]string{"loki", "source", "file"}, label, &sourceArgs)
+	block.Body().SetAttributeValue("forward_to", forwardTo)
+	f.Body().AppendBlock(block)
+
+	return diags
+}
+
+// unsupportedTargets returns the names of the non-file targets configured in
+// scrapeConfig.
+func unsupportedTargets(scrapeConfig *scrapeconfig.Config) []string {
+	var names []string
+	add := func(set bool, name string) {
+		if set {
+			names = append(names, name)
+		}
+	}
+
+	add(scrapeConfig.JournalConfig != nil, "journal")
+	add(scrapeConfig.SyslogConfig != nil, "syslog")
+	add(scrapeConfig.GcplogConfig != nil, "gcplog")
+	add(scrapeConfig.PushConfig != nil, "loki_push_api")
+	add(scrapeConfig.WindowsConfig != nil, "windows_events")
+	add(scrapeConfig.KafkaConfig != nil, "kafka")
+	add(scrapeConfig.GelfConfig != nil, "gelf")
+	add(scrapeConfig.CloudflareConfig != nil, "cloudflare")
+	add(scrapeConfig.HerokuDrainConfig != nil, "heroku_drain")
+	add(len(scrapeConfig.DockerSDConfigs) > 0, "docker_sd_configs")
+	return names
+}
@@ -0,0 +1,221 @@
+package staticconvert
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/grafana/agent/component/discovery"
+	flow_node_exporter "github.com/grafana/agent/component/prometheus/integration/node_exporter"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/converter/internal/prometheusconvert"
+	"github.com/grafana/agent/pkg/config"
+	"github.com/grafana/agent/pkg/integrations"
+	"github.com/grafana/agent/pkg/integrations/node_exporter"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	"github.com/prometheus/common/model"
+	prom_config "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// appendIntegrations appends the components for each enabled integration
+// along with the components needed to scrape them.
+func appendIntegrations(f *builder.File, staticConfig *config.Config) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	managerConfig := staticConfig.Integrations.ConfigV1()
+	if managerConfig == nil {
+		if !staticConfig.Integrations.IsZero() {
+			diags.Add(diag.SeverityLevelError, "integrations-next is not supported and was not converted")
+		}
+		return diags
+	}
+
+	// The remote_write component is only created once an integration needs to
+	// be scraped.
+	var forwardTo []common.Expr
+	getForwardTo := func() []common.Expr {
+		if forwardTo == nil && len(managerConfig.PrometheusRemoteWrite) > 0 {
+			receiver, rwDiags := prometheusconvert.AppendRemoteWrite(f, "integrations", managerConfig.PrometheusRemoteWrite, staticConfig.Metrics.Global.Prometheus.ExternalLabels)
+			diags.AddAll(rwDiags)
+			forwardTo = []common.Expr{receiver}
+		}
+		return forwardTo
+	}
+
+	for _, integration := range managerConfig.Integrations {
+		if !integration.Common.Enabled {
+			continue
+		}
+
+		var targets common.Expr
+		switch integrationConfig := integration.Config.(type) {
+		case *node_exporter.Config:
+			args := toNodeExporter(integrationConfig)
+			f.Body().AppendBlock(common.NewBlockWithOverride([]string{"prometheus", "integration", "node_exporter"}, "", args))
+			targets = common.Expr("prometheus.integration.node_exporter.targets")
+		default:
+			diags.Add(diag.SeverityLevelError, fmt.Sprintf("the %s integration is not supported and was not converted", integration.Name()))
+			continue
+		}
+
+		scrapeIntegration := managerConfig.ScrapeIntegrations
+		if integration.Common.ScrapeIntegration != nil {
+			scrapeIntegration = *integration.Common.ScrapeIntegration
+		}
+		if !scrapeIntegration {
+			continue
+		}
+
+		forwardTo := getForwardTo()
+		if len(forwardTo) == 0 {
+			diags.Add(diag.SeverityLevelWarn, fmt.Sprintf("no remote_write is configured; metrics from the %s integration will not be sent anywhere", integration.Name()))
+		}
+
+		scrapeConfig := toIntegrationScrapeConfig(managerConfig, &integration, staticConfig.Metrics.Global.Prometheus)
+		label := common.LabelForParts("integrations", integration.Name())
+		diags.AddAll(prometheusconvert.AppendScrape(f, label, scrapeConfig, []discovery.Target{common.ExprTarget(targets)}, forwardTo))
+	}
+
+	return diags
+}
+
+// toIntegrationScrapeConfig returns the scrape config used by the
+// integrations manager to scrape integration.
+func toIntegrationScrapeConfig(managerConfig *integrations.ManagerConfig, integration *integrations.UnmarshaledConfig, global prom_config.GlobalConfig) *prom_config.ScrapeConfig {
+	scrapeConfig := prom_config.DefaultScrapeConfig
+	scrapeConfig.JobName = fmt.Sprintf("integrations/%s", integration.Name())
+	scrapeConfig.ScrapeInterval = model.Duration(integration.Common.ScrapeInterval)
+	scrapeConfig.ScrapeTimeout = model.Duration(integration.Common.ScrapeTimeout)
+	scrapeConfig.MetricRelabelConfigs = integration.Common.MetricRelabelConfigs
+
+	if scrapeConfig.ScrapeInterval == 0 {
+		scrapeConfig.ScrapeInterval = global.ScrapeInterval
+	}
+	if scrapeConfig.ScrapeTimeout == 0 {
+		scrapeConfig.ScrapeTimeout = global.ScrapeTimeout
+		if scrapeConfig.ScrapeTimeout > scrapeConfig.ScrapeInterval {
+			scrapeConfig.ScrapeTimeout = scrapeConfig.ScrapeInterval
+		}
+	}
+
+	// The integrations manager attaches its labels and the instance key to
+	// the scraped target.
+	var relabelConfigs []*relabel.Config
+	for _, name := range sortedLabelNames(managerConfig.Labels) {
+		relabelConfigs = append(relabelConfigs, replaceLabel(string(name), string(managerConfig.Labels[name])))
+	}
+	if integration.Common.InstanceKey != nil {
+		relabelConfigs = append(relabelConfigs, replaceLabel(model.InstanceLabel, *integration.Common.InstanceKey))
+	}
+	scrapeConfig.RelabelConfigs = append(relabelConfigs, integration.Common.RelabelConfigs...)
+
+	return &scrapeConfig
+}
+
+// replaceLabel returns a relabel config which sets the label name to value.
+func replaceLabel(name, value string) *relabel.Config {
+	rc := relabel.DefaultRelabelConfig
+	rc.TargetLabel = name
+	rc.Replacement = value
+	return &rc
+}
+
+func sortedLabelNames(ls model.LabelSet) model.LabelNames {
+	names := make(model.LabelNames, 0, len(ls))
+	for name := range ls {
+		names = append(names, name)
+	}
+	sort.Sort(names)
+	return names
+}
+
+// toNodeExporter converts the node_exporter integration config into the
+// arguments of prometheus.integration.node_exporter. It is the inverse of
+// flow_node_exporter.Config.Convert.
+func toNodeExporter(c *node_exporter.Config) *flow_node_exporter.Config {
+	return &flow_node_exporter.Config{
+		IncludeExporterMetrics: c.IncludeExporterMetrics,
+		ProcFSPath:             c.ProcFSPath,
+		SysFSPath:              c.SysFSPath,
+		RootFSPath:             c.RootFSPath,
+		EnableCollectors:       c.EnableCollectors,
+		DisableCollectors:      c.DisableCollectors,
+		SetCollectors:          c.SetCollectors,
+
+		BCache: flow_node_exporter.BCacheConfig{
+			PriorityStats: c.BcachePriorityStats,
+		},
+		CPU: flow_node_exporter.CPUConfig{
+			BugsInclude:    c.CPUBugsInclude,
+			EnableCPUGuest: c.CPUEnableCPUGuest,
+			EnableCPUInfo:  c.CPUEnableCPUInfo,
+			FlagsInclude:   c.CPUFlagsInclude,
+		},
+		Disk: flow_node_exporter.DiskStatsConfig{
+			IgnoredDevices: c.DiskStatsIgnoredDevices,
+		},
+		EthTool: flow_node_exporter.EthToolConfig{
+			DeviceExclude:  c.EthtoolDeviceExclude,
+			DeviceInclude:  c.EthtoolDeviceInclude,
+			MetricsInclude: c.EthtoolMetricsInclude,
+		},
+		Filesystem: flow_node_exporter.FilesystemConfig{
+			FSTypesExclude:     c.FilesystemFSTypesExclude,
+			MountPointsExclude: c.FilesystemMountPointsExclude,
+			MountTimeout:       c.FilesystemMountTimeout,
+		},
+		IPVS: flow_node_exporter.IPVSConfig{
+			BackendLabels: c.IPVSBackendLabels,
+		},
+		NTP: flow_node_exporter.NTPConfig{
+			IPTTL:                c.NTPIPTTL,
+			LocalOffsetTolerance: c.NTPLocalOffsetTolerance,
+			MaxDistance:          c.NTPMaxDistance,
+			ProtocolVersion:      c.NTPProtocolVersion,
+			Server:               c.NTPServer,
+			ServerIsLocal:        c.NTPServerIsLocal,
+		},
+		Netclass: flow_node_exporter.NetclassConfig{
+			IgnoreInvalidSpeedDevice: c.NetclassIgnoreInvalidSpeedDevice,
+			IgnoredDevices:           c.NetclassIgnoredDevices,
+		},
+		Netdev: flow_node_exporter.NetdevConfig{
+			AddressInfo:   c.NetdevAddressInfo,
+			DeviceExclude: c.NetdevDeviceExclude,
+			DeviceInclude: c.NetdevDeviceInclude,
+		},
+		Netstat: flow_node_exporter.NetstatConfig{
+			Fields: c.NetstatFields,
+		},
+		Perf: flow_node_exporter.PerfConfig{
+			CPUS:       c.PerfCPUS,
+			Tracepoint: c.PerfTracepoint,
+		},
+		Powersupply: flow_node_exporter.PowersupplyConfig{
+			IgnoredSupplies: c.PowersupplyIgnoredSupplies,
+		},
+		Runit: flow_node_exporter.RunitConfig{
+			ServiceDir: c.RunitServiceDir,
+		},
+		Supervisord: flow_node_exporter.SupervisordConfig{
+			URL: c.SupervisordURL,
+		},
+		Systemd: flow_node_exporter.SystemdConfig{
+			EnableRestartsMetrics:  c.SystemdEnableRestartsMetrics,
+			EnableStartTimeMetrics: c.SystemdEnableStartTimeMetrics,
+			EnableTaskMetrics:      c.SystemdEnableTaskMetrics,
+			UnitExclude:            c.SystemdUnitExclude,
+			UnitInclude:            c.SystemdUnitInclude,
+		},
+		Tapestats: flow_node_exporter.TapestatsConfig{
+			IgnoredDevices: c.TapestatsIgnoredDevices,
+		},
+		Textfile: flow_node_exporter.TextfileConfig{
+			Directory: c.TextfileDirectory,
+		},
+		VMStat: flow_node_exporter.VMStatConfig{
+			Fields: c.VMStatFields,
+		},
+	}
+}
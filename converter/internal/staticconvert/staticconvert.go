@@ -0,0 +1,146 @@
+// Package staticconvert converts Grafana Agent static mode configuration into
+// Grafana Agent Flow components.
+package staticconvert
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drone/envsubst/v2"
+
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/converter/internal/common"
+	"github.com/grafana/agent/converter/internal/prometheusconvert"
+	"github.com/grafana/agent/converter/internal/promtailconvert"
+	"github.com/grafana/agent/pkg/config"
+	"github.com/grafana/agent/pkg/logs"
+	"github.com/grafana/agent/pkg/metrics"
+	"github.com/grafana/agent/pkg/river/token/builder"
+	prom_config "github.com/prometheus/prometheus/config"
+
+	// Register the integrations so they can be unmarshaled.
+	_ "github.com/grafana/agent/pkg/integrations/install"
+)
+
+// Convert converts a static mode config file into a River file holding Flow
+// components.
+func Convert(in []byte) ([]byte, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	staticConfig, err := load(in)
+	if err != nil {
+		diags.Add(diag.SeverityLevelCritical, fmt.Sprintf("failed to parse static mode config: %s", err))
+		return nil, diags
+	}
+
+	if names := envVarReferences(in); len(names) > 0 {
+		diags.Add(diag.SeverityLevelWarn, fmt.Sprintf("environment variable references to %s were not expanded and were converted as is; use the env function instead, for example env(%q)", strings.Join(names, ", "), names[0]))
+	}
+
+	f := builder.NewFile()
+	diags.AddAll(AppendAll(f, staticConfig))
+
+	out, printDiags := common.PrettyPrint(f)
+	diags.AddAll(printDiags)
+	return out, diags
+}
+
+// load loads in as a static mode config file, applying the same defaults as
+// the agent does when it starts up. Environment variables in in aren't
+// expanded, so that the values of the variables on the machine running the
+// conversion, which may be secrets, never end up in the output.
+func load(in []byte) (*config.Config, error) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	args := []string{"-config.file", "convert"}
+
+	return config.LoadFromFunc(fs, args, func(_, _ string, expandEnvVars bool, c *config.Config) error {
+		return config.LoadBytes(in, expandEnvVars, c)
+	})
+}
+
+// envVarReferences returns the sorted names of the environment variables
+// referenced in in, which the agent would expand when started with
+// -config.expand-env.
+func envVarReferences(in []byte) []string {
+	found := make(map[string]struct{})
+	_, err := envsubst.Eval(string(in), func(name string) string {
+		// Numeric names are regex capture groups, which aren't expanded.
+		if strings.Trim(name, "0123456789") != "" {
+			found[name] = struct{}{}
+		}
+		return ""
+	})
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AppendAll appends components to f which implement the subsystems of
+// staticConfig.
+func AppendAll(f *builder.File, staticConfig *config.Config) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	diags.AddAll(appendMetrics(f, &staticConfig.Metrics))
+	diags.AddAll(appendLogs(f, staticConfig.Logs))
+	diags.AddAll(appendIntegrations(f, staticConfig))
+
+	if len(staticConfig.Traces.Configs) > 0 {
+		diags.Add(diag.SeverityLevelError, "traces are not supported and were not converted")
+	}
+
+	return diags
+}
+
+// appendMetrics appends the components for each metrics instance. Component
+// labels are prefixed with the name of the instance.
+func appendMetrics(f *builder.File, metricsConfig *metrics.Config) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if metricsConfig.ServiceConfig.Enabled {
+		diags.Add(diag.SeverityLevelError, "the scraping service is not supported and was not converted")
+	}
+
+	for _, instanceConfig := range metricsConfig.Configs {
+		if instanceConfig.HostFilter {
+			diags.Add(diag.SeverityLevelError, fmt.Sprintf("host_filter in metrics instance %q is not supported and was not converted", instanceConfig.Name))
+		}
+
+		promConfig := &prom_config.Config{
+			GlobalConfig:       metricsConfig.Global.Prometheus,
+			ScrapeConfigs:      instanceConfig.ScrapeConfigs,
+			RemoteWriteConfigs: instanceConfig.RemoteWrite,
+		}
+		diags.AddAll(prometheusconvert.AppendAll(f, promConfig, instanceConfig.Name))
+	}
+
+	return diags
+}
+
+// appendLogs appends the components for each logs instance. Component labels
+// are prefixed with the name of the instance.
+func appendLogs(f *builder.File, logsConfig *logs.Config) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if logsConfig == nil {
+		return diags
+	}
+
+	for _, instanceConfig := range logsConfig.Configs {
+		diags.AddAll(promtailconvert.AppendAll(f, &promtailconvert.Config{
+			ClientConfigs:   instanceConfig.ClientConfigs,
+			PositionsConfig: instanceConfig.PositionsConfig,
+			ScrapeConfigs:   instanceConfig.ScrapeConfig,
+			TargetConfig:    instanceConfig.TargetConfig,
+		}, instanceConfig.Name))
+	}
+
+	return diags
+}
@@ -0,0 +1,118 @@
+// Package test_common holds helpers shared by the tests of the individual
+// converters.
+package test_common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/converter/diag"
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/grafana/agent/pkg/river/vm"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	diagsSuffix = ".diags"
+	riverSuffix = ".river"
+)
+
+// TestDirectory converts every file in folderPath ending in inputSuffix with
+// convert. The output is compared against the file of the same name ending
+// in .river, and the diagnostics are compared against the file of the same
+// name ending in .diags, which holds one diagnostic per line. A missing
+// .diags file means no diagnostics are expected.
+//
+// The output is also decoded into the Arguments of each component it
+// declares to ensure it can be loaded by Flow.
+func TestDirectory(t *testing.T, folderPath string, inputSuffix string, convert func([]byte) ([]byte, diag.Diagnostics)) {
+	inputs, err := filepath.Glob(filepath.Join(folderPath, "*"+inputSuffix))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	for _, input := range inputs {
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), inputSuffix)
+		basePath := strings.TrimSuffix(input, inputSuffix)
+
+		t.Run(name, func(t *testing.T) {
+			inputBytes, err := os.ReadFile(input)
+			require.NoError(t, err)
+
+			actual, diags := convert(inputBytes)
+
+			var expectDiags []string
+			if bb, err := os.ReadFile(basePath + diagsSuffix); err == nil {
+				expectDiags = strings.Split(strings.TrimSpace(string(bb)), "\n")
+			}
+			var actualDiags []string
+			for _, d := range diags {
+				actualDiags = append(actualDiags, d.Error())
+			}
+			require.Equal(t, expectDiags, actualDiags)
+
+			expectBytes, err := os.ReadFile(basePath + riverSuffix)
+			require.NoError(t, err)
+			require.Equal(t, string(expectBytes), string(actual))
+
+			ValidateRiver(t, actual)
+		})
+	}
+}
+
+// ValidateRiver evaluates every component block in river into the Arguments
+// of the component. References to other components resolve to the zero value
+// of their exports, the same as before the referenced components have run.
+func ValidateRiver(t *testing.T, river []byte) {
+	t.Helper()
+
+	f, err := parser.ParseFile("converted.river", river)
+	require.NoError(t, err)
+
+	var (
+		scope  = &vm.Scope{Variables: make(map[string]interface{})}
+		blocks []*ast.BlockStmt
+		regs   []component.Registration
+	)
+	for _, stmt := range f.Body {
+		block, ok := stmt.(*ast.BlockStmt)
+		require.True(t, ok, "unexpected statement %T in converted file", stmt)
+
+		name := strings.Join(block.Name, ".")
+		reg, ok := component.Get(name)
+		require.True(t, ok, "unrecognized component %q", name)
+
+		path := block.Name
+		if block.Label != "" {
+			path = append(append([]string{}, block.Name...), block.Label)
+		}
+		setNested(scope.Variables, path, reg.Exports)
+
+		blocks = append(blocks, block)
+		regs = append(regs, reg)
+	}
+
+	for i, block := range blocks {
+		args := regs[i].CloneArguments()
+		err := vm.New(block.Body).Evaluate(scope, args)
+		require.NoError(t, err, "failed to decode arguments of %s %q", strings.Join(block.Name, "."), block.Label)
+	}
+}
+
+// setNested sets the value at path within a tree of maps, creating
+// intermediate maps as needed.
+func setNested(m map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
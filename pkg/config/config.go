@@ -360,6 +360,13 @@ func Load(fs *flag.FlagSet, args []string) (*Config, error) {
 
 type loaderFunc func(path string, fileType string, expandArgs bool, target *Config) error
 
+// LoadFromFunc loads a config like Load, but retrieves the config file using
+// loader instead of reading it from the path given by the flags. This allows
+// loading configs which don't exist on disk.
+func LoadFromFunc(fs *flag.FlagSet, args []string, loader func(path string, fileType string, expandArgs bool, target *Config) error) (*Config, error) {
+	return load(fs, args, loader)
+}
+
 // load allows for tests to inject a function for retrieving the config file that
 // doesn't require having a literal file on disk.
 func load(fs *flag.FlagSet, args []string, loader loaderFunc) (*Config, error) {
@@ -115,6 +115,12 @@ func (c *VersionedIntegrations) setVersion(v integrationsVersion) error {
 	}
 }
 
+// ConfigV1 returns the config of the integrations v1 subsystem. It returns
+// nil if the integrations-next feature is in use.
+func (c *VersionedIntegrations) ConfigV1() *v1.ManagerConfig {
+	return c.configV1
+}
+
 // EnabledIntegrations returns a slice of enabled integrations
 func (c *VersionedIntegrations) EnabledIntegrations() []string {
 	integrations := map[string]struct{}{}
@@ -85,67 +85,11 @@ func configTraversals(cn *ConfigNode) []Traversal {
 // expressionsFromSyntaxBody recurses through body and finds all variable
 // references.
 func expressionsFromBody(body ast.Body) []Traversal {
-	var w traversalWalker
-	ast.Walk(&w, body)
-
-	// Flush after the walk in case there was an in-progress traversal.
-	w.flush()
-	return w.traversals
-}
-
-type traversalWalker struct {
-	traversals []Traversal
-
-	buildTraversal   bool      // Whether
-	currentTraversal Traversal // currentTraversal being built.
-}
-
-func (tw *traversalWalker) Visit(node ast.Node) ast.Visitor {
-	switch n := node.(type) {
-	case *ast.IdentifierExpr:
-		// Identifiers always start new traversals. Pop the last one.
-		tw.flush()
-		tw.buildTraversal = true
-		tw.currentTraversal = append(tw.currentTraversal, n.Ident)
-
-	case *ast.AccessExpr:
-		ast.Walk(tw, n.Value)
-
-		// Fields being accessed should get only added to the traversal if one is
-		// being built. This will be false for accesses like a().foo.
-		if tw.buildTraversal {
-			tw.currentTraversal = append(tw.currentTraversal, n.Name)
-		}
-		return nil
-
-	case *ast.IndexExpr:
-		// Indexing interrupts traversals so we flush after walking the value.
-		ast.Walk(tw, n.Value)
-		tw.flush()
-		ast.Walk(tw, n.Index)
-		return nil
-
-	case *ast.CallExpr:
-		// Calls interrupt traversals so we flush after walking the value.
-		ast.Walk(tw, n.Value)
-		tw.flush()
-		for _, arg := range n.Args {
-			ast.Walk(tw, arg)
-		}
-		return nil
-	}
-
-	return tw
-}
-
-// flush will flush the in-progress traversal to the traversals list and unset
-// the buildTraversal state.
-func (tw *traversalWalker) flush() {
-	if tw.buildTraversal && len(tw.currentTraversal) > 0 {
-		tw.traversals = append(tw.traversals, tw.currentTraversal)
+	var res []Traversal
+	for _, t := range ast.Traversals(body) {
+		res = append(res, Traversal(t))
 	}
-	tw.buildTraversal = false
-	tw.currentTraversal = nil
+	return res
 }
 
 func resolveTraversal(t Traversal, g *dag.Graph) (Reference, diag.Diagnostics) {
@@ -0,0 +1,103 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/flow/internal/controller"
+	"github.com/grafana/agent/pkg/flow/internal/dag"
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestComponentReferences(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		expect []string // Referenced node ID followed by its traversal.
+	}{
+		{
+			name:   "field access",
+			input:  `testcomponents.passthrough.a.output`,
+			expect: []string{"testcomponents.passthrough.a output"},
+		},
+		{
+			// Accesses after an index aren't part of the traversal of either the
+			// indexed value or the index.
+			name:  "access after index",
+			input: `testcomponents.passthrough.a.output[testcomponents.passthrough.b.output].field`,
+			expect: []string{
+				"testcomponents.passthrough.a output",
+				"testcomponents.passthrough.b output",
+			},
+		},
+		{
+			// Accesses after a call aren't part of the traversal of its last
+			// argument.
+			name:   "access after call",
+			input:  `env(testcomponents.passthrough.a.output).field`,
+			expect: []string{"testcomponents.passthrough.a output"},
+		},
+		{
+			name:  "call arguments",
+			input: `concat(testcomponents.passthrough.a.output, testcomponents.passthrough.b.output)`,
+			expect: []string{
+				"testcomponents.passthrough.a output",
+				"testcomponents.passthrough.b output",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			g := buildReferencesGraph(t, `
+				testcomponents.passthrough "a" {
+					input = "a"
+				}
+
+				testcomponents.passthrough "b" {
+					input = "b"
+				}
+
+				testcomponents.passthrough "test" {
+					input = `+tc.input+`
+				}
+			`)
+
+			refs, diags := controller.ComponentReferences(g.GetByID("testcomponents.passthrough.test"), g)
+			require.NoError(t, diags.ErrorOrNil())
+
+			var actual []string
+			for _, ref := range refs {
+				actual = append(actual, ref.Target.NodeID()+" "+ast.Traversal(ref.Traversal).String())
+			}
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+// buildReferencesGraph returns a graph with a node for every component in
+// content, without evaluating them.
+func buildReferencesGraph(t *testing.T, content string) *dag.Graph {
+	t.Helper()
+
+	file, err := parser.ParseFile(t.Name(), []byte(content))
+	require.NoError(t, err)
+
+	globals := controller.ComponentGlobals{
+		Logger:          log.NewNopLogger(),
+		TraceProvider:   trace.NewNoopTracerProvider(),
+		DataPath:        t.TempDir(),
+		OnExportsChange: func(cn *controller.ComponentNode) { /* no-op */ },
+		Registerer:      prometheus.NewRegistry(),
+	}
+
+	var g dag.Graph
+	for _, stmt := range file.Body {
+		g.Add(controller.NewComponentNode(globals, stmt.(*ast.BlockStmt)))
+	}
+	return &g
+}
@@ -27,6 +27,7 @@ var (
 	_ river.Capsule                = OptionalSecret{}
 	_ river.ConvertibleIntoCapsule = OptionalSecret{}
 	_ river.ConvertibleFromCapsule = (*OptionalSecret)(nil)
+	_ river.SecretCapsule          = OptionalSecret{}
 
 	_ builder.Tokenizer = OptionalSecret{}
 )
@@ -34,6 +35,15 @@ var (
 // RiverCapsule marks OptionalSecret as a RiverCapsule.
 func (s OptionalSecret) RiverCapsule() {}
 
+// RiverSecret returns the contents of the OptionalSecret. The contents are
+// only sensitive if IsSecret is true.
+func (s OptionalSecret) RiverSecret() (string, bool) { return s.Value, s.IsSecret }
+
+// RiverDeriveSecret returns a new sensitive OptionalSecret holding text.
+func (s OptionalSecret) RiverDeriveSecret(text string) interface{} {
+	return OptionalSecret{IsSecret: true, Value: text}
+}
+
 // ConvertInto converts the OptionalSecret and stores it into the Go value
 // pointed at by dst. OptionalSecrets can always be converted into *Secret.
 // OptionalSecrets can only be converted into *string if IsSecret is false. In
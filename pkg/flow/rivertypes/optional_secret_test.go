@@ -70,6 +70,22 @@ func TestOptionalSecret(t *testing.T) {
 	})
 }
 
+func TestOptionalSecret_Stdlib(t *testing.T) {
+	t.Run("non-sensitive values produce strings", func(t *testing.T) {
+		var s string
+		err := evalTo(t, `base64_encode(val)`, rivertypes.OptionalSecret{Value: "foo"}, &s)
+		require.NoError(t, err)
+		require.Equal(t, "Zm9v", s)
+	})
+
+	t.Run("sensitive values produce secrets", func(t *testing.T) {
+		var s rivertypes.OptionalSecret
+		err := evalTo(t, `base64_encode(val)`, rivertypes.OptionalSecret{IsSecret: true, Value: "foo"}, &s)
+		require.NoError(t, err)
+		require.Equal(t, rivertypes.OptionalSecret{IsSecret: true, Value: "Zm9v"}, s)
+	})
+}
+
 func TestOptionalSecret_Write(t *testing.T) {
 	tt := []struct {
 		name   string
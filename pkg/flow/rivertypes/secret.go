@@ -20,6 +20,7 @@ var (
 	_ river.Capsule                = Secret("")
 	_ river.ConvertibleIntoCapsule = Secret("")
 	_ river.ConvertibleFromCapsule = (*Secret)(nil)
+	_ river.SecretCapsule          = Secret("")
 
 	_ builder.Tokenizer = Secret("")
 )
@@ -27,6 +28,13 @@ var (
 // RiverCapsule marks Secret as a RiverCapsule.
 func (s Secret) RiverCapsule() {}
 
+// RiverSecret returns the contents of the Secret. Secrets are always
+// sensitive.
+func (s Secret) RiverSecret() (string, bool) { return string(s), true }
+
+// RiverDeriveSecret returns a new Secret holding text.
+func (s Secret) RiverDeriveSecret(text string) interface{} { return Secret(text) }
+
 // ConvertInto converts the Secret and stores it into the Go value pointed at
 // by dst. Secrets can be converted into *OptionalSecret. In other cases, this
 // method will return an explicit error or river.ErrNoConversion.
@@ -0,0 +1,88 @@
+package ast
+
+import "strings"
+
+// Traversal is an uninterrupted sequence of identifiers accessed from a
+// variable. For an expression "a.b.c[0].d", the Traversal is (a, b, c).
+type Traversal []*Ident
+
+// String returns the dot-separated names of the identifiers in t.
+func (t Traversal) String() string {
+	names := make([]string, len(t))
+	for i, ident := range t {
+		names[i] = ident.Name
+	}
+	return strings.Join(names, ".")
+}
+
+// Traversals returns every variable reference made within node, in the order
+// they appear. Field accesses on the result of an index or a function call
+// aren't part of a Traversal; for an expression "f(a.b).c", the only Traversals
+// are (f) and (a, b).
+func Traversals(node Node) []Traversal {
+	var w traversalWalker
+	Walk(&w, node)
+
+	// Flush after the walk in case there was an in-progress traversal.
+	w.flush()
+	return w.traversals
+}
+
+type traversalWalker struct {
+	traversals []Traversal
+
+	buildTraversal   bool      // Whether a traversal is being built.
+	currentTraversal Traversal // currentTraversal being built.
+}
+
+func (tw *traversalWalker) Visit(node Node) Visitor {
+	switch n := node.(type) {
+	case *IdentifierExpr:
+		// Identifiers always start new traversals. Pop the last one.
+		tw.flush()
+		tw.buildTraversal = true
+		tw.currentTraversal = append(tw.currentTraversal, n.Ident)
+
+	case *AccessExpr:
+		Walk(tw, n.Value)
+
+		// Fields being accessed should get only added to the traversal if one is
+		// being built. This will be false for accesses like a().foo.
+		if tw.buildTraversal {
+			tw.currentTraversal = append(tw.currentTraversal, n.Name)
+		}
+		return nil
+
+	case *IndexExpr:
+		// Indexing interrupts traversals so we flush after walking the value.
+		Walk(tw, n.Value)
+		tw.flush()
+		Walk(tw, n.Index)
+		tw.flush()
+		return nil
+
+	case *CallExpr:
+		// Calls interrupt traversals so we flush after walking the value.
+		Walk(tw, n.Value)
+		tw.flush()
+		for _, arg := range n.Args {
+			Walk(tw, arg)
+		}
+		// Flush again so accesses on the result of the call, such as a().foo,
+		// aren't added to the traversal of the last argument.
+		tw.flush()
+		return nil
+	}
+
+	return tw
+}
+
+// flush will flush the in-progress traversal to the traversals list and unset
+// the buildTraversal state.
+func (tw *traversalWalker) flush() {
+	if tw.buildTraversal && len(tw.currentTraversal) > 0 {
+		tw.traversals = append(tw.traversals, tw.currentTraversal)
+	}
+	tw.buildTraversal = false
+	tw.currentTraversal = nil
+}
@@ -0,0 +1,67 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraversals(t *testing.T) {
+	tt := []struct {
+		input  string
+		expect []string
+	}{
+		{`1 + 2`, nil},
+		{`a.b.c`, []string{"a.b.c"}},
+		{`a.b[0].c`, []string{"a.b"}},
+		{`f(a.b).c`, []string{"f", "a.b"}},
+		{`concat(x, [y.z, 3], {k = w})`, []string{"concat", "x", "y.z", "w"}},
+		{`a[b.c]`, []string{"a", "b.c"}},
+		{`a[b.c].d`, []string{"a", "b.c"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			expr, err := parser.ParseExpression(tc.input)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, tr := range ast.Traversals(expr) {
+				actual = append(actual, tr.String())
+			}
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	f, err := parser.ParseFile("", []byte(`
+		attr = 5
+		block "label" {
+			inner { value = true }
+		}
+	`))
+	require.NoError(t, err)
+
+	var blocks []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BlockStmt); ok {
+			blocks = append(blocks, b.Name[0])
+		}
+		return true
+	})
+	require.Equal(t, []string{"block", "inner"}, blocks)
+
+	// Returning false skips children.
+	blocks = nil
+	ast.Inspect(f, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BlockStmt); ok {
+			blocks = append(blocks, b.Name[0])
+			return false
+		}
+		return true
+	})
+	require.Equal(t, []string{"block"}, blocks)
+}
@@ -93,3 +93,26 @@ func (ds Diagnostics) HasErrors() bool {
 	}
 	return false
 }
+
+// AttributeError reports that the value of a specific attribute is invalid.
+// Implementations of river.Unmarshaler can return an AttributeError (or an
+// error wrapping one) from UnmarshalRiver to have the error converted into a
+// Diagnostic which points at the attribute in the source text.
+type AttributeError struct {
+	Name string // Name of the invalid attribute.
+	Err  error  // Reason the attribute is invalid.
+}
+
+// AttributeErrorf returns an AttributeError for the attribute name with a
+// reason formatted according to format.
+func AttributeErrorf(name string, format string, args ...interface{}) AttributeError {
+	return AttributeError{Name: name, Err: fmt.Errorf(format, args...)}
+}
+
+// Error implements error.
+func (e AttributeError) Error() string {
+	return fmt.Sprintf("attribute %q %s", e.Name, e.Err)
+}
+
+// Unwrap returns the reason the attribute is invalid.
+func (e AttributeError) Unwrap() error { return e.Err }
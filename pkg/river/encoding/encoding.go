@@ -43,6 +43,15 @@ func isFieldValue(val value.Value) bool {
 
 // convertValue is used to transform the underlying value of a river tag to a field
 func convertValue(val value.Value) (*valueField, error) {
+	// Sensitive secrets must never be exposed, even if they don't implement a
+	// custom tokenizer.
+	if _, _, sensitive, ok := value.SecretText(val); ok && sensitive {
+		return &valueField{
+			Type:  "capsule",
+			Value: "(secret)",
+		}, nil
+	}
+
 	// Handle items that explicitly use tokenizer, these are always considered capsule values.
 	if tkn, ok := val.Interface().(builder.Tokenizer); ok {
 		tokens := tkn.RiverTokenize()
@@ -29,3 +29,54 @@ func TestConvertRiverBodyToJSON_CapsuleValue(t *testing.T) {
 
 	require.JSONEq(t, expect, string(out))
 }
+
+type testSecret string
+
+func (s testSecret) RiverCapsule()                             {}
+func (s testSecret) RiverSecret() (string, bool)               { return string(s), true }
+func (s testSecret) RiverDeriveSecret(text string) interface{} { return testSecret(text) }
+
+func TestConvertRiverBodyToJSON_SecretValue(t *testing.T) {
+	type Content struct {
+		Field  testSecret            `river:"field,attr"`
+		Array  []testSecret          `river:"array,attr"`
+		Object map[string]testSecret `river:"object,attr"`
+	}
+
+	out, err := encoding.ConvertRiverBodyToJSON(Content{
+		Field:  "sensitive",
+		Array:  []testSecret{"sensitive"},
+		Object: map[string]testSecret{"key": "sensitive"},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, string(out), "sensitive")
+
+	expect := `[
+		{
+			"name": "field",
+			"type": "attr",
+			"value": {
+				"type": "capsule",
+				"value": "(secret)"
+			}
+		},
+		{
+			"name": "array",
+			"type": "attr",
+			"value": {
+				"type": "array",
+				"value": [{"type": "capsule", "value": "(secret)"}]
+			}
+		},
+		{
+			"name": "object",
+			"type": "attr",
+			"value": {
+				"type": "object",
+				"value": [{"key": "key", "value": {"type": "capsule", "value": "(secret)"}}]
+			}
+		}
+	]`
+
+	require.JSONEq(t, expect, string(out))
+}
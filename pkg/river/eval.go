@@ -0,0 +1,110 @@
+package river
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/internal/value"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/grafana/agent/pkg/river/scanner"
+	"github.com/grafana/agent/pkg/river/token"
+	"github.com/grafana/agent/pkg/river/vm"
+)
+
+// An Evaluator decodes River configuration like Unmarshal and UnmarshalValue,
+// but allows expressions to reference custom variables and functions.
+//
+// Names registered with an Evaluator take precedence over variables of the
+// same name in the parent scope and over standard library functions.
+//
+// An Evaluator is not safe for concurrent use while variables or functions
+// are being registered.
+type Evaluator struct {
+	scope *vm.Scope
+}
+
+// NewEvaluator returns a new Evaluator. parent may be nil; otherwise,
+// variables in parent are also available to expressions.
+func NewEvaluator(parent *vm.Scope) *Evaluator {
+	return &Evaluator{
+		scope: &vm.Scope{
+			Parent:    parent,
+			Variables: make(map[string]interface{}),
+		},
+	}
+}
+
+// SetVariable makes v available to expressions under name. name must be a
+// valid River identifier. Values are converted into River values using the
+// same rules as MarshalValue.
+//
+// Maps and slices are not copied; they should not be modified after being
+// passed to SetVariable.
+func (e *Evaluator) SetVariable(name string, v interface{}) error {
+	if !validIdentifier(name) {
+		return fmt.Errorf("%q is not a valid identifier", name)
+	}
+	e.scope.Variables[name] = v
+	return nil
+}
+
+// RegisterFunction makes the Go function fn callable from expressions under
+// name. name must be a valid River identifier.
+//
+// fn must return a single non-error value, optionally followed by an error.
+// A non-nil error returned by fn fails the evaluation of the expression which
+// called it. Arguments passed to fn are converted into the Go types of its
+// parameters, and variadic functions are supported.
+func (e *Evaluator) RegisterFunction(name string, fn interface{}) error {
+	if !validIdentifier(name) {
+		return fmt.Errorf("%q is not a valid identifier", name)
+	}
+	if fn == nil || value.RiverType(reflect.TypeOf(fn)) != value.TypeFunction {
+		return fmt.Errorf("%T is not a valid River function: functions must return one non-error value and an optional error", fn)
+	}
+	e.scope.Variables[name] = fn
+	return nil
+}
+
+// Scope returns the scope used by e. The returned scope is shared with e and
+// reflects variables and functions registered later on.
+func (e *Evaluator) Scope() *vm.Scope {
+	return e.scope
+}
+
+// Unmarshal converts the River configuration file specified by in and stores
+// it in the struct value pointed to by v. See the package-level Unmarshal for
+// the decoding rules.
+func (e *Evaluator) Unmarshal(in []byte, v interface{}) error {
+	f, err := parser.ParseFile("", in)
+	if err != nil {
+		return err
+	}
+	return e.Evaluate(f, v)
+}
+
+// UnmarshalValue converts the River expression specified by in and stores it
+// in the value pointed to by v. See the package-level UnmarshalValue for the
+// decoding rules.
+func (e *Evaluator) UnmarshalValue(in []byte, v interface{}) error {
+	expr, err := parser.ParseExpression(string(in))
+	if err != nil {
+		return err
+	}
+	return e.Evaluate(expr, v)
+}
+
+// Evaluate evaluates an already parsed node and stores the result in the value
+// pointed to by v. node must be an *ast.File, *ast.BlockStmt, ast.Body, or an
+// ast.Expr. Evaluate allows callers to inspect the AST, such as with
+// ast.Traversals, before evaluating it.
+func (e *Evaluator) Evaluate(node ast.Node, v interface{}) error {
+	return vm.New(node).Evaluate(e.scope, v)
+}
+
+func validIdentifier(in string) bool {
+	s := scanner.New(nil, []byte(in), nil, 0)
+	_, tok, lit := s.Scan()
+	return tok == token.IDENT && lit == in
+}
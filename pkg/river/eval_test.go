@@ -0,0 +1,52 @@
+package river_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/agent/pkg/river"
+	"github.com/grafana/agent/pkg/river/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluator_Register(t *testing.T) {
+	eval := river.NewEvaluator(nil)
+
+	require.EqualError(t, eval.SetVariable("not valid", 1), `"not valid" is not a valid identifier`)
+	require.EqualError(t, eval.SetVariable("true", 1), `"true" is not a valid identifier`)
+	require.Error(t, eval.RegisterFunction("f", "not a function"))
+	require.Error(t, eval.RegisterFunction("f", func() {}))
+	require.Error(t, eval.RegisterFunction("f", nil))
+	require.NoError(t, eval.RegisterFunction("f", func() (int, error) { return 1, nil }))
+}
+
+func TestEvaluator_Scope(t *testing.T) {
+	parent := &vm.Scope{
+		Variables: map[string]interface{}{"a": 1, "b": 2},
+	}
+	eval := river.NewEvaluator(parent)
+	require.NoError(t, eval.SetVariable("b", 20))
+
+	var res int
+	require.NoError(t, eval.UnmarshalValue([]byte(`a + b`), &res))
+	require.Equal(t, 21, res)
+
+	// Registered functions shadow the standard library.
+	require.NoError(t, eval.RegisterFunction("env", func(string) string { return "custom" }))
+	var str string
+	require.NoError(t, eval.UnmarshalValue([]byte(`env("HOME")`), &str))
+	require.Equal(t, "custom", str)
+}
+
+func TestEvaluator_Errors(t *testing.T) {
+	eval := river.NewEvaluator(nil)
+	require.NoError(t, eval.RegisterFunction("fail", func() (string, error) {
+		return "", fmt.Errorf("something went wrong")
+	}))
+
+	var s struct {
+		Value string `river:"value,attr"`
+	}
+	require.ErrorContains(t, eval.Unmarshal([]byte(`value = fail()`), &s), "something went wrong")
+	require.ErrorContains(t, eval.Unmarshal([]byte(`value = missing`), &s), `identifier "missing" does not exist`)
+}
@@ -48,6 +48,7 @@ type Field struct {
 	Name  []string // Name of tagged field
 	Index []int    // Index into field (reflect.Value.FieldByIndex)
 	Flags Flags    // Flags assigned to field
+	Rules *Rules   // Validation rules for the field; nil if there are none
 }
 
 // IsAttr returns whether f is for an attribute.
@@ -92,6 +93,12 @@ func (f Field) IsOptional() bool { return f.Flags&FlagOptional != 0 }
 // With the exception of the `river:",label"` tag, all tagged fields must have a
 // unique name.
 //
+// Attribute and block fields may also have a validate tag holding declarative
+// validation rules. See Rules for the supported syntax:
+//
+//	// Field is an optional attribute which must be between 0 and 100.
+//	Field int `river:"my_attr,attr,optional" validate:"min=0,max=100"`
+//
 // The type of tagged fields may be any Go type, with the exception of
 // `river:",label"` tags, which must be strings.
 func Get(ty reflect.Type) []Field {
@@ -178,6 +185,20 @@ func Get(ty reflect.Type) []Field {
 			panic(fmt.Sprintf("river: non-empty field name required at %s", printPathToField(ty, tf.Index)))
 		}
 
+		if rulesTag, ok := field.Tag.Lookup("validate"); ok {
+			if tf.Flags&(FlagAttr|FlagBlock) == 0 {
+				panic(fmt.Sprintf("river: validate tag may only be used by attributes and blocks (found at %s)", printPathToField(ty, tf.Index)))
+			}
+			rules, err := parseRules(rulesTag, field.Type)
+			if err != nil {
+				panic(fmt.Sprintf("river: invalid validate tag at %s: %s", printPathToField(ty, tf.Index), err))
+			}
+			if tf.Flags&FlagBlock != 0 && rules.AttrOnly() {
+				panic(fmt.Sprintf("river: blocks only support the exclusive validation rule (found at %s)", printPathToField(ty, tf.Index)))
+			}
+			tf.Rules = rules
+		}
+
 		fields = append(fields, tf)
 	}
 
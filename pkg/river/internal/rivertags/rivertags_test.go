@@ -3,6 +3,7 @@ package rivertags_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/grafana/agent/pkg/river/internal/rivertags"
 	"github.com/stretchr/testify/require"
@@ -22,11 +23,11 @@ func Test_Get(t *testing.T) {
 	fs := rivertags.Get(reflect.TypeOf(Struct{}))
 
 	expect := []rivertags.Field{
-		{[]string{"req_attr"}, []int{1}, rivertags.FlagAttr},
-		{[]string{"opt_attr"}, []int{2}, rivertags.FlagAttr | rivertags.FlagOptional},
-		{[]string{"req_block"}, []int{3}, rivertags.FlagBlock},
-		{[]string{"opt_block"}, []int{4}, rivertags.FlagBlock | rivertags.FlagOptional},
-		{[]string{""}, []int{5}, rivertags.FlagLabel},
+		{[]string{"req_attr"}, []int{1}, rivertags.FlagAttr, nil},
+		{[]string{"opt_attr"}, []int{2}, rivertags.FlagAttr | rivertags.FlagOptional, nil},
+		{[]string{"req_block"}, []int{3}, rivertags.FlagBlock, nil},
+		{[]string{"opt_block"}, []int{4}, rivertags.FlagBlock | rivertags.FlagOptional, nil},
+		{[]string{""}, []int{5}, rivertags.FlagLabel, nil},
 	}
 
 	require.Equal(t, expect, fs)
@@ -95,4 +96,49 @@ func Test_Get_Panics(t *testing.T) {
 		expect := `river: label field already used by rivertags_test.Struct.Label2`
 		expectPanic(t, expect, Struct{})
 	})
+
+	t.Run("Validation rules must be known", func(t *testing.T) {
+		type Struct struct {
+			Attr int `river:"attr,attr" validate:"between=1"`
+		}
+		expect := `river: invalid validate tag at rivertags_test.Struct.Attr: unrecognized validation rule "between"`
+		expectPanic(t, expect, Struct{})
+	})
+
+	t.Run("Bounds require numbers", func(t *testing.T) {
+		type Struct struct {
+			Attr string `river:"attr,attr" validate:"min=1"`
+		}
+		expect := `river: invalid validate tag at rivertags_test.Struct.Attr: numeric bounds can't be used with string`
+		expectPanic(t, expect, Struct{})
+	})
+
+	t.Run("Blocks only support exclusive", func(t *testing.T) {
+		type Struct struct {
+			Block []struct{} `river:"block,block" validate:"nonempty"`
+		}
+		expect := `river: blocks only support the exclusive validation rule (found at rivertags_test.Struct.Block)`
+		expectPanic(t, expect, Struct{})
+	})
+}
+
+func Test_Get_Rules(t *testing.T) {
+	type Struct struct {
+		Interval time.Duration `river:"interval,attr" validate:"gt=1m,max=1h"`
+		Mode     string        `river:"mode,attr" validate:"oneof=a|b,exclusive=group"`
+		Block    struct{}      `river:"block,block,optional" validate:"exclusive=group"`
+		Pattern  string        `river:"pattern,attr" validate:"nonempty,pattern=^a{1,2}$"`
+	}
+
+	fs := rivertags.Get(reflect.TypeOf(Struct{}))
+	require.Equal(t, &rivertags.Bound{Value: float64(time.Minute), Text: "1m"}, fs[0].Rules.Gt)
+	require.Equal(t, &rivertags.Bound{Value: float64(time.Hour), Text: "1h"}, fs[0].Rules.Max)
+	require.Equal(t, []string{"a", "b"}, fs[1].Rules.OneOf)
+	require.Equal(t, "group", fs[1].Rules.Exclusive)
+	require.Equal(t, "group", fs[2].Rules.Exclusive)
+	require.True(t, fs[3].Rules.NonEmpty)
+	require.Equal(t, "^a{1,2}$", fs[3].Rules.Pattern.String())
+
+	require.NoError(t, fs[0].Rules.Check(reflect.ValueOf(2*time.Minute)))
+	require.EqualError(t, fs[0].Rules.Check(reflect.ValueOf(time.Minute)), "must be greater than 1m")
 }
@@ -0,0 +1,231 @@
+package rivertags
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rules are declarative validation rules for a tagged field, parsed from the
+// field's validate struct tag. The validate tag is a comma-separated list of
+// the following rules:
+//
+//	min=N         Numeric value must be greater than or equal to N.
+//	max=N         Numeric value must be less than or equal to N.
+//	gt=N          Numeric value must be greater than N.
+//	lt=N          Numeric value must be less than N.
+//	nonempty      String, slice or map must not be empty.
+//	oneof=a|b|c   Value must be one of the listed values.
+//	exclusive=G   At most one field from group G may be set.
+//	pattern=RE    String must match the regular expression RE.
+//
+// Bounds for fields whose underlying type is int64, such as time.Duration,
+// may be written as durations (e.g., gt=30s). Because regular expressions may
+// contain commas, pattern must be the last rule of the tag.
+//
+// Rules other than exclusive may only be used by attributes.
+//
+// Rules only cover attributes and blocks which are explicitly set: defaults
+// aren't validated, and a field set to its zero value still counts as set for
+// exclusive. Constraints which depend on defaults must be checked by
+// UnmarshalRiver instead.
+type Rules struct {
+	Min, Max *Bound // Inclusive bounds
+	Gt, Lt   *Bound // Exclusive bounds
+
+	NonEmpty  bool
+	OneOf     []string
+	Exclusive string // Name of the mutually exclusive group
+	Pattern   *regexp.Regexp
+}
+
+// Bound is a numeric bound of a value.
+type Bound struct {
+	Value float64
+	Text  string // Text as written in the tag.
+}
+
+var patternCache sync.Map // map[string]*regexp.Regexp
+
+// parseRules parses the validate tag of a field of type ty.
+func parseRules(tag string, ty reflect.Type) (*Rules, error) {
+	var rules Rules
+
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "pattern=") {
+			rule, tag = tag, ""
+		} else if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			rule, tag = tag[:idx], tag[idx+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, arg, hasArg := strings.Cut(rule, "=")
+		switch {
+		case name == "nonempty" && hasArg:
+			return nil, fmt.Errorf("validation rule %q does not accept a value", name)
+		case name != "nonempty" && arg == "":
+			return nil, fmt.Errorf("validation rule %q requires a value", name)
+		}
+
+		var err error
+		switch name {
+		case "min":
+			rules.Min, err = parseBound(arg, ty)
+		case "max":
+			rules.Max, err = parseBound(arg, ty)
+		case "gt":
+			rules.Gt, err = parseBound(arg, ty)
+		case "lt":
+			rules.Lt, err = parseBound(arg, ty)
+		case "nonempty":
+			switch k := indirectType(ty).Kind(); k {
+			case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+				rules.NonEmpty = true
+			default:
+				err = fmt.Errorf("nonempty can't be used with %s", k)
+			}
+		case "oneof":
+			rules.OneOf = strings.Split(arg, "|")
+		case "exclusive":
+			rules.Exclusive = arg
+		case "pattern":
+			if k := indirectType(ty).Kind(); k != reflect.String {
+				return nil, fmt.Errorf("pattern can't be used with %s", k)
+			}
+			rules.Pattern, err = compilePattern(arg)
+		default:
+			err = fmt.Errorf("unrecognized validation rule %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rules, nil
+}
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	patternCache.Store(expr, re)
+	return re, nil
+}
+
+func parseBound(text string, ty reflect.Type) (*Bound, error) {
+	if !isNumber(indirectType(ty).Kind()) {
+		return nil, fmt.Errorf("numeric bounds can't be used with %s", indirectType(ty).Kind())
+	}
+
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return &Bound{Value: f, Text: text}, nil
+	}
+	if indirectType(ty).Kind() == reflect.Int64 {
+		if d, err := time.ParseDuration(text); err == nil {
+			return &Bound{Value: float64(d), Text: text}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid bound %q", text)
+}
+
+// AttrOnly reports whether r contains rules which can only be used by
+// attributes.
+func (r *Rules) AttrOnly() bool {
+	return r.Min != nil || r.Max != nil || r.Gt != nil || r.Lt != nil ||
+		r.NonEmpty || len(r.OneOf) > 0 || r.Pattern != nil
+}
+
+// Check validates v against the rules in r, excluding the exclusive rule
+// which depends on the other fields of a struct. Nil pointers are not
+// checked.
+func (r *Rules) Check(v reflect.Value) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if isNumber(v.Kind()) {
+		var n float64
+		switch {
+		case v.CanInt():
+			n = float64(v.Int())
+		case v.CanUint():
+			n = float64(v.Uint())
+		default:
+			n = v.Float()
+		}
+
+		switch {
+		case r.Min != nil && n < r.Min.Value:
+			return fmt.Errorf("must be greater than or equal to %s", r.Min.Text)
+		case r.Max != nil && n > r.Max.Value:
+			return fmt.Errorf("must be less than or equal to %s", r.Max.Text)
+		case r.Gt != nil && n <= r.Gt.Value:
+			return fmt.Errorf("must be greater than %s", r.Gt.Text)
+		case r.Lt != nil && n >= r.Lt.Value:
+			return fmt.Errorf("must be less than %s", r.Lt.Text)
+		}
+	}
+
+	if r.NonEmpty && v.Len() == 0 {
+		return fmt.Errorf("must not be empty")
+	}
+
+	if len(r.OneOf) > 0 {
+		text := fmt.Sprint(v.Interface())
+		var found bool
+		for _, allowed := range r.OneOf {
+			if text == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("must be one of %s", quoteList(r.OneOf))
+		}
+	}
+
+	if r.Pattern != nil && !r.Pattern.MatchString(v.String()) {
+		return fmt.Errorf("must match the pattern %q", r.Pattern.String())
+	}
+
+	return nil
+}
+
+func quoteList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func indirectType(ty reflect.Type) reflect.Type {
+	for ty.Kind() == reflect.Pointer {
+		ty = ty.Elem()
+	}
+	return ty
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
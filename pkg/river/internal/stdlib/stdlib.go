@@ -2,12 +2,20 @@
 package stdlib
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/grafana/agent/component/discovery"
 	"github.com/grafana/agent/pkg/river/internal/value"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"gopkg.in/yaml.v3"
 )
 
 // Functions returns the list of stdlib functions by name. The interface{}
@@ -62,14 +70,95 @@ var Functions = map[string]interface{}{
 		return value.Array(raw...), nil
 	}),
 
-	"json_decode": func(in string) (interface{}, error) {
+	// Functions below which operate on strings are implemented as raw
+	// functions so they can also accept secrets. Results computed from a
+	// sensitive secret are returned as secrets.
+
+	"json_decode": secretAwareFunc(func(in string) (interface{}, error) {
 		var res interface{}
 		err := json.Unmarshal([]byte(in), &res)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	},
+	}),
+
+	"json_encode": encodeFunc(func(in interface{}) (string, error) {
+		bb, err := json.Marshal(in)
+		if err != nil {
+			return "", err
+		}
+		return string(bb), nil
+	}),
+
+	"yaml_decode": secretAwareFunc(func(in string) (interface{}, error) {
+		var res interface{}
+		err := yaml.Unmarshal([]byte(in), &res)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeYAML(res), nil
+	}),
+
+	"yaml_encode": encodeFunc(func(in interface{}) (string, error) {
+		bb, err := yaml.Marshal(in)
+		if err != nil {
+			return "", err
+		}
+		return string(bb), nil
+	}),
+
+	"base64_encode": secretAwareFunc(func(in string) (interface{}, error) {
+		return base64.StdEncoding.EncodeToString([]byte(in)), nil
+	}),
+
+	"base64_decode": secretAwareFunc(func(in string) (interface{}, error) {
+		bb, err := base64.StdEncoding.DecodeString(in)
+		if err != nil {
+			return nil, err
+		}
+		return string(bb), nil
+	}),
+
+	"sha256": secretAwareFunc(func(in string) (interface{}, error) {
+		sum := sha256.Sum256([]byte(in))
+		return hex.EncodeToString(sum[:]), nil
+	}),
+
+	"md5": secretAwareFunc(func(in string) (interface{}, error) {
+		sum := md5.Sum([]byte(in))
+		return hex.EncodeToString(sum[:]), nil
+	}),
+
+	"url_parse": secretAwareFunc(func(in string) (interface{}, error) {
+		u, err := url.Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		password, _ := u.User.Password()
+		query := make(map[string]interface{}, len(u.Query()))
+		for k, vv := range u.Query() {
+			values := make([]interface{}, len(vv))
+			for i, v := range vv {
+				values[i] = v
+			}
+			query[k] = values
+		}
+
+		return map[string]interface{}{
+			"scheme":    u.Scheme,
+			"username":  u.User.Username(),
+			"password":  password,
+			"host":      u.Host,
+			"hostname":  u.Hostname(),
+			"port":      u.Port(),
+			"path":      u.Path,
+			"raw_query": u.RawQuery,
+			"query":     query,
+			"fragment":  u.Fragment,
+		}, nil
+	}),
 
 	"discovery_target_decode": func(in string) (interface{}, error) {
 		var targetGroups []*targetgroup.Group
@@ -99,3 +188,169 @@ var Functions = map[string]interface{}{
 		return res, nil
 	},
 }
+
+// secretAwareFunc wraps a function over a single string argument into a raw
+// function which also accepts secrets. When f is called with the contents of
+// a sensitive secret, string values in its result are wrapped back into a
+// secret.
+func secretAwareFunc(f func(in string) (interface{}, error)) value.RawFunction {
+	return func(funcValue value.Value, args ...value.Value) (value.Value, error) {
+		if len(args) != 1 {
+			return value.Null, value.Error{
+				Value: funcValue,
+				Inner: fmt.Errorf("expected 1 args, got %d", len(args)),
+			}
+		}
+
+		in, secret, err := textOrSecret(args[0])
+		if err != nil {
+			return value.Null, value.ArgError{
+				Function: funcValue,
+				Argument: args[0],
+				Index:    0,
+				Inner:    err,
+			}
+		}
+
+		res, err := f(in)
+		if err != nil {
+			return value.Null, value.Error{Value: funcValue, Inner: err}
+		}
+		if secret != nil {
+			return value.DeriveSecret(secret, value.Encode(res)), nil
+		}
+		return value.Encode(res), nil
+	}
+}
+
+// encodeFunc wraps a function which encodes an arbitrary Go value into a raw
+// function. Secrets found in the argument are unwrapped before calling f; if
+// any of them were sensitive, the encoded result is returned as a secret.
+func encodeFunc(f func(in interface{}) (string, error)) value.RawFunction {
+	return func(funcValue value.Value, args ...value.Value) (value.Value, error) {
+		if len(args) != 1 {
+			return value.Null, value.Error{
+				Value: funcValue,
+				Inner: fmt.Errorf("expected 1 args, got %d", len(args)),
+			}
+		}
+
+		in, secret, err := unwrapSecrets(args[0])
+		if err != nil {
+			return value.Null, value.ArgError{
+				Function: funcValue,
+				Argument: args[0],
+				Index:    0,
+				Inner:    err,
+			}
+		}
+
+		res, err := f(in)
+		if err != nil {
+			return value.Null, value.Error{Value: funcValue, Inner: err}
+		}
+		if secret != nil {
+			return value.Encapsulate(secret.RiverDeriveSecret(res)), nil
+		}
+		return value.String(res), nil
+	}
+}
+
+// textOrSecret returns the text of v, which must be either a string or a
+// secret. If v is a sensitive secret, it is returned so results can be derived
+// from it.
+func textOrSecret(v value.Value) (text string, secret value.SecretCapsule, err error) {
+	if v.Type() == value.TypeString {
+		return v.Text(), nil, nil
+	}
+	if secret, text, sensitive, ok := value.SecretText(v); ok {
+		if !sensitive {
+			return text, nil, nil
+		}
+		return text, secret, nil
+	}
+	return "", nil, value.TypeError{Value: v, Expected: value.TypeString}
+}
+
+// unwrapSecrets converts v into a plain Go value, replacing secrets with their
+// contents. The first sensitive secret found is returned.
+func unwrapSecrets(v value.Value) (res interface{}, secret value.SecretCapsule, err error) {
+	switch v.Type() {
+	case value.TypeNull:
+		return nil, nil, nil
+	case value.TypeNumber, value.TypeBool:
+		return v.Interface(), nil, nil
+	case value.TypeString:
+		return v.Text(), nil, nil
+
+	case value.TypeArray:
+		arr := make([]interface{}, v.Len())
+		for i := range arr {
+			elem, elemSecret, err := unwrapSecrets(v.Index(i))
+			if err != nil {
+				return nil, nil, value.ElementError{Value: v, Index: i, Inner: err}
+			}
+			if secret == nil {
+				secret = elemSecret
+			}
+			arr[i] = elem
+		}
+		return arr, secret, nil
+
+	case value.TypeObject:
+		obj := make(map[string]interface{}, v.Len())
+		for _, key := range v.Keys() {
+			field, _ := v.Key(key)
+			elem, elemSecret, err := unwrapSecrets(field)
+			if err != nil {
+				return nil, nil, value.FieldError{Value: v, Field: key, Inner: err}
+			}
+			if secret == nil {
+				secret = elemSecret
+			}
+			obj[key] = elem
+		}
+		return obj, secret, nil
+
+	case value.TypeCapsule:
+		if sc, text, sensitive, ok := value.SecretText(v); ok {
+			if !sensitive {
+				return text, nil, nil
+			}
+			return text, sc, nil
+		}
+	}
+
+	return nil, nil, value.Error{
+		Value: v,
+		Inner: fmt.Errorf("%s cannot be encoded", v.Describe()),
+	}
+}
+
+// normalizeYAML converts values decoded by the YAML decoder into values which
+// can be represented in River: map keys are converted into strings and
+// timestamps are formatted as RFC3339 strings.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeYAML(v[k])
+		}
+		return v
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			res[fmt.Sprint(k)] = normalizeYAML(elem)
+		}
+		return res
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeYAML(v[i])
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
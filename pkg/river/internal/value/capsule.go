@@ -2,6 +2,7 @@ package value
 
 import (
 	"fmt"
+	"strconv"
 )
 
 // Capsule is a marker interface for Go values which forces a type to be
@@ -51,3 +52,75 @@ type ConvertibleIntoCapsule interface {
 	// available.
 	ConvertInto(dst interface{}) error
 }
+
+// SecretCapsule is a Capsule which holds a potentially sensitive string.
+// Functions which compute new values from a sensitive SecretCapsule wrap
+// their results back into a secret so the sensitive value isn't leaked.
+type SecretCapsule interface {
+	Capsule
+
+	// RiverSecret returns the string held by the capsule and reports whether
+	// that string is sensitive.
+	RiverSecret() (text string, sensitive bool)
+
+	// RiverDeriveSecret returns a new sensitive capsule value holding text.
+	// The returned value must be a Capsule.
+	RiverDeriveSecret(text string) interface{}
+}
+
+// SecretText returns the text held by v if v is a SecretCapsule. sensitive
+// reports whether the text must be treated as sensitive. ok is false if v is
+// not a SecretCapsule.
+func SecretText(v Value) (secret SecretCapsule, text string, sensitive bool, ok bool) {
+	if v.Type() != TypeCapsule {
+		return nil, "", false, false
+	}
+	secret, ok = v.Interface().(SecretCapsule)
+	if !ok {
+		return nil, "", false, false
+	}
+	text, sensitive = secret.RiverSecret()
+	return secret, text, sensitive, true
+}
+
+// DeriveSecret returns a copy of v where every string, number and bool,
+// including strings held by non-sensitive secrets, is wrapped into a new
+// secret derived from secret. Numbers and bools are wrapped as their River
+// text, as they may hold parts of the secret too. Other values are returned
+// unmodified.
+func DeriveSecret(secret SecretCapsule, v Value) Value {
+	switch v.Type() {
+	case TypeString:
+		return Encapsulate(secret.RiverDeriveSecret(v.Text()))
+
+	case TypeNumber:
+		return Encapsulate(secret.RiverDeriveSecret(v.Number().ToString()))
+
+	case TypeBool:
+		return Encapsulate(secret.RiverDeriveSecret(strconv.FormatBool(v.Bool())))
+
+	case TypeCapsule:
+		if _, text, sensitive, ok := SecretText(v); ok && !sensitive {
+			return Encapsulate(secret.RiverDeriveSecret(text))
+		}
+		return v
+
+	case TypeArray:
+		res := make([]Value, v.Len())
+		for i := range res {
+			res[i] = DeriveSecret(secret, v.Index(i))
+		}
+		return Array(res...)
+
+	case TypeObject:
+		res := make(map[string]Value, v.Len())
+		for _, key := range v.Keys() {
+			field, _ := v.Key(key)
+			res[key] = DeriveSecret(secret, field)
+		}
+		return Object(res)
+
+	default:
+		return v
+	}
+}
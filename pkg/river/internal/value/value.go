@@ -423,15 +423,28 @@ func (v Value) Call(args ...Value) (Value, error) {
 		}
 	}
 
+	// secret is set to the first sensitive secret passed as a string argument.
+	// The result of the call is then derived from that secret so that the
+	// secret's contents can't be exposed as a plain string.
+	var secret SecretCapsule
+
 	reflectArgs := make([]reflect.Value, len(args))
 	for i, arg := range args {
-		var argVal reflect.Value
+		var argType reflect.Type
 		if variadic && i >= expectedArgs-1 {
-			argType := v.rv.Type().In(expectedArgs - 1).Elem()
-			argVal = reflect.New(argType).Elem()
+			argType = v.rv.Type().In(expectedArgs - 1).Elem()
 		} else {
-			argType := v.rv.Type().In(i)
-			argVal = reflect.New(argType).Elem()
+			argType = v.rv.Type().In(i)
+		}
+		argVal := reflect.New(argType).Elem()
+
+		if argType == goString {
+			if argSecret, text, sensitive, ok := SecretText(arg); ok && sensitive {
+				if secret == nil {
+					secret = argSecret
+				}
+				arg = String(text)
+			}
 		}
 
 		var d decoder
@@ -450,14 +463,14 @@ func (v Value) Call(args ...Value) (Value, error) {
 	outs := v.rv.Call(reflectArgs)
 	switch len(outs) {
 	case 1:
-		return makeValue(outs[0]), nil
+		return deriveCallResult(secret, makeValue(outs[0])), nil
 	case 2:
 		// When there's 2 return values, the second is always an error.
 		err, _ := outs[1].Interface().(error)
 		if err != nil {
 			return Null, Error{Value: v, Inner: err}
 		}
-		return makeValue(outs[0]), nil
+		return deriveCallResult(secret, makeValue(outs[0])), nil
 
 	default:
 		// It's not possible to reach here; we enforce that function values always
@@ -466,6 +479,14 @@ func (v Value) Call(args ...Value) (Value, error) {
 	}
 }
 
+// deriveCallResult derives res from secret if secret is non-nil.
+func deriveCallResult(secret SecretCapsule, res Value) Value {
+	if secret == nil {
+		return res
+	}
+	return DeriveSecret(secret, res)
+}
+
 func convertValue(val Value, toType Type) (Value, error) {
 	// TODO(rfratto): Use vm benchmarks to see if making this a method on Value
 	// changes anything.
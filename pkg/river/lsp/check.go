@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/diag"
+)
+
+// checkBody validates the attributes and blocks set in the body of block
+// against the Go type ty, which is expected to be the type used for decoding
+// the block. Unlike evaluation, checkBody reports every problem found rather
+// than the first one, and never evaluates expressions.
+func checkBody(block *ast.BlockStmt, ty reflect.Type) diag.Diagnostics {
+	fields := schemaFields(ty)
+	if fields == nil {
+		// ty isn't a struct with River fields, so there's nothing we can check.
+		return nil
+	}
+
+	var (
+		diags diag.Diagnostics
+		found = make(map[string]int)
+	)
+
+	for _, stmt := range block.Body {
+		switch stmt := stmt.(type) {
+		case *ast.AttributeStmt:
+			name := stmt.Name.Name
+			found[name]++
+
+			f, ok := lookupField(ty, name)
+			switch {
+			case !ok:
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: ast.StartPos(stmt.Name).Position(),
+					EndPos:   ast.EndPos(stmt.Name).Position(),
+					Message:  fmt.Sprintf("unrecognized attribute name %q", name),
+				})
+			case f.Block:
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: ast.StartPos(stmt.Name).Position(),
+					EndPos:   ast.EndPos(stmt.Name).Position(),
+					Message:  fmt.Sprintf("%q must be a block, but is used as an attribute", name),
+				})
+			case found[name] > 1:
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: ast.StartPos(stmt.Name).Position(),
+					EndPos:   ast.EndPos(stmt.Name).Position(),
+					Message:  fmt.Sprintf("attribute %q may only be set once", name),
+				})
+			}
+
+		case *ast.BlockStmt:
+			name := strings.Join(stmt.Name, ".")
+			found[name]++
+
+			var (
+				startPos = stmt.NamePos.Position()
+				endPos   = stmt.NamePos.Add(len(name) - 1).Position()
+			)
+
+			f, ok := lookupField(ty, name)
+			switch {
+			case !ok:
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: startPos,
+					EndPos:   endPos,
+					Message:  fmt.Sprintf("unrecognized block name %q", name),
+				})
+				continue
+			case !f.Block:
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: startPos,
+					EndPos:   endPos,
+					Message:  fmt.Sprintf("%q must be an attribute, but is used as a block", name),
+				})
+				continue
+			case found[name] > 1 && !isRepeatable(f):
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					StartPos: startPos,
+					EndPos:   endPos,
+					Message:  fmt.Sprintf("block %q may only be specified once", name),
+				})
+			}
+
+			diags = append(diags, checkBody(stmt, blockBodyType(f))...)
+		}
+	}
+
+	for _, f := range fields {
+		if f.Optional || found[f.Name] > 0 {
+			continue
+		}
+
+		kind := "attribute"
+		if f.Block {
+			kind = "block"
+		}
+
+		diags.Add(diag.Diagnostic{
+			Severity: diag.SeverityLevelError,
+			StartPos: block.NamePos.Position(),
+			EndPos:   block.NamePos.Add(len(strings.Join(block.Name, ".")) - 1).Position(),
+			Message:  fmt.Sprintf("missing required %s %q", kind, f.Name),
+		})
+	}
+
+	return diags
+}
+
+// isRepeatable returns true if the block field f can be set more than once.
+func isRepeatable(f schemaField) bool {
+	kind := derefType(f.Type).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
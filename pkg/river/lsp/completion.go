@@ -0,0 +1,275 @@
+package lsp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/agent/pkg/river/internal/stdlib"
+	"github.com/grafana/agent/pkg/river/scanner"
+	"github.com/grafana/agent/pkg/river/token"
+)
+
+// complete returns completion items for offset off.
+//
+// Completion is driven by scanning tokens rather than the AST, since the
+// document is rarely valid River while it's being edited.
+func (s *Server) complete(d *document, off int) completionList {
+	prefix := identPrefix(d.Text[:off])
+	ctx := scanContext(d.Text[:off])
+
+	// Items replace the full prefix, since clients don't treat "." as part of
+	// a word.
+	replace := textRange{Start: d.Position(off - len(prefix)), End: d.Position(off)}
+
+	var items []completionItem
+	add := func(label string, kind int, detail string) {
+		if !strings.HasPrefix(label, prefix) {
+			return
+		}
+		items = append(items, completionItem{
+			Label:    label,
+			Kind:     kind,
+			Detail:   detail,
+			TextEdit: &textEdit{Range: replace, NewText: label},
+		})
+	}
+
+	switch {
+	case ctx.InExpr:
+		s.completeExpr(d, prefix, add)
+
+	case len(ctx.Blocks) == 0:
+		for _, name := range s.names {
+			add(name, completionKindModule, "component")
+		}
+
+	default:
+		c, ok := s.components[ctx.Blocks[0]]
+		if !ok {
+			break
+		}
+
+		ty := c.argumentsType()
+		for _, name := range ctx.Blocks[1:] {
+			f, ok := lookupField(ty, name)
+			if !ok || !f.Block {
+				ty = nil
+				break
+			}
+			ty = blockBodyType(f)
+		}
+
+		for _, f := range schemaFields(ty) {
+			kind := completionKindProperty
+			if f.Block {
+				kind = completionKindModule
+			}
+			add(f.Name, kind, f.Detail())
+		}
+	}
+
+	return completionList{Items: items}
+}
+
+// completeExpr completes references to components, their exports, and
+// standard library functions.
+func (s *Server) completeExpr(d *document, prefix string, add func(label string, kind int, detail string)) {
+	declared := declaredBlocks(d.Text)
+
+	for _, b := range declared {
+		c, ok := s.components[b.Name]
+		if !ok {
+			continue
+		}
+
+		if strings.HasPrefix(prefix, b.ID+".") {
+			for _, f := range schemaFields(c.exportsType()) {
+				add(b.ID+"."+f.Name, completionKindField, describeType(f.Type))
+			}
+			continue
+		}
+		add(b.ID, completionKindVariable, c.Name)
+	}
+
+	names := make([]string, 0, len(stdlib.Functions))
+	for name := range stdlib.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, completionKindFunction, "function")
+	}
+}
+
+// identPrefix returns the trailing identifier text of text, including dots
+// used for field access.
+func identPrefix(text string) string {
+	i := len(text)
+	for i > 0 {
+		ch := text[i-1]
+		if ch == '_' || ch == '.' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') {
+			i--
+			continue
+		}
+		break
+	}
+	return text[i:]
+}
+
+// completionContext describes where the end of some text is located.
+type completionContext struct {
+	// Blocks holds the names of the blocks enclosing the end of the text, from
+	// outermost to innermost.
+	Blocks []string
+
+	// InExpr is true when the end of the text is inside of an expression.
+	InExpr bool
+}
+
+// blockHeader is a top-level block found by scanning text.
+type blockHeader struct {
+	Name string // Name of the block, such as "local.file".
+	ID   string // ID of the block, such as "local.file.example".
+}
+
+// scanContext determines the completion context for the end of text.
+func scanContext(text string) completionContext {
+	ts := newTokenScanner(text)
+	ts.Run()
+
+	var ctx completionContext
+	for _, f := range ts.frames {
+		if !f.block {
+			ctx.InExpr = true
+			break
+		}
+		ctx.Blocks = append(ctx.Blocks, f.name)
+	}
+	for _, tok := range ts.stmt {
+		if tok.tok == token.ASSIGN {
+			ctx.InExpr = true
+		}
+	}
+	return ctx
+}
+
+// declaredBlocks returns all top-level blocks declared in text.
+func declaredBlocks(text string) []blockHeader {
+	ts := newTokenScanner(text)
+	ts.Run()
+	return ts.topLevel
+}
+
+type scannedToken struct {
+	tok token.Token
+	lit string
+}
+
+// frame is a nesting level found while scanning. Frames are either blocks or
+// the inside of an expression, such as an object or array literal.
+type frame struct {
+	block bool
+	name  string
+}
+
+// tokenScanner tracks the nesting of blocks and expressions in possibly
+// invalid River text.
+type tokenScanner struct {
+	s *scanner.Scanner
+
+	frames   []frame
+	stmt     []scannedToken // Tokens in the current statement.
+	topLevel []blockHeader
+}
+
+func newTokenScanner(text string) *tokenScanner {
+	file := token.NewFile("")
+	return &tokenScanner{s: scanner.New(file, []byte(text), nil, 0)}
+}
+
+// inStatement returns true if the scanner is not inside of an expression.
+func (ts *tokenScanner) inStatement() bool {
+	return len(ts.frames) == 0 || ts.frames[len(ts.frames)-1].block
+}
+
+func (ts *tokenScanner) Run() {
+	for {
+		_, tok, lit := ts.s.Scan()
+
+		switch tok {
+		case token.EOF:
+			return
+
+		case token.TERMINATOR:
+			if ts.inStatement() {
+				ts.stmt = nil
+			}
+
+		case token.LCURLY:
+			if name, label, ok := blockHeaderTokens(ts.stmt); ok && ts.inStatement() {
+				if len(ts.frames) == 0 {
+					id := name
+					if label != "" {
+						id += "." + label
+					}
+					ts.topLevel = append(ts.topLevel, blockHeader{Name: name, ID: id})
+				}
+				ts.frames = append(ts.frames, frame{block: true, name: name})
+				ts.stmt = nil
+				continue
+			}
+			ts.frames = append(ts.frames, frame{})
+			ts.stmt = append(ts.stmt, scannedToken{tok, lit})
+
+		case token.LBRACK, token.LPAREN:
+			ts.frames = append(ts.frames, frame{})
+			ts.stmt = append(ts.stmt, scannedToken{tok, lit})
+
+		case token.RCURLY, token.RBRACK, token.RPAREN:
+			var popped frame
+			if len(ts.frames) > 0 {
+				popped = ts.frames[len(ts.frames)-1]
+				ts.frames = ts.frames[:len(ts.frames)-1]
+			}
+			if popped.block {
+				ts.stmt = nil
+				continue
+			}
+			ts.stmt = append(ts.stmt, scannedToken{tok, lit})
+
+		default:
+			ts.stmt = append(ts.stmt, scannedToken{tok, lit})
+		}
+	}
+}
+
+// blockHeaderTokens checks whether toks form a block header: a dot-separated
+// name followed by an optional string label.
+func blockHeaderTokens(toks []scannedToken) (name, label string, ok bool) {
+	if len(toks) > 0 && toks[len(toks)-1].tok == token.STRING {
+		unquoted, err := strconv.Unquote(toks[len(toks)-1].lit)
+		if err != nil {
+			return "", "", false
+		}
+		label = unquoted
+		toks = toks[:len(toks)-1]
+	}
+
+	if len(toks) == 0 || len(toks)%2 == 0 {
+		return "", "", false
+	}
+
+	parts := make([]string, 0, len(toks)/2+1)
+	for i, tok := range toks {
+		switch {
+		case i%2 == 0 && tok.tok == token.IDENT:
+			parts = append(parts, tok.lit)
+		case i%2 == 1 && tok.tok == token.DOT:
+			// Separator
+		default:
+			return "", "", false
+		}
+	}
+	return strings.Join(parts, "."), label, true
+}
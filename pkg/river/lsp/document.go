@@ -0,0 +1,223 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/diag"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/grafana/agent/pkg/river/token"
+)
+
+// document is an open River file.
+type document struct {
+	URI     string
+	Version int
+	Text    string
+
+	lines []int // Byte offset of the start of each line.
+
+	// File is the parsed AST of Text. It is nil if Text could not be parsed.
+	File *ast.File
+
+	// Blocks holds top-level blocks by their component ID, such as
+	// "local.file.example". Blocks is only set when File is non-nil.
+	Blocks map[string]*ast.BlockStmt
+
+	Diagnostics diag.Diagnostics
+}
+
+// newDocument creates a new document and analyzes its contents against the
+// known set of components.
+func newDocument(uri string, version int, text string, components map[string]Component) *document {
+	d := &document{
+		URI:     uri,
+		Version: version,
+		Text:    text,
+		lines:   []int{0},
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	f, err := parser.ParseFile(uri, []byte(text))
+	if err != nil {
+		var diags diag.Diagnostics
+		if !errors.As(err, &diags) {
+			diags = diag.Diagnostics{{Severity: diag.SeverityLevelError, Message: err.Error()}}
+		}
+		d.Diagnostics = diags
+		return d
+	}
+
+	d.File = f
+	d.Blocks = make(map[string]*ast.BlockStmt)
+	d.Diagnostics = checkFile(f, components, d.Blocks)
+	return d
+}
+
+// Offset converts an LSP position into a byte offset within the document.
+// Positions past the end of a line or the document are clamped.
+func (d *document) Offset(pos position) int {
+	if pos.Line < 0 {
+		return 0
+	} else if pos.Line >= len(d.lines) {
+		return len(d.Text)
+	}
+
+	start := d.lines[pos.Line]
+	end := len(d.Text)
+	if pos.Line+1 < len(d.lines) {
+		end = d.lines[pos.Line+1] - 1
+	}
+
+	// LSP character offsets are counted in UTF-16 code units.
+	off, units := start, 0
+	for off < end && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(d.Text[off:])
+		units += utf16.RuneLen(r)
+		off += size
+	}
+	return off
+}
+
+// Position converts a byte offset within the document into an LSP position.
+func (d *document) Position(off int) position {
+	if off > len(d.Text) {
+		off = len(d.Text)
+	}
+
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > off }) - 1
+	if line < 0 {
+		line = 0
+	}
+
+	var units int
+	for _, r := range d.Text[d.lines[line]:off] {
+		units += utf16.RuneLen(r)
+	}
+	return position{Line: line, Character: units}
+}
+
+// Range returns the LSP range between two River positions. If end is invalid,
+// the range covers a single character.
+func (d *document) Range(start, end token.Position) textRange {
+	if !start.Valid() {
+		return textRange{}
+	}
+	startOff := start.Offset
+
+	endOff := startOff + 1
+	if end.Valid() {
+		// River end positions are inclusive of the last character.
+		endOff = end.Offset + 1
+	}
+	return textRange{Start: d.Position(startOff), End: d.Position(endOff)}
+}
+
+// NodeRange returns the LSP range covered by an AST node.
+func (d *document) NodeRange(n ast.Node) textRange {
+	return d.Range(ast.StartPos(n).Position(), ast.EndPos(n).Position())
+}
+
+// LSPDiagnostics converts the diagnostics of the document into LSP
+// diagnostics.
+func (d *document) LSPDiagnostics() []diagnostic {
+	res := make([]diagnostic, 0, len(d.Diagnostics))
+	for _, dd := range d.Diagnostics {
+		severity := diagnosticSeverityError
+		if dd.Severity == diag.SeverityLevelWarn {
+			severity = diagnosticSeverityWarning
+		}
+
+		res = append(res, diagnostic{
+			Range:    d.Range(dd.StartPos, dd.EndPos),
+			Severity: severity,
+			Source:   "river",
+			Message:  dd.Message,
+		})
+	}
+	return res
+}
+
+// blockID returns the component ID of a top-level block.
+func blockID(b *ast.BlockStmt) string {
+	id := strings.Join(b.Name, ".")
+	if b.Label != "" {
+		id += "." + b.Label
+	}
+	return id
+}
+
+// checkFile validates the top-level blocks of f against the known components,
+// storing each block by its component ID into blocks.
+func checkFile(f *ast.File, components map[string]Component, blocks map[string]*ast.BlockStmt) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for _, stmt := range f.Body {
+		switch stmt := stmt.(type) {
+		case *ast.AttributeStmt:
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				StartPos: ast.StartPos(stmt.Name).Position(),
+				EndPos:   ast.EndPos(stmt.Name).Position(),
+				Message:  "unrecognized attribute " + stmt.Name.Name,
+			})
+
+		case *ast.BlockStmt:
+			name := strings.Join(stmt.Name, ".")
+			nameEnd := stmt.NamePos.Add(len(name) - 1).Position()
+
+			id := blockID(stmt)
+			if orig, redefined := blocks[id]; redefined {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("Component %s already declared at %s", id, ast.StartPos(orig).Position()),
+					StartPos: stmt.NamePos.Position(),
+					EndPos:   nameEnd,
+				})
+				continue
+			}
+			blocks[id] = stmt
+
+			c, ok := components[name]
+			if !ok {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("Unrecognized component name %q", name),
+					StartPos: stmt.NamePos.Position(),
+					EndPos:   nameEnd,
+				})
+				continue
+			}
+
+			switch {
+			case c.Singleton && stmt.Label != "":
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("Component %q does not support labels", name),
+					StartPos: stmt.LabelPos.Position(),
+					EndPos:   stmt.LabelPos.Add(len(stmt.Label) + 1).Position(),
+				})
+			case !c.Singleton && stmt.Label == "":
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("Component %q must have a label", name),
+					StartPos: stmt.NamePos.Position(),
+					EndPos:   nameEnd,
+				})
+			}
+
+			diags = append(diags, checkBody(stmt, c.argumentsType())...)
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,257 @@
+package lsp
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/grafana/agent/pkg/river/ast"
+	"github.com/grafana/agent/pkg/river/printer"
+)
+
+// hover returns hover documentation for the element at offset off, or nil if
+// there is nothing to describe.
+func (s *Server) hover(d *document, off int) *hover {
+	if d.File == nil {
+		return nil
+	}
+
+	// References to other components take precedence, since they can appear
+	// anywhere inside of a block.
+	if ref := findReference(d.File, off); ref != nil {
+		block, rest := resolveReference(d, ref)
+		if block == nil {
+			return nil
+		}
+
+		c := s.components[strings.Join(block.Name, ".")]
+		r := d.Range(ast.StartPos(ref[0]).Position(), ast.EndPos(ref[len(ref)-1]).Position())
+
+		if len(rest) == 0 {
+			return &hover{Contents: markdown(componentDoc(c)), Range: &r}
+		}
+
+		// Describe the export field being accessed.
+		f, ok := lookupField(c.exportsType(), rest[0].Name)
+		if !ok {
+			return nil
+		}
+		text := fmt.Sprintf("`%s.%s` %s\n\nExported by %s.", blockID(block), f.Name, describeType(f.Type), c.Name)
+		return &hover{Contents: markdown(text), Range: &r}
+	}
+
+	for _, stmt := range d.File.Body {
+		block, ok := stmt.(*ast.BlockStmt)
+		if !ok || !containsOffset(block, off) {
+			continue
+		}
+
+		name := strings.Join(block.Name, ".")
+		c, ok := s.components[name]
+		if !ok {
+			return nil
+		}
+
+		if r := blockNameRange(d, block); offsetInRange(d, r, off) {
+			return &hover{Contents: markdown(componentDoc(c)), Range: &r}
+		}
+		return hoverBody(d, block.Body, c.argumentsType(), off)
+	}
+
+	return nil
+}
+
+// hoverBody returns hover documentation for an attribute or block inside of
+// body, where body is decoded into the Go type ty.
+func hoverBody(d *document, body ast.Body, ty reflect.Type, off int) *hover {
+	for _, stmt := range body {
+		switch stmt := stmt.(type) {
+		case *ast.AttributeStmt:
+			if !containsOffset(stmt.Name, off) {
+				continue
+			}
+			f, ok := lookupField(ty, stmt.Name.Name)
+			if !ok {
+				return nil
+			}
+			r := d.NodeRange(stmt.Name)
+			return &hover{Contents: markdown(fmt.Sprintf("`%s` %s", f.Name, f.Detail())), Range: &r}
+
+		case *ast.BlockStmt:
+			if !containsOffset(stmt, off) {
+				continue
+			}
+			f, ok := lookupField(ty, strings.Join(stmt.Name, "."))
+			if !ok {
+				return nil
+			}
+			if r := blockNameRange(d, stmt); offsetInRange(d, r, off) {
+				text := fmt.Sprintf("`%s` %s", f.Name, f.Detail())
+				if fields := schemaFields(blockBodyType(f)); len(fields) > 0 {
+					text += "\n\n" + fieldList(fields, false)
+				}
+				return &hover{Contents: markdown(text), Range: &r}
+			}
+			return hoverBody(d, stmt.Body, blockBodyType(f), off)
+		}
+	}
+	return nil
+}
+
+// definition returns the location of the component referenced at offset off.
+func (s *Server) definition(d *document, off int) []location {
+	if d.File == nil {
+		return nil
+	}
+
+	ref := findReference(d.File, off)
+	if ref == nil {
+		return nil
+	}
+	block, _ := resolveReference(d, ref)
+	if block == nil {
+		return nil
+	}
+	return []location{{URI: d.URI, Range: blockNameRange(d, block)}}
+}
+
+// format returns the edits to apply to format d. No edits are returned when
+// the document is already formatted.
+func (s *Server) format(d *document) ([]textEdit, error) {
+	if d.File == nil {
+		return nil, fmt.Errorf("cannot format a file with syntax errors")
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, d.File); err != nil {
+		return nil, err
+	}
+	_ = buf.WriteByte('\n')
+
+	if buf.String() == d.Text {
+		return []textEdit{}, nil
+	}
+	return []textEdit{{
+		Range:   textRange{Start: position{}, End: d.Position(len(d.Text))},
+		NewText: buf.String(),
+	}}, nil
+}
+
+// componentDoc returns Markdown documentation for a component.
+func componentDoc(c Component) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s**", c.Name)
+
+	if fields := schemaFields(c.argumentsType()); len(fields) > 0 {
+		sb.WriteString("\n\nArguments:\n\n")
+		sb.WriteString(fieldList(fields, false))
+	}
+	if fields := schemaFields(c.exportsType()); len(fields) > 0 {
+		sb.WriteString("\n\nExports:\n\n")
+		sb.WriteString(fieldList(fields, true))
+	}
+	return sb.String()
+}
+
+// fieldList returns a Markdown list describing fields. When exports is true,
+// fields are described without noting whether they are required.
+func fieldList(fields []schemaField, exports bool) string {
+	lines := make([]string, 0, len(fields))
+	for _, f := range fields {
+		detail := f.Detail()
+		if exports {
+			detail = describeType(f.Type)
+		}
+		lines = append(lines, fmt.Sprintf("* `%s` %s", f.Name, detail))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func markdown(text string) markupContent {
+	return markupContent{Kind: "markdown", Value: text}
+}
+
+// blockNameRange returns the range covering the name of a block.
+func blockNameRange(d *document, b *ast.BlockStmt) textRange {
+	name := strings.Join(b.Name, ".")
+	return d.Range(b.NamePos.Position(), b.NamePos.Add(len(name)-1).Position())
+}
+
+// containsOffset returns true if the node n covers off. The offset directly
+// after the end of the node is considered to be covered, so the cursor at the
+// end of an identifier still refers to it.
+func containsOffset(n ast.Node, off int) bool {
+	start, end := ast.StartPos(n), ast.EndPos(n)
+	if !start.Valid() || !end.Valid() {
+		return false
+	}
+	return start.Offset() <= off && off <= end.Offset()+1
+}
+
+func offsetInRange(d *document, r textRange, off int) bool {
+	return d.Offset(r.Start) <= off && off <= d.Offset(r.End)
+}
+
+// findReference returns the chain of identifiers forming a reference
+// expression (such as local.file.example.content) covering off.
+func findReference(f *ast.File, off int) []*ast.Ident {
+	rf := &referenceFinder{off: off}
+	ast.Walk(rf, f)
+	return rf.found
+}
+
+type referenceFinder struct {
+	off   int
+	found []*ast.Ident
+}
+
+func (rf *referenceFinder) Visit(n ast.Node) ast.Visitor {
+	if n == nil || rf.found != nil {
+		return nil
+	}
+
+	switch n := n.(type) {
+	case *ast.IdentifierExpr, *ast.AccessExpr:
+		if !containsOffset(n, rf.off) {
+			return nil
+		}
+		if idents, ok := flattenReference(n.(ast.Expr)); ok {
+			rf.found = idents
+			return nil
+		}
+	}
+	return rf
+}
+
+// flattenReference converts an expression of chained field accesses into the
+// list of accessed identifiers.
+func flattenReference(e ast.Expr) ([]*ast.Ident, bool) {
+	switch e := e.(type) {
+	case *ast.IdentifierExpr:
+		return []*ast.Ident{e.Ident}, true
+	case *ast.AccessExpr:
+		base, ok := flattenReference(e.Value)
+		if !ok {
+			return nil, false
+		}
+		return append(base, e.Name), true
+	}
+	return nil, false
+}
+
+// resolveReference finds the block referenced by ref. The remaining
+// identifiers which access the block's exports are returned as rest.
+func resolveReference(d *document, ref []*ast.Ident) (block *ast.BlockStmt, rest []*ast.Ident) {
+	for i := len(ref); i > 0; i-- {
+		names := make([]string, i)
+		for j := range names {
+			names[j] = ref[j].Name
+		}
+
+		if block, ok := d.Blocks[strings.Join(names, ".")]; ok {
+			return block, ref[i:]
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,258 @@
+// Package lsp implements a Language Server Protocol server for River files.
+//
+// The server provides diagnostics, hover documentation, completion,
+// go-to-definition for component references, and formatting. Components which
+// may be declared in River files are provided when creating the server, which
+// allows the server to validate component blocks and describe their arguments
+// and exports.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Component describes a component which may be declared in a River file.
+type Component struct {
+	// Name of the component, such as "local.file".
+	Name string
+
+	// Singleton components may only be declared once and must not have a
+	// label.
+	Singleton bool
+
+	// Arguments holds an example value of the Go type used to decode the
+	// component's block. May be nil if the arguments are unknown.
+	Arguments interface{}
+
+	// Exports holds an example value of the Go type used for the component's
+	// exports. May be nil if the component doesn't have exports.
+	Exports interface{}
+}
+
+func (c Component) argumentsType() reflect.Type {
+	if c.Arguments == nil {
+		return nil
+	}
+	return reflect.TypeOf(c.Arguments)
+}
+
+func (c Component) exportsType() reflect.Type {
+	if c.Exports == nil {
+		return nil
+	}
+	return reflect.TypeOf(c.Exports)
+}
+
+// Options configures a Server.
+type Options struct {
+	// Components which can be declared in River files.
+	Components []Component
+
+	// Version of the server reported to clients.
+	Version string
+}
+
+// Server is a Language Server Protocol server for River files. Servers are
+// created with New and handle a single client connection through Serve.
+type Server struct {
+	opts       Options
+	components map[string]Component
+	names      []string
+
+	conn     *conn
+	docs     map[string]*document
+	shutdown bool
+}
+
+// New creates a new Server.
+func New(opts Options) *Server {
+	s := &Server{
+		opts:       opts,
+		components: make(map[string]Component, len(opts.Components)),
+		docs:       make(map[string]*document),
+	}
+	for _, c := range opts.Components {
+		s.components[c.Name] = c
+		s.names = append(s.names, c.Name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// errExit is used to stop serving once the exit notification is received.
+var errExit = errors.New("exit")
+
+// Serve reads LSP messages from r and writes responses to w. Serve returns
+// once the client sends the exit notification or once r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+
+	for {
+		req, err := s.conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			// The message was framed correctly but couldn't be decoded; report the
+			// problem and keep going.
+			if err := s.conn.Write(response{JSONRPC: "2.0", Error: rerr}); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := s.handle(req); errors.Is(err, errExit) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles an individual request. Errors are only returned for
+// problems writing to the client.
+func (s *Server) handle(req *request) error {
+	var (
+		result interface{}
+		err    error
+	)
+
+	switch {
+	case s.shutdown && req.Method != "exit":
+		err = &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+
+	case req.Method == "initialize":
+		result = initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           textDocumentSyncFull,
+				HoverProvider:              true,
+				CompletionProvider:         &completionOptions{TriggerCharacters: []string{"."}},
+				DefinitionProvider:         true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "river-lsp", Version: s.opts.Version},
+		}
+	case req.Method == "shutdown":
+		s.shutdown = true
+	case req.Method == "exit":
+		return errExit
+
+	case req.Method == "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err = decodeParams(req, &params); err == nil {
+			err = s.updateDocument(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		}
+	case req.Method == "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err = decodeParams(req, &params); err == nil && len(params.ContentChanges) > 0 {
+			// The server only supports full document syncs, so the last change
+			// always holds the full text.
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			err = s.updateDocument(params.TextDocument.URI, params.TextDocument.Version, text)
+		}
+	case req.Method == "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err = decodeParams(req, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			err = s.publishDiagnostics(params.TextDocument.URI, 0, []diagnostic{})
+		}
+
+	case req.Method == "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = decodeParams(req, &params); err == nil {
+			result, err = s.withDocument(params.TextDocument.URI, func(d *document) (interface{}, error) {
+				return s.hover(d, d.Offset(params.Position)), nil
+			})
+		}
+	case req.Method == "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = decodeParams(req, &params); err == nil {
+			result, err = s.withDocument(params.TextDocument.URI, func(d *document) (interface{}, error) {
+				return s.complete(d, d.Offset(params.Position)), nil
+			})
+		}
+	case req.Method == "textDocument/definition":
+		var params textDocumentPositionParams
+		if err = decodeParams(req, &params); err == nil {
+			result, err = s.withDocument(params.TextDocument.URI, func(d *document) (interface{}, error) {
+				return s.definition(d, d.Offset(params.Position)), nil
+			})
+		}
+	case req.Method == "textDocument/formatting":
+		var params documentFormattingParams
+		if err = decodeParams(req, &params); err == nil {
+			result, err = s.withDocument(params.TextDocument.URI, func(d *document) (interface{}, error) {
+				return s.format(d)
+			})
+		}
+
+	default:
+		if !req.IsNotification() {
+			err = &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not supported", req.Method)}
+		}
+	}
+
+	if req.IsNotification() {
+		// Notifications never get a response, even if handling them failed.
+		var rerr *responseError
+		if err != nil && !errors.As(err, &rerr) {
+			return err
+		}
+		return nil
+	}
+
+	resp := response{JSONRPC: "2.0", ID: req.ID, Result: result}
+	if err != nil {
+		var rerr *responseError
+		if !errors.As(err, &rerr) {
+			rerr = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Result, resp.Error = nil, rerr
+	}
+	return s.conn.Write(resp)
+}
+
+func decodeParams(req *request, v interface{}) error {
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// withDocument invokes f with the open document identified by uri.
+func (s *Server) withDocument(uri string, f func(d *document) (interface{}, error)) (interface{}, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %q is not open", uri)}
+	}
+	return f(d)
+}
+
+// updateDocument analyzes the new text of a document and publishes its
+// diagnostics.
+func (s *Server) updateDocument(uri string, version int, text string) error {
+	d := newDocument(uri, version, text, s.components)
+	s.docs[uri] = d
+	return s.publishDiagnostics(uri, version, d.LSPDiagnostics())
+}
+
+func (s *Server) publishDiagnostics(uri string, version int, diags []diagnostic) error {
+	return s.conn.Write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: publishDiagnosticsParams{
+			URI:         uri,
+			Version:     version,
+			Diagnostics: diags,
+		},
+	})
+}
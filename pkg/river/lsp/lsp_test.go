@@ -0,0 +1,386 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/pkg/river/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+type testArguments struct {
+	Filename string `river:"filename,attr"`
+	Poll     string `river:"poll_frequency,attr,optional"`
+
+	Retry *testRetry `river:"retry,block,optional"`
+}
+
+type testRetry struct {
+	Attempts int `river:"attempts,attr"`
+}
+
+type testExports struct {
+	Content string `river:"content,attr"`
+}
+
+var testComponents = []lsp.Component{
+	{Name: "local.file", Arguments: testArguments{}, Exports: testExports{}},
+	{Name: "testcomponents.singleton", Singleton: true},
+}
+
+const testURI = "file:///config.river"
+
+// message is a decoded message written by the server.
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// session records requests to send to a server.
+type session struct {
+	buf    bytes.Buffer
+	nextID int
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) request(method string, params interface{}) int {
+	s.nextID++
+	s.write(map[string]interface{}{"jsonrpc": "2.0", "id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) open(text string) {
+	s.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI, "languageId": "river", "version": 1, "text": text},
+	})
+}
+
+func (s *session) at(method string, line, character int) int {
+	return s.request(method, map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	})
+}
+
+func (s *session) write(msg interface{}) {
+	bb, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&s.buf, "Content-Length: %d\r\n\r\n%s", len(bb), bb)
+}
+
+// run runs a server against the recorded requests and returns all messages
+// written by the server.
+func (s *session) run(t *testing.T) []message {
+	t.Helper()
+
+	var out bytes.Buffer
+	srv := lsp.New(lsp.Options{Components: testComponents})
+	require.NoError(t, srv.Serve(&s.buf, &out))
+
+	var (
+		msgs []message
+		r    = textproto.NewReader(bufio.NewReader(&out))
+	)
+	for {
+		header, err := r.ReadMIMEHeader()
+		if err == io.EOF {
+			return msgs
+		}
+		require.NoError(t, err)
+
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		require.NoError(t, err)
+		body := make([]byte, length)
+		_, err = io.ReadFull(r.R, body)
+		require.NoError(t, err)
+
+		var msg message
+		require.NoError(t, json.Unmarshal(body, &msg))
+		msgs = append(msgs, msg)
+	}
+}
+
+func findResponse(t *testing.T, msgs []message, id int) message {
+	t.Helper()
+	for _, msg := range msgs {
+		if msg.ID != nil && *msg.ID == id {
+			return msg
+		}
+	}
+	require.FailNow(t, "missing response", "no response for request %d", id)
+	return message{}
+}
+
+type diagnostics struct {
+	Diagnostics []struct {
+		Range struct {
+			Start struct{ Line, Character int }
+		}
+		Message string
+	}
+}
+
+func lastDiagnostics(t *testing.T, msgs []message) []string {
+	t.Helper()
+
+	var res []string
+	for _, msg := range msgs {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params diagnostics
+		require.NoError(t, json.Unmarshal(msg.Params, &params))
+
+		res = []string{}
+		for _, d := range params.Diagnostics {
+			res = append(res, fmt.Sprintf("%d:%d: %s", d.Range.Start.Line+1, d.Range.Start.Character+1, d.Message))
+		}
+	}
+	return res
+}
+
+func TestServer_InvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "1099511627776"} {
+		t.Run(length, func(t *testing.T) {
+			in := strings.NewReader("Content-Length: " + length + "\r\n\r\n{}")
+
+			srv := lsp.New(lsp.Options{Components: testComponents})
+			err := srv.Serve(in, io.Discard)
+			require.ErrorContains(t, err, "invalid Content-Length header")
+		})
+	}
+}
+
+func TestServer_Initialize(t *testing.T) {
+	var s session
+	initID := s.request("initialize", map[string]interface{}{})
+	shutdownID := s.request("shutdown", nil)
+	afterID := s.request("textDocument/hover", nil)
+	s.notify("exit", nil)
+
+	msgs := s.run(t)
+	require.Len(t, msgs, 3)
+
+	var res struct {
+		Capabilities struct {
+			HoverProvider bool `json:"hoverProvider"`
+		} `json:"capabilities"`
+	}
+	require.NoError(t, json.Unmarshal(findResponse(t, msgs, initID).Result, &res))
+	require.True(t, res.Capabilities.HoverProvider)
+
+	require.Nil(t, findResponse(t, msgs, shutdownID).Error)
+	require.NotNil(t, findResponse(t, msgs, afterID).Error)
+}
+
+func TestServer_Diagnostics(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			name:   "valid",
+			input:  `local.file "a" { filename = "/tmp/a" }`,
+			expect: []string{},
+		},
+		{
+			name:   "syntax error",
+			input:  "local.file \"a\" {\n  filename = \n}",
+			expect: []string{`3:1: expected expression, got }`},
+		},
+		{
+			name: "unknown component",
+			input: `
+local.fil "a" { }
+testcomponents.singleton { }`,
+			expect: []string{`2:1: Unrecognized component name "local.fil"`},
+		},
+		{
+			name: "labels",
+			input: `
+local.file { filename = "a" }
+testcomponents.singleton "b" { }`,
+			expect: []string{
+				`2:1: Component "local.file" must have a label`,
+				`3:26: Component "testcomponents.singleton" does not support labels`,
+			},
+		},
+		{
+			name: "bad body",
+			input: `
+local.file "a" {
+	poll_frequency = "1m"
+	bad = true
+
+	retry { }
+}`,
+			expect: []string{
+				`4:2: unrecognized attribute name "bad"`,
+				`6:2: missing required attribute "attempts"`,
+				`2:1: missing required attribute "filename"`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var s session
+			s.open(tc.input)
+			require.ElementsMatch(t, tc.expect, lastDiagnostics(t, s.run(t)))
+		})
+	}
+}
+
+func TestServer_Hover(t *testing.T) {
+	input := `local.file "a" {
+	filename = "/tmp/a"
+}
+
+local.file "b" {
+	filename = local.file.a.content
+}`
+
+	var s session
+	s.open(input)
+	var (
+		componentID = s.at("textDocument/hover", 0, 3)
+		attrID      = s.at("textDocument/hover", 1, 3)
+		exportID    = s.at("textDocument/hover", 5, 28)
+		emptyID     = s.at("textDocument/hover", 3, 0)
+	)
+	msgs := s.run(t)
+
+	hoverText := func(id int) string {
+		var res struct {
+			Contents struct{ Value string }
+		}
+		require.NoError(t, json.Unmarshal(findResponse(t, msgs, id).Result, &res))
+		return res.Contents.Value
+	}
+
+	require.Contains(t, hoverText(componentID), "**local.file**")
+	require.Contains(t, hoverText(componentID), "* `content` string")
+	require.Equal(t, "`filename` string (required)", hoverText(attrID))
+	require.Contains(t, hoverText(exportID), "`local.file.a.content` string")
+	require.Equal(t, "null", string(findResponse(t, msgs, emptyID).Result))
+}
+
+func TestServer_Completion(t *testing.T) {
+	input := `local.file "a" {
+	filename = "/tmp/a"
+}
+
+local.file "b" {
+	poll_frequency = local.file.a.
+	f
+	retry {
+
+	}
+}
+
+lo`
+
+	var s session
+	s.open(input)
+	var (
+		exprID      = s.at("textDocument/completion", 5, 31)
+		attrID      = s.at("textDocument/completion", 6, 2)
+		nestedID    = s.at("textDocument/completion", 8, 2)
+		componentID = s.at("textDocument/completion", 12, 2)
+	)
+	msgs := s.run(t)
+
+	labels := func(id int) []string {
+		var res struct {
+			Items []struct{ Label string }
+		}
+		require.NoError(t, json.Unmarshal(findResponse(t, msgs, id).Result, &res))
+
+		labels := []string{}
+		for _, item := range res.Items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+
+	require.Equal(t, []string{"local.file.a.content"}, labels(exprID))
+	require.Equal(t, []string{"filename"}, labels(attrID))
+	require.Equal(t, []string{"attempts"}, labels(nestedID))
+	require.Equal(t, []string{"local.file"}, labels(componentID))
+}
+
+func TestServer_Definition(t *testing.T) {
+	input := `local.file "a" {
+	filename = "/tmp/a"
+}
+
+local.file "b" {
+	filename = local.file.a.content
+}`
+
+	var s session
+	s.open(input)
+	id := s.at("textDocument/definition", 5, 20)
+	msgs := s.run(t)
+
+	var res []struct {
+		Range struct {
+			Start, End struct{ Line, Character int }
+		}
+	}
+	require.NoError(t, json.Unmarshal(findResponse(t, msgs, id).Result, &res))
+	require.Len(t, res, 1)
+	require.Equal(t, 0, res[0].Range.Start.Line)
+	require.Equal(t, 0, res[0].Range.Start.Character)
+	require.Equal(t, 10, res[0].Range.End.Character)
+}
+
+func TestServer_Formatting(t *testing.T) {
+	formatDoc := func(t *testing.T, input string) message {
+		var s session
+		s.open(input)
+		id := s.request("textDocument/formatting", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": testURI},
+		})
+		return findResponse(t, s.run(t), id)
+	}
+
+	t.Run("unformatted", func(t *testing.T) {
+		resp := formatDoc(t, "local.file \"a\" {\nfilename=\"/tmp/a\"\n}")
+
+		var edits []struct{ NewText string }
+		require.NoError(t, json.Unmarshal(resp.Result, &edits))
+		require.Len(t, edits, 1)
+		require.Equal(t, "local.file \"a\" {\n\tfilename = \"/tmp/a\"\n}\n", edits[0].NewText)
+	})
+
+	t.Run("formatted", func(t *testing.T) {
+		resp := formatDoc(t, "local.file \"a\" {\n\tfilename = \"/tmp/a\"\n}\n")
+		require.Equal(t, "[]", string(resp.Result))
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		resp := formatDoc(t, "local.file \"a\" {")
+		require.NotNil(t, resp.Error)
+		require.True(t, strings.Contains(resp.Error.Message, "syntax errors"))
+	})
+}
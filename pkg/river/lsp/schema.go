@@ -0,0 +1,108 @@
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/grafana/agent/pkg/river/internal/rivertags"
+	"github.com/grafana/agent/pkg/river/internal/value"
+)
+
+// schemaField describes an individual attribute or block which can be set
+// within a block body or read from exports.
+type schemaField struct {
+	Name     string
+	Block    bool
+	Optional bool
+	Type     reflect.Type
+}
+
+// Detail returns a short description of the field's type and whether it is
+// required, suitable for hover text and completion details.
+func (f schemaField) Detail() string {
+	kind := describeType(f.Type)
+	if f.Block {
+		kind = "block"
+	}
+
+	if f.Optional {
+		return kind + " (optional)"
+	}
+	return kind + " (required)"
+}
+
+// schemaFields returns the River fields for the Go type ty. It returns nil if
+// ty does not represent a River block body.
+func schemaFields(ty reflect.Type) []schemaField {
+	ty = derefType(ty)
+	if ty == nil || ty.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []schemaField
+	for _, tf := range rivertags.Get(ty) {
+		if !tf.IsAttr() && !tf.IsBlock() {
+			continue
+		}
+
+		fields = append(fields, schemaField{
+			Name:     strings.Join(tf.Name, "."),
+			Block:    tf.IsBlock(),
+			Optional: tf.IsOptional(),
+			Type:     ty.FieldByIndex(tf.Index).Type,
+		})
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// lookupField finds the field named name in the Go type ty.
+func lookupField(ty reflect.Type, name string) (schemaField, bool) {
+	for _, f := range schemaFields(ty) {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return schemaField{}, false
+}
+
+// blockBodyType returns the Go type used for the body of a block field. Slices
+// of blocks are unwrapped to their element type.
+func blockBodyType(f schemaField) reflect.Type {
+	ty := derefType(f.Type)
+	if ty.Kind() == reflect.Slice || ty.Kind() == reflect.Array {
+		ty = derefType(ty.Elem())
+	}
+	return ty
+}
+
+// describeType returns the River type name for the Go type ty.
+func describeType(ty reflect.Type) string {
+	if ty == nil || (ty.Kind() == reflect.Interface && ty.NumMethod() == 0) {
+		return "any"
+	}
+
+	switch rt := value.RiverType(ty); rt {
+	case value.TypeCapsule:
+		return fmt.Sprintf("capsule(%q)", derefType(ty))
+	case value.TypeArray:
+		return fmt.Sprintf("list(%s)", describeType(derefType(ty).Elem()))
+	case value.TypeObject:
+		if elem := derefType(ty); elem.Kind() == reflect.Map {
+			return fmt.Sprintf("map(%s)", describeType(elem.Elem()))
+		}
+		return "object"
+	default:
+		return rt.String()
+	}
+}
+
+func derefType(ty reflect.Type) reflect.Type {
+	for ty != nil && ty.Kind() == reflect.Pointer {
+		ty = ty.Elem()
+	}
+	return ty
+}
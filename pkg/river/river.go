@@ -2,6 +2,9 @@
 // configuration files. The mapping between River and Go values is described in
 // the documentation for the Unmarshal and Marshal functions.
 //
+// Configuration which references custom variables and functions can be decoded
+// with an Evaluator.
+//
 // Lower-level APIs which give more control over configuration evaluation are
 // available in the inner packages. The implementation of this package is
 // minimal and serves as a reference for how to consume the lower-level
@@ -150,3 +150,36 @@ func ExampleMarshalValue() {
 	// 	age  = 43,
 	// }
 }
+
+// This example shows how custom variables and functions can be made available
+// to expressions with an Evaluator.
+func ExampleEvaluator() {
+	type Data struct {
+		Greeting string `river:"greeting,attr"`
+		Port     int    `river:"port,attr"`
+	}
+
+	eval := river.NewEvaluator(nil)
+	if err := eval.SetVariable("config", map[string]interface{}{"port": 8080}); err != nil {
+		panic(err)
+	}
+	err := eval.RegisterFunction("greet", func(name string) string {
+		return "Hello, " + name + "!"
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	input := `
+		greeting = greet("River")
+		port     = config.port + 1
+	`
+
+	var d Data
+	if err := eval.Unmarshal([]byte(input), &d); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(d.Greeting, d.Port)
+	// Output: Hello, River! 8081
+}
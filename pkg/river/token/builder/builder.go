@@ -4,6 +4,7 @@ package builder
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
 	"io"
 	"reflect"
@@ -76,8 +77,16 @@ func (f *File) Bytes() []byte {
 // created, but is retrieved from a File or Block.
 type Body struct {
 	nodes []tokenNode
+
+	valueOverrideHook ValueOverrideHook
 }
 
+// ValueOverrideHook can be used to replace the Go values of attributes
+// written by AppendFrom before they are encoded. The hook is invoked with the
+// original value of each attribute and returns the value to encode in its
+// place.
+type ValueOverrideHook = func(val interface{}) interface{}
+
 // A tokenNode is a structural element which can be converted into a set of
 // Tokens.
 type tokenNode interface {
@@ -116,6 +125,13 @@ func (b *Body) AppendBlock(block *Block) {
 	b.nodes = append(b.nodes, block)
 }
 
+// SetValueOverrideHook sets a hook to override the values of attributes
+// written by AppendFrom. The hook is inherited by blocks created by
+// AppendFrom.
+func (b *Body) SetValueOverrideHook(hook ValueOverrideHook) {
+	b.valueOverrideHook = hook
+}
+
 // AppendFrom sets attributes and appends blocks defined by goValue into the
 // Body. If any value reachable from goValue implements Tokenizer, the printed
 // tokens will instead be retrieved by calling the RiverTokenize method.
@@ -128,7 +144,24 @@ func (b *Body) AppendFrom(goValue interface{}) {
 	}
 
 	rv := reflect.ValueOf(goValue)
-	b.encodeFields(rv)
+	b.encodeFields(rv, false)
+}
+
+// AppendFromWithDefaults is like AppendFrom, but optional attributes and
+// blocks are only written when they differ from their default values. Unlike
+// AppendFrom, optional fields set to their zero value are written when the
+// zero value isn't the default.
+//
+// The defaults of a struct are determined by calling its UnmarshalRiver
+// method, if it has one, without decoding any River into it. Structs which
+// don't implement UnmarshalRiver use their zero value as their defaults.
+func (b *Body) AppendFromWithDefaults(goValue interface{}) {
+	if goValue == nil {
+		return
+	}
+
+	rv := reflect.ValueOf(goValue)
+	b.encodeFields(rv, true)
 }
 
 // getBlockLabel returns the label for a given block.
@@ -143,7 +176,7 @@ func getBlockLabel(rv reflect.Value) string {
 	return ""
 }
 
-func (b *Body) encodeFields(rv reflect.Value) {
+func (b *Body) encodeFields(rv reflect.Value, withDefaults bool) {
 	for rv.Kind() == reflect.Pointer {
 		if rv.IsNil() {
 			return
@@ -154,37 +187,69 @@ func (b *Body) encodeFields(rv reflect.Value) {
 		panic(fmt.Sprintf("river/token/builder: can only encode struct values to bodies, got %s", rv.Type()))
 	}
 
+	var defaults reflect.Value
+	if withDefaults {
+		defaults = defaultValue(rv.Type())
+	}
+
 	fields := rivertags.Get(rv.Type())
 
 	for _, field := range fields {
 		fieldVal := rv.FieldByIndex(field.Index)
-		b.encodeField(field, fieldVal)
+
+		var fieldDefault reflect.Value
+		if defaults.IsValid() {
+			fieldDefault = defaults.FieldByIndex(field.Index)
+		}
+		b.encodeField(field, fieldVal, fieldDefault)
 	}
 }
 
-func (b *Body) encodeField(field rivertags.Field, fieldValue reflect.Value) {
+// encodeField encodes a single field. If fieldDefault is valid, the field is
+// compared against fieldDefault instead of its zero value to decide whether
+// an optional field should be skipped.
+func (b *Body) encodeField(field rivertags.Field, fieldValue, fieldDefault reflect.Value) {
 	fieldName := strings.Join(field.Name, ".")
+	withDefaults := fieldDefault.IsValid()
 
+	var setPointer bool
 	for fieldValue.Kind() == reflect.Pointer {
 		if fieldValue.IsNil() {
 			break
 		}
+		setPointer = true
 		fieldValue = fieldValue.Elem()
 	}
-	if field.Flags&rivertags.FlagOptional != 0 && fieldValue.IsZero() {
-		return
+
+	// An unset block is only equivalent to an empty one if the block's type
+	// defines its defaults. Otherwise, such as for `docker {}`, the presence of
+	// the block may carry meaning on its own, so it's written whenever set.
+	keepBlock := setPointer && field.Flags&rivertags.FlagBlock != 0 &&
+		fieldValue.Kind() == reflect.Struct && !hasDefaults(fieldValue.Type())
+
+	if field.Flags&rivertags.FlagOptional != 0 && !keepBlock {
+		if !withDefaults && fieldValue.IsZero() {
+			return
+		} else if withDefaults && valuesEqual(fieldValue, fieldDefault) {
+			return
+		}
 	}
 
 	switch {
 	case field.Flags&rivertags.FlagAttr != 0:
-		b.SetAttributeValue(fieldName, fieldValue.Interface())
+		goValue := fieldValue.Interface()
+		if b.valueOverrideHook != nil {
+			goValue = b.valueOverrideHook(goValue)
+		}
+		b.SetAttributeValue(fieldName, goValue)
 
 	case field.Flags&rivertags.FlagBlock != 0:
 		switch {
-		case fieldValue.IsZero():
+		case fieldValue.Kind() == reflect.Pointer && fieldValue.IsNil(), !withDefaults && fieldValue.IsZero():
 			// It shouldn't be possible to have a required block which is unset, but
 			// we'll encode something anyway.
 			inner := NewBlock(field.Name, "")
+			inner.body.valueOverrideHook = b.valueOverrideHook
 			b.AppendBlock(inner)
 
 		case fieldValue.Kind() == reflect.Slice, fieldValue.Kind() == reflect.Array:
@@ -193,18 +258,88 @@ func (b *Body) encodeField(field rivertags.Field, fieldValue reflect.Value) {
 
 				// Recursively call encodeField for each element in the slice/array.
 				// The recurisve call will hit the case below and add a new block for
-				// each field encountered.
-				b.encodeField(field, elem)
+				// each field encountered. Elements are never optional, so they're
+				// always written.
+				elemField := field
+				elemField.Flags &^= rivertags.FlagOptional
+				var elemDefault reflect.Value
+				if withDefaults {
+					elemDefault = reflect.Zero(elem.Type())
+				}
+				b.encodeField(elemField, elem, elemDefault)
 			}
 
 		case fieldValue.Kind() == reflect.Struct:
 			inner := NewBlock(field.Name, getBlockLabel(fieldValue))
-			inner.Body().encodeFields(fieldValue)
+			inner.body.valueOverrideHook = b.valueOverrideHook
+			inner.Body().encodeFields(fieldValue, withDefaults)
 			b.AppendBlock(inner)
 		}
 	}
 }
 
+// riverUnmarshaler mirrors river.Unmarshaler, which can't be imported without
+// an import cycle.
+type riverUnmarshaler interface {
+	UnmarshalRiver(f func(v interface{}) error) error
+}
+
+// hasDefaults reports whether the struct type ty sets its defaults through
+// UnmarshalRiver.
+func hasDefaults(ty reflect.Type) bool {
+	return reflect.PointerTo(ty).Implements(reflect.TypeOf((*riverUnmarshaler)(nil)).Elem())
+}
+
+// defaultValue returns the default value for the struct type ty by calling
+// its UnmarshalRiver method with a function which doesn't decode anything.
+func defaultValue(ty reflect.Type) (res reflect.Value) {
+	ptr := reflect.New(ty)
+
+	defer func() {
+		// UnmarshalRiver implementations aren't written to be called without a
+		// body, so treat any panic as having no defaults.
+		if recover() != nil {
+			res = reflect.Zero(ty)
+		}
+	}()
+
+	if u, ok := ptr.Interface().(riverUnmarshaler); ok {
+		// Errors are ignored: implementations typically set defaults before
+		// decoding and validating, and validation failing doesn't matter here.
+		_ = u.UnmarshalRiver(func(v interface{}) error { return nil })
+	}
+	return ptr.Elem()
+}
+
+// valuesEqual reports whether v and def hold the same value. Values which
+// implement encoding.TextMarshaler are compared by their text.
+func valuesEqual(v, def reflect.Value) bool {
+	for def.Kind() == reflect.Pointer && !def.IsNil() {
+		def = def.Elem()
+	}
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return def.IsZero()
+	}
+	if def.Kind() == reflect.Pointer && def.IsNil() && v.Kind() == reflect.Struct && def.Type().Elem() == v.Type() {
+		// An unset block is treated the same as a block set to its defaults.
+		def = defaultValue(v.Type())
+	}
+	if v.Type() != def.Type() {
+		return false
+	}
+
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if defTM, ok := def.Interface().(encoding.TextMarshaler); ok {
+			text, err := tm.MarshalText()
+			defText, defErr := defTM.MarshalText()
+			if err == nil && defErr == nil {
+				return string(text) == string(defText)
+			}
+		}
+	}
+	return reflect.DeepEqual(v.Interface(), def.Interface())
+}
+
 // SetAttributeTokens sets an attribute to the Body whose value is a set of raw
 // tokens. If the attribute was previously set, its value tokens are updated.
 //
@@ -3,6 +3,7 @@ package builder_test
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -200,6 +201,148 @@ func TestBuilder_SkipOptional(t *testing.T) {
 	require.Equal(t, expect, string(f.Bytes()))
 }
 
+func TestBuilder_EmptyBlock(t *testing.T) {
+	type Marker struct{}
+	type Plain struct {
+		Count int `river:"count,attr,optional"`
+	}
+	type Structure struct {
+		Set   *Marker        `river:"set,block,optional"`
+		Unset *Marker        `river:"unset,block,optional"`
+		Plain *Plain         `river:"plain,block,optional"`
+		Inner *defaultsInner `river:"inner,block,optional"`
+	}
+
+	for _, withDefaults := range []bool{false, true} {
+		f := builder.NewFile()
+		// Blocks whose type defines defaults are skipped when they're set to
+		// their defaults, the same as unset blocks.
+		value := Structure{Set: &Marker{}, Plain: &Plain{}, Inner: &defaultsInner{Count: 5}}
+		if withDefaults {
+			f.Body().AppendFromWithDefaults(value)
+		} else {
+			value.Inner.Count = 0
+			f.Body().AppendFrom(value)
+		}
+
+		expect := format(t, `
+			set { }
+
+			plain { }
+		`)
+
+		require.Equal(t, expect, string(f.Bytes()))
+	}
+}
+
+func TestBuilder_ValueOverrideHook(t *testing.T) {
+	type InnerBlock struct {
+		Secret CustomTokenizer `river:"secret,attr"`
+	}
+	type Structure struct {
+		Field string     `river:"field,attr"`
+		Inner InnerBlock `river:"inner,block"`
+	}
+
+	f := builder.NewFile()
+	f.Body().SetValueOverrideHook(func(val interface{}) interface{} {
+		switch val := val.(type) {
+		case string:
+			return strings.ToUpper(val)
+		case CustomTokenizer:
+			return "overridden"
+		}
+		return val
+	})
+	f.Body().AppendFrom(Structure{
+		Field: "value",
+		Inner: InnerBlock{Secret: true},
+	})
+
+	expect := format(t, `
+		field = "VALUE"
+
+		inner {
+			secret = "overridden"
+		}
+	`)
+
+	require.Equal(t, expect, string(f.Bytes()))
+}
+
+type defaultsBlock struct {
+	Enabled  bool          `river:"enabled,attr,optional"`
+	Interval time.Duration `river:"interval,attr,optional"`
+	Name     string        `river:"name,attr,optional"`
+
+	Inner *defaultsInner `river:"inner,block,optional"`
+}
+
+func (b *defaultsBlock) UnmarshalRiver(f func(interface{}) error) error {
+	*b = defaultsBlock{Enabled: true, Interval: time.Minute}
+
+	type block defaultsBlock
+	return f((*block)(b))
+}
+
+type defaultsInner struct {
+	Count int `river:"count,attr,optional"`
+}
+
+func (i *defaultsInner) UnmarshalRiver(f func(interface{}) error) error {
+	*i = defaultsInner{Count: 5}
+
+	type inner defaultsInner
+	return f((*inner)(i))
+}
+
+func TestBuilder_AppendFromWithDefaults(t *testing.T) {
+	f := builder.NewFile()
+	f.Body().AppendFromWithDefaults(defaultsBlock{
+		Enabled:  false,       // Differs from the default; written.
+		Interval: time.Minute, // Same as the default; skipped.
+		Name:     "",          // Same as the default; skipped.
+
+		Inner: &defaultsInner{Count: 0},
+	})
+
+	expect := format(t, `
+		enabled = false
+
+		inner {
+			count = 0
+		}
+	`)
+
+	require.Equal(t, expect, string(f.Bytes()))
+}
+
+func TestBuilder_ZeroBlockElements(t *testing.T) {
+	type InnerBlock struct {
+		Number int `river:"number,attr"`
+	}
+	type Structure struct {
+		Blocks []InnerBlock `river:"block,block,optional"`
+	}
+
+	// Elements of block slices are written even when they're zero, so that
+	// the number of blocks is preserved. Zero blocks are written empty.
+	f := builder.NewFile()
+	f.Body().AppendFrom(Structure{
+		Blocks: []InnerBlock{{Number: 0}, {Number: 1}},
+	})
+
+	expect := format(t, `
+		block { }
+
+		block {
+			number = 1
+		}
+	`)
+
+	require.Equal(t, expect, string(f.Bytes()))
+}
+
 func format(t *testing.T, in string) string {
 	t.Helper()
 
@@ -14,6 +14,7 @@ var (
 	_ value.Capsule                = (Capsule)(nil)
 	_ value.ConvertibleFromCapsule = (ConvertibleFromCapsule)(nil)
 	_ value.ConvertibleIntoCapsule = (ConvertibleIntoCapsule)(nil)
+	_ value.SecretCapsule          = (SecretCapsule)(nil)
 )
 
 // The Unmarshaler interface allows a type to hook into River decoding and
@@ -73,3 +74,18 @@ type ConvertibleIntoCapsule interface {
 	// available. Other errors are treated as a River decoding error.
 	ConvertInto(dst interface{}) error
 }
+
+// SecretCapsule is a Capsule which holds a potentially sensitive string.
+// Functions which compute new values from a sensitive SecretCapsule wrap their
+// results back into a secret so the sensitive value isn't leaked.
+type SecretCapsule interface {
+	Capsule
+
+	// RiverSecret returns the string held by the capsule and reports whether
+	// that string is sensitive.
+	RiverSecret() (text string, sensitive bool)
+
+	// RiverDeriveSecret returns a new sensitive capsule value holding text.
+	// The returned value must be a Capsule.
+	RiverDeriveSecret(text string) interface{}
+}
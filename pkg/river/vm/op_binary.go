@@ -12,6 +12,12 @@ import (
 func evalBinop(lhs value.Value, op token.Token, rhs value.Value) (value.Value, error) {
 	// TODO(rfratto): evalBinop should check for underflows and overflows
 
+	// Sensitive secrets are handled separately so that values computed from
+	// them are never exposed as plain strings.
+	if secret := sensitiveOperand(lhs, rhs); secret != nil {
+		return evalSecretBinop(lhs, op, rhs, secret)
+	}
+
 	// We have special handling for EQ and NEQ since it's valid to attempt to
 	// compare values of any two types.
 	switch op {
@@ -188,6 +194,67 @@ func evalBinop(lhs value.Value, op token.Token, rhs value.Value) (value.Value, e
 	panic("river/vm: unreachable")
 }
 
+// sensitiveOperand returns the first of lhs and rhs which is a sensitive
+// secret, or nil if neither are.
+func sensitiveOperand(lhs, rhs value.Value) value.SecretCapsule {
+	for _, v := range []value.Value{lhs, rhs} {
+		if secret, _, sensitive, ok := value.SecretText(v); ok && sensitive {
+			return secret
+		}
+	}
+	return nil
+}
+
+// evalSecretBinop evaluates a binary operation where at least one operand is
+// a sensitive secret. Secrets behave like strings, but only support equality
+// checks and concatenation. Concatenation produces a secret derived from
+// secret.
+func evalSecretBinop(lhs value.Value, op token.Token, rhs value.Value, secret value.SecretCapsule) (value.Value, error) {
+	lhsText, lhsOK := secretOperandText(lhs)
+	rhsText, rhsOK := secretOperandText(rhs)
+
+	switch op {
+	case token.EQ:
+		return value.Bool(lhsOK && rhsOK && lhsText == rhsText), nil
+	case token.NEQ:
+		return value.Bool(!(lhsOK && rhsOK && lhsText == rhsText)), nil
+
+	case token.ADD: // secret + string, string + secret, secret + secret
+		if !lhsOK {
+			return value.Null, value.TypeError{Value: lhs, Expected: value.TypeString}
+		} else if !rhsOK {
+			return value.Null, value.TypeError{Value: rhs, Expected: value.TypeString}
+		}
+		return value.Encapsulate(secret.RiverDeriveSecret(lhsText + rhsText)), nil
+	}
+
+	errValue := lhs
+	if !isSecret(lhs) {
+		errValue = rhs
+	}
+	return value.Null, value.Error{
+		Value: errValue,
+		Inner: fmt.Errorf("secrets may not be used with binop %s", op),
+	}
+}
+
+// secretOperandText returns the text of v if v is a string or a secret.
+func secretOperandText(v value.Value) (string, bool) {
+	if v.Type() == value.TypeString {
+		return v.Text(), true
+	}
+	if _, text, _, ok := value.SecretText(v); ok {
+		return text, true
+	}
+	return "", false
+}
+
+// isSecret returns true if v is a sensitive secret.
+func isSecret(v value.Value) bool {
+	_, _, sensitive, ok := value.SecretText(v)
+	return ok && sensitive
+}
+
 // valuesEqual returns true if two River Values are equal.
 func valuesEqual(lhs value.Value, rhs value.Value) bool {
 	if lhs.Type() != rhs.Type() {
@@ -2,6 +2,7 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/grafana/agent/pkg/river/internal/rivertags"
 	"github.com/grafana/agent/pkg/river/internal/stdlib"
 	"github.com/grafana/agent/pkg/river/internal/value"
+	"github.com/grafana/agent/pkg/river/token/builder"
 )
 
 // Evaluator evaluates River AST nodes into Go values. Each Evaluator is bound
@@ -85,13 +87,21 @@ func (vm *Evaluator) evaluateBlockOrBody(scope *Scope, assoc map[value.Value]ast
 	}
 
 	if ru, ok := rv.Interface().(value.Unmarshaler); ok {
-		return ru.UnmarshalRiver(func(v interface{}) error {
+		err := ru.UnmarshalRiver(func(v interface{}) error {
 			rv := reflect.ValueOf(v)
 			if rv.Kind() != reflect.Pointer {
 				panic(fmt.Sprintf("river/vm: expected pointer, got %s", rv.Kind()))
 			}
 			return vm.evaluateBlockOrBody(scope, assoc, node, rv.Elem())
 		})
+
+		// Custom validation errors refer to attributes by name; convert them into
+		// diagnostics pointing at the attribute.
+		var attrErr diag.AttributeError
+		if errors.As(err, &attrErr) {
+			return attributeErrorDiagnostic(node, attrErr)
+		}
+		return err
 	}
 
 	// Fully deference rv and allocate pointers as necessary.
@@ -146,6 +156,12 @@ func (vm *Evaluator) evaluateBlockOrBody(scope *Scope, assoc map[value.Value]ast
 	var (
 		consumedAttrs  = make(map[string]struct{}, len(foundAttrs))
 		consumedBlocks = make(map[string]struct{}, len(foundBlocks))
+
+		diags diag.Diagnostics
+
+		// exclusiveSet tracks the names of fields from mutually exclusive groups
+		// which were set.
+		exclusiveSet = make(map[string][]string)
 	)
 	for _, tf := range tfs {
 		fullName := strings.Join(tf.Name, ".")
@@ -195,6 +211,25 @@ func (vm *Evaluator) evaluateBlockOrBody(scope *Scope, assoc map[value.Value]ast
 			return fmt.Errorf("%q may only be used as a block or an attribute, but found both", fullName)
 		}
 
+		if tf.Rules != nil && tf.Rules.Exclusive != "" {
+			group := tf.Rules.Exclusive
+			if len(exclusiveSet[group]) > 0 {
+				d := diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("%q and %q are mutually exclusive", exclusiveSet[group][0], fullName),
+				}
+				if len(attrs) > 0 {
+					d.StartPos = ast.StartPos(attrs[0].Name).Position()
+					d.EndPos = ast.EndPos(attrs[0].Name).Position()
+				} else {
+					d.StartPos = blocks[0].NamePos.Position()
+					d.EndPos = blocks[0].NamePos.Add(len(fullName) - 1).Position()
+				}
+				diags.Add(d)
+			}
+			exclusiveSet[group] = append(exclusiveSet[group], fullName)
+		}
+
 		field := rv.FieldByIndex(tf.Index)
 
 		// Decode.
@@ -256,11 +291,17 @@ func (vm *Evaluator) evaluateBlockOrBody(scope *Scope, assoc map[value.Value]ast
 			if err := value.Decode(val, field.Addr().Interface()); err != nil {
 				return err
 			}
+
+			// Rules are only checked against explicitly set attributes, not
+			// against defaults.
+			if tf.Rules != nil {
+				if err := tf.Rules.Check(field); err != nil {
+					diags.Add(attributeDiagnostic(attrs[0], field, err))
+				}
+			}
 		}
 	}
 
-	var diags diag.Diagnostics
-
 	// Make sure that all of the attributes and blocks defined in the AST node
 	// matched up with a field from our struct.
 	for attrName, attrs := range foundAttrs {
@@ -297,6 +338,51 @@ func (vm *Evaluator) evaluateBlockOrBody(scope *Scope, assoc map[value.Value]ast
 	return diags.ErrorOrNil()
 }
 
+// attributeDiagnostic returns a diagnostic reporting that the value of attr,
+// decoded into field, is invalid.
+func attributeDiagnostic(attr *ast.AttributeStmt, field reflect.Value, err error) diag.Diagnostic {
+	be := builder.NewExpr()
+	be.SetValue(field.Interface())
+
+	return diag.Diagnostic{
+		Severity: diag.SeverityLevelError,
+		StartPos: ast.StartPos(attr).Position(),
+		EndPos:   ast.EndPos(attr).Position(),
+		Message:  fmt.Sprintf("attribute %q %s", attr.Name.Name, err),
+		Value:    string(be.Bytes()),
+	}
+}
+
+// attributeErrorDiagnostic converts err into a diagnostic pointing at the
+// attribute it refers to within node. If the attribute isn't set in node,
+// the diagnostic points at the name of the block instead.
+func attributeErrorDiagnostic(node ast.Node, err diag.AttributeError) diag.Diagnostic {
+	d := diag.Diagnostic{
+		Severity: diag.SeverityLevelError,
+		Message:  err.Error(),
+	}
+
+	var stmts ast.Body
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		name := strings.Join(node.Name, ".")
+		d.StartPos = node.NamePos.Position()
+		d.EndPos = node.NamePos.Add(len(name) - 1).Position()
+		stmts = node.Body
+	case ast.Body:
+		stmts = node
+	}
+
+	for _, stmt := range stmts {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok && attr.Name.Name == err.Name {
+			d.StartPos = ast.StartPos(attr).Position()
+			d.EndPos = ast.EndPos(attr).Position()
+			break
+		}
+	}
+	return d
+}
+
 func (vm *Evaluator) evaluateBlockLabel(node *ast.BlockStmt, tfs []rivertags.Field, rv reflect.Value) error {
 	var (
 		labelField rivertags.Field
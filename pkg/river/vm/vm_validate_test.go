@@ -0,0 +1,166 @@
+package vm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/pkg/river/diag"
+	"github.com/grafana/agent/pkg/river/parser"
+	"github.com/grafana/agent/pkg/river/vm"
+	"github.com/stretchr/testify/require"
+)
+
+// This file contains tests for validating decoded blocks.
+
+type validatedBlock struct {
+	Percent  int           `river:"percent,attr,optional" validate:"min=0,max=100"`
+	Interval time.Duration `river:"interval,attr,optional" validate:"gt=0s"`
+	Ratio    *float64      `river:"ratio,attr,optional" validate:"gt=0,lt=1"`
+	Mode     string        `river:"mode,attr,optional" validate:"oneof=fast|slow"`
+	Name     string        `river:"name,attr,optional" validate:"nonempty,pattern=^[a-z]+(,[a-z]+)*$"`
+
+	Limit        int            `river:"limit,attr,optional" validate:"exclusive=limit"`
+	LimitPercent int            `river:"limit_percent,attr,optional" validate:"exclusive=limit"`
+	LimitBlock   *struct{}      `river:"limit_block,block,optional" validate:"exclusive=limit"`
+	Custom       *customizedArg `river:"custom,block,optional"`
+}
+
+type customizedArg struct {
+	Min int `river:"min,attr,optional"`
+	Max int `river:"max,attr,optional"`
+}
+
+func (c *customizedArg) UnmarshalRiver(f func(interface{}) error) error {
+	*c = customizedArg{Max: 10}
+
+	type arg customizedArg
+	if err := f((*arg)(c)); err != nil {
+		return err
+	}
+	if c.Max < c.Min {
+		return diag.AttributeErrorf("max", "must be greater than or equal to min")
+	}
+	return nil
+}
+
+func TestVM_Block_Validation(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			name: "valid",
+			input: `some_block {
+				percent  = 100
+				interval = "5s"
+				ratio    = 0.5
+				mode     = "slow"
+				name     = "a,b"
+				limit    = 5
+				custom {
+					min = 3
+				}
+			}`,
+		},
+		{
+			name:   "range",
+			input:  "some_block {\n\tpercent = 101\n}",
+			expect: []string{`2:2: attribute "percent" must be less than or equal to 100`},
+		},
+		{
+			name:   "duration range",
+			input:  "some_block {\n\tinterval = \"0s\"\n}",
+			expect: []string{`2:2: attribute "interval" must be greater than 0s`},
+		},
+		{
+			name:   "pointer range",
+			input:  "some_block {\n\tratio = 1\n}",
+			expect: []string{`2:2: attribute "ratio" must be less than 1`},
+		},
+		{
+			name:   "enum",
+			input:  "some_block {\n\tmode = \"medium\"\n}",
+			expect: []string{`2:2: attribute "mode" must be one of "fast", "slow"`},
+		},
+		{
+			name:   "pattern",
+			input:  "some_block {\n\tname = \"A\"\n}",
+			expect: []string{`2:2: attribute "name" must match the pattern "^[a-z]+(,[a-z]+)*$"`},
+		},
+		{
+			name:   "nonempty",
+			input:  "some_block {\n\tname = \"\"\n}",
+			expect: []string{`2:2: attribute "name" must not be empty`},
+		},
+		{
+			name:  "multiple",
+			input: "some_block {\n\tpercent = -1\n\tmode = \"\"\n}",
+			expect: []string{
+				`2:2: attribute "percent" must be greater than or equal to 0`,
+				`3:2: attribute "mode" must be one of "fast", "slow"`,
+			},
+		},
+		{
+			name:  "exclusive",
+			input: "some_block {\n\tlimit = 1\n\tlimit_percent = 5\n\tlimit_block { }\n}",
+			expect: []string{
+				`3:2: "limit" and "limit_percent" are mutually exclusive`,
+				`4:2: "limit" and "limit_block" are mutually exclusive`,
+			},
+		},
+		{
+			name:   "custom error",
+			input:  "some_block {\n\tcustom {\n\t\tmin = 5\n\t\tmax = 1\n\t}\n}",
+			expect: []string{`4:3: attribute "max" must be greater than or equal to min`},
+		},
+		{
+			name:   "custom error on unset attribute",
+			input:  "some_block {\n\tcustom {\n\t\tmin = 20\n\t}\n}",
+			expect: []string{`2:2: attribute "max" must be greater than or equal to min`},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			eval := vm.New(parseBlock(t, tc.input))
+
+			var actual validatedBlock
+			err := eval.Evaluate(nil, &actual)
+			if len(tc.expect) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var diags diag.Diagnostics
+			require.True(t, errors.As(err, &diags), "expected diagnostics, got %v", err)
+
+			var messages []string
+			for _, d := range diags {
+				messages = append(messages, d.Error())
+			}
+			require.Equal(t, tc.expect, messages)
+		})
+	}
+}
+
+func TestVM_Block_Validation_Positions(t *testing.T) {
+	input := "some_block {\n\tpercent = 200\n}"
+	file, err := parser.ParseFile("", []byte(input))
+	require.NoError(t, err)
+
+	var actual struct {
+		Block validatedBlock `river:"some_block,block"`
+	}
+	err = vm.New(file).Evaluate(nil, &actual)
+
+	var diags diag.Diagnostics
+	require.True(t, errors.As(err, &diags))
+	require.Len(t, diags, 1)
+	require.Equal(t, 2, diags[0].StartPos.Line)
+	require.Equal(t, 2, diags[0].StartPos.Column)
+	require.Equal(t, 2, diags[0].EndPos.Line)
+	require.Equal(t, 14, diags[0].EndPos.Column)
+	require.Equal(t, "200", diags[0].Value)
+}